@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// maxWorkersPerProc caps adaptive concurrency, so that a slow service can not make it start
+	// an unbounded number of operations
+	maxWorkersPerProc = 8
+	// saturationFactor is how many times slower than the fastest one a computation gets before
+	// the host is considered saturated
+	saturationFactor = 2
+	// costSmoothing is the weight of a new sample in the moving averages of operation costs
+	costSmoothing = 0.2
+)
+
+// adaptiveLimit sizes the concurrency of Migrator and VerifyPasswords when no worker count is configured.
+// Following Little's law, the target is GOMAXPROCS times the ratio of operation latency to its compute
+// cost, so operations which wait on the network run more workers than pure computations. When
+// computations take saturationFactor times longer than the fastest one, other goroutines or processes
+// compete for the CPUs and the limit is halved. Otherwise it doubles towards the target once per round
+// of operations. The zero value is ready to use
+type adaptiveLimit struct {
+	mu      sync.Mutex
+	procs   int
+	limit   int
+	active  int
+	changed chan struct{}
+	// samples counts operations since the limit was last adjusted
+	samples int
+	// compute and latency are moving averages in nanoseconds
+	compute float64
+	latency float64
+	fastest time.Duration
+}
+
+func (l *adaptiveLimit) init() {
+	if l.procs == 0 {
+		l.procs = runtime.GOMAXPROCS(0)
+		l.limit = l.procs
+		l.changed = make(chan struct{})
+	}
+}
+
+// max returns the number of workers needed to reach any limit
+func (l *adaptiveLimit) max() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	return l.procs * maxWorkersPerProc
+}
+
+// current returns the number of operations allowed to run at once
+func (l *adaptiveLimit) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	return l.limit
+}
+
+// acquire waits until fewer than the limit operations run or ctx is done
+func (l *adaptiveLimit) acquire(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		l.init()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release ends an operation which spent compute of its latency on the CPU
+func (l *adaptiveLimit) release(compute, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.observe(compute, latency)
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *adaptiveLimit) observe(compute, latency time.Duration) {
+	if l.compute == 0 && l.latency == 0 {
+		l.compute, l.latency = float64(compute), float64(latency)
+	} else {
+		l.compute += costSmoothing * (float64(compute) - l.compute)
+		l.latency += costSmoothing * (float64(latency) - l.latency)
+	}
+	if compute > 0 && (l.fastest == 0 || compute < l.fastest) {
+		l.fastest = compute
+	}
+
+	if l.samples++; l.samples < l.limit {
+		return
+	}
+	l.samples = 0
+
+	target := l.target()
+	switch {
+	case l.fastest > 0 && l.compute > saturationFactor*float64(l.fastest):
+		l.limit /= 2
+	case l.limit < target:
+		l.limit *= 2
+	}
+	if l.limit > target {
+		l.limit = target
+	}
+	if l.limit < 1 {
+		l.limit = 1
+	}
+}
+
+// target returns GOMAXPROCS scaled by the share of latency not spent computing
+func (l *adaptiveLimit) target() int {
+	target := l.procs * maxWorkersPerProc
+	if l.compute > 0 && l.latency < l.compute*maxWorkersPerProc {
+		target = int(float64(l.procs)*l.latency/l.compute + 0.5)
+	}
+	if target < l.procs {
+		target = l.procs
+	}
+	return target
+}
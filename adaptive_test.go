@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// round completes as many operations as the limit allows
+func (l *adaptiveLimit) round(compute, latency time.Duration) {
+	for i, n := 0, l.current(); i < n; i++ {
+		l.active++
+		l.release(compute, latency)
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+
+	var l adaptiveLimit
+	assert.Equal(t, procs, l.current())
+	assert.Equal(t, procs*maxWorkersPerProc, l.max())
+
+	// pure computations do not need more workers than CPUs
+	l.round(time.Millisecond, time.Millisecond)
+	assert.Equal(t, procs, l.current())
+
+	// operations computing a quarter of the time get four times as many workers
+	for i := 0; i < 10; i++ {
+		l.round(time.Millisecond, 4*time.Millisecond)
+	}
+	assert.Equal(t, 4*procs, l.current())
+
+	// computations slowed down by other load halve the limit each round
+	l.round(5*time.Millisecond, 8*time.Millisecond)
+	assert.Equal(t, 2*procs, l.current())
+	for i := 0; i < 10; i++ {
+		l.round(5*time.Millisecond, 8*time.Millisecond)
+	}
+	assert.Equal(t, 1, l.current())
+
+	// and it recovers once they are fast again
+	for i := 0; i < 20; i++ {
+		l.round(time.Millisecond, 4*time.Millisecond)
+	}
+	assert.Equal(t, 4*procs, l.current())
+}
+
+func TestAdaptiveLimit_Acquire(t *testing.T) {
+	var l adaptiveLimit
+	for i := 0; i < l.current(); i++ {
+		require.NoError(t, l.acquire(context.Background()))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(ctx))
+
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(context.Background()) }()
+	l.release(time.Millisecond, time.Millisecond)
+	assert.NoError(t, <-acquired)
+}
@@ -37,13 +37,14 @@
 package passw0rd
 
 import (
+	"context"
 	"net/http"
 	"sync"
 )
 
 //APIClient implements API request layer
 type APIClient struct {
-	AppToken   string
+	AppToken   SecretString
 	URL        string
 	HTTPClient *VirgilHTTPClient
 	once       sync.Once
@@ -51,15 +52,25 @@ type APIClient struct {
 
 //GetEnrollment receives random enrollment from service
 func (c *APIClient) GetEnrollment(req *EnrollmentRequest) (resp *EnrollmentResponse, err error) {
+	return c.GetEnrollmentContext(context.Background(), req)
+}
+
+// GetEnrollmentContext is like GetEnrollment but the request is bound to ctx and carries its correlation ID
+func (c *APIClient) GetEnrollmentContext(ctx context.Context, req *EnrollmentRequest) (resp *EnrollmentResponse, err error) {
 	resp = &EnrollmentResponse{}
-	_, err = c.getClient().Send(c.AppToken, http.MethodPost, "enroll", req, resp)
+	_, err = c.getClient().SendContext(ctx, c.AppToken.Reveal(), http.MethodPost, "enroll", req, resp)
 	return
 }
 
 //VerifyPassword does not send password to server, only the part tat server provided in GetEnrollment
 func (c *APIClient) VerifyPassword(req *VerifyPasswordRequest) (resp *VerifyPasswordResponse, err error) {
+	return c.VerifyPasswordContext(context.Background(), req)
+}
+
+// VerifyPasswordContext is like VerifyPassword but the request is bound to ctx and carries its correlation ID
+func (c *APIClient) VerifyPasswordContext(ctx context.Context, req *VerifyPasswordRequest) (resp *VerifyPasswordResponse, err error) {
 	resp = &VerifyPasswordResponse{}
-	_, err = c.getClient().Send(c.AppToken, http.MethodPost, "verify-password", req, resp)
+	_, err = c.getClient().SendContext(ctx, c.AppToken.Reveal(), http.MethodPost, "verify-password", req, resp)
 	return
 }
 
@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditEventType identifies an authentication event
+type AuditEventType string
+
+// Audit event types
+const (
+	AuditEnrollment          AuditEventType = "enrollment"
+	AuditVerificationSuccess AuditEventType = "verification_success"
+	AuditVerificationFailure AuditEventType = "verification_failure"
+	AuditRecordUpdated       AuditEventType = "record_updated"
+	AuditRotationApplied     AuditEventType = "rotation_applied"
+)
+
+// AuditEvent describes a single authentication event. It never contains passwords, keys or records
+type AuditEvent struct {
+	Type    AuditEventType `json:"type"`
+	Time    time.Time      `json:"time"`
+	UserID  string         `json:"user_id,omitempty"`
+	Version uint32         `json:"version,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	// CorrelationID is the correlation ID of the operation, see WithCorrelationID
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// AuditSink receives audit events from Protocol. Implementations must be safe for concurrent use
+// and should not block, as events are delivered synchronously
+type AuditSink interface {
+	Audit(event *AuditEvent)
+}
+
+// AuditSinkFunc allows an ordinary function to be used as an AuditSink
+type AuditSinkFunc func(event *AuditEvent)
+
+// Audit calls f(event)
+func (f AuditSinkFunc) Audit(event *AuditEvent) {
+	f(event)
+}
+
+type userIDKey struct{}
+
+// WithUserID returns a copy of ctx carrying the caller's user identifier, which is attached to audit events
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext returns the user identifier set by WithUserID
+func UserIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+func (p *Protocol) audit(ctx context.Context, eventType AuditEventType, version uint32, err error) {
+	if p.AuditSink == nil {
+		return
+	}
+
+	event := &AuditEvent{
+		Type:    eventType,
+		Time:    p.now().UTC(),
+		UserID:  UserIDFromContext(ctx),
+		Version: version,
+
+		CorrelationID: CorrelationIDFromContext(ctx),
+	}
+	if err != nil {
+		event.Reason = auditReason(err)
+	}
+
+	p.AuditSink.Audit(event)
+}
+
+func auditReason(err error) string {
+	switch errors.Cause(err) {
+	case ErrInvalidPassword:
+		return "invalid_password"
+	case ErrRateLimited:
+		return "rate_limited"
+	case ErrAccountLocked:
+		return "account_locked"
+	}
+	return "error"
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	sync.Mutex
+	events []*AuditEvent
+}
+
+func (s *recordingSink) Audit(event *AuditEvent) {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, event)
+}
+
+func TestProtocol_Audit(t *testing.T) {
+	req := require.New(t)
+
+	service := newTestService(t)
+	proto := service.protocol(t, "")
+	sink := &recordingSink{}
+	proto.AuditSink = sink
+	onSecurityEvent, securityEvents := SecurityEventChannel(10)
+	proto.OnSecurityEvent = onSecurityEvent
+
+	ctx := WithSource(WithUserID(context.Background(), "alice"), "web")
+
+	rec, key, err := proto.EnrollAccountContext(ctx, "p@ssw0Rd")
+	req.NoError(err)
+
+	_, err = proto.VerifyPasswordContext(ctx, "wrong", rec)
+	req.Equal(ErrInvalidPassword, err)
+
+	req.NoError(proto.AddUpdateToken(service.rotate(t)))
+
+	newRec, err := proto.UpdateEnrollmentRecordContext(ctx, rec)
+	req.NoError(err)
+
+	key1, err := proto.VerifyPasswordContext(ctx, "p@ssw0Rd", newRec)
+	req.NoError(err)
+	req.Equal(key, key1)
+
+	types := make([]AuditEventType, 0, len(sink.events))
+	for _, e := range sink.events {
+		types = append(types, e.Type)
+		req.False(e.Time.IsZero())
+		if e.Type != AuditRotationApplied {
+			req.Equal("alice", e.UserID)
+		}
+	}
+
+	req.Equal([]AuditEventType{
+		AuditEnrollment,
+		AuditVerificationFailure,
+		AuditRotationApplied,
+		AuditRecordUpdated,
+		AuditVerificationSuccess,
+	}, types)
+	req.Equal("invalid_password", sink.events[1].Reason)
+
+	req.Len(securityEvents, 1)
+	event := <-securityEvents
+	req.Equal("web", event.Source)
+	req.Equal("invalid_password", event.Reason)
+	req.Len(event.UserHash, 64)
+	req.NotContains(event.UserHash, "alice")
+	req.Equal(uint32(2), sink.events[4].Version)
+}
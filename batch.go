@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+)
+
+// enrollAhead is how many enrollments per computing worker EnrollAccounts fetches ahead of computations
+const enrollAhead = 2
+
+// VerifyRequest is a single verification of VerifyPasswords
+type VerifyRequest struct {
+	// UserID, if set, is passed with WithUserID for rate limits, lockouts and audit events
+	UserID   string
+	Password string
+	Record   []byte
+}
+
+// VerifyResult is the outcome of a VerifyRequest. Err is ErrInvalidPassword if the password is wrong
+type VerifyResult struct {
+	Key []byte
+	Err error
+}
+
+// EnrollRequest is a single enrollment of EnrollAccounts
+type EnrollRequest struct {
+	// UserID, if set, is passed with WithUserID for audit events
+	UserID   string
+	Password string
+}
+
+// EnrollResult is the outcome of an EnrollRequest
+type EnrollResult struct {
+	Record []byte
+	Key    []byte
+	Err    error
+}
+
+// enrollment is an enrollment response fetched by EnrollAccounts
+type enrollment struct {
+	resp *EnrollmentResponse
+	err  error
+}
+
+// EnrollAccounts enrolls passwords and returns results in the order of reqs. Enrollments are fetched from
+// the service while previous accounts are computed, so that network round trips and PHE computations overlap.
+// Up to WorkerPool.Size() accounts are computed at once, with at most enrollAhead times as many enrollments
+// fetched ahead. Requests not started when ctx is done fail with ctx.Err()
+func (p *Protocol) EnrollAccounts(ctx context.Context, reqs []EnrollRequest) []EnrollResult {
+	defer p.Profile.start("enroll-accounts")()
+
+	results := make([]EnrollResult, len(reqs))
+	state := p.snapshot()
+	workers := p.WorkerPool.Size()
+	ctx = withLabels(ctx, OperationEnroll, state.version)
+
+	ctxs := make([]context.Context, len(reqs))
+	fetched := make([]chan enrollment, len(reqs))
+	for i := range reqs {
+		ctxs[i] = ensureCorrelationID(ctx)
+		if reqs[i].UserID != "" {
+			ctxs[i] = WithUserID(ctxs[i], reqs[i].UserID)
+		}
+		fetched[i] = make(chan enrollment, 1)
+	}
+
+	// enrollments are fetched in order, each holding a slot of ahead until its account is computed
+	ahead := make(chan struct{}, workers*enrollAhead)
+	goLabeled(ctx, OperationEnroll, state.version, func(ctx context.Context) {
+		for i := range reqs {
+			select {
+			case ahead <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int) {
+				resp, err := p.fetchEnrollment(ctxs[i], state.version)
+				fetched[i] <- enrollment{resp: resp, err: err}
+			}(i)
+		}
+	})
+
+	forEach(ctx, OperationEnroll, state.version, workers, len(reqs), func(i int) {
+		var e enrollment
+		select {
+		case e = <-fetched[i]:
+			<-ahead
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			return
+		}
+
+		results[i].Record, results[i].Key, results[i].Err = p.enrollAccount(ctxs[i], state, reqs[i].Password,
+			func(context.Context) (*EnrollmentResponse, error) { return e.resp, e.err })
+	}, func(i int, err error) {
+		results[i].Err = err
+	})
+
+	return results
+}
+
+// VerifyPasswords verifies passwords concurrently and returns results in the order of reqs.
+// The number of verifications running at once starts at GOMAXPROCS and adapts to the measured share
+// of PHE computations in their latency, backing off when the host is saturated. PHE computations share
+// WorkerPool with all other operations of the protocol. Requests not started when ctx is done fail with ctx.Err()
+func (p *Protocol) VerifyPasswords(ctx context.Context, reqs []VerifyRequest) []VerifyResult {
+	defer p.Profile.start("verify-passwords")()
+
+	results := make([]VerifyResult, len(reqs))
+	version := p.CurrentVersion()
+	ctx = withLabels(ctx, OperationVerify, version)
+
+	forEach(ctx, OperationVerify, version, p.verifyLimit.max(), len(reqs), func(i int) {
+		if err := p.verifyLimit.acquire(ctx); err != nil {
+			results[i].Err = err
+			return
+		}
+
+		reqCtx := ctx
+		if reqs[i].UserID != "" {
+			reqCtx = WithUserID(ctx, reqs[i].UserID)
+		}
+		timing := &verifyTiming{clock: p.clock(), start: p.now()}
+		results[i].Key, results[i].Err = p.verifyPasswordTimed(reqCtx, timing, reqs[i].Password, reqs[i].Record)
+		p.verifyLimit.release(timing.compute, p.now().Sub(timing.start))
+	}, func(i int, err error) {
+		results[i].Err = err
+	})
+
+	return results
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of VerifyBatcher
+const (
+	DefaultBatchWindow = time.Millisecond
+	DefaultMaxBatch    = 64
+)
+
+// BatchVerifier is implemented by service clients which verify several requests in one round trip.
+// Responses are returned in the order of requests. The passw0rd service API has no bulk endpoint,
+// so APIClient does not implement it and there is no BatchVerifier for the passw0rd service;
+// fake.Service implements it for tests
+type BatchVerifier interface {
+	VerifyPasswordBatch(ctx context.Context, reqs []*VerifyPasswordRequest) ([]*VerifyPasswordResponse, error)
+}
+
+// VerifyBatcher coalesces service requests of verifications which arrive within Window into a single
+// call of Service, trading up to Window of latency for fewer round trips during login storms. Set it as
+// Protocol.Batcher. It can not be used with the passw0rd service, which has no batch endpoint: verifications
+// only reach Service, never APIClient. Protocols do not batch unless Batcher is set.
+// A failed batch call fails every verification of the batch.
+// Batched requests do not carry correlation IDs of their operations. It is safe for concurrent use
+type VerifyBatcher struct {
+	Service BatchVerifier
+	// Window is how long the first request of a batch waits for others, DefaultBatchWindow if not set
+	Window time.Duration
+	// MaxBatch sends a batch as soon as it has this many requests, DefaultMaxBatch if not set
+	MaxBatch int
+	// Clock, if set, replaces the system clock for batch windows
+	Clock Clock
+
+	mu      sync.Mutex
+	pending *verifyBatch
+}
+
+type verifyBatch struct {
+	reqs  []*VerifyPasswordRequest
+	resps []*VerifyPasswordResponse
+	err   error
+	done  chan struct{}
+}
+
+// verify adds req to the pending batch and waits for its response. Callers may reuse req once verify returns
+func (b *VerifyBatcher) verify(ctx context.Context, req *VerifyPasswordRequest) (*VerifyPasswordResponse, error) {
+	if b.Service == nil {
+		return nil, withCode(CodeInvalidConfiguration, errors.New("VerifyBatcher.Service is not set"))
+	}
+
+	b.mu.Lock()
+	batch := b.pending
+	if batch == nil {
+		batch = &verifyBatch{done: make(chan struct{})}
+		b.pending = batch
+
+		timer := clockOrSystem(b.Clock).NewTimer(b.window())
+		goLabeled(context.Background(), "verify_batch", req.Version, func(ctx context.Context) {
+			<-timer.C()
+			b.send(ctx, batch)
+		})
+	}
+	i := len(batch.reqs)
+	batch.reqs = append(batch.reqs, &VerifyPasswordRequest{Version: req.Version, Request: req.Request})
+	full := len(batch.reqs) >= b.maxBatch()
+	b.mu.Unlock()
+
+	if full {
+		b.send(withLabels(context.Background(), "verify_batch", req.Version), batch)
+	}
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	if batch.resps[i] == nil {
+		return nil, withCode(CodeServiceError, errors.New("batch response is missing"))
+	}
+	return batch.resps[i], nil
+}
+
+// send calls the service with batch unless it was sent already. Ctx only carries labels, batches outlive
+// the requests they were started by
+func (b *VerifyBatcher) send(ctx context.Context, batch *verifyBatch) {
+	b.mu.Lock()
+	if b.pending != batch {
+		b.mu.Unlock()
+		return
+	}
+	b.pending = nil
+	b.mu.Unlock()
+
+	batch.resps, batch.err = b.Service.VerifyPasswordBatch(ctx, batch.reqs)
+	if batch.err == nil && len(batch.resps) != len(batch.reqs) {
+		batch.err = withCode(CodeServiceError, errors.Errorf("batch of %d requests got %d responses", len(batch.reqs), len(batch.resps)))
+	}
+	close(batch.done)
+}
+
+func (b *VerifyBatcher) window() time.Duration {
+	if b.Window <= 0 {
+		return DefaultBatchWindow
+	}
+	return b.Window
+}
+
+func (b *VerifyBatcher) maxBatch() int {
+	if b.MaxBatch <= 0 {
+		return DefaultMaxBatch
+	}
+	return b.MaxBatch
+}
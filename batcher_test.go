@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/phe-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchService verifies batches with the keys of testService and records their sizes
+type batchService struct {
+	*testService
+	mu    sync.Mutex
+	sizes []int
+	err   error
+}
+
+func (s *batchService) VerifyPasswordBatch(ctx context.Context, reqs []*VerifyPasswordRequest) ([]*VerifyPasswordResponse, error) {
+	s.mu.Lock()
+	s.sizes = append(s.sizes, len(reqs))
+	s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	resps := make([]*VerifyPasswordResponse, len(reqs))
+	for i, req := range reqs {
+		resp, err := phe.VerifyPassword(s.keypair(req.Version), req.Request)
+		if err != nil {
+			return nil, err
+		}
+		resps[i] = &VerifyPasswordResponse{Response: resp}
+	}
+	return resps, nil
+}
+
+// heldClock creates timers which fire when the test sends to fire
+type heldClock struct {
+	fire chan time.Time
+}
+
+func (c heldClock) Now() time.Time               { return time.Now() }
+func (c heldClock) NewTimer(time.Duration) Timer { return firedTimer(c.fire) }
+
+func TestVerifyBatcher(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	svc := &batchService{testService: s}
+
+	const n = 4
+	records := make([][]byte, n)
+	keys := make([][]byte, n)
+	for i := range records {
+		var err error
+		records[i], keys[i], err = p.EnrollAccount(selfTestPassword)
+		require.NoError(t, err)
+	}
+
+	clock := heldClock{fire: make(chan time.Time, 1)}
+	defer func() { clock.fire <- time.Now() }()
+	p.Batcher = &VerifyBatcher{Service: svc, MaxBatch: n, Clock: clock}
+
+	var wg sync.WaitGroup
+	for i := range records {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			password := selfTestPassword
+			if i == 0 {
+				password = "wrong"
+			}
+
+			key, err := p.VerifyPassword(password, records[i])
+			if i == 0 {
+				assert.Equal(t, ErrInvalidPassword, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, keys[i], key)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []int{n}, svc.sizes)
+}
+
+func TestVerifyBatcher_Errors(t *testing.T) {
+	req := require.New(t)
+
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	record, _, err := p.EnrollAccount(selfTestPassword)
+	req.NoError(err)
+
+	svc := &batchService{testService: s, err: withCode(CodeTransport, errors.New("unreachable"))}
+	p.Batcher = &VerifyBatcher{Service: svc, Clock: newTestClock()}
+	_, err = p.VerifyPassword(selfTestPassword, record)
+	req.Equal(CodeTransport, ErrorCode(err))
+
+	clock := heldClock{fire: make(chan time.Time, 1)}
+	p.Batcher = &VerifyBatcher{Service: svc, Clock: clock}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.VerifyPasswordContext(ctx, selfTestPassword, record)
+	req.Equal(context.DeadlineExceeded, errors.Cause(err))
+	clock.fire <- time.Now()
+	p.Batcher = &VerifyBatcher{}
+	_, err = p.VerifyPassword(selfTestPassword, record)
+	req.Equal(CodeInvalidConfiguration, ErrorCode(err))
+}
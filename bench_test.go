@@ -0,0 +1,406 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/phe-go"
+	"github.com/stretchr/testify/require"
+)
+
+// cannedPHEClient accepts every password without allocating, so that benchmarks measure the SDK only
+type cannedPHEClient struct {
+	key []byte
+}
+
+func (c cannedPHEClient) EnrollAccount(password, enrollmentResponse []byte) ([]byte, []byte, error) {
+	return enrollmentResponse, c.key, nil
+}
+
+func (c cannedPHEClient) CreateVerifyPasswordRequest(password, record []byte) ([]byte, error) {
+	return record, nil
+}
+
+func (c cannedPHEClient) CheckResponseAndDecrypt(password, record, response []byte) ([]byte, error) {
+	return c.key, nil
+}
+
+// cannedResponse answers every request with the same body without allocating. It is not safe for concurrent use
+type cannedResponse struct {
+	body   []byte
+	reader bytes.Reader
+	resp   http.Response
+}
+
+func newCannedResponse(msg proto.Message) (*cannedResponse, error) {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	c := &cannedResponse{body: body}
+	c.resp = http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: c, ContentLength: int64(len(body))}
+	return c, nil
+}
+
+func (c *cannedResponse) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	c.reader.Reset(c.body)
+	return &c.resp, nil
+}
+
+func (c *cannedResponse) Read(p []byte) (int, error) { return c.reader.Read(p) }
+func (c *cannedResponse) Close() error               { return nil }
+
+func BenchmarkEnrollAccount(b *testing.B) {
+	p := newTestService(b).protocol(b, "")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := p.EnrollAccount(selfTestPassword); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyPassword(b *testing.B) {
+	p := newTestService(b).protocol(b, "")
+	record, _, err := p.EnrollAccount(selfTestPassword)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.VerifyPassword(selfTestPassword, record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// verifyPasswordAllocs is the ceiling of allocations per VerifyPassword call made by the SDK itself,
+// see BenchmarkVerifyPassword_SDK in testdata/perf/baseline.txt
+const verifyPasswordAllocs = 14
+
+// newCannedProtocol returns a protocol with canned PHE cryptography and transport, and a record it accepts
+func newCannedProtocol(tb testing.TB) (*Protocol, []byte) {
+	client, err := newCannedResponse(&VerifyPasswordResponse{Response: make([]byte, 65)})
+	require.NoError(tb, err)
+
+	p, err := NewProtocol(&Context{AppToken: "PT.test", Version: 1, PHEClients: map[uint32]PHEClient{1: cannedPHEClient{key: make([]byte, 32)}}})
+	require.NoError(tb, err)
+	p.APIClient = &APIClient{AppToken: p.AppToken, HTTPClient: &VirgilHTTPClient{Address: "http://passw0rd.test", Client: client}}
+
+	record, err := MarshalRecord(1, make([]byte, 194))
+	require.NoError(tb, err)
+	return p, record
+}
+
+func TestVerifyPassword_Allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector adds allocations")
+	}
+	p, record := newCannedProtocol(t)
+
+	var err error
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, e := p.VerifyPassword(selfTestPassword, record); e != nil {
+			err = e
+		}
+	})
+	require.NoError(t, err)
+	require.True(t, allocs <= verifyPasswordAllocs, "VerifyPassword made %v allocations, the ceiling is %d", allocs, verifyPasswordAllocs)
+}
+
+// BenchmarkVerifyPassword_SDK measures allocations of the SDK itself, without PHE cryptography
+// and transport
+func BenchmarkVerifyPassword_SDK(b *testing.B) {
+	p, record := newCannedProtocol(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.VerifyPassword(selfTestPassword, record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyPassword_Invalid(b *testing.B) {
+	p := newTestService(b).protocol(b, "")
+	record, _, err := p.EnrollAccount(selfTestPassword)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.VerifyPassword("wrong", record); err != ErrInvalidPassword {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateEnrollmentRecord(b *testing.B) {
+	record, err := MarshalRecord(1, mustDecode(selfTestRecord))
+	require.NoError(b, err)
+	token := "UT.2." + selfTestUpdateToken
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UpdateEnrollmentRecord(record, token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProtocol_UpdateEnrollmentRecord(b *testing.B) {
+	s := newTestService(b)
+	record, _, err := s.protocol(b, "").EnrollAccount(selfTestPassword)
+	require.NoError(b, err)
+	p := s.protocol(b, s.rotate(b))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.UpdateEnrollmentRecord(record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// repeatedRecords yields the same record n times
+type repeatedRecords struct {
+	record []byte
+	n      int
+}
+
+func (r *repeatedRecords) Next(ctx context.Context) (string, []byte, error) {
+	if r.n == 0 {
+		return "", nil, io.EOF
+	}
+	r.n--
+	return "id", r.record, nil
+}
+
+func (r *repeatedRecords) Save(ctx context.Context, id string, old, updated []byte) error {
+	return nil
+}
+
+func BenchmarkMigrator(b *testing.B) {
+	s := newTestService(b)
+	rec, _, err := s.protocol(b, "").EnrollAccount("passw0rd")
+	require.NoError(b, err)
+	token := s.rotate(b)
+
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reuse=%t", reuse), func(b *testing.B) {
+			records := &repeatedRecords{record: rec, n: b.N}
+			m := &Migrator{UpdateToken: token, Workers: 1, ReuseBuffers: reuse}
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			_, err := m.Migrate(context.Background(), records, records)
+			require.NoError(b, err)
+		})
+	}
+}
+
+func BenchmarkMarshalRecord(b *testing.B) {
+	rec := mustDecode(selfTestRecord)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalRecord(1, rec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalRecord(b *testing.B) {
+	record, err := MarshalRecord(1, mustDecode(selfTestRecord))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := UnmarshalRecord(record); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVirgilHTTPClient_Send measures allocations of a single request with pooled request
+// and response buffers
+func BenchmarkVirgilHTTPClient_Send(b *testing.B) {
+	client, err := newCannedResponse(&VerifyPasswordResponse{Response: make([]byte, 65)})
+	require.NoError(b, err)
+
+	vc := &VirgilHTTPClient{Address: "http://passw0rd.test", Client: client}
+	req := &VerifyPasswordRequest{Version: 1, Request: make([]byte, 130)}
+	resp := &VerifyPasswordResponse{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := vc.Send("PT.test", http.MethodPost, "verify-password", req, resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRecordEncoding compares hand-written encoding of records with the proto package
+func BenchmarkRecordEncoding(b *testing.B) {
+	record, err := MarshalRecord(1, make([]byte, 194))
+	require.NoError(b, err)
+
+	codecs := []struct {
+		name      string
+		marshal   func(proto.Message) ([]byte, error)
+		unmarshal func([]byte, proto.Message) error
+	}{
+		{"wire", func(m proto.Message) ([]byte, error) {
+			w := m.(wireMessage)
+			return w.appendWire(make([]byte, 0, w.wireSize())), nil
+		}, unmarshalMessage},
+		{"proto", proto.Marshal, proto.Unmarshal},
+	}
+
+	for _, c := range codecs {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			dbRecord := &DatabaseRecord{}
+			for i := 0; i < b.N; i++ {
+				if err := c.unmarshal(record, dbRecord); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := c.marshal(dbRecord); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPHEClient compares verification requests of a client built once per key version, as Protocol
+// does, with building it on every call
+func BenchmarkPHEClient(b *testing.B) {
+	s := newTestService(b)
+	p := s.protocol(b, "")
+	dbRecord, _, err := p.EnrollAccount(selfTestPassword)
+	require.NoError(b, err)
+	_, record, err := UnmarshalRecord(dbRecord)
+	require.NoError(b, err)
+
+	_, sk, err := ParseVersionAndContent("SK", s.clientSecret)
+	require.NoError(b, err)
+	_, pub, err := ParseVersionAndContent("PK", s.publicKey)
+	require.NoError(b, err)
+	client := p.snapshot().currentClient()
+
+	b.Run("per-version", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := client.CreateVerifyPasswordRequest([]byte(selfTestPassword), record); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("per-call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c, err := phe.NewClient(sk, pub)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := c.CreateVerifyPasswordRequest([]byte(selfTestPassword), record); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkPepperPassword compares peppering with HMACs keyed once per pepper version with keying them on every call
+func BenchmarkPepperPassword(b *testing.B) {
+	pepper := SecretBytes("0123456789abcdef")
+	p := &Protocol{Peppers: map[uint32]SecretBytes{1: pepper}}
+
+	b.Run("per-version", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.pepperPassword(1, selfTestPassword); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("per-call", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mac := hmac.New(sha256.New, pepper.Reveal())
+			_, _ = mac.Write([]byte(selfTestPassword))
+			_ = mac.Sum(nil)
+		}
+	})
+}
+
+// BenchmarkProtocol_Snapshot takes key snapshots from parallel goroutines, as concurrent verifications do
+func BenchmarkProtocol_Snapshot(b *testing.B) {
+	p := newTestService(b).protocol(b, "")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if p.snapshot().currentClient() == nil {
+				b.Fatal("no client")
+			}
+		}
+	})
+}
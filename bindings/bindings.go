@@ -0,0 +1,215 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package bindings exposes the client side of the passw0rd protocol to iOS and Android apps with gomobile:
+//
+//	gomobile bind -target android github.com/passw0rd/sdk-go/bindings
+//
+// Signatures are limited to what gomobile supports: strings, []byte, int64, bool and pointers to
+// structs of them, returned alone or together with an error. Errors are thrown as exceptions whose
+// messages start with the SDK error code name, e.g. "transport: ...", see the Code constants
+package bindings
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// Error code names which prefix error messages
+const (
+	CodeInvalidRecord     = "invalid_record"
+	CodeVersionMismatch   = "version_mismatch"
+	CodeUnknownKeyVersion = "unknown_key_version"
+	CodeNoUpdateToken     = "no_update_token"
+	CodeInvalidCredential = "invalid_credential"
+	CodeTransport         = "transport"
+	CodeServiceError      = "service_error"
+	// CodeCanceled is reported for calls aborted by Close or TimeoutMillis
+	CodeCanceled = "canceled"
+)
+
+// Config holds the credentials of a Client
+type Config struct {
+	AppToken         string
+	ServicePublicKey string
+	ClientSecretKey  string
+	UpdateToken      string
+	// URL, if set, replaces the passw0rd service address
+	URL string
+	// TimeoutMillis, if positive, limits the duration of every call
+	TimeoutMillis int64
+}
+
+// NewConfig returns an empty Config, for platforms which can not create Go structs directly
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// Client runs the protocol. It is safe for concurrent use
+type Client struct {
+	p       *passw0rd.Protocol
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewClient validates config and creates a client
+func NewClient(config *Config) (*Client, error) {
+	pctx, err := passw0rd.CreateContext(config.AppToken, config.ServicePublicKey, config.ClientSecretKey, config.UpdateToken)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	pctx.URL = config.URL
+
+	p, err := passw0rd.NewProtocol(pctx)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	c := &Client{p: p, timeout: time.Duration(config.TimeoutMillis) * time.Millisecond}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Enrollment is the result of Enroll. Record is stored for the user, Key encrypts user data
+type Enrollment struct {
+	Record []byte
+	Key    []byte
+}
+
+// Verification is the result of Verify. Key is the record encryption key if Verified is true
+type Verification struct {
+	Verified bool
+	Key      []byte
+}
+
+// Enroll protects a new password
+func (c *Client) Enroll(password string) (*Enrollment, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	record, key, err := c.p.EnrollAccountContext(ctx, password)
+	if err != nil {
+		return nil, wrapCall(ctx, err)
+	}
+	return &Enrollment{Record: record, Key: key}, nil
+}
+
+// Verify checks a password against its record. A wrong password is not an error, Verified is false then
+func (c *Client) Verify(password string, record []byte) (*Verification, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	key, err := c.p.VerifyPasswordContext(ctx, password, record)
+	if passw0rd.ErrorCode(err) == passw0rd.CodeInvalidPassword {
+		return &Verification{}, nil
+	}
+	if err != nil {
+		return nil, wrapCall(ctx, err)
+	}
+	return &Verification{Verified: true, Key: key}, nil
+}
+
+// Update updates a record with the update token of the configuration. It returns nil if the record
+// is up to date
+func (c *Client) Update(record []byte) ([]byte, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	updated, err := c.p.UpdateEnrollmentRecordContext(ctx, record)
+	if err != nil {
+		return nil, wrapCall(ctx, err)
+	}
+	return updated, nil
+}
+
+// CurrentVersion returns the key version new records are enrolled with
+func (c *Client) CurrentVersion() int64 {
+	return int64(c.p.CurrentVersion())
+}
+
+// Close cancels calls in flight, e.g. when the screen which started them goes away.
+// The client can not be used afterwards
+func (c *Client) Close() {
+	c.once.Do(c.cancel)
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(c.ctx, c.timeout)
+	}
+	return context.WithCancel(c.ctx)
+}
+
+// RecordVersion returns the key version of a record
+func RecordVersion(record []byte) (int64, error) {
+	version, _, err := passw0rd.UnmarshalRecord(record)
+	if err != nil {
+		return 0, wrap(err)
+	}
+	return int64(version), nil
+}
+
+// codeError prefixes error messages with the SDK error code name
+type codeError struct {
+	code string
+	err  error
+}
+
+func (e *codeError) Error() string {
+	return e.code + ": " + e.err.Error()
+}
+
+func (e *codeError) Cause() error {
+	return e.err
+}
+
+func wrap(err error) error {
+	return &codeError{code: passw0rd.ErrorCode(err).String(), err: err}
+}
+
+// wrapCall is wrap for errors of calls bound to ctx, which fail with CodeCanceled once ctx is done
+func wrapCall(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return &codeError{code: CodeCanceled, err: err}
+	}
+	return wrap(err)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package bindings
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	srv := httptest.NewServer(svc)
+	defer srv.Close()
+
+	config := NewConfig()
+	config.AppToken, config.ServicePublicKey, config.ClientSecretKey = svc.AppToken, svc.ServicePublicKey, svc.ClientSecretKey
+	config.URL = srv.URL + "/phe/v1"
+
+	c, err := NewClient(config)
+	require.NoError(t, err)
+
+	enrollment, err := c.Enroll("passw0rd")
+	require.NoError(t, err)
+
+	verification, err := c.Verify("passw0rd", enrollment.Record)
+	require.NoError(t, err)
+	assert.True(t, verification.Verified)
+	assert.Equal(t, enrollment.Key, verification.Key)
+
+	verification, err = c.Verify("wrong", enrollment.Record)
+	require.NoError(t, err)
+	assert.False(t, verification.Verified)
+	assert.Nil(t, verification.Key)
+
+	_, err = c.Verify("passw0rd", []byte("garbage"))
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), CodeInvalidRecord+": "), err.Error())
+
+	config.UpdateToken, err = svc.Rotate()
+	require.NoError(t, err)
+	c, err = NewClient(config)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), c.CurrentVersion())
+
+	updated, err := c.Update(enrollment.Record)
+	require.NoError(t, err)
+	version, err := RecordVersion(updated)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	verification, err = c.Verify("passw0rd", updated)
+	require.NoError(t, err)
+	assert.Equal(t, enrollment.Key, verification.Key)
+
+	c.Close()
+	_, err = c.Verify("passw0rd", updated)
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), CodeCanceled+": "), err.Error())
+
+	_, err = NewClient(NewConfig())
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), CodeInvalidCredential+": "), err.Error())
+}
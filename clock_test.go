@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// testClock is a Clock which only moves when advanced. Timers fire at once and move the clock
+// to their deadline, so that code waiting for them runs without sleeping
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Unix(1500000000, 0)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *testClock) NewTimer(d time.Duration) Timer {
+	c.Advance(d)
+	fired := make(chan time.Time, 1)
+	fired <- c.Now()
+	return firedTimer(fired)
+}
+
+type firedTimer chan time.Time
+
+func (t firedTimer) C() <-chan time.Time { return t }
+func (t firedTimer) Stop() bool          { return false }
+
+func TestProtocol_Clock(t *testing.T) {
+	req := require.New(t)
+
+	clock := newTestClock()
+	p := newTestService(t).protocol(t, "")
+	p.Clock = clock
+	p.Lockout = NewLockout(LockoutPolicy{MaxFailures: 1, LockDuration: time.Minute})
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	req.NoError(err)
+
+	ctx := WithUserID(context.Background(), "alice")
+	_, err = p.VerifyPasswordContext(ctx, "wrong", rec)
+	req.Equal(ErrInvalidPassword, err)
+
+	_, err = p.VerifyPasswordContext(ctx, "passw0rd", rec)
+	req.Equal(ErrAccountLocked, errors.Cause(err))
+	req.Equal(clock.Now().Add(time.Minute), err.(*AccountLockedError).Until)
+
+	clock.Advance(time.Minute)
+	verified, err := p.VerifyPasswordContext(ctx, "passw0rd", rec)
+	req.NoError(err)
+	req.Equal(key, verified)
+
+	p.MinVerifyDuration = time.Hour
+	start, wall := clock.Now(), time.Now()
+	_, err = p.VerifyPassword("passw0rd", rec)
+	req.NoError(err)
+	req.Equal(start.Add(time.Hour), clock.Now())
+	req.True(time.Since(wall) < time.Minute)
+}
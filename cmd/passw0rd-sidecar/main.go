@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Command passw0rd-sidecar serves Enroll, Verify and Update of the passw0rd protocol over gRPC and,
+// optionally, REST, so that services written in other languages can use the SDK through a local process.
+//
+// Credentials are read from a JSON file given with -config, which has the format of the passw0rd command,
+// and PASSW0RD_APP_TOKEN, PASSW0RD_SERVICE_PUBLIC_KEY, PASSW0RD_CLIENT_SECRET_KEY, PASSW0RD_UPDATE_TOKEN
+// and PASSW0RD_URL environment variables:
+//
+//	passw0rd-sidecar -config passw0rd.json -grpc 127.0.0.1:50051 -rest 127.0.0.1:8080
+//
+// With -socket it also runs as a local daemon for short-lived processes such as PHP-FPM workers, which
+// send length-prefixed JSON frames over a unix socket instead of parsing keys and opening TLS connections
+// on every invocation, see sidecar.Server.ServeSocket:
+//
+//	passw0rd-sidecar -config passw0rd.json -grpc "" -socket /run/passw0rd/passw0rd.sock
+//
+// The API is defined in sidecar/sidecar.proto. Responses carry record encryption keys, so the sidecar
+// must only listen on addresses reachable by the services it belongs to
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/sidecar"
+	"google.golang.org/grpc"
+)
+
+// config holds SDK credentials, PASSW0RD_* environment variables override the file
+type config struct {
+	AppToken         string `json:"app_token"`
+	ServicePublicKey string `json:"service_public_key"`
+	ClientSecretKey  string `json:"client_secret_key"`
+	UpdateToken      string `json:"update_token,omitempty"`
+	URL              string `json:"url,omitempty"`
+}
+
+func loadConfig(file string) (*config, error) {
+	cfg := &config{}
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %v", file, err)
+		}
+	}
+
+	for name, value := range map[string]*string{
+		"PASSW0RD_APP_TOKEN":          &cfg.AppToken,
+		"PASSW0RD_SERVICE_PUBLIC_KEY": &cfg.ServicePublicKey,
+		"PASSW0RD_CLIENT_SECRET_KEY":  &cfg.ClientSecretKey,
+		"PASSW0RD_UPDATE_TOKEN":       &cfg.UpdateToken,
+		"PASSW0RD_URL":                &cfg.URL,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*value = v
+		}
+	}
+	return cfg, nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "passw0rd-sidecar: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("passw0rd-sidecar", flag.ExitOnError)
+	var (
+		configFile = flags.String("config", "", "JSON file with app_token, service_public_key, client_secret_key, update_token and url")
+		grpcAddr   = flags.String("grpc", "127.0.0.1:50051", "gRPC listen address, gRPC is disabled if empty")
+		restAddr   = flags.String("rest", "", "REST listen address, REST is disabled if empty")
+		socketPath = flags.String("socket", "", "unix socket for the length-prefixed JSON protocol of short-lived clients")
+		logJSON    = flags.Bool("log", false, "log SDK decisions to standard error as JSON lines")
+	)
+	_ = flags.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	pctx, err := passw0rd.CreateContext(cfg.AppToken, cfg.ServicePublicKey, cfg.ClientSecretKey, cfg.UpdateToken)
+	if err != nil {
+		return err
+	}
+	pctx.URL = cfg.URL
+
+	p, err := passw0rd.NewProtocol(pctx)
+	if err != nil {
+		return err
+	}
+	if *logJSON {
+		p.Logger = passw0rd.NewJSONLog(os.Stderr)
+	}
+	srv := &sidecar.Server{Protocol: p}
+
+	errs := make(chan error, 3)
+	var gs *grpc.Server
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		gs = grpc.NewServer()
+		sidecar.RegisterPassw0rdServer(gs, srv)
+		go func() { errs <- gs.Serve(lis) }()
+		fmt.Fprintf(os.Stderr, "serving gRPC on %s\n", lis.Addr())
+	}
+
+	var hs *http.Server
+	if *restAddr != "" {
+		hs = &http.Server{Addr: *restAddr, Handler: srv.Handler()}
+		go func() {
+			if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+				errs <- err
+			}
+		}()
+		fmt.Fprintf(os.Stderr, "serving REST on %s\n", *restAddr)
+	}
+
+	var sock net.Listener
+	if *socketPath != "" {
+		if sock, err = listenSocket(*socketPath); err != nil {
+			return err
+		}
+		go func() { errs <- srv.ServeSocket(sock) }()
+		fmt.Fprintf(os.Stderr, "serving the socket protocol on %s\n", *socketPath)
+	}
+
+	if gs == nil && hs == nil && sock == nil {
+		return fmt.Errorf("nothing to serve, set -grpc, -rest or -socket")
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err = <-errs:
+	case <-stop:
+	}
+
+	if sock != nil {
+		sock.Close()
+	}
+	if hs != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = hs.Shutdown(ctx)
+	}
+	if gs != nil {
+		gs.GracefulStop()
+	}
+	return err
+}
+
+// listenSocket listens on a unix socket only the owner and group can connect to, replacing a socket
+// left behind by a previous run
+func listenSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0660); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
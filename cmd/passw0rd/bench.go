@@ -0,0 +1,232 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// maxBenchSamples bounds memory of latency samples, percentiles of longer runs cover the latest samples
+const maxBenchSamples = 1000000
+
+func bench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	pf := newProtocolFlags(flags)
+	var (
+		rps         = flags.Int("rps", 10, "operations started per second")
+		duration    = flags.Duration("duration", time.Minute, "duration of the load")
+		concurrency = flags.Int("concurrency", 64, "maximum operations in flight, further operations are dropped")
+		users       = flags.Int("users", 100, "records enrolled before the load for verifications")
+		verifyRatio = flags.Float64("verify-ratio", 0.9, "share of verifications, the rest are enrollments")
+		wrongRatio  = flags.Float64("wrong-ratio", 0, "share of verifications with a wrong password")
+		interval    = flags.Duration("progress", 10*time.Second, "progress report interval")
+	)
+	out := newOutput(flags, "bench")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if *rps < 1 || *duration <= 0 || *concurrency < 1 || *users < 1 {
+		return out.done(nil, usageError("rps, duration, concurrency and users must be positive"))
+	}
+
+	p, err := pf.protocol()
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	fmt.Fprintf(stderr, "enrolling %d users\n", *users)
+	records := make([][]byte, *users)
+	for i := range records {
+		if records[i], _, err = p.EnrollAccount(benchPassword(i)); err != nil {
+			return out.done(nil, describe(err))
+		}
+	}
+
+	samples := int64(*rps) * int64(duration.Seconds()+1)
+	if samples > maxBenchSamples {
+		samples = maxBenchSamples
+	}
+	tracker := &passw0rd.LatencyTracker{Window: *duration * 2, MaxSamples: int(samples)}
+	p.Metrics = tracker
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var started, dropped, completed int64
+	slots := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(time.Second / time.Duration(*rps))
+	defer ticker.Stop()
+	progress := time.NewTicker(*interval)
+	defer progress.Stop()
+	deadline := time.After(*duration)
+	start := time.Now()
+
+	fmt.Fprintf(stderr, "running %d operations/s for %s\n", *rps, *duration)
+load:
+	for i := 0; ; i++ {
+		select {
+		case <-ticker.C:
+		case <-progress.C:
+			fmt.Fprintf(stderr, "%s: completed %d, dropped %d\n", time.Since(start).Round(time.Second), atomic.LoadInt64(&completed), dropped)
+			continue
+		case <-deadline:
+			break load
+		case <-interrupt:
+			break load
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			dropped++
+			continue
+		}
+
+		started++
+		wg.Add(1)
+		go func(r *rand.Rand) {
+			defer func() {
+				<-slots
+				atomic.AddInt64(&completed, 1)
+				wg.Done()
+			}()
+
+			if r.Float64() >= *verifyRatio {
+				_, _, _ = p.EnrollAccount(benchPassword(r.Int()))
+				return
+			}
+
+			user := r.Intn(len(records))
+			password := benchPassword(user)
+			if r.Float64() < *wrongRatio {
+				password += "-wrong"
+			}
+			_, _ = p.VerifyPassword(password, records[user])
+		}(rand.New(rand.NewSource(int64(i))))
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	res := &benchResult{
+		Started:    started,
+		Dropped:    dropped,
+		TargetRate: *rps,
+		Rate:       float64(started) / elapsed.Seconds(),
+		Latencies:  []benchLatency{},
+	}
+	total, failed := 0, 0
+	for _, r := range tracker.Report() {
+		res.Latencies = append(res.Latencies, benchLatency{
+			Operation: r.Operation,
+			Version:   r.Version,
+			Outcome:   r.Outcome,
+			Count:     r.Count,
+			P50:       r.P50.Seconds(),
+			P95:       r.P95.Seconds(),
+			P99:       r.P99.Seconds(),
+		})
+		total += r.Count
+		if r.Outcome != passw0rd.OutcomeSuccess && r.Outcome != passw0rd.CodeInvalidPassword.String() {
+			failed += r.Count
+		}
+	}
+	if total > 0 {
+		res.ErrorRate = float64(failed) / float64(total)
+	}
+	if out.json {
+		return out.done(res, nil)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATION\tVERSION\tOUTCOME\tCOUNT\tP50\tP95\tP99")
+	for _, r := range tracker.Report() {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\t%s\t%s\n", r.Operation, r.Version, r.Outcome, r.Count,
+			r.P50.Round(time.Microsecond), r.P95.Round(time.Microsecond), r.P99.Round(time.Microsecond))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "\nstarted %d, dropped %d, throughput %.1f/s of %d/s, error rate %.2f%%\n",
+		res.Started, res.Dropped, res.Rate, res.TargetRate, res.ErrorRate*100)
+	if dropped > 0 {
+		fmt.Fprintln(stdout, "operations were dropped because -concurrency was exhausted, the service is slower than the load")
+	}
+	return nil
+}
+
+// benchResult is the -json result of bench. ErrorRate is the share of failed operations,
+// rejected wrong passwords do not count as failures
+type benchResult struct {
+	Started    int64          `json:"started"`
+	Dropped    int64          `json:"dropped"`
+	TargetRate int            `json:"target_rate"`
+	Rate       float64        `json:"rate"`
+	ErrorRate  float64        `json:"error_rate"`
+	Latencies  []benchLatency `json:"latencies"`
+}
+
+// benchLatency holds latency percentiles in seconds
+type benchLatency struct {
+	Operation string  `json:"operation"`
+	Version   uint32  `json:"version"`
+	Outcome   string  `json:"outcome"`
+	Count     int     `json:"count"`
+	P50       float64 `json:"p50_seconds"`
+	P95       float64 `json:"p95_seconds"`
+	P99       float64 `json:"p99_seconds"`
+}
+
+// benchPassword returns the password of the i-th bench user
+func benchPassword(i int) string {
+	return fmt.Sprintf("bench-password-%d", i)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBench(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+
+	res := &benchResult{}
+	_, err := c.runJSON(bench, "", res, "-config", c.config, "-rps", "100", "-duration", "200ms", "-users", "2",
+		"-verify-ratio", "0.5", "-wrong-ratio", "0.5")
+	require.NoError(t, err)
+	assert.NotZero(t, res.Started)
+	assert.Equal(t, 100, res.TargetRate)
+	assert.Zero(t, res.ErrorRate)
+	assert.NotEmpty(t, res.Latencies)
+
+	out, errOut, err := c.run(bench, "", "-config", c.config, "-rps", "50", "-duration", "100ms", "-users", "1")
+	require.NoError(t, err)
+	assert.Contains(t, errOut, "enrolling 1 users")
+	assert.Contains(t, out, "OPERATION")
+	assert.Contains(t, out, "error rate 0.00%")
+
+	_, _, err = c.run(bench, "", "-config", c.config, "-rps", "0")
+	assert.Equal(t, exitUsage, exitCode(err))
+
+	c.server.Close()
+	_, err = c.runJSON(bench, "", nil, "-config", c.config, "-users", "1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// config holds SDK credentials. They are read from the file given with -config, PASSW0RD_* environment
+// variables override the file
+type config struct {
+	AppToken         string `json:"app_token"`
+	ServicePublicKey string `json:"service_public_key"`
+	ClientSecretKey  string `json:"client_secret_key"`
+	UpdateToken      string `json:"update_token,omitempty"`
+	URL              string `json:"url,omitempty"`
+}
+
+// loadConfig reads file, if it is not empty, and applies environment variables
+func loadConfig(file string) (*config, error) {
+	cfg := &config{}
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %v", file, err)
+		}
+	}
+
+	for _, v := range cfg.variables() {
+		if value := os.Getenv(v.name); value != "" {
+			*v.value = value
+		}
+	}
+	return cfg, nil
+}
+
+type variable struct {
+	name  string
+	value *string
+}
+
+// variables returns the environment variables of the configuration
+func (cfg *config) variables() []variable {
+	return []variable{
+		{"PASSW0RD_APP_TOKEN", &cfg.AppToken},
+		{"PASSW0RD_SERVICE_PUBLIC_KEY", &cfg.ServicePublicKey},
+		{"PASSW0RD_CLIENT_SECRET_KEY", &cfg.ClientSecretKey},
+		{"PASSW0RD_UPDATE_TOKEN", &cfg.UpdateToken},
+		{"PASSW0RD_URL", &cfg.URL},
+	}
+}
+
+// marshal encodes the configuration as a -config file with format "json",
+// or as an environment file with format "env"
+func (cfg *config) marshal(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		return append(data, '\n'), err
+	case "env":
+		buf := &bytes.Buffer{}
+		for _, v := range cfg.variables() {
+			if *v.value != "" {
+				fmt.Fprintf(buf, "%s=%s\n", v.name, *v.value)
+			}
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// configResult is the -json result of init and keygen. The configuration is part of the result
+// if it is not written to a file
+type configResult struct {
+	Version            uint32  `json:"version"`
+	GeneratedClientKey bool    `json:"generated_client_key"`
+	File               string  `json:"file,omitempty"`
+	Config             *config `json:"config,omitempty"`
+}
+
+// write writes the configuration to file in format, with -json to standard output only as part of the result.
+// Format "text" writes the client secret key only
+func (res *configResult) write(out *output, cfg *config, format, file string) error {
+	res.File = file
+	if out.json && file == "" {
+		res.Config = cfg
+		return nil
+	}
+
+	if format == "text" {
+		return writeOutput(file, []byte(cfg.ClientSecretKey+"\n"))
+	}
+	data, err := cfg.marshal(format)
+	if err != nil {
+		return err
+	}
+	return writeOutput(file, data)
+}
+
+// writeOutput writes data to a new file with owner only permissions, or to standard output if file is empty
+func writeOutput(file string, data []byte) error {
+	if file == "" {
+		_, err := stdout.Write(data)
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+)
+
+// demoStore keeps records of demo-server users in memory
+type demoStore struct {
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+// add stores the record of a new user and reports whether the username was free
+func (s *demoStore) add(username string, record []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[username]; ok {
+		return false
+	}
+	s.records[username] = record
+	return true
+}
+
+func (s *demoStore) get(username string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[username]
+}
+
+// demoServer serves signup and login endpoints backed by the SDK
+type demoServer struct {
+	p     *passw0rd.Protocol
+	store *demoStore
+}
+
+// credentials is the request body of signup and login
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// account is the response body of signup and login
+type account struct {
+	Username       string `json:"username"`
+	RecordVersion  uint32 `json:"record_version"`
+	CurrentVersion uint32 `json:"current_version"`
+}
+
+func demo(args []string) error {
+	flags := flag.NewFlagSet("demo-server", flag.ContinueOnError)
+	pf := newProtocolFlags(flags)
+	var (
+		addr  = flags.String("addr", "localhost:8080", "listen address")
+		local = flags.Bool("local", false, "use an emulated service running in-process, no credentials needed")
+	)
+	out := newOutput(flags, "demo-server")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	var p *passw0rd.Protocol
+	var err error
+	if *local {
+		var svc *fake.Service
+		if svc, err = fake.New(); err == nil {
+			p, err = svc.Protocol()
+		}
+	} else {
+		p, err = pf.protocol()
+	}
+	if err != nil {
+		if !*local {
+			err = fmt.Errorf("%v, run with -local to try the demo without credentials", err)
+		}
+		return out.done(nil, err)
+	}
+
+	ds := &demoServer{p: p, store: &demoStore{records: map[string][]byte{}}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/signup", ds.signup)
+	mux.HandleFunc("/login", ds.login)
+	mux.HandleFunc("/users", ds.users)
+	srv := &http.Server{Addr: *addr, Handler: mux}
+
+	ctx, cancel := interruptible()
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(stderr, `listening on %s, try:
+
+	curl -d '{"username": "alice", "password": "passw0rd"}' http://%[1]s/signup
+	curl -d '{"username": "alice", "password": "passw0rd"}' http://%[1]s/login
+	curl -d '{"username": "alice", "password": "wrong"}' http://%[1]s/login
+	curl http://%[1]s/users
+
+`, *addr)
+	if err = srv.ListenAndServe(); err == http.ErrServerClosed {
+		err = nil
+	}
+
+	ds.store.mu.Lock()
+	res := &demoResult{Users: len(ds.store.records)}
+	ds.store.mu.Unlock()
+	return out.done(res, err)
+}
+
+// demoResult is the -json result of demo-server, written when it is stopped
+type demoResult struct {
+	Users int `json:"users"`
+}
+
+// signup enrolls a new user
+func (ds *demoServer) signup(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCredentials(w, r)
+	if !ok {
+		return
+	}
+	if ds.store.get(c.Username) != nil {
+		writeError(w, http.StatusConflict, "username is taken")
+		return
+	}
+
+	record, _, err := ds.p.EnrollAccountContext(r.Context(), c.Password)
+	if err != nil {
+		writeSDKError(w, err)
+		return
+	}
+	if !ds.store.add(c.Username, record) {
+		writeError(w, http.StatusConflict, "username is taken")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ds.account(c.Username, record))
+}
+
+// login verifies the password of a user. Unknown users and wrong passwords are not told apart
+func (ds *demoServer) login(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCredentials(w, r)
+	if !ok {
+		return
+	}
+	record := ds.store.get(c.Username)
+	if record == nil {
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	if _, err := ds.p.VerifyPasswordContext(r.Context(), c.Password, record); err != nil {
+		if passw0rd.ErrorCode(err) == passw0rd.CodeInvalidPassword {
+			writeError(w, http.StatusUnauthorized, "invalid username or password")
+			return
+		}
+		writeSDKError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ds.account(c.Username, record))
+}
+
+// users lists all users with their record versions, records themselves are not shown
+func (ds *demoServer) users(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	ds.store.mu.Lock()
+	accounts := make([]*account, 0, len(ds.store.records))
+	for username, record := range ds.store.records {
+		accounts = append(accounts, ds.account(username, record))
+	}
+	ds.store.mu.Unlock()
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Username < accounts[j].Username })
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (ds *demoServer) account(username string, record []byte) *account {
+	version, _, _ := passw0rd.UnmarshalRecord(record)
+	return &account{Username: username, RecordVersion: version, CurrentVersion: ds.p.CurrentVersion()}
+}
+
+// readCredentials decodes the request body and writes an error response if it is invalid
+func readCredentials(w http.ResponseWriter, r *http.Request) (*credentials, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return nil, false
+	}
+
+	c := &credentials{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(c); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be {\"username\": \"...\", \"password\": \"...\"}")
+		return nil, false
+	}
+	if c.Username == "" || c.Password == "" {
+		writeError(w, http.StatusBadRequest, "username and password are required")
+		return nil, false
+	}
+	return c, true
+}
+
+// writeSDKError responds to errors of the SDK, throttling and lockouts are passed on to the client
+func writeSDKError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	switch passw0rd.ErrorCode(err) {
+	case passw0rd.CodeRateLimited, passw0rd.CodeAccountLocked:
+		status = http.StatusTooManyRequests
+	}
+	fmt.Fprintf(stderr, "%v\n", describe(err))
+
+	info := newErrorInfo(err)
+	writeJSON(w, status, map[string]string{"error": info.Message, "code": info.Name})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
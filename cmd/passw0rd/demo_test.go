@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemoServer(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	p, err := c.svc.Protocol()
+	require.NoError(t, err)
+	ds := &demoServer{p: p, store: &demoStore{records: map[string][]byte{}}}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+		status  int
+		result  string
+	}{
+		{"signup", ds.signup, http.MethodPost, `{"username": "alice", "password": "passw0rd"}`, http.StatusCreated, `"record_version": 1`},
+		{"taken", ds.signup, http.MethodPost, `{"username": "alice", "password": "other"}`, http.StatusConflict, "username is taken"},
+		{"login", ds.login, http.MethodPost, `{"username": "alice", "password": "passw0rd"}`, http.StatusOK, `"username": "alice"`},
+		{"wrong password", ds.login, http.MethodPost, `{"username": "alice", "password": "wrong"}`, http.StatusUnauthorized, "invalid username or password"},
+		{"unknown user", ds.login, http.MethodPost, `{"username": "bob", "password": "passw0rd"}`, http.StatusUnauthorized, "invalid username or password"},
+		{"missing password", ds.login, http.MethodPost, `{"username": "alice"}`, http.StatusBadRequest, "are required"},
+		{"invalid body", ds.signup, http.MethodPost, `alice`, http.StatusBadRequest, "body must be"},
+		{"get signup", ds.signup, http.MethodGet, "", http.StatusMethodNotAllowed, "use POST"},
+		{"users", ds.users, http.MethodGet, "", http.StatusOK, `"username": "alice"`},
+		{"post users", ds.users, http.MethodPost, "", http.StatusMethodNotAllowed, "use GET"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			test.handler(w, httptest.NewRequest(test.method, "/", strings.NewReader(test.body)))
+			assert.Equal(t, test.status, w.Code)
+			assert.Contains(t, w.Body.String(), test.result)
+		})
+	}
+
+	_, err = c.runJSON(demo, "", nil, "-config", c.writeFile("empty.json", "{}"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run with -local")
+}
@@ -0,0 +1,331 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/pkg/errors"
+)
+
+// defaultURL is the service URL used when the configuration does not set one
+const defaultURL = "https://api.passw0rd.io/phe/v1"
+
+// certificateExpiryWarning is how long before expiry a service certificate is reported
+const certificateExpiryWarning = 14 * 24 * time.Hour
+
+// finding is the outcome of a doctor check
+type finding struct {
+	Status string `json:"status"`
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// doctorResult is the -json result of doctor
+type doctorResult struct {
+	Checks []finding `json:"checks"`
+	Failed int       `json:"failed"`
+}
+
+// Finding statuses
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "FAIL"
+	statusSkip = "skip"
+)
+
+func doctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	var (
+		configFile = flags.String("config", "", "JSON file with app_token, service_public_key, client_secret_key, update_token and url")
+		serviceURL = flags.String("url", "", "service URL, overrides the configuration")
+		timeout    = flags.Duration("timeout", 10*time.Second, "timeout of each network check")
+	)
+	out := newOutput(flags, "doctor")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	res := &doctorResult{Checks: []finding{}}
+	report := func(f finding) {
+		res.Checks = append(res.Checks, f)
+		out.Printf("%-4s  %-14s %s\n", f.Status, f.Name, f.Detail)
+		if f.Fix != "" {
+			out.Printf("%-4s  %-14s fix: %s\n", "", "", f.Fix)
+		}
+		if f.Status == statusFail {
+			res.Failed++
+		}
+	}
+	done := func() error {
+		out.Printf("\n")
+		if res.Failed > 0 {
+			return out.done(res, fmt.Errorf("failed checks: %d", res.Failed))
+		}
+		out.Printf("all checks passed\n")
+		return out.done(res, nil)
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		report(finding{statusFail, "configuration", err.Error(), "pass an existing file with -config or create one with passw0rd init"})
+		return done()
+	}
+	if *serviceURL != "" {
+		cfg.URL = *serviceURL
+	}
+
+	ctx, f := checkConfig(cfg)
+	report(f)
+	if ctx != nil {
+		report(checkTokenChain(cfg, ctx))
+	}
+	report(checkSelfTest())
+
+	address := cfg.URL
+	if address == "" {
+		address = defaultURL
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		report(finding{statusFail, "network", fmt.Sprintf("invalid service URL %q", address), "set url to the service URL, e.g. " + defaultURL})
+		return done()
+	}
+	report(checkProxy(u))
+	network := checkTransport(u, *timeout)
+	report(network)
+
+	if ctx == nil || network.Status == statusFail {
+		report(finding{Status: statusSkip, Name: "service", Detail: "requires a valid configuration and a reachable service"})
+		return done()
+	}
+
+	p, err := passw0rd.NewProtocol(ctx)
+	if err != nil {
+		report(finding{statusFail, "service", err.Error(), ""})
+		return done()
+	}
+	p.APIClient = &passw0rd.APIClient{AppToken: p.AppToken, URL: address}
+
+	service := checkService(p, *timeout)
+	report(service)
+	if service.Status == statusFail {
+		report(finding{Status: statusSkip, Name: "round trip", Detail: "requires a reachable service"})
+		return done()
+	}
+	report(checkRoundTrip(p))
+	return done()
+}
+
+// checkConfig validates each configuration value and returns the context they make up
+func checkConfig(cfg *config) (*passw0rd.Context, finding) {
+	const name = "configuration"
+	for _, s := range cfg.settings() {
+		*s.value = strings.TrimSpace(*s.value)
+		if err := s.validate(); err != nil {
+			return nil, finding{statusFail, name, fmt.Sprintf("%s %v", s.name, err),
+				fmt.Sprintf("correct %s in the -config file or %s, or run passw0rd init", s.name, variableName(cfg, s.value))}
+		}
+	}
+
+	ctx, err := passw0rd.CreateContext(cfg.AppToken, cfg.ServicePublicKey, cfg.ClientSecretKey, cfg.UpdateToken)
+	if err != nil {
+		return nil, finding{statusFail, name, describe(err).Error(), "check that the update token was issued for this service public key"}
+	}
+	return ctx, finding{Status: statusOK, Name: name, Detail: "app token, service public key and client secret key are valid"}
+}
+
+// checkTokenChain reports the key versions, the configured update token must lead from the
+// service public key version to the next one
+func checkTokenChain(cfg *config, ctx *passw0rd.Context) finding {
+	const name = "token chain"
+	if cfg.UpdateToken == "" {
+		return finding{Status: statusOK, Name: name, Detail: fmt.Sprintf("keys of version %d, no update token", ctx.Version)}
+	}
+
+	previous := ctx.Version - 1
+	if _, ok := ctx.PHEClients[previous]; !ok {
+		return finding{statusFail, name, fmt.Sprintf("no keys for version %d, the version before the update token", previous), "configure the service public key and client secret key the update token was issued for"}
+	}
+	return finding{Status: statusOK, Name: name,
+		Detail: fmt.Sprintf("keys of version %d, update token to version %d, records of both versions verify", previous, ctx.Version)}
+}
+
+// checkSelfTest runs known answer tests of the protocol implementation
+func checkSelfTest() finding {
+	const name = "self-test"
+	if err := passw0rd.RunSelfTest(); err != nil {
+		return finding{statusFail, name, err.Error(), "check the randomness source and that the binary was built from an unmodified SDK"}
+	}
+	return finding{Status: statusOK, Name: name, Detail: "randomness source and known answer tests"}
+}
+
+// checkProxy warns about proxy variables, the SDK connects to the service directly
+func checkProxy(u *url.URL) finding {
+	const name = "proxy"
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u})
+	if err != nil {
+		return finding{statusWarn, name, fmt.Sprintf("invalid proxy variable: %v", err), "correct HTTPS_PROXY or HTTP_PROXY"}
+	}
+	if proxy == nil {
+		return finding{Status: statusOK, Name: name, Detail: "no proxy configured, connecting directly"}
+	}
+	return finding{statusWarn, name, fmt.Sprintf("proxy %s is configured, but the SDK connects to %s directly", proxy.Host, u.Host),
+		"allow direct egress to " + u.Host + ", or set Protocol.APIClient.HTTPClient to a client with a proxying transport"}
+}
+
+// checkTransport connects to the service the way the SDK does and checks its certificate
+func checkTransport(u *url.URL, timeout time.Duration) finding {
+	const name = "network"
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if u.Scheme != "https" {
+		conn, err := dialer.Dial("tcp", host)
+		if err != nil {
+			return finding{statusFail, name, err.Error(), "check DNS and firewall rules for " + host}
+		}
+		conn.Close()
+		return finding{statusWarn, name, "connected to " + host + " without TLS", "use an https URL unless this is a local test service"}
+	}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	if err != nil {
+		if _, ok := err.(net.Error); ok {
+			return finding{statusFail, name, err.Error(), "check DNS and firewall rules for " + host}
+		}
+		return finding{statusFail, name, err.Error(), "install the system CA certificates, or check for a TLS intercepting proxy between this host and the service"}
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	cert := state.PeerCertificates[0]
+	detail := fmt.Sprintf("TLS %s to %s, certificate for %s issued by %s, expires %s", tlsVersion(state.Version), host,
+		cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"))
+	if time.Until(cert.NotAfter) < certificateExpiryWarning {
+		return finding{statusWarn, name, detail, "the service certificate expires soon, update pins configured with passw0rd.PinSet"}
+	}
+	return finding{Status: statusOK, Name: name, Detail: detail}
+}
+
+// checkService pings the service, it authenticates with the app token
+func checkService(p *passw0rd.Protocol, timeout time.Duration) finding {
+	const name = "service"
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := p.Ping(ctx); err != nil {
+		fix := "check the service status and the url setting"
+		if he, ok := errors.Cause(err).(*passw0rd.HttpError); ok && he.Code == http.StatusUnauthorized {
+			fix = "the app token is not accepted, copy it again from the dashboard"
+		}
+		return finding{statusFail, name, describe(err).Error(), fix}
+	}
+	return finding{Status: statusOK, Name: name, Detail: fmt.Sprintf("enrollment for version %d answered in %s", p.CurrentVersion(), time.Since(start).Round(time.Millisecond))}
+}
+
+// checkRoundTrip enrolls a random password and verifies it, and a wrong one
+func checkRoundTrip(p *passw0rd.Protocol) finding {
+	const name = "round trip"
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return finding{statusFail, name, err.Error(), ""}
+	}
+	password := base64.StdEncoding.EncodeToString(buf)
+
+	record, key, err := p.EnrollAccount(password)
+	if err != nil {
+		return finding{statusFail, name, "enroll: " + describe(err).Error(), "check that the service public key belongs to this app"}
+	}
+	verified, err := p.VerifyPassword(password, record)
+	if err != nil {
+		return finding{statusFail, name, "verify: " + describe(err).Error(), "check that the client secret key was not changed since the keys were generated"}
+	}
+	if !bytes.Equal(key, verified) {
+		return finding{statusFail, name, "verification derived a different key", "report this with passw0rd verify -debug output"}
+	}
+	if _, err = p.VerifyPassword("not "+password, record); passw0rd.ErrorCode(err) != passw0rd.CodeInvalidPassword {
+		return finding{statusFail, name, fmt.Sprintf("wrong password was not rejected: %v", err), "report this with passw0rd verify -debug output"}
+	}
+	return finding{Status: statusOK, Name: name, Detail: "enrolled a password, verified it and rejected a wrong one"}
+}
+
+// variableName returns the environment variable of a configuration value
+func variableName(cfg *config, value *string) string {
+	for _, v := range cfg.variables() {
+		if v.value == value {
+			return v.name
+		}
+	}
+	return ""
+}
+
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
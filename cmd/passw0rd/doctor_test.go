@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statuses returns the status of each check in res by name
+func (res *doctorResult) statuses() map[string]string {
+	statuses := map[string]string{}
+	for _, f := range res.Checks {
+		statuses[f.Name] = f.Status
+	}
+	return statuses
+}
+
+func TestDoctor(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	token, err := c.svc.Rotate()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		args     []string
+		statuses map[string]string
+	}{
+		{
+			name: "healthy",
+			args: []string{"-config", c.writeConfig("rotated.json", token)},
+			statuses: map[string]string{"configuration": statusOK, "token chain": statusOK, "proxy": statusOK,
+				"network": statusWarn, "service": statusOK, "round trip": statusOK},
+		},
+		{
+			name:     "missing file",
+			args:     []string{"-config", filepath.Join(c.dir, "missing.json")},
+			statuses: map[string]string{"configuration": statusFail},
+		},
+		{
+			name:     "invalid configuration",
+			args:     []string{"-config", c.writeFile("invalid.json", `{"app_token": "x"}`)},
+			statuses: map[string]string{"configuration": statusFail, "service": statusSkip},
+		},
+		{
+			name:     "invalid url",
+			args:     []string{"-config", c.config, "-url", "localhost"},
+			statuses: map[string]string{"configuration": statusFail, "network": statusFail},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &doctorResult{}
+			_, err := c.runJSON(doctor, "", res, test.args...)
+			assert.Equal(t, res.Failed > 0, err != nil)
+
+			statuses := res.statuses()
+			for name, status := range test.statuses {
+				assert.Equal(t, status, statuses[name], name)
+			}
+		})
+	}
+
+	out, _, _ := c.run(doctor, "", "-config", c.writeFile("invalid.json", `{"app_token": "x"}`))
+	assert.Contains(t, out, "FAIL  configuration  app token must look like PT.<base64>\n")
+	assert.Contains(t, out, "fix: correct app token in the -config file or PASSW0RD_APP_TOKEN, or run passw0rd init\n")
+}
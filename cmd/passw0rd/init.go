@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// setting is a configuration value set up by init
+type setting struct {
+	name     string
+	flag     string
+	prompt   string
+	value    *string
+	required bool
+	check    func(value string) error
+}
+
+func initConfig(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	cfg := &config{}
+	var (
+		format         = flags.String("format", "json", "output format: json for a -config file or env for environment variables")
+		output         = flags.String("o", "passw0rd.json", "output file created with owner only permissions, - for standard output")
+		nonInteractive = flags.Bool("non-interactive", false, "fail on missing or invalid values instead of asking for them")
+	)
+	out := newOutput(flags, "init")
+
+	settings := cfg.settings()
+	for _, s := range settings {
+		flags.StringVar(s.value, s.flag, "", s.name)
+	}
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if *format != "json" && *format != "env" {
+		return out.done(nil, usageError(fmt.Sprintf("unknown format %q", *format)))
+	}
+
+	input := bufio.NewReader(stdin)
+	for _, s := range settings {
+		if err := s.setUp(input, !*nonInteractive, !*nonInteractive && !isSet(flags, s.flag)); err != nil {
+			return out.done(nil, err)
+		}
+	}
+
+	res := &configResult{}
+	if cfg.ClientSecretKey == "" {
+		pkVersion, _, _ := passw0rd.ParseVersionAndContent("PK", cfg.ServicePublicKey)
+		cfg.ClientSecretKey = generateClientKey(pkVersion)
+		res.GeneratedClientKey = true
+		fmt.Fprintf(stderr, "generated client secret key of version %d\n", pkVersion)
+	}
+
+	ctx, err := passw0rd.CreateContext(cfg.AppToken, cfg.ServicePublicKey, cfg.ClientSecretKey, cfg.UpdateToken)
+	if err != nil {
+		return out.done(nil, fmt.Errorf("invalid configuration: %v", err))
+	}
+	res.Version = ctx.Version
+
+	if *output == "-" {
+		*output = ""
+	}
+	if err = res.write(out, cfg, *format, *output); err != nil {
+		return out.done(nil, err)
+	}
+	if *output != "" {
+		fmt.Fprintf(stderr, "wrote %s\n", *output)
+	}
+	return out.done(res, nil)
+}
+
+// settings returns the values of the configuration with their validation, the key versions are checked
+// against the service public key which is validated first
+func (cfg *config) settings() []*setting {
+	var pkVersion uint32
+	return []*setting{
+		{name: "app token", flag: "app-token", prompt: "App token (PT.<base64>)", value: &cfg.AppToken, required: true,
+			check: func(value string) error {
+				if !strings.HasPrefix(value, "PT.") || len(value) == len("PT.") {
+					return fmt.Errorf("must look like PT.<base64>")
+				}
+				return nil
+			}},
+		{name: "service public key", flag: "service-public-key", prompt: "Service public key (PK.<version>.<base64>)", value: &cfg.ServicePublicKey, required: true,
+			check: func(value string) (err error) {
+				pkVersion, _, err = passw0rd.ParseVersionAndContent("PK", value)
+				return err
+			}},
+		{name: "client secret key", flag: "client-secret-key", prompt: "Client secret key (SK.<version>.<base64>, empty to generate one)", value: &cfg.ClientSecretKey,
+			check: func(value string) error {
+				version, _, err := passw0rd.ParseVersionAndContent("SK", value)
+				if err == nil && version != pkVersion {
+					err = fmt.Errorf("version %d does not match service public key version %d", version, pkVersion)
+				}
+				return err
+			}},
+		{name: "update token", flag: "update-token", prompt: "Update token (UT.<version>.<base64>, empty if keys were not rotated)", value: &cfg.UpdateToken,
+			check: func(value string) error {
+				version, _, err := passw0rd.ParseVersionAndContent("UT", value)
+				if err == nil && version != pkVersion+1 {
+					err = fmt.Errorf("version %d must follow service public key version %d", version, pkVersion)
+				}
+				return err
+			}},
+		{name: "service URL", flag: "url", prompt: "Service URL (empty for the default)", value: &cfg.URL,
+			check: func(value string) error {
+				u, err := url.Parse(value)
+				if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+					err = fmt.Errorf("must be an http or https URL")
+				}
+				return err
+			}},
+	}
+}
+
+// setUp asks for the value if ask is set and validates it. Invalid values are asked for again
+// in interactive mode
+func (s *setting) setUp(input *bufio.Reader, interactive, ask bool) error {
+	for {
+		if ask {
+			fmt.Fprintf(stderr, "%s: ", s.prompt)
+			line, err := input.ReadString('\n')
+			if err != nil && (err != io.EOF || line == "") {
+				return fmt.Errorf("%s: no input", s.name)
+			}
+			*s.value = line
+		}
+
+		*s.value = strings.TrimSpace(*s.value)
+		err := s.validate()
+		if err == nil {
+			return nil
+		}
+		if !interactive {
+			return fmt.Errorf("-%s: %v", s.flag, err)
+		}
+		fmt.Fprintf(stderr, "invalid %s: %v\n", s.name, err)
+		ask = true
+	}
+}
+
+func (s *setting) validate() error {
+	if *s.value == "" {
+		if s.required {
+			return fmt.Errorf("is required")
+		}
+		return nil
+	}
+	return s.check(*s.value)
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitConfig(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	svc := c.svc
+
+	file := filepath.Join(c.dir, "init.json")
+	res := &configResult{}
+	_, err := c.runJSON(initConfig, "", res, "-non-interactive", "-o", file,
+		"-app-token", svc.AppToken, "-service-public-key", svc.ServicePublicKey, "-url", c.server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, &configResult{Version: 1, GeneratedClientKey: true, File: file}, res)
+
+	cfg, err := loadConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, svc.AppToken, cfg.AppToken)
+	assert.Equal(t, c.server.URL, cfg.URL)
+	assert.True(t, strings.HasPrefix(cfg.ClientSecretKey, "SK.1."))
+
+	_, _, err = c.run(initConfig, "", "-non-interactive", "-o", file,
+		"-app-token", svc.AppToken, "-service-public-key", svc.ServicePublicKey)
+	assert.Error(t, err, "existing files are not overwritten")
+
+	input := strings.Join([]string{"PT", svc.AppToken, svc.ServicePublicKey, svc.ClientSecretKey, "", ""}, "\n") + "\n"
+	res = &configResult{}
+	_, err = c.runJSON(initConfig, input, res, "-o", "-")
+	require.NoError(t, err)
+	assert.False(t, res.GeneratedClientKey)
+	require.NotNil(t, res.Config)
+	assert.Equal(t, config{AppToken: svc.AppToken, ServicePublicKey: svc.ServicePublicKey, ClientSecretKey: svc.ClientSecretKey}, *res.Config)
+
+	out, errOut, err := c.run(initConfig, input, "-format", "env", "-o", "-")
+	require.NoError(t, err)
+	assert.Contains(t, errOut, "invalid app token: must look like PT.<base64>")
+	assert.Equal(t, "PASSW0RD_APP_TOKEN="+svc.AppToken+"\n"+
+		"PASSW0RD_SERVICE_PUBLIC_KEY="+svc.ServicePublicKey+"\n"+
+		"PASSW0RD_CLIENT_SECRET_KEY="+svc.ClientSecretKey+"\n", out)
+
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+		err   string
+	}{
+		{name: "missing", args: []string{"-non-interactive"}, err: "-app-token: is required"},
+		{name: "invalid", args: []string{"-non-interactive", "-app-token", svc.AppToken, "-service-public-key", "PK.x"}, err: "-service-public-key: "},
+		{name: "no input", input: svc.AppToken + "\n", err: "service public key: no input"},
+		{name: "format", args: []string{"-format", "yaml"}, err: `usage: unknown format "yaml"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := c.run(initConfig, test.input, append(test.args, "-o", "-")...)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	svc := c.svc
+
+	tests := []struct {
+		name   string
+		args   []string
+		prefix string
+		usage  bool
+	}{
+		{name: "default", prefix: "SK.1."},
+		{name: "version", args: []string{"-version", "3"}, prefix: "SK.3."},
+		{name: "public key version", args: []string{"-service-public-key", svc.ServicePublicKey}, prefix: "SK.1."},
+		{name: "env", args: []string{"-format", "env", "-app-token", svc.AppToken}, prefix: "PASSW0RD_APP_TOKEN=" + svc.AppToken + "\nPASSW0RD_CLIENT_SECRET_KEY=SK.1."},
+		{name: "zero version", args: []string{"-version", "0"}, usage: true},
+		{name: "format", args: []string{"-format", "yaml"}, usage: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, _, err := c.run(keygen, "", test.args...)
+			if test.usage {
+				assert.Equal(t, exitUsage, exitCode(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(out, test.prefix), out)
+		})
+	}
+
+	res := &configResult{}
+	_, err := c.runJSON(keygen, "", res, "-format", "json", "-app-token", svc.AppToken, "-service-public-key", svc.ServicePublicKey)
+	require.NoError(t, err)
+	assert.True(t, res.GeneratedClientKey)
+	require.NotNil(t, res.Config)
+	assert.Equal(t, svc.ServicePublicKey, res.Config.ServicePublicKey)
+
+	file := filepath.Join(c.dir, "keygen.json")
+	_, err = c.runJSON(keygen, "", nil, "-format", "json", "-o", file)
+	require.NoError(t, err)
+	cfg, err := loadConfig(file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(cfg.ClientSecretKey, "SK.1."))
+
+	_, err = c.runJSON(keygen, "", nil, "-version", "2", "-app-token", svc.AppToken, "-service-public-key", svc.ServicePublicKey)
+	assert.Error(t, err)
+}
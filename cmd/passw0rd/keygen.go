@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+
+	"github.com/passw0rd/phe-go"
+	"github.com/passw0rd/sdk-go"
+)
+
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	var (
+		version   = flags.Uint("version", 1, "key version, the version of service-public-key if it is set")
+		format    = flags.String("format", "text", "output format: text for the key only, json for a -config file or env for environment variables")
+		appToken  = flags.String("app-token", "", "PT.<base64> app token to include in json and env output")
+		publicKey = flags.String("service-public-key", "", "PK.<version>.<base64> service public key to include in json and env output")
+		url       = flags.String("url", "", "service URL to include in json and env output")
+		output    = flags.String("o", "", "output file created with owner only permissions, standard output if empty")
+	)
+	out := newOutput(flags, "keygen")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if *publicKey != "" && !isSet(flags, "version") {
+		pkVersion, _, err := passw0rd.ParseVersionAndContent("PK", *publicKey)
+		if err != nil {
+			return out.done(nil, fmt.Errorf("invalid service public key: %v", err))
+		}
+		*version = uint(pkVersion)
+	}
+
+	if *version < 1 {
+		return out.done(nil, usageError(fmt.Sprintf("invalid key version %d", *version)))
+	}
+	if *format != "text" && *format != "json" && *format != "env" {
+		return out.done(nil, usageError(fmt.Sprintf("unknown format %q", *format)))
+	}
+
+	cfg := &config{
+		AppToken:         *appToken,
+		ServicePublicKey: *publicKey,
+		ClientSecretKey:  generateClientKey(uint32(*version)),
+		URL:              *url,
+	}
+
+	// a complete configuration is checked the way the SDK will load it
+	if cfg.AppToken != "" && cfg.ServicePublicKey != "" {
+		if _, err := passw0rd.CreateContext(cfg.AppToken, cfg.ServicePublicKey, cfg.ClientSecretKey, ""); err != nil {
+			return out.done(nil, err)
+		}
+	}
+
+	res := &configResult{Version: uint32(*version), GeneratedClientKey: true}
+	return out.done(res, res.write(out, cfg, *format, *output))
+}
+
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// generateClientKey returns a new client secret key in the format CreateContext expects
+func generateClientKey(version uint32) string {
+	return fmt.Sprintf("SK.%d.%s", version, base64.StdEncoding.EncodeToString(phe.GenerateClientKey()))
+}
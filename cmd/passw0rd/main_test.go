@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cli runs commands with fake standard streams, configured for a fake service
+type cli struct {
+	t      *testing.T
+	svc    *fake.Service
+	server *httptest.Server
+	dir    string
+	config string
+}
+
+func newCLI(t *testing.T) *cli {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "passw0rd-cli")
+	require.NoError(t, err)
+
+	c := &cli{t: t, svc: svc, server: httptest.NewServer(svc), dir: dir}
+	c.config = c.writeConfig("passw0rd.json", "")
+	return c
+}
+
+func (c *cli) close() {
+	c.server.Close()
+	os.RemoveAll(c.dir)
+}
+
+// writeConfig writes a -config file for the fake service with updateToken and returns its name
+func (c *cli) writeConfig(name, updateToken string) string {
+	data, err := json.Marshal(&config{
+		AppToken:         c.svc.AppToken,
+		ServicePublicKey: c.svc.ServicePublicKey,
+		ClientSecretKey:  c.svc.ClientSecretKey,
+		UpdateToken:      updateToken,
+		URL:              c.server.URL,
+	})
+	require.NoError(c.t, err)
+	return c.writeFile(name, string(data))
+}
+
+// writeFile creates a file in the temporary directory and returns its name
+func (c *cli) writeFile(name, content string) string {
+	file := filepath.Join(c.dir, name)
+	require.NoError(c.t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+// run calls command with args and input as standard input, and returns standard output and error
+func (c *cli) run(command func([]string) error, input string, args ...string) (string, string, error) {
+	var out, errOut bytes.Buffer
+	in, o, e := stdin, stdout, stderr
+	defer func() { stdin, stdout, stderr = in, o, e }()
+	stdin, stdout, stderr = strings.NewReader(input), &out, &errOut
+
+	err := command(args)
+	return out.String(), errOut.String(), err
+}
+
+// testDocument is a -json document with the result left encoded
+type testDocument struct {
+	Schema  string          `json:"schema"`
+	Command string          `json:"command"`
+	OK      bool            `json:"ok"`
+	Result  json.RawMessage `json:"result"`
+	Error   *errorInfo      `json:"error"`
+}
+
+// runJSON runs command with -json, decodes the result of its document into result if it is not nil
+// and returns the document
+func (c *cli) runJSON(command func([]string) error, input string, result interface{}, args ...string) (*testDocument, error) {
+	out, _, err := c.run(command, input, append([]string{"-json"}, args...)...)
+
+	doc := &testDocument{}
+	require.NoError(c.t, json.Unmarshal([]byte(out), doc), out)
+	assert.Equal(c.t, OutputSchema, doc.Schema)
+	assert.Equal(c.t, err == nil, doc.OK)
+	if result != nil && len(doc.Result) > 0 {
+		require.NoError(c.t, json.Unmarshal(doc.Result, result))
+	}
+	return doc, err
+}
+
+func TestVectors(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+
+	file := filepath.Join(c.dir, "vector.json")
+	out, _, err := c.run(generate, "", "-password", "passw0rd", "-wrong", "wrong", "-rotate", "-o", file)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	var checks []*vectorCheck
+	_, err = c.runJSON(verify, "", &checks, file)
+	require.NoError(t, err)
+	require.Len(t, checks, 1)
+	assert.True(t, checks[0].OK)
+
+	broken := c.writeFile("broken.json", "{}")
+	out, _, err = c.run(verify, "", file, broken)
+	assert.EqualError(t, err, "1 of 2 vectors failed")
+	assert.Contains(t, out, "ok   "+file)
+	assert.Contains(t, out, "FAIL "+broken)
+
+	_, _, err = c.run(verify, "")
+	assert.Equal(t, exitUsage, exitCode(err))
+}
+
+func TestParseErrors(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+
+	tests := []struct {
+		name    string
+		command func([]string) error
+		args    []string
+		json    bool
+	}{
+		{"text", enroll, []string{"-unknown"}, false},
+		{"json before", enroll, []string{"-json", "-unknown"}, true},
+		{"json after", verifyPassword, []string{"-unknown", "-json"}, true},
+		{"json value", keygen, []string{"-version", "x", "--json=true"}, true},
+		{"json false", keygen, []string{"-version", "x", "-json=false"}, false},
+		{"json argument", validateTokens, []string{"-unknown", "--", "-json"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, errOut, err := c.run(test.command, "", test.args...)
+			require.Error(t, err)
+			assert.Equal(t, exitUsage, exitCode(err))
+			assert.Contains(t, errOut, "Usage of")
+			if !test.json {
+				assert.Empty(t, out)
+				return
+			}
+
+			doc := &testDocument{}
+			require.NoError(t, json.Unmarshal([]byte(out), doc), out)
+			assert.False(t, doc.OK)
+			assert.Equal(t, err.Error(), doc.Error.Message)
+		})
+	}
+
+	_, _, err := c.run(enroll, "", "-h")
+	assert.Equal(t, exitOK, exitCode(err))
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// OutputSchema identifies the documents written with -json. Fields are only added within a schema version
+const OutputSchema = "passw0rd.cli.v1"
+
+// Standard streams of the commands, tests replace them
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// Exit codes
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// document is written to standard output with -json, once per command
+type document struct {
+	Schema  string      `json:"schema"`
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *errorInfo  `json:"error,omitempty"`
+}
+
+// errorInfo describes an error with its SDK code
+type errorInfo struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+}
+
+func newErrorInfo(err error) *errorInfo {
+	if err == nil {
+		return nil
+	}
+	if d, ok := err.(*describedError); ok {
+		err = d.err
+	}
+	code := passw0rd.ErrorCode(err)
+	return &errorInfo{Message: err.Error(), Code: int(code), Name: code.String()}
+}
+
+// output writes the result of a command as text, or as a document with -json
+type output struct {
+	command string
+	json    bool
+}
+
+func newOutput(flags *flag.FlagSet, command string) *output {
+	o := &output{command: command}
+	flags.BoolVar(&o.json, "json", false, "write the result as a JSON document to standard output")
+	flags.SetOutput(stderr)
+	return o
+}
+
+// parse parses the command line into flags. Invalid flags are usage errors, written as a document
+// if -json is given anywhere in args, as parsing stops at the invalid flag
+func (o *output) parse(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err == nil || err == flag.ErrHelp {
+		return err
+	}
+	o.json = o.json || jsonRequested(args)
+	return o.done(nil, usageError(err.Error()))
+}
+
+// jsonRequested reports whether args contain a -json flag which is true
+func jsonRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg || len(arg)-len(name) > 2 {
+			continue
+		}
+		if name == "json" {
+			return true
+		}
+		if strings.HasPrefix(name, "json=") {
+			set, err := strconv.ParseBool(name[len("json="):])
+			return err == nil && set
+		}
+	}
+	return false
+}
+
+// Printf writes text output, which is left out with -json
+func (o *output) Printf(format string, args ...interface{}) {
+	if !o.json {
+		fmt.Fprintf(stdout, format, args...)
+	}
+}
+
+// done writes result and err as a document with -json and returns err for the exit code
+func (o *output) done(result interface{}, err error) error {
+	if !o.json {
+		return err
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(&document{
+		Schema:  OutputSchema,
+		Command: o.command,
+		OK:      err == nil,
+		Result:  result,
+		Error:   newErrorInfo(err),
+	}); encErr != nil && err == nil {
+		return encErr
+	}
+	return err
+}
+
+// usageError is a command line mistake, it exits with exitUsage
+type usageError string
+
+func (e usageError) Error() string {
+	return "usage: " + string(e)
+}
+
+// describedError adds the SDK error code to the message, so that support engineers can look it up
+type describedError struct {
+	err error
+}
+
+func (e *describedError) Error() string {
+	code := passw0rd.ErrorCode(e.err)
+	return fmt.Sprintf("%v (code %d %s)", e.err, code, code)
+}
+
+// Cause keeps the code available to passw0rd.ErrorCode
+func (e *describedError) Cause() error {
+	return e.err
+}
+
+func describe(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &describedError{err}
+}
+
+// exitCode returns the exit code of a command which returned err
+func exitCode(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	switch err.(type) {
+	case nil:
+		return exitOK
+	case usageError:
+		return exitUsage
+	}
+	return exitFailed
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/passw0rd/sdk-go/perf"
+)
+
+// perfResult is the result of perf compare
+type perfResult struct {
+	Deltas      []perf.Delta `json:"deltas"`
+	Regressions int          `json:"regressions"`
+}
+
+func comparePerf(args []string) error {
+	flags := flag.NewFlagSet("perf compare", flag.ContinueOnError)
+	var thresholds listFlag
+	flags.Var(&thresholds, "threshold", "unit=ratio regression threshold replacing the defaults, e.g. ns/op=0.05, repeatable")
+	out := newOutput(flags, "perf compare")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		return out.done(nil, usageError("passw0rd perf compare [flags] old.txt new.txt"))
+	}
+
+	limits := perf.DefaultThresholds
+	if len(thresholds) > 0 {
+		limits = perf.Thresholds{}
+		for _, t := range thresholds {
+			i := strings.LastIndexByte(t, '=')
+			if i < 1 {
+				return out.done(nil, usageError("-threshold unit=ratio"))
+			}
+			ratio, err := strconv.ParseFloat(t[i+1:], 64)
+			if err != nil || ratio < 0 {
+				return out.done(nil, usageError("-threshold unit=ratio with a non-negative ratio"))
+			}
+			limits[t[:i]] = ratio
+		}
+	}
+
+	old, err := perf.ParseFile(flags.Arg(0))
+	if err != nil {
+		return out.done(nil, err)
+	}
+	current, err := perf.ParseFile(flags.Arg(1))
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	deltas := perf.Compare(old, current, limits)
+	if len(deltas) == 0 {
+		return out.done(nil, fmt.Errorf("%s and %s have no benchmarks in common", flags.Arg(0), flags.Arg(1)))
+	}
+
+	res := &perfResult{Deltas: deltas, Regressions: len(perf.Regressions(deltas))}
+	if !out.json {
+		if err = perf.Format(stdout, deltas); err != nil {
+			return err
+		}
+	}
+	if res.Regressions > 0 {
+		return out.done(res, fmt.Errorf("%d measurements regressed", res.Regressions))
+	}
+	return out.done(res, nil)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparePerf(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+
+	old := c.writeFile("old.txt", "BenchmarkVerify-8 \t 1000 \t 1000 ns/op \t 100 B/op \t 2 allocs/op\n")
+	same := c.writeFile("same.txt", "BenchmarkVerify-8 \t 1000 \t 1020 ns/op \t 100 B/op \t 2 allocs/op\n")
+	slower := c.writeFile("slower.txt", "BenchmarkVerify-8 \t 1000 \t 1200 ns/op \t 100 B/op \t 3 allocs/op\n")
+	other := c.writeFile("other.txt", "BenchmarkOther-8 \t 1000 \t 1000 ns/op\n")
+
+	tests := []struct {
+		name        string
+		args        []string
+		deltas      int
+		regressions int
+		usage       bool
+	}{
+		{name: "same", args: []string{old, same}, deltas: 3},
+		{name: "slower", args: []string{old, slower}, deltas: 3, regressions: 2},
+		{name: "thresholds", args: []string{"-threshold", "ns/op=0.5", old, slower}, deltas: 3},
+		{name: "no common benchmarks", args: []string{old, other}},
+		{name: "invalid threshold", args: []string{"-threshold", "ns/op", old, slower}, usage: true},
+		{name: "one file", args: []string{old}, usage: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &perfResult{}
+			_, err := c.runJSON(comparePerf, "", res, test.args...)
+			assert.Equal(t, test.usage, exitCode(err) == exitUsage)
+			assert.Equal(t, test.deltas > 0 && test.regressions == 0, err == nil)
+			assert.Len(t, res.Deltas, test.deltas)
+			assert.Equal(t, test.regressions, res.Regressions)
+		})
+	}
+
+	out, _, err := c.run(comparePerf, "", old, slower)
+	require.Error(t, err)
+	assert.Contains(t, out, "BenchmarkVerify")
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// protocolFlags registers flags common to the protocol commands
+type protocolFlags struct {
+	config  *string
+	url     *string
+	debug   *bool
+	showKey *bool
+}
+
+func newProtocolFlags(flags *flag.FlagSet) *protocolFlags {
+	return &protocolFlags{
+		config:  flags.String("config", "", "JSON file with app_token, service_public_key, client_secret_key, update_token and url"),
+		url:     flags.String("url", "", "service URL, overrides the configuration"),
+		debug:   flags.Bool("debug", false, "dump protocol state and service traffic to standard error as JSON lines"),
+		showKey: flags.Bool("show-key", false, "print record encryption keys"),
+	}
+}
+
+func (f *protocolFlags) protocol() (*passw0rd.Protocol, error) {
+	cfg, err := loadConfig(*f.config)
+	if err != nil {
+		return nil, err
+	}
+	if *f.url != "" {
+		cfg.URL = *f.url
+	}
+
+	ctx, err := passw0rd.CreateContext(cfg.AppToken, cfg.ServicePublicKey, cfg.ClientSecretKey, cfg.UpdateToken)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := passw0rd.NewProtocol(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if *f.debug {
+		p.Debug, p.Logger = true, passw0rd.NewJSONLog(stderr)
+	}
+	if cfg.URL != "" {
+		p.APIClient = &passw0rd.APIClient{AppToken: p.AppToken, URL: cfg.URL}
+		p.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{Address: cfg.URL, Logger: p.Logger, Debug: p.Debug}
+	}
+	return p, nil
+}
+
+// enrollResult is the -json result of enroll
+type enrollResult struct {
+	Record  string `json:"record"`
+	Version uint32 `json:"version"`
+	Key     string `json:"key,omitempty"`
+}
+
+func enroll(args []string) error {
+	flags := flag.NewFlagSet("enroll", flag.ContinueOnError)
+	pf := newProtocolFlags(flags)
+	out := newOutput(flags, "enroll")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	password, err := readPassword(flags.Arg(0))
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	p, err := pf.protocol()
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	record, key, err := p.EnrollAccount(password)
+	if err != nil {
+		return out.done(nil, describe(err))
+	}
+
+	res := &enrollResult{Record: base64.StdEncoding.EncodeToString(record), Version: p.CurrentVersion()}
+	out.Printf("%s\n", res.Record)
+	if *pf.showKey {
+		res.Key = base64.StdEncoding.EncodeToString(key)
+		out.Printf("%s\n", res.Key)
+	}
+	return out.done(res, nil)
+}
+
+// verifyResult is the -json result of verify, Verified is false if the password is wrong
+type verifyResult struct {
+	RecordVersion  uint32 `json:"record_version"`
+	CurrentVersion uint32 `json:"current_version"`
+	Verified       bool   `json:"verified"`
+	Key            string `json:"key,omitempty"`
+}
+
+func verifyPassword(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	pf := newProtocolFlags(flags)
+	out := newOutput(flags, "verify")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 {
+		return out.done(nil, usageError("passw0rd verify [flags] record [password]"))
+	}
+
+	record, err := base64.StdEncoding.DecodeString(flags.Arg(0))
+	if err != nil {
+		return out.done(nil, fmt.Errorf("invalid record: %v", err))
+	}
+	password, err := readPassword(flags.Arg(1))
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	p, err := pf.protocol()
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	version, _, err := passw0rd.UnmarshalRecord(record)
+	if err != nil {
+		return out.done(nil, describe(err))
+	}
+	res := &verifyResult{RecordVersion: version, CurrentVersion: p.CurrentVersion()}
+	out.Printf("record version %d, current version %d\n", res.RecordVersion, res.CurrentVersion)
+
+	key, err := p.VerifyPassword(password, record)
+	if err != nil {
+		return out.done(res, describe(err))
+	}
+
+	res.Verified = true
+	out.Printf("ok\n")
+	if *pf.showKey {
+		res.Key = base64.StdEncoding.EncodeToString(key)
+		out.Printf("%s\n", res.Key)
+	}
+	return out.done(res, nil)
+}
+
+// updateResult is the -json result of update-record, records keep the order of the input
+type updateResult struct {
+	Records []*updatedRecord `json:"records"`
+	Failed  int              `json:"failed"`
+}
+
+// updatedRecord is an updated record, or the record itself if it is up to date
+type updatedRecord struct {
+	Record  string     `json:"record,omitempty"`
+	Updated bool       `json:"updated"`
+	Error   *errorInfo `json:"error,omitempty"`
+}
+
+func updateRecord(args []string) error {
+	flags := flag.NewFlagSet("update-record", flag.ContinueOnError)
+	pf := newProtocolFlags(flags)
+	out := newOutput(flags, "update-record")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	records := flags.Args()
+	if len(records) == 0 {
+		lines, err := readLines(stdin)
+		if err != nil {
+			return out.done(nil, err)
+		}
+		records = lines
+	}
+
+	p, err := pf.protocol()
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	res := &updateResult{Records: []*updatedRecord{}}
+	for i, encoded := range records {
+		updated, err := update(p, encoded)
+		res.Records = append(res.Records, updated)
+		if err != nil {
+			res.Failed++
+			updated.Error = newErrorInfo(err)
+			fmt.Fprintf(stderr, "record %d: %v\n", i+1, err)
+			out.Printf("\n")
+			continue
+		}
+		out.Printf("%s\n", updated.Record)
+	}
+
+	if res.Failed > 0 {
+		return out.done(res, fmt.Errorf("%d of %d records failed", res.Failed, len(records)))
+	}
+	return out.done(res, nil)
+}
+
+// update returns the updated record, or the record itself if it is up to date
+func update(p *passw0rd.Protocol, encoded string) (*updatedRecord, error) {
+	record, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return &updatedRecord{}, fmt.Errorf("invalid record: %v", err)
+	}
+
+	updated, err := p.UpdateEnrollmentRecord(record)
+	if err != nil {
+		return &updatedRecord{}, describe(err)
+	}
+	if updated == nil {
+		return &updatedRecord{Record: encoded}, nil
+	}
+	return &updatedRecord{Record: base64.StdEncoding.EncodeToString(updated), Updated: true}, nil
+}
+
+// readPassword returns arg, or the first line of standard input if arg is empty
+func readPassword(arg string) (string, error) {
+	if arg != "" {
+		return arg, nil
+	}
+
+	lines, err := readLines(stdin)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no password given")
+	}
+	return lines[0], nil
+}
+
+// readLines returns non-empty lines of r without line endings
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enrollRecord enrolls password with the CLI and returns the base64 record
+func (c *cli) enrollRecord(password string) string {
+	res := &enrollResult{}
+	_, err := c.runJSON(enroll, password+"\n", res, "-config", c.config)
+	require.NoError(c.t, err)
+	return res.Record
+}
+
+func TestEnroll(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+		lines int
+		err   string
+	}{
+		{name: "stdin", input: "passw0rd\n", lines: 1},
+		{name: "argument", args: []string{"passw0rd"}, lines: 1},
+		{name: "show key", input: "passw0rd\r\n", args: []string{"-show-key"}, lines: 2},
+		{name: "no password", err: "no password given"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, _, err := c.run(enroll, test.input, append([]string{"-config", c.config}, test.args...)...)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			require.Len(t, lines, test.lines)
+			record, err := base64.StdEncoding.DecodeString(lines[0])
+			require.NoError(t, err)
+			version, _, err := passw0rd.UnmarshalRecord(record)
+			require.NoError(t, err)
+			assert.Equal(t, uint32(1), version)
+		})
+	}
+
+	res := &enrollResult{}
+	doc, err := c.runJSON(enroll, "passw0rd\n", res, "-config", c.config, "-show-key")
+	require.NoError(t, err)
+	assert.Equal(t, "enroll", doc.Command)
+	assert.Equal(t, uint32(1), res.Version)
+	assert.NotEmpty(t, res.Record)
+	assert.NotEmpty(t, res.Key)
+
+	_, err = c.runJSON(enroll, "passw0rd\n", nil, "-config", c.writeFile("invalid.json", "{"))
+	assert.Error(t, err)
+}
+
+func TestVerifyPassword(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	record := c.enrollRecord("passw0rd")
+
+	tests := []struct {
+		name     string
+		input    string
+		args     []string
+		verified bool
+		code     passw0rd.Code
+		usage    bool
+	}{
+		{name: "argument", args: []string{record, "passw0rd"}, verified: true},
+		{name: "stdin", input: "passw0rd\n", args: []string{record}, verified: true},
+		{name: "wrong password", args: []string{record, "wrong"}, code: passw0rd.CodeInvalidPassword},
+		{name: "invalid base64", args: []string{"!", "passw0rd"}},
+		{name: "no record", usage: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &verifyResult{}
+			doc, err := c.runJSON(verifyPassword, test.input, res, append([]string{"-config", c.config}, test.args...)...)
+			assert.Equal(t, test.verified, res.Verified)
+			if test.verified {
+				require.NoError(t, err)
+				assert.Equal(t, uint32(1), res.RecordVersion)
+				assert.Equal(t, uint32(1), res.CurrentVersion)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, test.usage, exitCode(err) == exitUsage)
+			if test.code != 0 {
+				assert.Equal(t, int(test.code), doc.Error.Code)
+			}
+		})
+	}
+
+	out, _, err := c.run(verifyPassword, "", "-config", c.config, "-show-key", record, "passw0rd")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"record version 1, current version 1", "ok"}, lines[:2])
+}
+
+func TestUpdateRecord(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	record := c.enrollRecord("passw0rd")
+
+	token, err := c.svc.Rotate()
+	require.NoError(t, err)
+	config := c.writeConfig("rotated.json", token)
+
+	res := &updateResult{}
+	_, err = c.runJSON(updateRecord, record+"\n\n", res, "-config", config)
+	require.NoError(t, err)
+	require.Len(t, res.Records, 1)
+	assert.True(t, res.Records[0].Updated)
+	updated := res.Records[0].Record
+
+	out, _, err := c.run(verifyPassword, "", "-config", config, updated, "passw0rd")
+	require.NoError(t, err)
+	assert.Contains(t, out, "record version 2, current version 2")
+
+	res = &updateResult{}
+	_, err = c.runJSON(updateRecord, "", res, "-config", config, updated, "AAAA")
+	assert.EqualError(t, err, "1 of 2 records failed")
+	require.Len(t, res.Records, 2)
+	assert.Equal(t, &updatedRecord{Record: updated}, res.Records[0])
+	assert.Equal(t, 1, res.Failed)
+	assert.NotNil(t, res.Records[1].Error)
+
+	out, errOut, err := c.run(updateRecord, record+"\n!\n", "-config", config)
+	assert.Error(t, err)
+	assert.Equal(t, updated+"\n\n", out)
+	assert.Contains(t, errOut, "record 2: invalid record")
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/sdk-go"
+)
+
+// recordResult is the -json result of record inspect. ConfiguredVersion is set with -config,
+// NeedsUpdate when the record is behind it
+type recordResult struct {
+	Size              int    `json:"size"`
+	KeyVersion        uint32 `json:"key_version"`
+	PepperVersion     uint32 `json:"pepper_version"`
+	EnrollmentSize    int    `json:"enrollment_record_size"`
+	UnknownFieldsSize int    `json:"unknown_fields_size"`
+	ConfiguredVersion uint32 `json:"configured_version,omitempty"`
+	NeedsUpdate       bool   `json:"needs_update,omitempty"`
+}
+
+// inspectRecord prints the structure of a record without its cryptographic contents. With -config
+// it also tells whether the configured keys are able to verify the record
+func inspectRecord(args []string) error {
+	flags := flag.NewFlagSet("record inspect", flag.ContinueOnError)
+	config := flags.String("config", "", "JSON file with credentials to check the record version against, optional")
+	out := newOutput(flags, "record inspect")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	res, err := inspect(flags.Arg(0), *config, out)
+	return out.done(res, err)
+}
+
+func inspect(arg, config string, out *output) (*recordResult, error) {
+	encoded, err := readPassword(arg)
+	if err != nil {
+		return nil, usageError("passw0rd record inspect [flags] record")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+
+	record := &passw0rd.DatabaseRecord{}
+	if err = proto.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("not a passw0rd record (%d bytes): %v", len(data), err)
+	}
+	res := &recordResult{
+		Size:              len(data),
+		KeyVersion:        record.Version,
+		PepperVersion:     record.PepperVersion,
+		EnrollmentSize:    len(record.Record),
+		UnknownFieldsSize: len(record.XXX_unrecognized),
+	}
+
+	if !out.json {
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "size\t%d bytes\n", res.Size)
+		fmt.Fprintf(w, "key version\t%d\n", res.KeyVersion)
+		if res.PepperVersion == 0 {
+			fmt.Fprintf(w, "pepper version\tnone\n")
+		} else {
+			fmt.Fprintf(w, "pepper version\t%d\n", res.PepperVersion)
+		}
+		fmt.Fprintf(w, "enrollment record\t%d bytes\n", res.EnrollmentSize)
+		if res.UnknownFieldsSize > 0 {
+			fmt.Fprintf(w, "unknown fields\t%d bytes, written by a newer SDK\n", res.UnknownFieldsSize)
+		}
+		if err = w.Flush(); err != nil {
+			return res, err
+		}
+	}
+
+	if record.Version < 1 {
+		return res, fmt.Errorf("invalid record: key version must be positive")
+	}
+	if len(record.Record) == 0 {
+		return res, fmt.Errorf("invalid record: enrollment record is empty")
+	}
+	if config == "" {
+		return res, nil
+	}
+
+	cfg, err := loadConfig(config)
+	if err != nil {
+		return res, err
+	}
+	ctx, err := passw0rd.CreateContext(cfg.AppToken, cfg.ServicePublicKey, cfg.ClientSecretKey, cfg.UpdateToken)
+	if err != nil {
+		return res, err
+	}
+
+	current := ctx.Version
+	res.ConfiguredVersion = current
+	_, known := ctx.PHEClients[record.Version]
+	switch {
+	case record.Version > current:
+		return res, fmt.Errorf("record key version %d is newer than the configured version %d, the update token is missing from the configuration", record.Version, current)
+	case !known:
+		return res, fmt.Errorf("record key version %d is older than the keys configured for versions %d and %d, it must have been skipped by a rotation", record.Version, current-1, current)
+	case record.Version < current:
+		res.NeedsUpdate = true
+		out.Printf("record key version %d is behind the configured version %d, update it with passw0rd update-record\n", record.Version, current)
+	default:
+		out.Printf("record key version matches the configured version %d\n", current)
+	}
+	if record.PepperVersion != 0 {
+		out.Printf("record is peppered, verification needs the application pepper of its version\n")
+	}
+	return res, nil
+}
+
+// lintResult is the -json result of record lint
+type lintResult struct {
+	Records  []*lintedRecord `json:"records"`
+	Invalid  int             `json:"invalid"`
+	Warnings int             `json:"warnings"`
+}
+
+// lintedRecord is a checked record, ID is set for records read with -i
+type lintedRecord struct {
+	ID string `json:"id,omitempty"`
+	*passw0rd.RecordLint
+}
+
+// lintRecords checks records against the record interchange format. Records are
+// given as arguments, base64 lines on standard input or with -i as an NDJSON or CSV file
+func lintRecords(args []string) error {
+	flags := flag.NewFlagSet("record lint", flag.ContinueOnError)
+	var (
+		input  = flags.String("i", "", "NDJSON or CSV record file, plain or gzip compressed, read instead of base64 lines")
+		format = flags.String("format", "", "ndjson or csv, detected from the -i file name if empty")
+		strict = flags.Bool("strict", false, "fail on warnings as well as on errors")
+	)
+	out := newOutput(flags, "record lint")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	res := &lintResult{Records: []*lintedRecord{}}
+	var err error
+	if *input != "" {
+		err = lintFile(res, *input, *format)
+	} else {
+		records := flags.Args()
+		if len(records) == 0 {
+			if records, err = readLines(stdin); err != nil {
+				return out.done(nil, err)
+			}
+		}
+		for _, encoded := range records {
+			res.add("", passw0rd.LintEncodedRecord(encoded))
+		}
+	}
+	if err != nil {
+		return out.done(res, err)
+	}
+
+	for i, r := range res.Records {
+		name := r.ID
+		if name == "" {
+			name = fmt.Sprint(i + 1)
+		}
+		for _, issue := range r.Issues {
+			out.Printf("record %s: %s\n", name, issue)
+		}
+	}
+	out.Printf("%d records, %d invalid, %d with warnings, schema version %d\n", len(res.Records), res.Invalid, res.Warnings, passw0rd.RecordSchemaVersion)
+
+	switch {
+	case res.Invalid > 0:
+		return out.done(res, fmt.Errorf("%d of %d records are invalid", res.Invalid, len(res.Records)))
+	case *strict && res.Warnings > 0:
+		return out.done(res, fmt.Errorf("%d of %d records have warnings", res.Warnings, len(res.Records)))
+	}
+	return out.done(res, nil)
+}
+
+func lintFile(res *lintResult, file, format string) error {
+	kind, err := fileFormat(file, format)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if r, err = decompress(r); err != nil {
+		return err
+	}
+
+	source := newRecordReader(kind, r)
+	ctx := context.Background()
+	for {
+		id, record, err := source.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		res.add(id, passw0rd.LintRecord(record))
+	}
+}
+
+func (res *lintResult) add(id string, l *passw0rd.RecordLint) {
+	res.Records = append(res.Records, &lintedRecord{ID: id, RecordLint: l})
+	switch {
+	case !l.Valid():
+		res.Invalid++
+	case len(l.Issues) > 0:
+		res.Warnings++
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectRecord(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	record := c.enrollRecord("passw0rd")
+
+	token, err := c.svc.Rotate()
+	require.NoError(t, err)
+	rotated := c.writeConfig("rotated.json", token)
+
+	tests := []struct {
+		name        string
+		input       string
+		args        []string
+		configured  uint32
+		needsUpdate bool
+		err         string
+	}{
+		{name: "argument", args: []string{record}},
+		{name: "stdin", input: record + "\n"},
+		{name: "current", args: []string{"-config", c.config, record}, configured: 1},
+		{name: "behind", args: []string{"-config", rotated, record}, configured: 2, needsUpdate: true},
+		{name: "invalid base64", args: []string{"!"}, err: "invalid base64"},
+		{name: "no record", err: "usage: "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &recordResult{}
+			_, err := c.runJSON(inspectRecord, test.input, res, test.args...)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint32(1), res.KeyVersion)
+			assert.NotZero(t, res.EnrollmentSize)
+			assert.Equal(t, test.configured, res.ConfiguredVersion)
+			assert.Equal(t, test.needsUpdate, res.NeedsUpdate)
+		})
+	}
+
+	out, _, err := c.run(inspectRecord, "", "-config", rotated, record)
+	require.NoError(t, err)
+	assert.Regexp(t, `key version +1\n`, out)
+	assert.Regexp(t, `pepper version +none\n`, out)
+	assert.Contains(t, out, "behind the configured version 2")
+}
+
+// validRecord returns the valid record fixture of the SDK, see testdata/records/README.md
+func validRecord(t *testing.T) string {
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", "records", "valid.json"))
+	require.NoError(t, err)
+	var fixture struct {
+		Record string `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(data, &fixture))
+	return fixture.Record
+}
+
+func TestLintRecords(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	record := validRecord(t)
+
+	ndjson := c.writeFile("records.ndjson", `{"id":"1","record":"`+record+`"}`+"\n")
+	tests := []struct {
+		name    string
+		input   string
+		args    []string
+		records int
+		invalid int
+	}{
+		{name: "argument", args: []string{record}, records: 1},
+		{name: "stdin", input: record + "\n" + record + "\n", records: 2},
+		{name: "file", args: []string{"-i", ndjson}, records: 1},
+		{name: "invalid", args: []string{record, "AAAA"}, records: 2, invalid: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &lintResult{}
+			_, err := c.runJSON(lintRecords, test.input, res, test.args...)
+			assert.Equal(t, test.invalid > 0, err != nil)
+			assert.Len(t, res.Records, test.records)
+			assert.Equal(t, test.invalid, res.Invalid)
+		})
+	}
+
+	out, _, err := c.run(lintRecords, "", "-i", ndjson)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "1 records, 0 invalid"), out)
+}
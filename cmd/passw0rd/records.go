@@ -0,0 +1,414 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// gzipMagic starts gzip streams
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func exportRecords(args []string) error {
+	flags := flag.NewFlagSet("records export", flag.ContinueOnError)
+	df := newDatabaseFlags(flags)
+	var (
+		output   = flags.String("o", "", "output file created with owner only permissions, standard output if empty")
+		format   = flags.String("format", "", "ndjson or csv, detected from the output file name if empty")
+		compress = flags.Bool("gzip", false, "compress with gzip, set for .gz output file names")
+		resume   = flags.Bool("resume", false, "continue an interrupted export, appending to the output file")
+		interval = flags.Duration("progress", 5*time.Second, "progress report interval")
+	)
+	out := newOutput(flags, "records export")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if *df.dsn == "" {
+		return out.done(nil, usageError("passw0rd records export -dsn DSN [-o file] [flags]"))
+	}
+	if *resume && *output == "" {
+		return out.done(nil, usageError("-resume needs an output file"))
+	}
+	if out.json && *output == "" {
+		return out.done(nil, usageError("-json needs an output file"))
+	}
+	kind, err := fileFormat(*output, *format)
+	if err != nil {
+		return out.done(nil, err)
+	}
+	*compress = *compress || strings.HasSuffix(*output, ".gz")
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	db, store, err := df.open(ctx)
+	if err != nil {
+		return out.done(nil, err)
+	}
+	defer db.Close()
+
+	exported, appending := 0, false
+	if *resume {
+		lastID, n, err := resumePoint(*output, kind, *compress)
+		if err != nil {
+			return out.done(nil, fmt.Errorf("cannot resume %s: %v", *output, err))
+		}
+		if n > 0 {
+			store.lastID, exported, appending = &lastID, n, true
+			fmt.Fprintf(stderr, "resuming after record %s, %d records exported before\n", lastID, n)
+		}
+	}
+
+	var w io.Writer = stdout
+	if *output != "" {
+		mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if *resume {
+			mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(*output, mode, 0600)
+		if os.IsExist(err) {
+			return out.done(nil, fmt.Errorf("%s exists, continue it with -resume or choose another file", *output))
+		}
+		if err != nil {
+			return out.done(nil, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var zw *gzip.Writer
+	if *compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	rw := newRecordWriter(kind, w, appending)
+
+	var last time.Time
+	var lastID string
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		var id string
+		var record []byte
+		if id, record, err = store.Next(ctx); err != nil {
+			break
+		}
+		if err = rw.Write(id, record); err != nil {
+			break
+		}
+		exported++
+		lastID = id
+
+		if time.Since(last) >= *interval {
+			last = time.Now()
+			fmt.Fprintf(stderr, "exported %d records\n", exported)
+		}
+	}
+
+	// finish the file in any case, so that it can be resumed
+	if flushErr := rw.Flush(); flushErr != nil && err == io.EOF {
+		err = flushErr
+	}
+	if zw != nil {
+		if closeErr := zw.Close(); closeErr != nil && err == io.EOF {
+			err = closeErr
+		}
+	}
+
+	fmt.Fprintf(stderr, "exported %d records\n", exported)
+	res := &transferResult{Records: exported, LastID: lastID}
+	if err != io.EOF {
+		if *output != "" {
+			fmt.Fprintf(stderr, "stopped after record %q, continue with -resume\n", lastID)
+		}
+		return out.done(res, err)
+	}
+	return out.done(res, nil)
+}
+
+func importRecords(args []string) error {
+	flags := flag.NewFlagSet("records import", flag.ContinueOnError)
+	df := newDatabaseFlags(flags)
+	var (
+		input      = flags.String("i", "", "input file, plain or gzip compressed, standard input if empty")
+		format     = flags.String("format", "", "ndjson or csv, detected from the input file name if empty")
+		startAfter = flags.String("start-after", "", "skip records up to this id, to continue an interrupted import")
+		insert     = flags.Bool("insert", false, "insert rows for records whose id is not in the table, other columns must have defaults")
+		dryRun     = flags.Bool("dry-run", false, "read the input without updating the table")
+		interval   = flags.Duration("progress", 5*time.Second, "progress report interval")
+	)
+	out := newOutput(flags, "records import")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if *df.dsn == "" {
+		return out.done(nil, usageError("passw0rd records import -dsn DSN [-i file] [flags]"))
+	}
+	kind, err := fileFormat(*input, *format)
+	if err != nil {
+		return out.done(nil, err)
+	}
+
+	var r io.Reader = stdin
+	if *input != "" && *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return out.done(nil, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	if r, err = decompress(r); err != nil {
+		return out.done(nil, err)
+	}
+	source := newRecordReader(kind, r)
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	db, store, err := df.open(ctx)
+	if err != nil {
+		return out.done(nil, err)
+	}
+	defer db.Close()
+	store.dryRun = *dryRun
+
+	var last time.Time
+	var res transferResult
+	skipping := *startAfter != ""
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		var id string
+		var record []byte
+		if id, record, err = source.Next(ctx); err != nil {
+			break
+		}
+		if skipping {
+			skipping = id != *startAfter
+			continue
+		}
+
+		var put putResult
+		if put, err = store.put(ctx, id, record, *insert); err != nil {
+			err = fmt.Errorf("record %s: %v", id, err)
+			break
+		}
+		switch put {
+		case putUpdated:
+			res.Records++
+		case putInserted:
+			res.Records++
+			res.Inserted++
+		case putUnchanged:
+			res.Unchanged++
+		case putNotFound:
+			res.NotFound++
+		}
+		res.LastID = id
+
+		if time.Since(last) >= *interval {
+			last = time.Now()
+			reportImport(&res)
+		}
+	}
+
+	reportImport(&res)
+	if err != io.EOF {
+		if res.LastID != "" {
+			fmt.Fprintf(stderr, "stopped after record %q, continue with -start-after\n", res.LastID)
+		}
+		return out.done(&res, err)
+	}
+	if skipping {
+		return out.done(&res, fmt.Errorf("record %q of -start-after not found in the input", *startAfter))
+	}
+	if res.NotFound > 0 {
+		fmt.Fprintf(stderr, "%d records have no row in the table, insert them with -insert\n", res.NotFound)
+	}
+	return out.done(&res, nil)
+}
+
+func reportImport(res *transferResult) {
+	fmt.Fprintf(stderr, "imported %d records (%d inserted), %d unchanged, %d not found\n",
+		res.Records, res.Inserted, res.Unchanged, res.NotFound)
+}
+
+// transferResult is the -json result of records export and import. LastID is the last record
+// written, to continue with -resume or -start-after. Records counts imported records including
+// Inserted ones, Unchanged records already had the value and NotFound records had no row
+type transferResult struct {
+	Records   int    `json:"records"`
+	Inserted  int    `json:"inserted,omitempty"`
+	Unchanged int    `json:"unchanged,omitempty"`
+	NotFound  int    `json:"not_found,omitempty"`
+	LastID    string `json:"last_id"`
+}
+
+// fileFormat returns format, or the format of file detected from its name
+func fileFormat(file, format string) (string, error) {
+	switch format {
+	case "ndjson", "csv":
+		return format, nil
+	case "":
+		if strings.HasSuffix(strings.TrimSuffix(file, ".gz"), ".csv") {
+			return "csv", nil
+		}
+		return "ndjson", nil
+	}
+	return "", fmt.Errorf("unknown format %q", format)
+}
+
+func newRecordWriter(format string, w io.Writer, appending bool) passw0rd.RecordWriter {
+	if format == "csv" {
+		cw := passw0rd.NewCSVRecordWriter(w)
+		cw.SkipHeader = appending
+		return cw
+	}
+	return passw0rd.NewNDJSONRecordWriter(w)
+}
+
+func newRecordReader(format string, r io.Reader) passw0rd.RecordSource {
+	if format == "csv" {
+		return passw0rd.NewCSVRecordReader(r)
+	}
+	return passw0rd.NewNDJSONRecordReader(r)
+}
+
+// decompress returns a reader of r which decompresses gzip streams
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// resumePoint returns the last ID and number of records in an export file. A partially written last line
+// of an uncompressed file is removed, compressed files must have been finished, e.g. by an interrupt
+func resumePoint(file, format string, compressed bool) (lastID string, n int, err error) {
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(gzipMagic))
+	if _, err = io.ReadFull(f, magic); err == io.EOF {
+		return "", 0, nil
+	}
+	if bytes.Equal(magic, gzipMagic) != compressed {
+		return "", 0, fmt.Errorf("compression does not match -gzip")
+	}
+
+	if !compressed {
+		if err = truncatePartialLine(f); err != nil {
+			return "", 0, err
+		}
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	r, err := decompress(f)
+	if err != nil {
+		return "", 0, err
+	}
+	source := newRecordReader(format, r)
+	for {
+		id, _, err := source.Next(context.Background())
+		if err == io.EOF {
+			return lastID, n, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		lastID, n = id, n+1
+	}
+}
+
+// truncatePartialLine removes data following the last line break of f
+func truncatePartialLine(f *os.File) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err = f.ReadAt(chunk, start); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			if complete := start + int64(i) + 1; complete < size {
+				return f.Truncate(complete)
+			}
+			return nil
+		}
+		end = start
+	}
+	return f.Truncate(0)
+}
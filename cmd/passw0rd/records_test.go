@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readRecordFile returns the records of an export file by ID
+func readRecordFile(t *testing.T, file, format string) map[string][]byte {
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := decompress(f)
+	require.NoError(t, err)
+
+	records := map[string][]byte{}
+	source := newRecordReader(format, r)
+	for {
+		id, record, err := source.Next(context.Background())
+		if err == io.EOF {
+			return records
+		}
+		require.NoError(t, err)
+		records[id] = record
+	}
+}
+
+func TestExportRecords(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	records := c.enrollRecords(3)
+	rows := map[string][]byte{"1": records[0], "2": records[1], "3": records[2], "4": nil}
+	dsn, _ := newSQLTable(t, rows)
+
+	tests := []struct {
+		name   string
+		file   string
+		format string
+	}{
+		{"ndjson", "records.ndjson", "ndjson"},
+		{"csv", "records.csv", "csv"},
+		{"gzip", "records.ndjson.gz", "ndjson"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(c.dir, test.file)
+			res := &transferResult{}
+			_, err := c.runJSON(exportRecords, "", res, "-driver", "fakesql", "-dsn", dsn, "-o", file, "-batch", "2")
+			require.NoError(t, err)
+			assert.Equal(t, &transferResult{Records: 3, LastID: "3"}, res)
+			assert.Equal(t, map[string][]byte{"1": records[0], "2": records[1], "3": records[2]}, readRecordFile(t, file, test.format))
+
+			_, _, err = c.run(exportRecords, "", "-driver", "fakesql", "-dsn", dsn, "-o", file)
+			assert.Error(t, err, "existing files are not overwritten")
+		})
+	}
+
+	// an export interrupted after the first record, with a partially written second line
+	file := filepath.Join(c.dir, "resumed.ndjson")
+	buf := &bytes.Buffer{}
+	w := passw0rd.NewNDJSONRecordWriter(buf)
+	require.NoError(t, w.Write("1", records[0]))
+	require.NoError(t, w.Flush())
+	require.NoError(t, ioutil.WriteFile(file, append(buf.Bytes(), `{"id":"2","rec`...), 0600))
+
+	res := &transferResult{}
+	_, err := c.runJSON(exportRecords, "", res, "-driver", "fakesql", "-dsn", dsn, "-o", file, "-resume")
+	require.NoError(t, err)
+	assert.Equal(t, &transferResult{Records: 3, LastID: "3"}, res)
+	assert.Len(t, readRecordFile(t, file, "ndjson"), 3)
+
+	out, _, err := c.run(exportRecords, "", "-driver", "fakesql", "-dsn", dsn)
+	require.NoError(t, err)
+	assert.Equal(t, 3, bytes.Count([]byte(out), []byte("\n")))
+
+	for _, args := range [][]string{{}, {"-dsn", dsn, "-resume"}, {"-dsn", dsn, "-json"}} {
+		_, _, err = c.run(exportRecords, "", args...)
+		assert.Equal(t, exitUsage, exitCode(err), "%v", args)
+	}
+}
+
+func TestImportRecords(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	records := c.enrollRecords(4)
+	dsn, table := newSQLTable(t, map[string][]byte{"1": []byte("old"), "2": []byte("old"), "3": nil, "5": records[3]})
+
+	buf := &bytes.Buffer{}
+	w := passw0rd.NewCSVRecordWriter(buf)
+	// 5 has its record already
+	for i, record := range [][]byte{records[0], records[1], records[2], records[3], records[3]} {
+		require.NoError(t, w.Write(fmt.Sprint(i+1), record))
+	}
+	require.NoError(t, w.Flush())
+	file := c.writeFile("records.csv", buf.String())
+
+	res := &transferResult{}
+	_, err := c.runJSON(importRecords, "", res, "-driver", "fakesql", "-dsn", dsn, "-i", file, "-dry-run")
+	require.NoError(t, err)
+	assert.Equal(t, 5, res.Records)
+	assert.Equal(t, "old", string(table.get("1")))
+
+	res = &transferResult{}
+	_, errOut, err := c.run(importRecords, "", "-driver", "fakesql", "-dsn", dsn, "-i", file, "-start-after", "1")
+	require.NoError(t, err)
+	assert.Contains(t, errOut, "imported 2 records (0 inserted), 1 unchanged, 1 not found\n")
+	assert.Contains(t, errOut, "1 records have no row in the table, insert them with -insert\n")
+	assert.Equal(t, "old", string(table.get("1")))
+	assert.Equal(t, records[1], table.get("2"))
+	assert.Equal(t, records[2], table.get("3"))
+	assert.Nil(t, table.get("4"))
+
+	_, err = c.runJSON(importRecords, buf.String(), res, "-driver", "fakesql", "-dsn", dsn, "-format", "csv", "-insert")
+	require.NoError(t, err)
+	assert.Equal(t, &transferResult{Records: 2, Inserted: 1, Unchanged: 3, LastID: "5"}, res)
+	assert.Equal(t, records[0], table.get("1"))
+	assert.Equal(t, records[3], table.get("4"))
+
+	_, err = c.runJSON(importRecords, "", nil, "-driver", "fakesql", "-dsn", dsn, "-i", file, "-start-after", "9")
+	assert.EqualError(t, err, `record "9" of -start-after not found in the input`)
+	_, _, err = c.run(importRecords, "")
+	assert.Equal(t, exitUsage, exitCode(err))
+}
@@ -0,0 +1,397 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/passw0rd/sdk-go"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// databaseFlags registers flags of commands working on a table of records
+type databaseFlags struct {
+	dsn      *string
+	driver   *string
+	table    *string
+	idColumn *string
+	column   *string
+	encoded  *bool
+	batch    *int
+}
+
+func newDatabaseFlags(flags *flag.FlagSet) *databaseFlags {
+	return &databaseFlags{
+		dsn:      flags.String("dsn", "", "database DSN, postgres://... for Postgres or user:password@tcp(host)/db for MySQL"),
+		driver:   flags.String("driver", "", "database driver, postgres or mysql, detected from the DSN if empty"),
+		table:    flags.String("table", "users", "table with records"),
+		idColumn: flags.String("id-column", "id", "unique column used to page through the table"),
+		column:   flags.String("record-column", "passw0rd_record", "record column"),
+		encoded:  flags.Bool("base64", false, "records are stored as base64 text instead of bytes"),
+		batch:    flags.Int("batch", 1000, "number of records read per query"),
+	}
+}
+
+// open connects to the database and returns a store of its records
+func (f *databaseFlags) open(ctx context.Context) (*sql.DB, *sqlStore, error) {
+	for _, name := range []string{*f.table, *f.idColumn, *f.column} {
+		if !identifier.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid identifier %q", name)
+		}
+	}
+
+	driver := *f.driver
+	if driver == "" {
+		driver = "mysql"
+		if strings.HasPrefix(*f.dsn, "postgres://") || strings.HasPrefix(*f.dsn, "postgresql://") {
+			driver = "postgres"
+		}
+	}
+
+	db, err := sql.Open(driver, *f.dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	store := newSQLStore(db, driver, *f.table, *f.idColumn, *f.column, *f.batch)
+	store.base64 = *f.encoded
+	return db, store, nil
+}
+
+// interruptible returns a context which is canceled on interrupt
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupt)
+	}()
+	return ctx, cancel
+}
+
+func rotate(args []string) error {
+	flags := flag.NewFlagSet("rotate", flag.ContinueOnError)
+	df := newDatabaseFlags(flags)
+	var (
+		token    = flags.String("token", "", "UT.<version>.<base64> update token")
+		workers  = flags.Int("workers", 0, "number of records updated concurrently, sized from available CPUs if 0")
+		dryRun   = flags.Bool("dry-run", false, "update records in memory without saving them")
+		interval = flags.Duration("progress", 5*time.Second, "progress report interval")
+	)
+	out := newOutput(flags, "rotate")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	if *df.dsn == "" || *token == "" {
+		return out.done(nil, usageError("passw0rd rotate -dsn DSN -token UT.... [flags]"))
+	}
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	db, store, err := df.open(ctx)
+	if err != nil {
+		return out.done(nil, err)
+	}
+	defer db.Close()
+	store.dryRun = *dryRun
+
+	var last time.Time
+	m := &passw0rd.Migrator{
+		UpdateToken: *token,
+		Workers:     *workers,
+		// sqlStore.Save does not keep records once ExecContext returns
+		ReuseBuffers: true,
+		Progress: func(p passw0rd.MigrationProgress) {
+			if time.Since(last) >= *interval {
+				last = time.Now()
+				report(p)
+			}
+		},
+		OnError: func(id string, err error) {
+			fmt.Fprintf(stderr, "record %s: %v\n", id, describe(err))
+		},
+	}
+
+	progress, err := m.Migrate(ctx, store, store)
+	report(progress)
+	res := &migrationResult{
+		Version:        progress.Version,
+		Processed:      progress.Processed,
+		Migrated:       progress.Migrated,
+		UpToDate:       progress.UpToDate,
+		Failed:         progress.Failed,
+		Changed:        progress.Changed,
+		ElapsedSeconds: progress.Elapsed.Seconds(),
+		Complete:       progress.Complete() && !*dryRun,
+	}
+	if err != nil {
+		return out.done(res, describe(err))
+	}
+	if progress.Failed > 0 {
+		return out.done(res, fmt.Errorf("%d of %d records failed", progress.Failed, progress.Processed))
+	}
+	if res.Complete {
+		out.Printf("every record has key version %d, earlier versions can be released with Protocol.ReleaseMigrated\n", progress.Version)
+	}
+	return out.done(res, nil)
+}
+
+// migrationResult is the -json result of rotate. Complete is set when every record was saved with
+// the key version of the token, so that no records of earlier versions remain
+type migrationResult struct {
+	Version        uint32  `json:"version"`
+	Processed      int     `json:"processed"`
+	Migrated       int     `json:"migrated"`
+	UpToDate       int     `json:"up_to_date"`
+	Failed         int     `json:"failed"`
+	Changed        int     `json:"changed"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	Complete       bool    `json:"complete"`
+}
+
+func report(p passw0rd.MigrationProgress) {
+	rate := 0.0
+	if p.Elapsed > 0 {
+		rate = float64(p.Processed) / p.Elapsed.Seconds()
+	}
+	fmt.Fprintf(stderr, "processed %d: migrated %d, up to date %d, failed %d, changed %d (%.0f records/s, %d workers)\n",
+		p.Processed, p.Migrated, p.UpToDate, p.Failed, p.Changed, rate, p.Workers)
+}
+
+// sqlStore pages through a table by its ID column and updates records in place, unless they were
+// changed in the meantime. It implements passw0rd.RecordSource and passw0rd.RecordSink
+type sqlStore struct {
+	db     *sql.DB
+	first  string
+	query  string
+	update string
+	set    string
+	exists string
+	insert string
+	base64 bool
+	dryRun bool
+	lastID *string
+	rows   []sqlRecord
+	// raw holds base64 values which do not re-encode to themselves, e.g. with line breaks, by ID
+	raw map[string]string
+}
+
+type sqlRecord struct {
+	id    string
+	value []byte
+}
+
+func newSQLStore(db *sql.DB, driver, table, idColumn, column string, batch int) *sqlStore {
+	arg := func(n int) string { return "?" }
+	if driver == "postgres" {
+		arg = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+
+	selectFrom := fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL", idColumn, column, table, column)
+	return &sqlStore{
+		db:    db,
+		first: fmt.Sprintf("%s ORDER BY %s LIMIT %d", selectFrom, idColumn, batch),
+		query: fmt.Sprintf("%s AND %s > %s ORDER BY %s LIMIT %d", selectFrom, idColumn, arg(1), idColumn, batch),
+		update: fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s AND %s = %s",
+			table, column, arg(1), idColumn, arg(2), column, arg(3)),
+		set: fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s AND (%s IS NULL OR %s <> %s)",
+			table, column, arg(1), idColumn, arg(2), column, column, arg(3)),
+		exists: fmt.Sprintf("SELECT 1 FROM %s WHERE %s = %s", table, idColumn, arg(1)),
+		insert: fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (%s, %s)", table, idColumn, column, arg(1), arg(2)),
+	}
+}
+
+// Next implements passw0rd.RecordSource
+func (s *sqlStore) Next(ctx context.Context) (string, []byte, error) {
+	if len(s.rows) == 0 {
+		if err := s.fetch(ctx); err != nil {
+			return "", nil, err
+		}
+		if len(s.rows) == 0 {
+			return "", nil, io.EOF
+		}
+	}
+
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+
+	if !s.base64 {
+		return row.id, row.value, nil
+	}
+
+	record, err := base64.StdEncoding.DecodeString(string(row.value))
+	if err != nil {
+		// the raw value fails to update like any corrupt record
+		return row.id, row.value, nil
+	}
+	if base64.StdEncoding.EncodeToString(record) != string(row.value) {
+		if s.raw == nil {
+			s.raw = make(map[string]string)
+		}
+		s.raw[row.id] = string(row.value)
+	}
+	return row.id, record, nil
+}
+
+func (s *sqlStore) fetch(ctx context.Context) error {
+	var rows *sql.Rows
+	var err error
+	if s.lastID == nil {
+		rows, err = s.db.QueryContext(ctx, s.first)
+	} else {
+		rows, err = s.db.QueryContext(ctx, s.query, *s.lastID)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row sqlRecord
+		if err = rows.Scan(&row.id, &row.value); err != nil {
+			return err
+		}
+		s.rows = append(s.rows, row)
+		s.lastID = &row.id
+	}
+	return rows.Err()
+}
+
+// Save implements passw0rd.RecordSink
+func (s *sqlStore) Save(ctx context.Context, id string, old, updated []byte) error {
+	if s.dryRun {
+		return nil
+	}
+
+	var oldValue, newValue interface{} = old, updated
+	if s.base64 {
+		oldValue, newValue = s.column(id, old), base64.StdEncoding.EncodeToString(updated)
+	}
+	res, err := s.db.ExecContext(ctx, s.update, newValue, id, oldValue)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return passw0rd.ErrRecordChanged
+	}
+	return nil
+}
+
+// column returns the value read from the database for the record old of id in base64 mode
+func (s *sqlStore) column(id string, old []byte) string {
+	if raw, ok := s.raw[id]; ok {
+		delete(s.raw, id)
+		return raw
+	}
+	return base64.StdEncoding.EncodeToString(old)
+}
+
+// putResult is what sqlStore.put did with a record
+type putResult int
+
+const (
+	putUpdated putResult = iota
+	putUnchanged
+	putNotFound
+	putInserted
+)
+
+// put replaces the record of id unconditionally. If there is no row with id, it inserts one
+// if insert is set
+func (s *sqlStore) put(ctx context.Context, id string, record []byte, insert bool) (putResult, error) {
+	if s.dryRun {
+		return putUpdated, nil
+	}
+
+	var value interface{} = record
+	if s.base64 {
+		value = base64.StdEncoding.EncodeToString(record)
+	}
+	res, err := s.db.ExecContext(ctx, s.set, value, id, value)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return putUpdated, err
+	}
+
+	// no row was updated, either it has the record already or it does not exist
+	var found int
+	err = s.db.QueryRowContext(ctx, s.exists, id).Scan(&found)
+	switch {
+	case err == nil:
+		return putUnchanged, nil
+	case err != sql.ErrNoRows:
+		return 0, err
+	case !insert:
+		return putNotFound, nil
+	}
+
+	if _, err = s.db.ExecContext(ctx, s.insert, id, value); err != nil {
+		return 0, err
+	}
+	return putInserted, nil
+}
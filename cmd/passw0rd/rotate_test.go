@@ -0,0 +1,327 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	sql.Register("fakesql", fakeSQL{})
+}
+
+// sqlTables are the tables of the fakesql driver by DSN
+var sqlTables = struct {
+	sync.Mutex
+	m map[string]*sqlTable
+}{m: map[string]*sqlTable{}}
+
+// sqlTable is a table of the fakesql driver, a database/sql driver which understands the statements
+// of sqlStore. Rows are ordered by ID as strings, nil values are NULL
+type sqlTable struct {
+	mu   sync.Mutex
+	rows map[string][]byte
+	// conflicts are IDs whose row is changed by someone else right before a compare-and-swap
+	conflicts map[string]bool
+}
+
+// newSQLTable registers a table with rows under the name of the test and returns its DSN
+func newSQLTable(t *testing.T, rows map[string][]byte) (string, *sqlTable) {
+	table := &sqlTable{rows: rows, conflicts: map[string]bool{}}
+	sqlTables.Lock()
+	defer sqlTables.Unlock()
+	sqlTables.m[t.Name()] = table
+	return t.Name(), table
+}
+
+func (t *sqlTable) get(id string) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rows[id]
+}
+
+func (t *sqlTable) exec(query string, args []driver.Value) (driver.Result, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case strings.HasPrefix(query, "INSERT "):
+		id := string(valueBytes(args[0]))
+		if _, ok := t.rows[id]; ok {
+			return nil, fmt.Errorf("duplicate id %s", id)
+		}
+		t.rows[id] = valueBytes(args[1])
+		return driver.RowsAffected(1), nil
+	case !strings.HasPrefix(query, "UPDATE "):
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+
+	// sqlStore either swaps values which are equal to the old one, or puts values which differ
+	id := string(valueBytes(args[1]))
+	swap := !strings.Contains(query, " <> ")
+	if swap && t.conflicts[id] {
+		t.rows[id] = []byte("changed meanwhile")
+	}
+	value, ok := t.rows[id]
+	if !ok || swap != bytes.Equal(value, valueBytes(args[2])) {
+		return driver.RowsAffected(0), nil
+	}
+	t.rows[id] = valueBytes(args[0])
+	return driver.RowsAffected(1), nil
+}
+
+func (t *sqlTable) query(query string, args []driver.Value) (driver.Rows, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if strings.HasPrefix(query, "SELECT 1 ") {
+		rows := &sqlRows{columns: []string{"1"}}
+		if _, ok := t.rows[string(valueBytes(args[0]))]; ok {
+			rows.values = [][]driver.Value{{int64(1)}}
+		}
+		return rows, nil
+	}
+
+	i := strings.LastIndex(query, "LIMIT ")
+	if !strings.HasPrefix(query, "SELECT ") || i < 0 {
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+	var limit int
+	if _, err := fmt.Sscanf(query[i:], "LIMIT %d", &limit); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rows := &sqlRows{columns: []string{"id", "record"}}
+	for _, id := range ids {
+		if len(args) > 0 && id <= string(valueBytes(args[0])) || t.rows[id] == nil {
+			continue
+		}
+		if len(rows.values) == limit {
+			break
+		}
+		rows.values = append(rows.values, []driver.Value{id, append([]byte(nil), t.rows[id]...)})
+	}
+	return rows, nil
+}
+
+func valueBytes(v driver.Value) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return append([]byte(nil), v...)
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+type fakeSQL struct{}
+
+func (fakeSQL) Open(dsn string) (driver.Conn, error) {
+	sqlTables.Lock()
+	defer sqlTables.Unlock()
+	table, ok := sqlTables.m[dsn]
+	if !ok {
+		return nil, fmt.Errorf("no table %q", dsn)
+	}
+	return &sqlConn{table}, nil
+}
+
+type sqlConn struct {
+	table *sqlTable
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlStmt{table: c.table, query: query}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return nil
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type sqlStmt struct {
+	table *sqlTable
+	query string
+}
+
+func (s *sqlStmt) Close() error {
+	return nil
+}
+
+func (s *sqlStmt) NumInput() int {
+	return -1
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.table.exec(s.query, args)
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.table.query(s.query, args)
+}
+
+type sqlRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *sqlRows) Columns() []string {
+	return r.columns
+}
+
+func (r *sqlRows) Close() error {
+	return nil
+}
+
+func (r *sqlRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// enrollRecords enrolls n passwords with the fake service and returns the records
+func (c *cli) enrollRecords(n int) [][]byte {
+	p, err := c.svc.Protocol()
+	require.NoError(c.t, err)
+
+	records := make([][]byte, n)
+	for i := range records {
+		records[i], _, err = p.EnrollAccount(fmt.Sprint("passw0rd", i))
+		require.NoError(c.t, err)
+	}
+	return records
+}
+
+// recordVersion returns the key version of record, or 0 if it is invalid
+func recordVersion(record []byte) uint32 {
+	version, _, _ := passw0rd.UnmarshalRecord(record)
+	return version
+}
+
+func TestRotate(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	records := c.enrollRecords(4)
+	token, err := c.svc.Rotate()
+	require.NoError(t, err)
+
+	dsn, table := newSQLTable(t, map[string][]byte{
+		"1": records[0], "2": records[1], "3": records[2], "4": records[3], "5": []byte("corrupt"), "6": nil,
+	})
+	table.conflicts["4"] = true
+
+	res := &migrationResult{}
+	_, err = c.runJSON(rotate, "", res, "-driver", "fakesql", "-dsn", dsn, "-token", token, "-batch", "2")
+	assert.EqualError(t, err, "1 of 5 records failed")
+	assert.Equal(t, &migrationResult{Version: 2, Processed: 5, Migrated: 3, Failed: 1, Changed: 1, ElapsedSeconds: res.ElapsedSeconds}, res)
+	for _, id := range []string{"1", "2", "3"} {
+		assert.Equal(t, uint32(2), recordVersion(table.get(id)), id)
+	}
+	assert.Equal(t, "changed meanwhile", string(table.get("4")))
+
+	res = &migrationResult{}
+	_, err = c.runJSON(rotate, "", res, "-driver", "fakesql", "-dsn", dsn, "-token", token, "-batch", "2")
+	assert.Error(t, err)
+	assert.Equal(t, 3, res.UpToDate)
+
+	_, _, err = c.run(rotate, "", "-dsn", dsn)
+	assert.Equal(t, exitUsage, exitCode(err))
+	_, _, err = c.run(rotate, "", "-driver", "fakesql", "-dsn", dsn, "-token", token, "-table", "users; --")
+	assert.EqualError(t, err, `invalid identifier "users; --"`)
+}
+
+func TestRotate_Base64(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	records := c.enrollRecords(2)
+	token, err := c.svc.Rotate()
+	require.NoError(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(records[1])
+	wrapped := encoded[:20] + "\r\n" + encoded[20:]
+	dsn, table := newSQLTable(t, map[string][]byte{
+		"1": []byte(base64.StdEncoding.EncodeToString(records[0])),
+		"2": []byte(wrapped),
+	})
+
+	res := &migrationResult{}
+	_, err = c.runJSON(rotate, "", res, "-driver", "fakesql", "-dsn", dsn, "-token", token, "-base64", "-dry-run")
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Migrated)
+	assert.False(t, res.Complete, "records of a dry run are not saved")
+	assert.Equal(t, wrapped, string(table.get("2")))
+
+	res = &migrationResult{}
+	_, err = c.runJSON(rotate, "", res, "-driver", "fakesql", "-dsn", dsn, "-token", token, "-base64")
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Migrated)
+	assert.Zero(t, res.Changed)
+	assert.True(t, res.Complete)
+	for _, id := range []string{"1", "2"} {
+		record, err := base64.StdEncoding.DecodeString(string(table.get(id)))
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), recordVersion(record), id)
+	}
+
+	stdout, _, err := c.run(rotate, "", "-driver", "fakesql", "-dsn", dsn, "-token", token, "-base64")
+	require.NoError(t, err)
+	assert.Contains(t, stdout, "every record has key version 2")
+}
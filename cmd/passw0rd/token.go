@@ -0,0 +1,245 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/passw0rd/phe-go"
+	"github.com/passw0rd/sdk-go"
+	"github.com/pkg/errors"
+)
+
+// validateTokens checks app tokens, service public keys, client secret keys and update tokens
+// given as arguments or lines of standard input. Contents are never printed
+func validateTokens(args []string) error {
+	flags := flag.NewFlagSet("token validate", flag.ContinueOnError)
+	var (
+		version   = flags.Uint("version", 0, "key version an update token must chain onto, 0 to skip the check")
+		publicKey = flags.String("service-public-key", "", "PK.<version>.<base64> the client secret key or update token must belong to")
+		secretKey = flags.String("client-secret-key", "", "SK.<version>.<base64> the update token must apply to, together with -service-public-key")
+	)
+	out := newOutput(flags, "token validate")
+	if err := out.parse(flags, args); err != nil {
+		return err
+	}
+
+	tokens := flags.Args()
+	if len(tokens) == 0 {
+		lines, err := readLines(stdin)
+		if err != nil {
+			return out.done(nil, err)
+		}
+		tokens = lines
+	}
+	if len(tokens) == 0 {
+		return out.done(nil, usageError("passw0rd token validate [flags] token..."))
+	}
+
+	v := &tokenValidator{version: uint32(*version)}
+	if *publicKey != "" {
+		var err error
+		if v.pkVersion, v.pk, err = passw0rd.ParseVersionAndContent("PK", *publicKey); err != nil {
+			return out.done(nil, fmt.Errorf("-service-public-key: %v", err))
+		}
+	}
+	if *secretKey != "" {
+		var err error
+		if v.skVersion, v.sk, err = passw0rd.ParseVersionAndContent("SK", *secretKey); err != nil {
+			return out.done(nil, fmt.Errorf("-client-secret-key: %v", err))
+		}
+	}
+
+	results := make([]*tokenResult, len(tokens))
+	invalid := 0
+	for i, token := range tokens {
+		res := &tokenResult{}
+		results[i] = res
+		if err := v.validate(token, res); err != nil {
+			invalid++
+			res.Error = newErrorInfo(err)
+			out.Printf("%d: invalid %s: %v\n", i+1, res.description(), err)
+			continue
+		}
+		res.Valid = true
+		out.Printf("%d: valid %s\n", i+1, res.description())
+	}
+
+	if invalid > 0 {
+		return out.done(results, fmt.Errorf("%d of %d tokens are invalid", invalid, len(tokens)))
+	}
+	return out.done(results, nil)
+}
+
+// tokenValidator holds the keys tokens are checked against
+type tokenValidator struct {
+	version   uint32
+	pkVersion uint32
+	pk        []byte
+	skVersion uint32
+	sk        []byte
+}
+
+// tokenResult describes a validated token in -json results
+type tokenResult struct {
+	Type          string     `json:"type,omitempty"`
+	Version       uint32     `json:"version,omitempty"`
+	AppliesToKeys bool       `json:"applies_to_keys,omitempty"`
+	Valid         bool       `json:"valid"`
+	Error         *errorInfo `json:"error,omitempty"`
+}
+
+// tokenTypes are the token prefixes with their result types
+var tokenTypes = map[string]string{
+	"PT": "app_token",
+	"PK": "service_public_key",
+	"SK": "client_secret_key",
+	"UT": "update_token",
+}
+
+// description returns the text description of the token
+func (r *tokenResult) description() string {
+	if r.Type == "" {
+		return "token"
+	}
+	description := strings.Replace(r.Type, "_", " ", -1)
+	if r.Version != 0 {
+		description += fmt.Sprintf(" of version %d", r.Version)
+	}
+	if r.AppliesToKeys {
+		description += ", applies to the given keys"
+	}
+	return description
+}
+
+// validate describes token in res and returns why it is invalid
+func (v *tokenValidator) validate(token string, res *tokenResult) error {
+	if err := checkPasted(token); err != nil {
+		return err
+	}
+
+	prefix := strings.SplitN(token, ".", 2)[0]
+	res.Type = tokenTypes[prefix]
+	if res.Type == "" {
+		return fmt.Errorf("unknown prefix %q, expected PT, PK, SK or UT", prefix)
+	}
+	if prefix == "PT" {
+		if len(token) == len("PT.") || strings.Count(token, ".") != 1 {
+			return fmt.Errorf("must look like PT.<base64>")
+		}
+		return nil
+	}
+
+	if parts := strings.Split(token, "."); len(parts) != 3 {
+		return fmt.Errorf("must look like %s.<version>.<base64>, found %d parts", prefix, len(parts))
+	}
+	if strings.ContainsAny(token, "-_") {
+		return fmt.Errorf("contains URL safe base64 characters, standard base64 is expected")
+	}
+
+	version, content, err := passw0rd.ParseVersionAndContent(prefix, token)
+	if err != nil {
+		return fmt.Errorf("version or base64 content: %v", errorMessage(err))
+	}
+	res.Version = version
+
+	switch prefix {
+	case "PK":
+		if _, err = phe.NewClient(phe.GenerateClientKey(), content); err != nil {
+			return fmt.Errorf("not a public key: %v", err)
+		}
+	case "SK":
+		if v.pk != nil && version != v.pkVersion {
+			return fmt.Errorf("service public key is of version %d", v.pkVersion)
+		}
+		pk := v.pk
+		if pk == nil {
+			if pk, err = generatePublicKey(); err != nil {
+				return err
+			}
+		}
+		if _, err = phe.NewClient(content, pk); err != nil {
+			return fmt.Errorf("not a secret key: %v", err)
+		}
+	case "UT":
+		if v.version != 0 && version != v.version+1 {
+			return fmt.Errorf("does not chain onto version %d, expected version %d", v.version, v.version+1)
+		}
+		if v.pk == nil || v.sk == nil {
+			break
+		}
+		if version != v.pkVersion+1 {
+			return fmt.Errorf("does not chain onto the keys of version %d", v.pkVersion)
+		}
+		if _, _, err = phe.RotateClientKeys(v.pk, v.sk, content); err != nil {
+			return fmt.Errorf("does not apply to the given keys: %v", err)
+		}
+		res.AppliesToKeys = true
+	}
+	return nil
+}
+
+// checkPasted detects common copy and paste mistakes
+func checkPasted(token string) error {
+	switch {
+	case token == "":
+		return fmt.Errorf("empty")
+	case strings.TrimSpace(token) != token:
+		return fmt.Errorf("leading or trailing whitespace")
+	case strings.ContainsAny(token, "\"'`"):
+		return fmt.Errorf("contains quotes")
+	case strings.ContainsAny(token, " \t\r\n"):
+		return fmt.Errorf("contains whitespace, it may have been wrapped")
+	}
+	return nil
+}
+
+// generatePublicKey returns a throwaway service public key to check client secret keys against
+func generatePublicKey() ([]byte, error) {
+	kp, err := phe.GenerateServerKeypair()
+	if err != nil {
+		return nil, err
+	}
+	return phe.GetPublicKey(kp)
+}
+
+// errorMessage returns the innermost message of err
+func errorMessage(err error) string {
+	return errors.Cause(err).Error()
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTokens(t *testing.T) {
+	c := newCLI(t)
+	defer c.close()
+	svc := c.svc
+	token, err := svc.Rotate()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		input  string
+		args   []string
+		result tokenResult
+	}{
+		{name: "app token", args: []string{svc.AppToken}, result: tokenResult{Type: "app_token", Valid: true}},
+		{name: "public key", args: []string{svc.ServicePublicKey}, result: tokenResult{Type: "service_public_key", Version: 1, Valid: true}},
+		{name: "secret key", args: []string{svc.ClientSecretKey}, result: tokenResult{Type: "client_secret_key", Version: 1, Valid: true}},
+		{name: "stdin", input: token + "\n", result: tokenResult{Type: "update_token", Version: 2, Valid: true}},
+		{name: "chained", args: []string{"-version", "1", token}, result: tokenResult{Type: "update_token", Version: 2, Valid: true}},
+		{name: "not chained", args: []string{"-version", "2", token}, result: tokenResult{Type: "update_token", Version: 2}},
+		{
+			name:   "keys",
+			args:   []string{"-service-public-key", svc.ServicePublicKey, "-client-secret-key", svc.ClientSecretKey, token},
+			result: tokenResult{Type: "update_token", Version: 2, AppliesToKeys: true, Valid: true},
+		},
+		{name: "quoted", args: []string{`"` + svc.AppToken + `"`}},
+		{name: "unknown prefix", args: []string{"XX.1.AAAA"}},
+		{name: "url safe", args: []string{"PK.1.AB-_"}, result: tokenResult{Type: "service_public_key"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var results []*tokenResult
+			_, err := c.runJSON(validateTokens, test.input, &results, test.args...)
+			assert.Equal(t, test.result.Valid, err == nil)
+			require.Len(t, results, 1)
+
+			res := results[0]
+			assert.Equal(t, test.result.Valid, res.Error == nil)
+			res.Error = nil
+			assert.Equal(t, test.result, *res)
+		})
+	}
+
+	out, _, err := c.run(validateTokens, "", svc.AppToken, "PK.1")
+	assert.EqualError(t, err, "1 of 2 tokens are invalid")
+	assert.Equal(t, "1: valid app token\n2: invalid service public key: must look like PK.<version>.<base64>, found 2 parts\n", out)
+
+	_, _, err = c.run(validateTokens, "")
+	assert.Equal(t, exitUsage, exitCode(err))
+	_, _, err = c.run(validateTokens, "", "-service-public-key", "PK.x", svc.AppToken)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+// Code is a stable machine-readable error code. Numbers and names of codes never change,
+// so they may be used in alerting rules and in error mapping for clients
+type Code int
+
+// Error codes returned by ErrorCode
+const (
+	CodeOK      Code = 0
+	CodeUnknown Code = 1
+
+	CodeInvalidPassword Code = 100
+	CodeRateLimited     Code = 101
+	CodeAccountLocked   Code = 102
+
+	CodeInvalidRecord     Code = 200
+	CodeVersionMismatch   Code = 201
+	CodeUnknownKeyVersion Code = 202
+	CodeNoUpdateToken     Code = 203
+	CodeRecordChanged     Code = 204
+
+	CodeInvalidCredential    Code = 300
+	CodeInvalidConfiguration Code = 301
+	CodeKeyPolicyViolation   Code = 302
+	CodeUnknownServiceKey    Code = 303
+	CodeSelfTestFailed       Code = 304
+
+	CodeTransport      Code = 400
+	CodeServiceError   Code = 401
+	CodeReplayDetected Code = 402
+	CodePinMismatch    Code = 403
+	CodeCircuitOpen    Code = 404
+
+	CodePHEPanic      Code = 500
+	CodeCryptoFailure Code = 501
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                   "ok",
+	CodeUnknown:              "unknown",
+	CodeInvalidPassword:      "invalid_password",
+	CodeRateLimited:          "rate_limited",
+	CodeAccountLocked:        "account_locked",
+	CodeInvalidRecord:        "invalid_record",
+	CodeVersionMismatch:      "version_mismatch",
+	CodeUnknownKeyVersion:    "unknown_key_version",
+	CodeNoUpdateToken:        "no_update_token",
+	CodeRecordChanged:        "record_changed",
+	CodeInvalidCredential:    "invalid_credential",
+	CodeInvalidConfiguration: "invalid_configuration",
+	CodeKeyPolicyViolation:   "key_policy_violation",
+	CodeUnknownServiceKey:    "unknown_service_key",
+	CodeSelfTestFailed:       "self_test_failed",
+	CodeTransport:            "transport",
+	CodeServiceError:         "service_error",
+	CodeReplayDetected:       "replay_detected",
+	CodePinMismatch:          "pin_mismatch",
+	CodeCircuitOpen:          "circuit_open",
+	CodePHEPanic:             "phe_panic",
+	CodeCryptoFailure:        "crypto_failure",
+}
+
+// sentinelCode returns the code of err if it is a sentinel error of the SDK. It compares err with
+// each sentinel rather than looking it up in a map, which panics for errors of uncomparable types
+func sentinelCode(err error) (Code, bool) {
+	switch err {
+	case ErrInvalidPassword:
+		return CodeInvalidPassword, true
+	case ErrReplayDetected:
+		return CodeReplayDetected, true
+	case ErrRateLimited:
+		return CodeRateLimited, true
+	case ErrAccountLocked:
+		return CodeAccountLocked, true
+	case ErrPinMismatch:
+		return CodePinMismatch, true
+	case ErrKeyPolicyViolation:
+		return CodeKeyPolicyViolation, true
+	case ErrPHEPanic:
+		return CodePHEPanic, true
+	case ErrUnknownServiceKey:
+		return CodeUnknownServiceKey, true
+	case ErrCircuitOpen:
+		return CodeCircuitOpen, true
+	case ErrRecordChanged:
+		return CodeRecordChanged, true
+	}
+	return 0, false
+}
+
+// String returns the stable name of the code, e.g. "invalid_password"
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return codeNames[CodeUnknown]
+}
+
+// ErrorCode returns the code of an error returned by the SDK. The code survives wrapping
+// with github.com/pkg/errors. It returns CodeOK for nil and CodeUnknown for foreign errors
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+
+	for err != nil {
+		if code, ok := sentinelCode(err); ok {
+			return code
+		}
+
+		switch e := err.(type) {
+		case *codedError:
+			return e.code
+		case *HttpError:
+			return CodeServiceError
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return CodeUnknown
+		}
+	}
+	return CodeUnknown
+}
+
+// codedError attaches a code to an error without changing its message
+type codedError struct {
+	code Code
+	err  error
+}
+
+func withCode(code Code, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the underlying error so that errors.Cause keeps working
+func (e *codedError) Cause() error {
+	return e.err
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCode(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	_, err := p.VerifyPassword("passw0rd", []byte("garbage"))
+	require.Error(t, err)
+	assert.Equal(t, CodeInvalidRecord, ErrorCode(err))
+	assert.Equal(t, CodeInvalidRecord, ErrorCode(errors.Wrap(err, "login")))
+
+	_, err = p.UpdateEnrollmentRecord([]byte("garbage"))
+	assert.Equal(t, CodeNoUpdateToken, ErrorCode(err))
+
+	_, err = CreateContext("PT.test", "PK.1.invalid", s.clientSecret, "")
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+
+	assert.Equal(t, CodeOK, ErrorCode(nil))
+	assert.Equal(t, CodeInvalidPassword, ErrorCode(errors.Wrap(ErrInvalidPassword, "login")))
+	assert.Equal(t, CodeRateLimited, ErrorCode(&RateLimitedError{}))
+	assert.Equal(t, CodeServiceError, ErrorCode(errors.Wrap(&HttpError{Code: 500}, "call")))
+	assert.Equal(t, CodePHEPanic, ErrorCode(&PanicError{Op: "test"}))
+	assert.Equal(t, CodeUnknown, ErrorCode(errors.New("foreign")))
+	assert.Equal(t, CodeUnknown, ErrorCode(sliceError{"a"}))
+	assert.Equal(t, CodeUnknown, ErrorCode(errors.Wrap(sliceError{"a"}, "save")))
+}
+
+// sliceError is an error of an uncomparable type, like validation errors listing several problems
+type sliceError []string
+
+func (e sliceError) Error() string { return strings.Join(e, ", ") }
+
+func TestCode_Stable(t *testing.T) {
+	codes := map[Code]string{
+		0:   "ok",
+		1:   "unknown",
+		100: "invalid_password",
+		101: "rate_limited",
+		102: "account_locked",
+		200: "invalid_record",
+		201: "version_mismatch",
+		202: "unknown_key_version",
+		203: "no_update_token",
+		204: "record_changed",
+		300: "invalid_credential",
+		301: "invalid_configuration",
+		302: "key_policy_violation",
+		303: "unknown_service_key",
+		304: "self_test_failed",
+		400: "transport",
+		401: "service_error",
+		402: "replay_detected",
+		403: "pin_mismatch",
+		404: "circuit_open",
+		500: "phe_panic",
+		501: "crypto_failure",
+	}
+
+	assert.Len(t, codeNames, len(codes))
+	for code, name := range codes {
+		assert.Equal(t, name, code.String())
+	}
+	assert.Equal(t, "unknown", Code(999).String())
+}
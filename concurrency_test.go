@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProtocol_Concurrency hammers a single protocol with every hook enabled while keys are rotated.
+// Run it with -race
+func TestProtocol_Concurrency(t *testing.T) {
+	workers, rounds, rotations := 200, 2, 4
+	if testing.Short() {
+		workers, rotations = 20, 2
+	}
+
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	log := NewJSONLog(ioutil.Discard)
+	p.Logger = log
+	p.AuditSink = log
+	p.Debug = true
+	p.Hardened = true
+	p.Metrics = &LatencyTracker{}
+	p.Tracer = &testTracer{}
+	p.Events = NewEventBus()
+	p.Events.Subscribe(log.Publish)
+	p.OnSecurityEvent = func(*SecurityEvent) {}
+	p.Lockout = NewLockout(LockoutPolicy{MaxFailures: 1000, LockDuration: time.Second, Events: p.Events})
+	p.RateLimitStore = NewMemoryRateLimitStore()
+	p.RateLimit = RateLimit{Strategy: SlidingWindow, Limit: 1000, Window: time.Minute}
+	p.APIClient.HTTPClient.Retry = &RetryPolicy{}
+	p.APIClient.HTTPClient.Breaker = &CircuitBreaker{Events: p.Events}
+
+	done := make(chan struct{})
+	var rotator sync.WaitGroup
+	rotator.Add(1)
+	go func() {
+		defer rotator.Done()
+		for i := 0; i < rotations; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if err := p.AddUpdateToken(s.rotate(t)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			ctx := WithUserID(context.Background(), fmt.Sprintf("user-%d", w%10))
+			if err := hammer(ctx, p, rounds); err != nil {
+				errs <- fmt.Errorf("worker %d: %v", w, err)
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(done)
+	rotator.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	assert.Equal(t, uint32(1+rotations), p.CurrentVersion())
+	assert.True(t, p.Status().Ready)
+}
+
+// hammer runs enroll, verify and update cycles along with read-only calls
+func hammer(ctx context.Context, p *Protocol, rounds int) error {
+	for i := 0; i < rounds; i++ {
+		rec, key, err := p.EnrollAccountContext(ctx, "passw0rd")
+		if err != nil {
+			return err
+		}
+
+		if _, err = p.VerifyPasswordContext(ctx, "wrong", rec); err != ErrInvalidPassword {
+			return fmt.Errorf("wrong password: %v", err)
+		}
+
+		verified, err := p.VerifyPasswordContext(ctx, "passw0rd", rec)
+		if err != nil {
+			return err
+		}
+		if string(verified) != string(key) {
+			return fmt.Errorf("key mismatch")
+		}
+
+		updated, err := p.UpdateEnrollmentRecordContext(ctx, rec)
+		switch ErrorCode(err) {
+		case CodeOK:
+			if updated == nil {
+				break
+			}
+			if verified, err = p.VerifyPasswordContext(ctx, "passw0rd", updated); err != nil {
+				return fmt.Errorf("updated record: %v", err)
+			}
+			if string(verified) != string(key) {
+				return fmt.Errorf("updated record key mismatch")
+			}
+		case CodeNoUpdateToken, CodeVersionMismatch:
+			// the record was created before the latest rotation but one
+		default:
+			return fmt.Errorf("update: %v", err)
+		}
+
+		_ = p.Status()
+		_ = p.Versions()
+		_ = p.CurrentVersion()
+		_, _ = p.NeedsPepperRotation(rec)
+	}
+	return nil
+}
+
+func TestProtocol_ConcurrentSetContext(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 50; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verified, err := p.VerifyPassword("passw0rd", rec)
+			assert.NoError(t, err)
+			assert.Equal(t, key, verified)
+		}()
+	}
+
+	ctx, err := CreateContext("PT.test", s.publicKey, s.clientSecret, s.rotate(t))
+	require.NoError(t, err)
+	require.NoError(t, p.SetContext(ctx))
+
+	wg.Wait()
+	assert.Equal(t, uint32(2), p.CurrentVersion())
+}
@@ -41,6 +41,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/passw0rd/phe-go"
 
@@ -49,77 +50,105 @@ import (
 
 // Context holds & validates protocol input parameters
 type Context struct {
-	AppToken    string
-	PHEClients  map[uint32]*phe.Client
+	AppToken    SecretString
+	PHEClients  map[uint32]PHEClient
 	Version     uint32
 	UpdateToken *VersionedUpdateToken
+	// SelfTest makes NewProtocol run RunSelfTest and fail on broken environments
+	SelfTest bool
+	// VerifyServiceKey makes NewProtocol run Protocol.VerifyServiceKey against URL and fail if the service
+	// does not prove possession of the configured service key. It costs one request to the service
+	VerifyServiceKey bool
+	// URL, if set, replaces the passw0rd service address for protocols created from the context
+	URL string
+	// AdoptedAt is the time the current key version was put in use, for KeyPolicy.
+	// NewProtocol assumes keys are fresh if it is not set
+	AdoptedAt time.Time
+	// KnownServiceKeys, if set, are the only service public keys NewProtocol accepts. It protects
+	// against tampered configuration. The service public key is not checked if it is nil
+	KnownServiceKeys []KnownServiceKey
+
+	servicePublicKey []byte
 }
 
 //CreateContext validates input parameters and prepares them for being used in Protocol
 func CreateContext(appToken, servicePublicKey, clientSecretKey, updateToken string) (*Context, error) {
 
 	if clientSecretKey == "" || servicePublicKey == "" || appToken == "" {
-		return nil, errors.New("all parameters are mandatory")
+		return nil, withCode(CodeInvalidCredential, errors.New("all parameters are mandatory"))
 	}
 
 	skVersion, sk, err := ParseVersionAndContent("SK", clientSecretKey)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid secret key")
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid secret key"))
 	}
 
 	pubVersion, pubBytes, err := ParseVersionAndContent("PK", servicePublicKey)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid public key")
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid public key"))
 	}
 
 	if skVersion != pubVersion {
-		return nil, errors.New("public and secret keys must have the same version")
+		return nil, withCode(CodeInvalidCredential, errors.New("public and secret keys must have the same version"))
 	}
 
 	currentSk, currentPub := sk, pubBytes
-	pheClient, err := phe.NewClient(currentSk, currentPub)
-
-	if err != nil {
-		return nil, errors.Wrap(err, "could not create PHE client")
-	}
-
-	phes := make(map[uint32]*phe.Client)
-	phes[pubVersion] = pheClient
 
 	token, err := parseToken(updateToken)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not parse update tokens")
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "could not parse update tokens"))
 	}
 
+	phes := make(map[uint32]PHEClient)
 	currentVersion := pubVersion
 
-	if token != nil {
+	if token == nil {
+		if phes[pubVersion], err = newPHEClient(currentSk, currentPub); err != nil {
+			return nil, err
+		}
+	} else {
 		if token.Version != currentVersion+1 {
-			return nil, fmt.Errorf("incorrect token version %d", token.Version)
+			return nil, withCode(CodeVersionMismatch, fmt.Errorf("incorrect token version %d", token.Version))
 		}
 
-		nextSk, nextPub, err := phe.RotateClientKeys(currentPub, currentSk, token.UpdateToken)
+		nextSk, nextPub, err := rotateClientKeys(currentPub, currentSk, token.UpdateToken)
+		if _, ok := err.(*PanicError); ok {
+			return nil, err
+		}
 		if err != nil {
-			return nil, errors.Wrap(err, "could not update keys using token")
+			return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "could not update keys using token"))
 		}
 
-		nextClient, err := phe.NewClient(nextSk, nextPub)
-		if err != nil {
-			return nil, errors.Wrap(err, "could not create PHE client")
+		if phes[token.Version], err = newPHEClient(nextSk, nextPub); err != nil {
+			return nil, err
 		}
 
-		phes[token.Version] = nextClient
+		// the client of the previous version is only needed once a record of that version shows up
+		phes[pubVersion] = LazyPHEClient(func() (PHEClient, error) {
+			return newPHEClient(currentSk, currentPub)
+		})
 		currentVersion = token.Version
 	}
 
 	return &Context{
-		AppToken:    appToken,
-		PHEClients:  phes,
-		Version:     currentVersion,
-		UpdateToken: token,
+		AppToken:         SecretString(appToken),
+		PHEClients:       phes,
+		Version:          currentVersion,
+		UpdateToken:      token,
+		servicePublicKey: pubBytes,
 	}, nil
 }
 
+func newPHEClient(sk, pub []byte) (_ PHEClient, err error) {
+	defer recoverPanic("NewClient", &err)
+
+	client, err := phe.NewClient(sk, pub)
+	if err != nil {
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "could not create PHE client"))
+	}
+	return client, nil
+}
+
 func parseToken(token string) (parsedToken *VersionedUpdateToken, err error) {
 	if len(token) == 0 {
 		return nil, nil
@@ -128,7 +157,7 @@ func parseToken(token string) (parsedToken *VersionedUpdateToken, err error) {
 	version, content, err := ParseVersionAndContent("UT", token)
 
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid update token")
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid update token"))
 	}
 
 	vt := &VersionedUpdateToken{
@@ -145,22 +174,22 @@ func parseToken(token string) (parsedToken *VersionedUpdateToken, err error) {
 func ParseVersionAndContent(prefix, str string) (version uint32, content []byte, err error) {
 	parts := strings.Split(str, ".")
 	if len(parts) != 3 || parts[0] != prefix {
-		return 0, nil, errors.New("invalid string")
+		return 0, nil, withCode(CodeInvalidCredential, errors.New("invalid string"))
 	}
 
 	nVersion, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "invalid string")
+		return 0, nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid string"))
 	}
 
 	if nVersion < 1 {
-		return 0, nil, errors.Wrap(err, "invalid version")
+		return 0, nil, withCode(CodeInvalidCredential, errors.New("invalid version"))
 	}
 	version = uint32(nVersion)
 
 	content, err = base64.StdEncoding.DecodeString(parts[2])
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "invalid string")
+		return 0, nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid string"))
 	}
 	return
 }
@@ -0,0 +1,246 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package contract
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/sdk-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sandbox struct {
+	address          string
+	appToken         string
+	servicePublicKey string
+	clientSecretKey  string
+	updateToken      string
+}
+
+func getSandbox(t *testing.T) *sandbox {
+	s := &sandbox{
+		address:          os.Getenv("PASSW0RD_CONTRACT_ADDRESS"),
+		appToken:         os.Getenv("PASSW0RD_CONTRACT_APP_TOKEN"),
+		servicePublicKey: os.Getenv("PASSW0RD_CONTRACT_SERVICE_PUBLIC_KEY"),
+		clientSecretKey:  os.Getenv("PASSW0RD_CONTRACT_CLIENT_SECRET_KEY"),
+		updateToken:      os.Getenv("PASSW0RD_CONTRACT_UPDATE_TOKEN"),
+	}
+	if s.address == "" || s.appToken == "" || s.servicePublicKey == "" || s.clientSecretKey == "" {
+		t.Skip("no sandbox credentials")
+	}
+	return s
+}
+
+// exchange is a request and response seen on the wire
+type exchange struct {
+	req      *http.Request
+	reqBody  []byte
+	resp     *http.Response
+	respBody []byte
+}
+
+// recorder is an HTTPClient keeping all exchanges with the service
+type recorder struct {
+	mu        sync.Mutex
+	exchanges []*exchange
+}
+
+func (r *recorder) Do(req *http.Request) (*http.Response, error) {
+	ex := &exchange{req: req}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		ex.reqBody = body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if ex.respBody, err = ioutil.ReadAll(resp.Body); err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(ex.respBody))
+	ex.resp = resp
+
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, ex)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *recorder) last(t *testing.T) *exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	require.NotEmpty(t, r.exchanges)
+	return r.exchanges[len(r.exchanges)-1]
+}
+
+// protocol creates a protocol recording its traffic
+func (s *sandbox) protocol(t *testing.T, appToken, updateToken string) (*passw0rd.Protocol, *recorder) {
+	ctx, err := passw0rd.CreateContext(appToken, s.servicePublicKey, s.clientSecretKey, updateToken)
+	require.NoError(t, err)
+
+	p, err := passw0rd.NewProtocol(ctx)
+	require.NoError(t, err)
+
+	rec := &recorder{}
+	p.APIClient = &passw0rd.APIClient{
+		AppToken:   p.AppToken,
+		URL:        s.address,
+		HTTPClient: &passw0rd.VirgilHTTPClient{Client: rec, Address: s.address},
+	}
+	return p, rec
+}
+
+func TestContract_Enrollment(t *testing.T) {
+	s := getSandbox(t)
+	p, rec := s.protocol(t, s.appToken, "")
+
+	_, _, err := p.EnrollAccount("p@ssw0Rd")
+	require.NoError(t, err)
+
+	ex := rec.last(t)
+	assert.Equal(t, http.MethodPost, ex.req.Method)
+	assert.Equal(t, "enroll", path.Base(ex.req.URL.Path))
+	assert.Equal(t, s.appToken, ex.req.Header.Get("AppToken"))
+	require.Equal(t, http.StatusOK, ex.resp.StatusCode)
+
+	resp := &passw0rd.EnrollmentResponse{}
+	require.NoError(t, proto.Unmarshal(ex.respBody, resp))
+	assert.Equal(t, p.CurrentVersion(), resp.Version)
+	assert.NotEmpty(t, resp.Response)
+
+	// replay protection relies on the Date header of successful responses
+	_, err = http.ParseTime(ex.resp.Header.Get("Date"))
+	assert.NoError(t, err)
+}
+
+func TestContract_Verification(t *testing.T) {
+	s := getSandbox(t)
+	p, rec := s.protocol(t, s.appToken, "")
+
+	record, key, err := p.EnrollAccount("p@ssw0Rd")
+	require.NoError(t, err)
+
+	verified, err := p.VerifyPassword("p@ssw0Rd", record)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	ex := rec.last(t)
+	assert.Equal(t, "verify-password", path.Base(ex.req.URL.Path))
+	require.Equal(t, http.StatusOK, ex.resp.StatusCode)
+	assert.NoError(t, proto.Unmarshal(ex.respBody, &passw0rd.VerifyPasswordResponse{}))
+
+	// an invalid password is a successful exchange with a proof of failure, not a service error
+	_, err = p.VerifyPassword("p@ss", record)
+	assert.Equal(t, passw0rd.ErrInvalidPassword, err)
+	assert.Equal(t, http.StatusOK, rec.last(t).resp.StatusCode)
+}
+
+func TestContract_Errors(t *testing.T) {
+	s := getSandbox(t)
+
+	p, rec := s.protocol(t, "PT.invalid", "")
+	_, _, err := p.EnrollAccount("p@ssw0Rd")
+	require.Error(t, err)
+	assertHTTPError(t, rec.last(t), err)
+
+	p, rec = s.protocol(t, s.appToken, "")
+	_, err = p.APIClient.GetEnrollment(&passw0rd.EnrollmentRequest{Version: p.CurrentVersion() + 100})
+	require.Error(t, err)
+	assertHTTPError(t, rec.last(t), err)
+
+	// the SDK maps 404 to a service error without parsing the body
+	_, err = p.APIClient.HTTPClient.Send(s.appToken, http.MethodPost, "no-such-endpoint", nil, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.last(t).resp.StatusCode)
+	assert.Equal(t, passw0rd.CodeServiceError, passw0rd.ErrorCode(err))
+}
+
+func TestContract_Rotation(t *testing.T) {
+	s := getSandbox(t)
+	if s.updateToken == "" {
+		t.Skip("no update token")
+	}
+
+	p, _ := s.protocol(t, s.appToken, "")
+	record, key, err := p.EnrollAccount("p@ssw0Rd")
+	require.NoError(t, err)
+
+	rotated, rec := s.protocol(t, s.appToken, s.updateToken)
+
+	// the service must still serve records of the previous version
+	verified, err := rotated.VerifyPassword("p@ssw0Rd", record)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	updated, err := rotated.UpdateEnrollmentRecord(record)
+	require.NoError(t, err)
+
+	verified, err = rotated.VerifyPassword("p@ssw0Rd", updated)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	req := &passw0rd.VerifyPasswordRequest{}
+	require.NoError(t, proto.Unmarshal(rec.last(t).reqBody, req))
+	assert.Equal(t, rotated.CurrentVersion(), req.Version)
+}
+
+// assertHTTPError checks that a rejected request is answered with an HttpError body
+func assertHTTPError(t *testing.T, ex *exchange, err error) {
+	assert.NotEqual(t, http.StatusOK, ex.resp.StatusCode)
+
+	httpErr, ok := errors.Cause(err).(*passw0rd.HttpError)
+	require.True(t, ok, "expected HttpError, got %v", err)
+	assert.NotZero(t, httpErr.Code)
+	assert.NotEmpty(t, httpErr.Message)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// CorrelationIDHeader carries the correlation ID of an operation in service requests
+const CorrelationIDHeader = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying a correlation ID, e.g. the request ID of an incoming
+// login request. Protocol operations generate one if ctx has none. The ID is sent to the service and is
+// included in logs, events, audit events and errors of the operation
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID set with WithCorrelationID
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// ensureCorrelationID returns ctx with a random correlation ID if it has none
+func ensureCorrelationID(ctx context.Context) context.Context {
+	if CorrelationIDFromContext(ctx) != "" {
+		return ctx
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return ctx
+	}
+	return WithCorrelationID(ctx, hex.EncodeToString(id))
+}
+
+// CorrelationIDFromError returns the correlation ID of the operation which returned err, if any
+func CorrelationIDFromError(err error) string {
+	for err != nil {
+		switch e := err.(type) {
+		case *correlatedError:
+			return e.id
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// correlatedError adds a correlation ID to a service request error
+type correlatedError struct {
+	id  string
+	err error
+}
+
+func withCorrelationID(ctx context.Context, err error) error {
+	id := CorrelationIDFromContext(ctx)
+	if err == nil || id == "" {
+		return err
+	}
+	return &correlatedError{id: id, err: err}
+}
+
+func (e *correlatedError) Error() string {
+	return fmt.Sprintf("%s (correlation id %s)", e.err, e.id)
+}
+
+// Cause returns the underlying error so that errors.Cause keeps working
+func (e *correlatedError) Cause() error {
+	return e.err
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_CorrelationID(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	var headers []string
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		headers = append(headers, req.Header.Get(CorrelationIDHeader))
+		return s.Do(req)
+	})
+
+	var events []*AuditEvent
+	p.AuditSink = AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) })
+
+	logger := &testLogger{}
+	p.Logger = logger
+
+	ctx := WithCorrelationID(context.Background(), "req-42")
+	rec, _, err := p.EnrollAccountContext(ctx, "passw0rd")
+	require.NoError(t, err)
+
+	_, err = p.VerifyPasswordContext(ctx, "wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+
+	_, err = p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+
+	require.Len(t, headers, 3)
+	assert.Equal(t, "req-42", headers[0])
+	assert.Equal(t, "req-42", headers[1])
+	assert.NotEmpty(t, headers[2])
+	assert.NotEqual(t, "req-42", headers[2])
+
+	require.Len(t, events, 3)
+	assert.Equal(t, "req-42", events[0].CorrelationID)
+	assert.Equal(t, "req-42", events[1].CorrelationID)
+	assert.Equal(t, headers[2], events[2].CorrelationID)
+
+	assert.Contains(t, logger.fields, F("correlation_id", "req-42"))
+
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	_, _, err = p.EnrollAccountContext(ctx, "passw0rd")
+	require.Error(t, err)
+	assert.Equal(t, "req-42", CorrelationIDFromError(err))
+	assert.Contains(t, err.Error(), "req-42")
+	assert.Equal(t, CodeTransport, ErrorCode(err))
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// HashPrefix starts hashes of PHEBackend, in the style of PHC strings such as "$argon2id$..."
+const HashPrefix = "$passw0rd$"
+
+// CredentialBackend is the contract identity platforms expect from password hashers. Hashes are
+// self-describing, so that they can share a column with hashes of other algorithms
+type CredentialBackend interface {
+	// HashForStorage protects a new password
+	HashForStorage(ctx context.Context, password []byte) ([]byte, error)
+	// Verify returns nil if password matches hash and ErrInvalidPassword if it does not
+	Verify(ctx context.Context, password, hash []byte) error
+	// NeedsRehash reports whether hash should be replaced with HashForStorage after a successful Verify
+	NeedsRehash(hash []byte) bool
+	// Understands reports whether hash is of this backend
+	Understands(hash []byte) bool
+}
+
+// PHEBackend is a CredentialBackend whose hashes are records of Protocol encoded as
+// $passw0rd$v=<key version>$<base64 record>. Record encryption keys are not available through
+// the hasher contract, applications which encrypt user data with them use Protocol directly.
+//
+// Generate makes it an Ory Kratos hash.Hasher, other identity platforms wrap it in a few lines
+type PHEBackend struct {
+	Protocol *Protocol
+}
+
+// NewPHEBackend returns a backend for p
+func NewPHEBackend(p *Protocol) *PHEBackend {
+	return &PHEBackend{Protocol: p}
+}
+
+// HashForStorage enrolls password and returns the encoded record
+func (b *PHEBackend) HashForStorage(ctx context.Context, password []byte) ([]byte, error) {
+	record, _, err := b.Protocol.EnrollAccountContext(ctx, string(password))
+	if err != nil {
+		return nil, err
+	}
+	version, _, err := UnmarshalRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	return encodeHash(version, record), nil
+}
+
+// Generate is HashForStorage
+func (b *PHEBackend) Generate(ctx context.Context, password []byte) ([]byte, error) {
+	return b.HashForStorage(ctx, password)
+}
+
+// Verify verifies password against the record encoded in hash
+func (b *PHEBackend) Verify(ctx context.Context, password, hash []byte) error {
+	record, err := decodeHash(hash)
+	if err != nil {
+		return err
+	}
+	_, err = b.Protocol.VerifyPasswordContext(ctx, string(password), record)
+	return err
+}
+
+// NeedsRehash reports whether the record in hash was enrolled with another pepper version. Records
+// only behind the key version are not rehashed, which would give them a new key, but updated with Update
+func (b *PHEBackend) NeedsRehash(hash []byte) bool {
+	record, err := decodeHash(hash)
+	if err != nil {
+		return true
+	}
+	return b.Protocol.needsRehash(record)
+}
+
+// Update returns hash with its record updated to the key version of the update token, keeping the record
+// key, or nil if it is up to date
+func (b *PHEBackend) Update(ctx context.Context, hash []byte) ([]byte, error) {
+	record, err := decodeHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := b.Protocol.UpdateEnrollmentRecordContext(ctx, record)
+	if err != nil || updated == nil {
+		return nil, err
+	}
+	version, _, err := UnmarshalRecord(updated)
+	if err != nil {
+		return nil, err
+	}
+	return encodeHash(version, updated), nil
+}
+
+// Understands reports whether hash starts with HashPrefix
+func (b *PHEBackend) Understands(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(HashPrefix))
+}
+
+// HashPassword enrolls password like bcrypt.GenerateFromPassword hashes it. The record is stored
+// for the user, see CheckPassword
+func (p *Protocol) HashPassword(password string) (record []byte, err error) {
+	record, _, err = p.EnrollAccount(password)
+	return record, err
+}
+
+// CheckPassword verifies password against record like bcrypt.CompareHashAndPassword, failing with
+// ErrInvalidPassword for a wrong one, and returns the record encryption key. needsRehash reports that
+// the record was enrolled with another pepper version and must be enrolled again with EnrollAccount while
+// the password is at hand. That gives it a new key, data encrypted with key must be encrypted again with it.
+// Records only behind the key version are not reported, they keep their key with UpdateEnrollmentRecord
+func (p *Protocol) CheckPassword(record []byte, password string) (key []byte, needsRehash bool, err error) {
+	key, err = p.VerifyPassword(password, record)
+	if err != nil {
+		return nil, false, err
+	}
+	return key, p.needsRehash(record), nil
+}
+
+// needsRehash reports whether record is invalid or not of the current pepper version
+func (p *Protocol) needsRehash(record []byte) bool {
+	needsRotation, err := p.NeedsPepperRotation(record)
+	return needsRotation || err != nil
+}
+
+func encodeHash(version uint32, record []byte) []byte {
+	hash := make([]byte, 0, len(HashPrefix)+16+base64.RawStdEncoding.EncodedLen(len(record)))
+	hash = append(hash, HashPrefix...)
+	hash = append(hash, "v="...)
+	hash = strconv.AppendUint(hash, uint64(version), 10)
+	hash = append(hash, '$')
+	return append(hash, base64.RawStdEncoding.EncodeToString(record)...)
+}
+
+// decodeHash returns the record of a hash. The version of the hash is informative, the record's one is used
+func decodeHash(hash []byte) ([]byte, error) {
+	if !bytes.HasPrefix(hash, []byte(HashPrefix+"v=")) {
+		return nil, withCode(CodeInvalidRecord, errors.New("not a passw0rd hash"))
+	}
+	parts := bytes.SplitN(hash[len(HashPrefix):], []byte("$"), 2)
+	if len(parts) != 2 {
+		return nil, withCode(CodeInvalidRecord, errors.New("invalid passw0rd hash"))
+	}
+
+	record, err := base64.RawStdEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return nil, withCode(CodeInvalidRecord, errors.Wrap(err, "invalid passw0rd hash"))
+	}
+	return record, nil
+}
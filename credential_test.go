@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPHEBackend(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	var backend CredentialBackend = NewPHEBackend(s.protocol(t, ""))
+
+	hash, err := backend.HashForStorage(ctx, []byte("passw0rd"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$passw0rd$v=1$"), string(hash))
+	assert.True(t, backend.Understands(hash))
+	assert.False(t, backend.Understands([]byte("$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA")))
+	assert.False(t, backend.NeedsRehash(hash))
+
+	require.NoError(t, backend.Verify(ctx, []byte("passw0rd"), hash))
+	assert.Equal(t, ErrInvalidPassword, backend.Verify(ctx, []byte("wrong"), hash))
+
+	err = backend.Verify(ctx, []byte("passw0rd"), []byte("$passw0rd$v=1"))
+	assert.Equal(t, CodeInvalidRecord, ErrorCode(err))
+	assert.True(t, backend.NeedsRehash([]byte("$2a$10$invalid")))
+
+	rotated := NewPHEBackend(s.protocol(t, s.rotate(t)))
+	assert.False(t, rotated.NeedsRehash(hash))
+	require.NoError(t, rotated.Verify(ctx, []byte("passw0rd"), hash))
+
+	updated, err := rotated.Update(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(updated), "$passw0rd$v=2$"), string(updated))
+	require.NoError(t, rotated.Verify(ctx, []byte("passw0rd"), updated))
+	updated, err = rotated.Update(ctx, updated)
+	require.NoError(t, err)
+	assert.Nil(t, updated)
+
+	rotated.Protocol.Peppers = map[uint32]SecretBytes{1: SecretBytes("0123456789abcdef")}
+	rotated.Protocol.PepperVersion = 1
+	assert.True(t, rotated.NeedsRehash(hash))
+}
+
+func TestProtocol_HashPassword(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	record, err := p.HashPassword("passw0rd")
+	require.NoError(t, err)
+
+	key, needsRehash, err := p.CheckPassword(record, "passw0rd")
+	require.NoError(t, err)
+	assert.NotEmpty(t, key)
+	assert.False(t, needsRehash)
+
+	_, _, err = p.CheckPassword(record, "wrong")
+	assert.Equal(t, ErrInvalidPassword, err)
+
+	// a rotation keeps the key of the record
+	rotated := s.protocol(t, s.rotate(t))
+	verified, needsRehash, err := rotated.CheckPassword(record, "passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+	assert.False(t, needsRehash)
+
+	updated, err := rotated.UpdateEnrollmentRecord(record)
+	require.NoError(t, err)
+	verified, needsRehash, err = rotated.CheckPassword(updated, "passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+	assert.False(t, needsRehash)
+
+	// a pepper rotation needs a new enrollment and gives a new key
+	rotated.Peppers = map[uint32]SecretBytes{1: SecretBytes("0123456789abcdef")}
+	rotated.PepperVersion = 1
+	verified, needsRehash, err = rotated.CheckPassword(updated, "passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+	assert.True(t, needsRehash)
+
+	record, newKey, err := rotated.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	assert.NotEqual(t, key, newKey)
+	verified, needsRehash, err = rotated.CheckPassword(record, "passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, newKey, verified)
+	assert.False(t, needsRehash)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// redact replaces sensitive data with its length and a short hash, so that dumps can be
+// compared between requests without revealing key material or enrollment payloads
+func redact(data []byte) string {
+	if len(data) == 0 {
+		return "[empty]"
+	}
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("[%d bytes sha256:%s]", len(data), hex.EncodeToString(hash[:4]))
+}
+
+// redactHeaders returns headers in a stable order with credential values redacted
+func redactHeaders(headers http.Header) []string {
+	res := make([]string, 0, len(headers))
+	for name, values := range headers {
+		for _, value := range values {
+			if name == "Apptoken" || name == "Authorization" || name == "Cookie" || name == "Set-Cookie" {
+				value = redact([]byte(value))
+			}
+			res = append(res, name+": "+value)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// dump logs internal state transitions if debug mode is enabled. Hot paths check Debug before
+// calling it, so that fields are not built when they are discarded
+func (p *Protocol) dump(ctx context.Context, msg string, fields ...Field) {
+	if p.Debug {
+		withCorrelation(ctx, p.logger()).Debug(msg, fields...)
+	}
+}
+
+// dump logs request and response traces if debug mode is enabled
+func (vc *VirgilHTTPClient) dump(ctx context.Context, msg string, fields ...Field) {
+	if vc.Debug {
+		withCorrelation(ctx, vc.logger()).Debug(msg, fields...)
+	}
+}
+
+func (vc *VirgilHTTPClient) dumpResponse(ctx context.Context, resp *http.Response, body []byte) {
+	if !vc.Debug {
+		return
+	}
+	vc.dump(ctx, "http: response", F("status", resp.StatusCode),
+		F("headers", redactHeaders(resp.Header)), F("body", redact(body)))
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_Debug(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	logger := &testLogger{}
+	p.Logger, p.Debug = logger, true
+	p.APIClient.HTTPClient.Logger, p.APIClient.HTTPClient.Debug = logger, true
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	_, err = p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+
+	assert.Contains(t, logger.lines, "debug enroll: record created")
+	assert.Contains(t, logger.lines, "debug verify: password accepted")
+	assert.Contains(t, logger.lines, "debug http: request")
+	assert.Contains(t, logger.lines, "debug http: response")
+
+	dbRecord, err := unmarshalRecord(rec)
+	require.NoError(t, err)
+
+	for _, f := range logger.fields {
+		value := fmt.Sprint(f.Value)
+		assert.NotContains(t, value, "PT.test", f.Key)
+		for _, secret := range [][]byte{key, dbRecord.Record} {
+			assert.False(t, strings.Contains(value, string(secret)) || strings.Contains(value, hex.EncodeToString(secret)), f.Key)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "[empty]", redact(nil))
+	assert.Equal(t, redact([]byte("secret")), redact([]byte("secret")))
+	assert.Regexp(t, `^\[6 bytes sha256:[0-9a-f]{8}\]$`, redact([]byte("secret")))
+}
@@ -0,0 +1,248 @@
+//go:build e2e
+// +build e2e
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// credentials mirror the response of the admin API
+type credentials struct {
+	AppToken         string   `json:"app_token"`
+	ServicePublicKey string   `json:"service_public_key"`
+	ClientSecretKey  string   `json:"client_secret_key"`
+	UpdateTokens     []string `json:"update_tokens"`
+	Version          uint32   `json:"version"`
+}
+
+func address() string {
+	if addr := os.Getenv("PASSW0RD_E2E_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "http://localhost:8080"
+}
+
+// admin calls the admin API of the service, waiting for it to come up
+func admin(t *testing.T, method, path string) *credentials {
+	req, err := http.NewRequest(method, address()+path, nil)
+	require.NoError(t, err)
+
+	var resp *http.Response
+	for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(time.Second) {
+		resp, err = http.DefaultClient.Do(req)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	require.NoError(t, err, "service is not reachable, is docker-compose up?")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	creds := &credentials{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(creds))
+	return creds
+}
+
+// protocol creates a protocol with the credentials and all update tokens of the application
+func protocol(t *testing.T, creds *credentials) *passw0rd.Protocol {
+	ctx, err := passw0rd.CreateContext(creds.AppToken, creds.ServicePublicKey, creds.ClientSecretKey, "")
+	require.NoError(t, err)
+
+	p, err := passw0rd.NewProtocol(ctx)
+	require.NoError(t, err)
+	p.APIClient = &passw0rd.APIClient{AppToken: p.AppToken, URL: address() + "/phe/v1"}
+
+	for _, token := range creds.UpdateTokens {
+		require.NoError(t, p.AddUpdateToken(token))
+	}
+	require.Equal(t, creds.Version, p.CurrentVersion())
+	return p
+}
+
+// simulate enables simulated faults of the service until the returned function is called
+func simulate(t *testing.T, cfg string) (stop func()) {
+	resp, err := http.Post(address()+"/admin/simulation", "application/json", strings.NewReader(cfg))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	return func() {
+		req, err := http.NewRequest(http.MethodDelete, address()+"/admin/simulation", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+}
+
+// simulationStats returns the counters of the current simulation
+func simulationStats(t *testing.T) map[string]interface{} {
+	resp, err := http.Get(address() + "/admin/simulation")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	stats := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	return stats
+}
+
+func rotate(t *testing.T) *credentials {
+	return admin(t, http.MethodPost, "/admin/rotate")
+}
+
+func TestEnrollAndVerify(t *testing.T) {
+	p := protocol(t, admin(t, http.MethodGet, "/admin/credentials"))
+
+	rec, key, err := p.EnrollAccount("p@ssw0Rd")
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	verified, err := p.VerifyPassword("p@ssw0Rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	_, err = p.VerifyPassword("p@ss", rec)
+	assert.Equal(t, passw0rd.ErrInvalidPassword, err)
+}
+
+func TestRotation(t *testing.T) {
+	p := protocol(t, admin(t, http.MethodGet, "/admin/credentials"))
+
+	rec, key, err := p.EnrollAccount("p@ssw0Rd")
+	require.NoError(t, err)
+
+	creds := rotate(t)
+	require.NoError(t, p.AddUpdateToken(creds.UpdateTokens[len(creds.UpdateTokens)-1]))
+	assert.Equal(t, creds.Version, p.CurrentVersion())
+
+	// records of the previous version keep working until they are updated
+	verified, err := p.VerifyPassword("p@ssw0Rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	newRec, err := p.UpdateEnrollmentRecord(rec)
+	require.NoError(t, err)
+
+	version, _, err := passw0rd.UnmarshalRecord(newRec)
+	require.NoError(t, err)
+	assert.Equal(t, creds.Version, version)
+
+	// a protocol configured from scratch only needs the updated record
+	verified, err = protocol(t, creds).VerifyPassword("p@ssw0Rd", newRec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	newer, _, err := p.EnrollAccount("p@ssw0Rd")
+	require.NoError(t, err)
+	version, _, err = passw0rd.UnmarshalRecord(newer)
+	require.NoError(t, err)
+	assert.Equal(t, creds.Version, version)
+}
+
+func TestMigration(t *testing.T) {
+	p := protocol(t, admin(t, http.MethodGet, "/admin/credentials"))
+
+	const users = 10
+	records := make([][]byte, users)
+	keys := make([][]byte, users)
+	for i := range records {
+		var err error
+		records[i], keys[i], err = p.EnrollAccount(fmt.Sprintf("password-%d", i))
+		require.NoError(t, err)
+	}
+
+	// records which missed several rotations are updated one version at a time
+	rotate(t)
+	creds := rotate(t)
+	tokens := creds.UpdateTokens[len(creds.UpdateTokens)-2:]
+
+	for i, rec := range records {
+		for _, token := range tokens {
+			updated, err := passw0rd.UpdateEnrollmentRecord(rec, token)
+			require.NoError(t, err)
+			rec = updated
+		}
+		records[i] = rec
+	}
+
+	migrated := protocol(t, creds)
+	for i, rec := range records {
+		version, _, err := passw0rd.UnmarshalRecord(rec)
+		require.NoError(t, err)
+		assert.Equal(t, creds.Version, version)
+
+		key, err := migrated.VerifyPassword(fmt.Sprintf("password-%d", i), rec)
+		require.NoError(t, err)
+		assert.Equal(t, keys[i], key)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	p := protocol(t, admin(t, http.MethodGet, "/admin/credentials"))
+	p.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{
+		Address: address() + "/phe/v1",
+		Retry:   &passw0rd.RetryPolicy{MaxAttempts: 10, Backoff: 10 * time.Millisecond, MaxBackoff: 2 * time.Second},
+	}
+
+	defer simulate(t, `{"latency": "normal", "latency_mean": "20ms", "latency_spread": "10ms",
+		"unavailable_rate": 0.3, "burst_length": 2, "throttle_rate": 0.05, "retry_after": "1s", "seed": 1}`)()
+
+	for i := 0; i < 10; i++ {
+		rec, key, err := p.EnrollAccount("p@ssw0Rd")
+		require.NoError(t, err)
+
+		verified, err := p.VerifyPassword("p@ssw0Rd", rec)
+		require.NoError(t, err)
+		assert.Equal(t, key, verified)
+	}
+
+	stats := simulationStats(t)
+	assert.NotZero(t, stats["unavailable"], "%v", stats)
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Command phe serves a fake passw0rd service over HTTP for the end-to-end tests. Besides the
+// service endpoints under /phe/v1 it exposes an admin API which the tests use instead of the dashboard:
+//
+//	GET  /admin/credentials  returns the application credentials and all update tokens as JSON
+//	POST /admin/rotate       rotates service keys and returns the new credentials
+//	POST /admin/simulation   enables simulated latency and faults configured by a Simulation JSON body
+//	GET  /admin/simulation   returns counters of the simulation as JSON
+//	DELETE /admin/simulation disables the simulation
+//	GET  /healthz            reports readiness
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/passw0rd/sdk-go/fake"
+)
+
+// Credentials are the application credentials returned by the admin API
+type Credentials struct {
+	AppToken         string   `json:"app_token"`
+	ServicePublicKey string   `json:"service_public_key"`
+	ClientSecretKey  string   `json:"client_secret_key"`
+	UpdateTokens     []string `json:"update_tokens"`
+	Version          uint32   `json:"version"`
+}
+
+// Simulation configures simulated latency and faults, durations are in Go syntax, e.g. "50ms"
+type Simulation struct {
+	// Latency is the distribution of response times: constant, uniform, normal or exponential
+	Latency string `json:"latency"`
+	// LatencyMean is the mean response time, LatencySpread the width of uniform or the deviation of normal latency
+	LatencyMean     string  `json:"latency_mean"`
+	LatencySpread   string  `json:"latency_spread"`
+	ThrottleRate    float64 `json:"throttle_rate"`
+	RetryAfter      string  `json:"retry_after"`
+	UnavailableRate float64 `json:"unavailable_rate"`
+	BurstLength     int     `json:"burst_length"`
+	Seed            int64   `json:"seed"`
+}
+
+// SimulationStats are the counters returned by the admin API
+type SimulationStats struct {
+	Requests    int    `json:"requests"`
+	Throttled   int    `json:"throttled"`
+	Unavailable int    `json:"unavailable"`
+	Delay       string `json:"delay"`
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	flag.Parse()
+
+	svc, err := fake.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/phe/v1/", svc)
+	mux.HandleFunc("/admin/credentials", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeCredentials(w, svc)
+	})
+	mux.HandleFunc("/admin/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, err := svc.Rotate(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeCredentials(w, svc)
+	})
+	mux.HandleFunc("/admin/simulation", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			cfg := &Simulation{}
+			if err := json.NewDecoder(r.Body).Decode(cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			sim, err := cfg.simulation()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			svc.Simulate(sim)
+		case http.MethodDelete:
+			svc.Simulate(nil)
+		case http.MethodGet:
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		stats := svc.SimulationStats()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&SimulationStats{
+			Requests:    stats.Requests,
+			Throttled:   stats.Throttled,
+			Unavailable: stats.Unavailable,
+			Delay:       stats.Delay.String(),
+		})
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("serving fake passw0rd service on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func writeCredentials(w http.ResponseWriter, svc *fake.Service) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&Credentials{
+		AppToken:         svc.AppToken,
+		ServicePublicKey: svc.ServicePublicKey,
+		ClientSecretKey:  svc.ClientSecretKey,
+		UpdateTokens:     svc.UpdateTokens(),
+		Version:          svc.CurrentVersion(),
+	})
+}
+
+func (cfg *Simulation) simulation() (*fake.Simulation, error) {
+	mean, err := parseDuration(cfg.LatencyMean)
+	if err != nil {
+		return nil, err
+	}
+	spread, err := parseDuration(cfg.LatencySpread)
+	if err != nil {
+		return nil, err
+	}
+	retryAfter, err := parseDuration(cfg.RetryAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &fake.Simulation{
+		ThrottleRate:    cfg.ThrottleRate,
+		RetryAfter:      retryAfter,
+		UnavailableRate: cfg.UnavailableRate,
+		BurstLength:     cfg.BurstLength,
+		Seed:            cfg.Seed,
+	}
+
+	switch cfg.Latency {
+	case "":
+	case "constant":
+		sim.Latency = fake.ConstantLatency(mean)
+	case "uniform":
+		sim.Latency = fake.UniformLatency(mean-spread/2, mean+spread/2)
+	case "normal":
+		sim.Latency = fake.NormalLatency(mean, spread)
+	case "exponential":
+		sim.Latency = fake.ExponentialLatency(mean)
+	default:
+		return nil, fmt.Errorf("unknown latency distribution %q", cfg.Latency)
+	}
+	return sim, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -38,5 +38,25 @@ package passw0rd
 
 import "github.com/pkg/errors"
 
-// ErrInvalidPassword is returned when protocol determines validation failure
-var ErrInvalidPassword = errors.New("invalid password")
+var (
+	// ErrInvalidPassword is returned when protocol determines validation failure
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrReplayDetected is returned when a service response fails replay protection checks
+	ErrReplayDetected = errors.New("replayed or stale service response")
+	// ErrRateLimited is the cause of RateLimitedError
+	ErrRateLimited = errors.New("too many attempts")
+	// ErrAccountLocked is the cause of AccountLockedError
+	ErrAccountLocked = errors.New("account is locked")
+	// ErrPinMismatch is returned when no service certificate matches configured pins
+	ErrPinMismatch = errors.New("service certificate does not match pinned keys")
+	// ErrKeyPolicyViolation is the cause of KeyPolicyError
+	ErrKeyPolicyViolation = errors.New("key policy violation")
+	// ErrPHEPanic is the cause of PanicError
+	ErrPHEPanic = errors.New("PHE library panic")
+	// ErrUnknownServiceKey is returned by NewProtocol when the service public key is not a known key, see Context.KnownServiceKeys
+	ErrUnknownServiceKey = errors.New("service public key is not a known key")
+	// ErrRecordChanged is returned by RecordSink.Save when the stored record is no longer the one read from the source
+	ErrRecordChanged = errors.New("stored record changed meanwhile")
+	// ErrCircuitOpen is returned without calling the service while CircuitBreaker is open
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is an operational event published to an EventBus. Use a type switch to handle events:
+//
+//	bus.Subscribe(func(e passw0rd.Event) {
+//		switch e := e.(type) {
+//		case *passw0rd.RotationApplied:
+//			log.Printf("keys rotated to version %d", e.Version)
+//		case *passw0rd.ServiceDegraded:
+//			log.Printf("passw0rd service degraded: %s", e.Err)
+//		}
+//	})
+type Event interface {
+	// EventName returns a stable event name, e.g. "rotation_applied"
+	EventName() string
+}
+
+// RotationApplied is published when protocol keys are rotated with AddUpdateToken or SetContext
+type RotationApplied struct {
+	Version         uint32
+	PreviousVersion uint32
+	Time            time.Time
+}
+
+// ServiceDegraded is published when an operation fails because the service could not be reached
+// or returned an error
+type ServiceDegraded struct {
+	Operation     string
+	Err           error
+	CorrelationID string
+	Time          time.Time
+}
+
+// CircuitOpened is published when requests to the service are suspended after repeated failures
+type CircuitOpened struct {
+	Failures int
+	Until    time.Time
+	Time     time.Time
+}
+
+// MigrationCompleted is published when a batch of records has been updated to a new key version
+type MigrationCompleted struct {
+	Version  uint32
+	Migrated int
+	Failed   int
+	Duration time.Duration
+	Time     time.Time
+}
+
+// AccountLocked is published when Lockout locks an account, see LockoutPolicy.OnLock
+type AccountLocked struct {
+	UserID string
+	Until  time.Time
+}
+
+// AccountUnlocked is published when an account is unlocked with Lockout.Unlock
+type AccountUnlocked struct {
+	UserID string
+}
+
+// KeyPolicyViolated is published for key policy violations, see KeyPolicy.OnViolation
+type KeyPolicyViolated struct {
+	Err *KeyPolicyError
+}
+
+// PinMismatched is published when no service certificate matches configured pins, see PinSet.OnMismatch
+type PinMismatched struct {
+	Err error
+}
+
+func (*RotationApplied) EventName() string    { return "rotation_applied" }
+func (*ServiceDegraded) EventName() string    { return "service_degraded" }
+func (*CircuitOpened) EventName() string      { return "circuit_opened" }
+func (*MigrationCompleted) EventName() string { return "migration_completed" }
+func (*AccountLocked) EventName() string      { return "account_locked" }
+func (*AccountUnlocked) EventName() string    { return "account_unlocked" }
+func (*KeyPolicyViolated) EventName() string  { return "key_policy_violated" }
+func (*PinMismatched) EventName() string      { return "pin_mismatched" }
+
+// EventName implements Event, security events are published to the bus as well
+func (*SecurityEvent) EventName() string { return "security_event" }
+
+// EventBus delivers events from SDK components to subscribers. Subscribers are called synchronously
+// in the publishing goroutine and must not block, see EventBus.Channel.
+// A nil *EventBus discards events. It is safe for concurrent use
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers []subscriber
+	next        int
+}
+
+type subscriber struct {
+	id int
+	fn func(Event)
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers fn for all events and returns a function which removes the subscription
+func (b *EventBus) Subscribe(fn func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subscribers = append(b.subscribers, subscriber{id: id, fn: fn})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		// copy on write, Publish iterates over the previous slice without holding the lock
+		subscribers := make([]subscriber, 0, len(b.subscribers))
+		for _, s := range b.subscribers {
+			if s.id != id {
+				subscribers = append(subscribers, s)
+			}
+		}
+		b.subscribers = subscribers
+	}
+}
+
+// Channel subscribes a buffered channel of the given size. Events are dropped while the buffer is full
+func (b *EventBus) Channel(size int) (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event, size)
+	unsubscribe = b.Subscribe(func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+	return ch, unsubscribe
+}
+
+// Publish delivers e to all subscribers
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, s := range subscribers {
+		s.fn(e)
+	}
+}
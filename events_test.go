@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	var names []string
+	unsubscribe := bus.Subscribe(func(e Event) { names = append(names, e.EventName()) })
+	ch, unsubscribeChannel := bus.Channel(1)
+
+	bus.Publish(&RotationApplied{Version: 2})
+	bus.Publish(&CircuitOpened{})
+	unsubscribe()
+	bus.Publish(&MigrationCompleted{})
+	unsubscribeChannel()
+
+	assert.Equal(t, []string{"rotation_applied", "circuit_opened"}, names)
+	assert.Equal(t, &RotationApplied{Version: 2}, <-ch)
+	assert.Len(t, ch, 0)
+
+	var nilBus *EventBus
+	nilBus.Publish(&RotationApplied{})
+}
+
+func TestProtocol_Events(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	p.Events = NewEventBus()
+	p.Lockout = NewLockout(LockoutPolicy{MaxFailures: 1, LockDuration: time.Minute, Events: p.Events})
+	events, _ := p.Events.Channel(10)
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+
+	_, err = p.VerifyPasswordContext(WithUserID(context.Background(), "alice"), "wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	_, _, err = p.EnrollAccount("passw0rd")
+	require.Error(t, err)
+
+	var names []string
+	for len(events) > 0 {
+		e := <-events
+		names = append(names, e.EventName())
+
+		if rotation, ok := e.(*RotationApplied); ok {
+			assert.Equal(t, uint32(2), rotation.Version)
+			assert.Equal(t, uint32(1), rotation.PreviousVersion)
+		}
+	}
+
+	assert.Equal(t, []string{"rotation_applied", "version_skew", "account_locked", "security_event", "service_degraded"}, names)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// expvars are published once per process under the "passw0rd" name
+var expvars struct {
+	once     sync.Once
+	mu       sync.Mutex
+	protocol *Protocol
+
+	requests *expvar.Map
+	errors   *expvar.Map
+	retries  expvar.Int
+	migrated *expvar.Int
+}
+
+// EnableExpvar publishes counters of p via expvar under the "passw0rd" name, so they are served at
+// /debug/vars together with the standard variables:
+//
+//	"passw0rd": {"requests": {"verify": 10}, "errors": {"verify": 1}, "retries": 0,
+//	             "records_migrated": 0, "current_key_version": 2}
+//
+// Counters are process-wide, the key version is reported for the last enabled protocol.
+// It sets up p.Metrics and p.Events, so it must be called before p is used
+func EnableExpvar(p *Protocol) {
+	expvars.once.Do(func() {
+		expvars.requests = new(expvar.Map).Init()
+		expvars.errors = new(expvar.Map).Init()
+		expvars.migrated = new(expvar.Int)
+
+		vars := expvar.NewMap("passw0rd")
+		vars.Set("requests", expvars.requests)
+		vars.Set("errors", expvars.errors)
+		vars.Set("retries", &expvars.retries)
+		vars.Set("records_migrated", expvars.migrated)
+		vars.Set("current_key_version", expvar.Func(func() interface{} {
+			expvars.mu.Lock()
+			defer expvars.mu.Unlock()
+
+			if expvars.protocol == nil {
+				return 0
+			}
+			return expvars.protocol.CurrentVersion()
+		}))
+	})
+
+	expvars.mu.Lock()
+	expvars.protocol = p
+	expvars.mu.Unlock()
+
+	if p.Metrics == nil {
+		p.Metrics = expvarMetrics{}
+	} else {
+		p.Metrics = MultiMetrics(p.Metrics, expvarMetrics{})
+	}
+
+	if p.Events == nil {
+		p.Events = NewEventBus()
+	}
+	p.Events.Subscribe(func(e Event) {
+		if migration, ok := e.(*MigrationCompleted); ok {
+			expvars.migrated.Add(int64(migration.Migrated))
+		}
+	})
+}
+
+type expvarMetrics struct{}
+
+func (expvarMetrics) ObserveOperation(operation string, version uint32, outcome string, duration time.Duration) {
+	expvars.requests.Add(operation, 1)
+	if outcome != OutcomeSuccess && outcome != "invalid_password" {
+		expvars.errors.Add(operation, 1)
+	}
+}
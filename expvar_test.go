@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableExpvar(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	EnableExpvar(p)
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	_, err = p.VerifyPassword("wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+
+	_, err = p.VerifyPassword("passw0rd", []byte("garbage"))
+	require.Error(t, err)
+
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+	p.Events.Publish(&MigrationCompleted{Version: 2, Migrated: 3})
+
+	var vars struct {
+		Requests          map[string]int `json:"requests"`
+		Errors            map[string]int `json:"errors"`
+		Retries           int            `json:"retries"`
+		RecordsMigrated   int            `json:"records_migrated"`
+		CurrentKeyVersion uint32         `json:"current_key_version"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("passw0rd").String()), &vars))
+
+	assert.Equal(t, 1, vars.Requests[OperationEnroll])
+	assert.Equal(t, 2, vars.Requests[OperationVerify])
+	assert.Equal(t, 1, vars.Errors[OperationVerify])
+	assert.Equal(t, 3, vars.RecordsMigrated)
+	assert.Equal(t, uint32(2), vars.CurrentKeyVersion)
+}
@@ -0,0 +1,362 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package fake provides an in-process passw0rd service for integration tests. It implements
+// the enrollment and verification endpoints on top of phe-go server functions with generated keys,
+// so the full protocol runs offline:
+//
+//	svc, err := fake.New()
+//	...
+//	protocol, err := svc.Protocol()
+//	record, key, err := protocol.EnrollAccount("passw0rd")
+package fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/phe-go"
+	"github.com/passw0rd/sdk-go"
+	"github.com/pkg/errors"
+)
+
+// Address is the service address used by protocols created with Service.Protocol
+const Address = "http://passw0rd.fake/phe/v1"
+
+// Service is a fake passw0rd service. It implements passw0rd.HTTPClient for in-process use
+// and http.Handler for use with net/http/httptest. It is safe for concurrent use
+type Service struct {
+	// AppToken, ServicePublicKey and ClientSecretKey are credentials of the fake application
+	AppToken         string
+	ServicePublicKey string
+	ClientSecretKey  string
+
+	mu       sync.RWMutex
+	keypairs map[uint32][]byte
+	current  uint32
+	tokens   []string
+	sim      *simulation
+}
+
+// New creates a service with freshly generated keys of version 1
+func New() (*Service, error) {
+	kp, err := phe.GenerateServerKeypair()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not generate server keypair")
+	}
+	return NewWithKeys(1, kp, phe.GenerateClientKey())
+}
+
+// NewWithKeys creates a service with the given server keypair and client secret key of version,
+// e.g. to reproduce records created with known keys
+func NewWithKeys(version uint32, serverKeypair, clientSecretKey []byte) (*Service, error) {
+	if version < 1 {
+		return nil, fmt.Errorf("invalid key version %d", version)
+	}
+
+	pub, err := phe.GetPublicKey(serverKeypair)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get server public key")
+	}
+
+	token := make([]byte, 32)
+	if _, err = rand.Read(token); err != nil {
+		return nil, errors.Wrap(err, "could not generate app token")
+	}
+
+	return &Service{
+		AppToken:         "PT." + base64.RawURLEncoding.EncodeToString(token),
+		ServicePublicKey: fmt.Sprintf("PK.%d.%s", version, base64.StdEncoding.EncodeToString(pub)),
+		ClientSecretKey:  fmt.Sprintf("SK.%d.%s", version, base64.StdEncoding.EncodeToString(clientSecretKey)),
+		keypairs:         map[uint32][]byte{version: serverKeypair},
+		current:          version,
+	}, nil
+}
+
+// Rotate generates keys of the next version and returns the update token for them
+func (s *Service) Rotate() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, kp, err := phe.Rotate(s.keypairs[s.current])
+	if err != nil {
+		return "", errors.Wrap(err, "could not rotate server keypair")
+	}
+
+	s.current++
+	s.keypairs[s.current] = kp
+
+	updateToken := fmt.Sprintf("UT.%d.%s", s.current, base64.StdEncoding.EncodeToString(token))
+	s.tokens = append(s.tokens, updateToken)
+	return updateToken, nil
+}
+
+// CurrentVersion returns the current key version of the service
+func (s *Service) CurrentVersion() uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// UpdateToken returns the update token of the current version, or an empty string if keys were never rotated
+func (s *Service) UpdateToken() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.tokens) == 0 {
+		return ""
+	}
+	return s.tokens[len(s.tokens)-1]
+}
+
+// UpdateTokens returns update tokens of all rotations in version order
+func (s *Service) UpdateTokens() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.tokens...)
+}
+
+// Context creates a context with the credentials of the service and keys of all its versions.
+// The update token of the context is the latest one
+func (s *Service) Context() (*passw0rd.Context, error) {
+	tokens := s.UpdateTokens()
+	if len(tokens) == 0 {
+		return passw0rd.CreateContext(s.AppToken, s.ServicePublicKey, s.ClientSecretKey, "")
+	}
+
+	ctx, err := passw0rd.CreateContext(s.AppToken, s.ServicePublicKey, s.ClientSecretKey, tokens[0])
+	if err != nil || len(tokens) == 1 {
+		return ctx, err
+	}
+
+	// CreateContext accepts a single update token, keys of later versions are derived like the generator does
+	last, token, err := passw0rd.ParseVersionAndContent("UT", tokens[len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	gen := s.Generator()
+	for version := ctx.Version + 1; version <= last; version++ {
+		if ctx.PHEClients[version], err = gen.client(version); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx.Version = last
+	ctx.UpdateToken = &passw0rd.VersionedUpdateToken{Version: last, UpdateToken: token}
+	return ctx, nil
+}
+
+// Protocol creates a protocol which talks to the service in-process
+func (s *Service) Protocol() (*passw0rd.Protocol, error) {
+	ctx, err := s.Context()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := passw0rd.NewProtocol(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.APIClient = &passw0rd.APIClient{
+		AppToken:   p.AppToken,
+		URL:        Address,
+		HTTPClient: &passw0rd.VirgilHTTPClient{Client: s, Address: Address},
+	}
+	return p, nil
+}
+
+// Do implements passw0rd.HTTPClient
+func (s *Service) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	status, header, body, err := s.serve(req)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// VerifyPasswordBatch implements passw0rd.BatchVerifier. The real service has no bulk endpoint,
+// it lets tests run protocols with passw0rd.VerifyBatcher. Simulated faults do not apply to it
+func (s *Service) VerifyPasswordBatch(ctx context.Context, reqs []*passw0rd.VerifyPasswordRequest) ([]*passw0rd.VerifyPasswordResponse, error) {
+	resps := make([]*passw0rd.VerifyPasswordResponse, len(reqs))
+	for i, req := range reqs {
+		kp := s.keypair(req.Version)
+		if kp == nil {
+			return nil, &passw0rd.HttpError{Code: http.StatusBadRequest, Message: fmt.Sprintf("unknown key version %d", req.Version)}
+		}
+
+		resp, err := phe.VerifyPassword(kp, req.Request)
+		if err != nil {
+			return nil, &passw0rd.HttpError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		resps[i] = &passw0rd.VerifyPasswordResponse{Response: resp}
+	}
+	return resps, nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Service) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	status, header, body, err := s.serve(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// serve answers req with a simulated fault if there is one, or handles it
+func (s *Service) serve(req *http.Request) (status int, header http.Header, body []byte, err error) {
+	status, header, err = s.simulate(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if status != 0 {
+		body, err = proto.Marshal(&passw0rd.HttpError{Code: uint32(status), Message: http.StatusText(status)})
+	} else {
+		status, body, err = s.handle(req)
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/protobuf")
+	return status, header, body, nil
+}
+
+func (s *Service) handle(req *http.Request) (status int, body []byte, err error) {
+	if req.Method != http.MethodPost {
+		return reply(http.StatusMethodNotAllowed, &passw0rd.HttpError{Code: http.StatusMethodNotAllowed, Message: "method not allowed"})
+	}
+
+	if req.Header.Get("AppToken") != s.AppToken {
+		return reply(http.StatusUnauthorized, &passw0rd.HttpError{Code: http.StatusUnauthorized, Message: "invalid app token"})
+	}
+
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch path.Base(req.URL.Path) {
+	case "enroll":
+		return s.enroll(payload)
+	case "verify-password":
+		return s.verify(payload)
+	}
+	return reply(http.StatusNotFound, nil)
+}
+
+func (s *Service) enroll(payload []byte) (int, []byte, error) {
+	req := &passw0rd.EnrollmentRequest{}
+	if err := proto.Unmarshal(payload, req); err != nil {
+		return badRequest(err)
+	}
+
+	kp := s.keypair(req.Version)
+	if kp == nil {
+		return badRequest(fmt.Errorf("unknown key version %d", req.Version))
+	}
+
+	enrollment, err := phe.GetEnrollment(kp)
+	if err != nil {
+		return badRequest(err)
+	}
+	return reply(http.StatusOK, &passw0rd.EnrollmentResponse{Version: req.Version, Response: enrollment})
+}
+
+func (s *Service) verify(payload []byte) (int, []byte, error) {
+	req := &passw0rd.VerifyPasswordRequest{}
+	if err := proto.Unmarshal(payload, req); err != nil {
+		return badRequest(err)
+	}
+
+	kp := s.keypair(req.Version)
+	if kp == nil {
+		return badRequest(fmt.Errorf("unknown key version %d", req.Version))
+	}
+
+	resp, err := phe.VerifyPassword(kp, req.Request)
+	if err != nil {
+		return badRequest(err)
+	}
+	return reply(http.StatusOK, &passw0rd.VerifyPasswordResponse{Response: resp})
+}
+
+func (s *Service) keypair(version uint32) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keypairs[version]
+}
+
+func badRequest(err error) (int, []byte, error) {
+	return reply(http.StatusBadRequest, &passw0rd.HttpError{Code: http.StatusBadRequest, Message: err.Error()})
+}
+
+func reply(status int, msg proto.Message) (int, []byte, error) {
+	if msg == nil {
+		return status, nil, nil
+	}
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return 0, nil, err
+	}
+	return status, body, nil
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/passw0rd/phe-go"
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	svc, err := New()
+	require.NoError(t, err)
+
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	verified, err := p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	_, err = p.VerifyPassword("wrong", rec)
+	assert.Equal(t, passw0rd.ErrInvalidPassword, err)
+
+	token, err := svc.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, []string{token}, svc.UpdateTokens())
+	require.NoError(t, p.AddUpdateToken(token))
+
+	newRec, err := p.UpdateEnrollmentRecord(rec)
+	require.NoError(t, err)
+
+	rotated, err := svc.Protocol()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), rotated.CurrentVersion())
+
+	verified, err = rotated.VerifyPassword("passw0rd", newRec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+}
+
+func TestService_HTTP(t *testing.T) {
+	svc, err := New()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	ctx, err := svc.Context()
+	require.NoError(t, err)
+
+	p, err := passw0rd.NewProtocol(ctx)
+	require.NoError(t, err)
+	p.APIClient = &passw0rd.APIClient{AppToken: p.AppToken, URL: server.URL}
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	verified, err := p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	ctx, err = passw0rd.CreateContext("PT.wrong", svc.ServicePublicKey, svc.ClientSecretKey, "")
+	require.NoError(t, err)
+	p, err = passw0rd.NewProtocol(ctx)
+	require.NoError(t, err)
+	p.APIClient = &passw0rd.APIClient{AppToken: p.AppToken, URL: server.URL}
+
+	_, _, err = p.EnrollAccount("passw0rd")
+	assert.Equal(t, passw0rd.CodeServiceError, passw0rd.ErrorCode(err))
+}
+
+func TestNewWithKeys(t *testing.T) {
+	kp, err := phe.GenerateServerKeypair()
+	require.NoError(t, err)
+
+	svc, err := NewWithKeys(3, kp, phe.GenerateClientKey())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), svc.CurrentVersion())
+
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	version, _, err := passw0rd.UnmarshalRecord(rec)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), version)
+
+	_, err = svc.Rotate()
+	require.NoError(t, err)
+	generated, _, err := svc.Generator().Record(4, "passw0rd")
+	require.NoError(t, err)
+
+	p, err = svc.Protocol()
+	require.NoError(t, err)
+	_, err = p.VerifyPassword("passw0rd", generated)
+	assert.NoError(t, err)
+
+	_, err = NewWithKeys(0, kp, phe.GenerateClientKey())
+	assert.Error(t, err)
+}
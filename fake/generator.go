@@ -0,0 +1,216 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/passw0rd/phe-go"
+	"github.com/passw0rd/sdk-go"
+	"github.com/pkg/errors"
+)
+
+// Generator produces valid enrollment records at any key version of a service without
+// requests, so that load tests of storage and record migration can run on large datasets.
+// It is safe for concurrent use
+type Generator struct {
+	// Password returns the password of the i-th generated record, "password-<i>" if it is nil
+	Password func(i int) string
+	// Workers is the number of goroutines used by Generate, runtime.NumCPU() if it is not positive
+	Workers int
+
+	svc     *Service
+	mu      sync.Mutex
+	clients map[uint32]*phe.Client
+}
+
+// Generator returns a record generator which uses the keys of the service
+func (s *Service) Generator() *Generator {
+	return &Generator{svc: s, clients: make(map[uint32]*phe.Client)}
+}
+
+// Record enrolls password with the keys of version and returns the record and its encryption key
+func (g *Generator) Record(version uint32, password string) (record []byte, key []byte, err error) {
+	client, err := g.client(version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enrollment, err := phe.GetEnrollment(g.svc.keypair(version))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not get enrollment")
+	}
+
+	rec, key, err := client.EnrollAccount([]byte(password), enrollment)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not enroll account")
+	}
+
+	record, err = passw0rd.MarshalRecord(version, rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return record, key, nil
+}
+
+// Generate creates n records of version in parallel and passes them to fn along with their index.
+// fn is called from the calling goroutine in no particular order. Generation stops at the first error
+func (g *Generator) Generate(version uint32, n int, fn func(i int, record, key []byte) error) error {
+	if _, err := g.client(version); err != nil {
+		return err
+	}
+
+	type result struct {
+		i           int
+		record, key []byte
+		err         error
+	}
+
+	workers := g.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	indexes := make(chan int)
+	results := make(chan result)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(indexes)
+		for i := 0; i < n; i++ {
+			select {
+			case indexes <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				record, key, err := g.Record(version, g.password(i))
+				select {
+				case results <- result{i: i, record: record, key: key, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if res.err != nil {
+			return res.err
+		}
+		if err := fn(res.i, res.record, res.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Generator) password(i int) string {
+	if g.Password != nil {
+		return g.Password(i)
+	}
+	return fmt.Sprintf("password-%d", i)
+}
+
+// client returns the client of version. Client keys the service was created with are rotated
+// with its update tokens up to the requested version
+func (g *Generator) client(version uint32) (*phe.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if client, ok := g.clients[version]; ok {
+		return client, nil
+	}
+
+	first, sk, err := passw0rd.ParseVersionAndContent("SK", g.svc.ClientSecretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := g.svc.UpdateTokens()
+	if version < first || version > first+uint32(len(tokens)) {
+		return nil, fmt.Errorf("unknown key version %d", version)
+	}
+
+	client, ok := g.clients[first]
+	if !ok {
+		_, pub, err := passw0rd.ParseVersionAndContent("PK", g.svc.ServicePublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if client, err = phe.NewClient(sk, pub); err != nil {
+			return nil, errors.Wrap(err, "could not create PHE client")
+		}
+		g.clients[first] = client
+	}
+
+	for v := first + 1; v <= version; v++ {
+		if next, ok := g.clients[v]; ok {
+			client = next
+			continue
+		}
+
+		_, token, err := passw0rd.ParseVersionAndContent("UT", tokens[v-first-1])
+		if err != nil {
+			return nil, err
+		}
+
+		// Rotate replaces key fields, so the copy leaves the previous client intact
+		next := *client
+		if err = next.Rotate(token); err != nil {
+			return nil, errors.Wrap(err, "could not rotate client keys")
+		}
+		client = &next
+		g.clients[v] = client
+	}
+	return client, nil
+}
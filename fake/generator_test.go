@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator(t *testing.T) {
+	svc, err := New()
+	require.NoError(t, err)
+
+	gen := svc.Generator()
+	v1, key1, err := gen.Record(1, "passw0rd")
+	require.NoError(t, err)
+
+	_, err = svc.Rotate()
+	require.NoError(t, err)
+
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	verified, err := p.VerifyPassword("passw0rd", v1)
+	require.NoError(t, err)
+	assert.Equal(t, key1, verified)
+
+	const n = 20
+	keys := make(map[int][]byte)
+	err = gen.Generate(2, n, func(i int, record, key []byte) error {
+		version, _, err := passw0rd.UnmarshalRecord(record)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), version)
+		keys[i] = key
+
+		verified, err := p.VerifyPassword(fmt.Sprintf("password-%d", i), record)
+		require.NoError(t, err)
+		assert.Equal(t, key, verified)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, keys, n)
+
+	stop := fmt.Errorf("stop")
+	assert.Equal(t, stop, gen.Generate(2, n, func(int, []byte, []byte) error { return stop }))
+
+	_, _, err = gen.Record(3, "passw0rd")
+	assert.Error(t, err)
+}
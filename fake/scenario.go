@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/pkg/errors"
+)
+
+// User is an account of a scenario with its current record
+type User struct {
+	ID       string
+	Password string
+	Record   []byte
+	// Key is the encryption key derived at enrollment, it survives record updates
+	Key []byte
+}
+
+// Scenario simulates the state of an application going through several rotations: a chain
+// of key versions and users whose records are spread over them. It lets applications test their
+// rotation runbooks against the fake service:
+//
+//	sc, err := fake.NewScenario()
+//	...
+//	_, err = sc.Enroll(1, 100)
+//	_, err = sc.Rotate(2)
+//	_, err = sc.Enroll(3, 100)
+//	...
+//	runRunbook(sc.Service, sc.Users)
+//	err = sc.Check(protocol)
+type Scenario struct {
+	Service *Service
+	Users   []*User
+
+	gen *Generator
+}
+
+// NewScenario creates a scenario on a new service with keys of version 1 and no users
+func NewScenario() (*Scenario, error) {
+	svc, err := New()
+	if err != nil {
+		return nil, err
+	}
+	return &Scenario{Service: svc, gen: svc.Generator()}, nil
+}
+
+// Rotate rotates service keys n times and returns the new update tokens in version order
+func (sc *Scenario) Rotate(n int) ([]string, error) {
+	tokens := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		token, err := sc.Service.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Enroll adds n users with records of version and returns them
+func (sc *Scenario) Enroll(version uint32, n int) ([]*User, error) {
+	users := make([]*User, n)
+	first := len(sc.Users)
+
+	sc.gen.Password = func(i int) string { return fmt.Sprintf("password-%d", first+i) }
+	err := sc.gen.Generate(version, n, func(i int, record, key []byte) error {
+		users[i] = &User{
+			ID:       fmt.Sprintf("user-%d", first+i),
+			Password: fmt.Sprintf("password-%d", first+i),
+			Record:   record,
+			Key:      key,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sc.Users = append(sc.Users, users...)
+	return users, nil
+}
+
+// Protocol creates a protocol which knows keys of all versions of the service
+func (sc *Scenario) Protocol() (*passw0rd.Protocol, error) {
+	return sc.Service.Protocol()
+}
+
+// Versions returns the number of users by record version
+func (sc *Scenario) Versions() (map[uint32]int, error) {
+	versions := make(map[uint32]int)
+	for _, u := range sc.Users {
+		version, _, err := passw0rd.UnmarshalRecord(u.Record)
+		if err != nil {
+			return nil, errors.Wrapf(err, "record of %s", u.ID)
+		}
+		versions[version]++
+	}
+	return versions, nil
+}
+
+// UpdateAll brings records of all users to the current version with the chain of update tokens,
+// e.g. to compare the outcome of a runbook with. It returns the number of updated records
+func (sc *Scenario) UpdateAll() (int, error) {
+	tokens := sc.Service.UpdateTokens()
+	updated := 0
+	for _, u := range sc.Users {
+		version, _, err := passw0rd.UnmarshalRecord(u.Record)
+		if err != nil {
+			return updated, errors.Wrapf(err, "record of %s", u.ID)
+		}
+
+		// scenarios start at version 1, so tokens[i] updates records of version i+1
+		record := u.Record
+		for _, token := range tokens[version-1:] {
+			if record, err = passw0rd.UpdateEnrollmentRecord(record, token); err != nil {
+				return updated, errors.Wrapf(err, "could not update record of %s", u.ID)
+			}
+		}
+
+		if int(version) <= len(tokens) {
+			u.Record = record
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// Check verifies the password of every user with p and returns an error listing users whose
+// records are rejected or yield a different key
+func (sc *Scenario) Check(p *passw0rd.Protocol) error {
+	var failed []string
+	for _, u := range sc.Users {
+		key, err := p.VerifyPassword(u.Password, u.Record)
+		if err != nil || !bytes.Equal(key, u.Key) {
+			failed = append(failed, u.ID)
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%d of %d users failed verification: %v", len(failed), len(sc.Users), failed)
+	}
+	return nil
+}
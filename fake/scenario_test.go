@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenario(t *testing.T) {
+	sc, err := NewScenario()
+	require.NoError(t, err)
+
+	_, err = sc.Enroll(1, 3)
+	require.NoError(t, err)
+	tokens, err := sc.Rotate(2)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 2)
+	_, err = sc.Enroll(2, 2)
+	require.NoError(t, err)
+	users, err := sc.Enroll(3, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "user-5", users[0].ID)
+
+	versions, err := sc.Versions()
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]int{1: 3, 2: 2, 3: 1}, versions)
+
+	p, err := sc.Protocol()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), p.CurrentVersion())
+	require.NoError(t, sc.Check(p))
+
+	// a runbook step which only applies the latest token leaves version 1 records behind
+	for _, u := range sc.Users {
+		if record, err := p.UpdateEnrollmentRecord(u.Record); err == nil && record != nil {
+			u.Record = record
+		}
+	}
+	versions, err = sc.Versions()
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]int{1: 3, 3: 3}, versions)
+
+	updated, err := sc.UpdateAll()
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated)
+	versions, err = sc.Versions()
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]int{3: 6}, versions)
+	require.NoError(t, sc.Check(p))
+
+	sc.Users[0].Password = "wrong"
+	assert.EqualError(t, sc.Check(p), "1 of 6 users failed verification: [user-0]")
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+var seedMu sync.Mutex
+
+// Seed replaces crypto/rand.Reader with a deterministic stream derived from seed until the returned
+// function is called. Keys, app tokens, enrollments and proofs created in between, both by the service
+// and by protocols talking to it, are reproducible across test runs, which allows golden-file snapshots
+// of full protocol exchanges:
+//
+//	defer fake.Seed(42)()
+//	svc, err := fake.New()
+//
+// The stream is only reproducible if randomness is consumed in the same order, so requests must be
+// sequential and Generator.Workers must be 1. Seed serializes seeded sections of concurrent tests and
+// must not be nested. It is meant for tests only, since crypto/rand.Reader is replaced process-wide
+func Seed(seed int64) (restore func()) {
+	seedMu.Lock()
+
+	orig := rand.Reader
+	rand.Reader = newSeededReader(seed)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			rand.Reader = orig
+			seedMu.Unlock()
+		})
+	}
+}
+
+// seededReader is a SHA-256 counter mode stream. It is not a secure generator, only a stable one
+type seededReader struct {
+	mu      sync.Mutex
+	seed    [8]byte
+	counter uint64
+	buf     []byte
+}
+
+func newSeededReader(seed int64) io.Reader {
+	r := &seededReader{}
+	binary.BigEndian.PutUint64(r.seed[:], uint64(seed))
+	return r
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			var block [16]byte
+			copy(block[:8], r.seed[:])
+			binary.BigEndian.PutUint64(block[8:], r.counter)
+			r.counter++
+			sum := sha256.Sum256(block[:])
+			r.buf = sum[:]
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder captures request and response bodies of the service
+type recorder struct {
+	svc       *Service
+	exchanges [][]byte
+}
+
+func (r *recorder) Do(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	resp, err := r.svc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.exchanges = append(r.exchanges, body, respBody)
+	return resp, nil
+}
+
+type seededRun struct {
+	appToken, publicKey, secretKey, updateToken string
+	record, key                                 []byte
+	exchanges                                   [][]byte
+}
+
+func runSeeded(t *testing.T, seed int64) *seededRun {
+	defer Seed(seed)()
+
+	svc, err := New()
+	require.NoError(t, err)
+	updateToken, err := svc.Rotate()
+	require.NoError(t, err)
+
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+	rec := &recorder{svc: svc}
+	p.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{Client: rec, Address: Address}
+
+	record, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	verified, err := p.VerifyPassword("passw0rd", record)
+	require.NoError(t, err)
+	require.Equal(t, key, verified)
+
+	return &seededRun{
+		appToken:    svc.AppToken,
+		publicKey:   svc.ServicePublicKey,
+		secretKey:   svc.ClientSecretKey,
+		updateToken: updateToken,
+		record:      record,
+		key:         key,
+		exchanges:   rec.exchanges,
+	}
+}
+
+func TestSeed(t *testing.T) {
+	first := runSeeded(t, 42)
+	second := runSeeded(t, 42)
+	assert.Equal(t, first, second)
+	assert.Len(t, first.exchanges, 4)
+
+	other := runSeeded(t, 43)
+	assert.NotEqual(t, first.secretKey, other.secretKey)
+	assert.NotEqual(t, first.record, other.record)
+}
+
+func TestSeed_Restore(t *testing.T) {
+	restore := Seed(1)
+	restore()
+	restore()
+
+	svc1, err := New()
+	require.NoError(t, err)
+	svc2, err := New()
+	require.NoError(t, err)
+	assert.NotEqual(t, svc1.ClientSecretKey, svc2.ClientSecretKey)
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// Latency is a distribution of simulated response times
+type Latency func(r *rand.Rand) time.Duration
+
+// ConstantLatency delays every response by d
+func ConstantLatency(d time.Duration) Latency {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// UniformLatency delays responses by a duration evenly distributed between min and max
+func UniformLatency(min, max time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// NormalLatency delays responses by a normally distributed duration, negative samples are cut to zero
+func NormalLatency(mean, stddev time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		d := time.Duration(r.NormFloat64()*float64(stddev)) + mean
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+}
+
+// ExponentialLatency delays responses by an exponentially distributed duration with the given mean,
+// which gives the long tail of a loaded service
+func ExponentialLatency(mean time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(math.Min(r.ExpFloat64()*float64(mean), math.MaxInt64))
+	}
+}
+
+// Simulation makes the service behave like a loaded production one, so that retries and backoff of
+// clients can be verified end to end. Rates are probabilities from 0 to 1
+type Simulation struct {
+	// Latency is waited before every response, none if nil
+	Latency Latency
+	// ThrottleRate answers requests with 429 and a Retry-After of RetryAfter rounded up to seconds
+	ThrottleRate float64
+	RetryAfter   time.Duration
+	// UnavailableRate starts bursts of BurstLength 503 responses, BurstLength is 1 if not set
+	UnavailableRate float64
+	BurstLength     int
+	// Seed makes the simulation reproducible, a time based seed is used if zero
+	Seed int64
+	// Clock waits latencies, the system clock if nil
+	Clock passw0rd.Clock
+}
+
+// SimulationStats counts requests and simulated faults
+type SimulationStats struct {
+	Requests    int
+	Throttled   int
+	Unavailable int
+	// Delay is the total simulated latency
+	Delay time.Duration
+}
+
+type simulation struct {
+	*Simulation
+	rnd   *rand.Rand
+	burst int
+	stats SimulationStats
+}
+
+// Simulate enables the simulation for subsequent requests, nil disables it. Statistics are reset
+func (s *Service) Simulate(sim *Simulation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sim == nil {
+		s.sim = nil
+		return
+	}
+
+	seed := sim.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s.sim = &simulation{Simulation: sim, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// SimulationStats returns the counters of the current simulation
+func (s *Service) SimulationStats() SimulationStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.sim == nil {
+		return SimulationStats{}
+	}
+	return s.sim.stats
+}
+
+// simulate waits the simulated latency of req and returns the status and headers of a simulated
+// fault, a zero status if the request is to be served
+func (s *Service) simulate(req *http.Request) (int, http.Header, error) {
+	status, header, delay, clock := s.decide()
+	if delay > 0 {
+		timer := clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-req.Context().Done():
+			timer.Stop()
+			return 0, nil, req.Context().Err()
+		}
+	}
+	return status, header, nil
+}
+
+func (s *Service) decide() (status int, header http.Header, delay time.Duration, clock passw0rd.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sim := s.sim
+	if sim == nil {
+		return 0, nil, 0, nil
+	}
+
+	sim.stats.Requests++
+	if sim.Latency != nil {
+		delay = sim.Latency(sim.rnd)
+		sim.stats.Delay += delay
+	}
+	clock = sim.Clock
+	if clock == nil {
+		clock = passw0rd.SystemClock
+	}
+
+	switch {
+	case sim.burst > 0:
+		sim.burst--
+		sim.stats.Unavailable++
+		return http.StatusServiceUnavailable, nil, delay, clock
+	case sim.rnd.Float64() < sim.UnavailableRate:
+		sim.burst = sim.BurstLength - 1
+		if sim.burst < 0 {
+			sim.burst = 0
+		}
+		sim.stats.Unavailable++
+		return http.StatusServiceUnavailable, nil, delay, clock
+	case sim.rnd.Float64() < sim.ThrottleRate:
+		sim.stats.Throttled++
+		seconds := int((sim.RetryAfter + time.Second - 1) / time.Second)
+		return http.StatusTooManyRequests, http.Header{"Retry-After": {strconv.Itoa(seconds)}}, delay, clock
+	}
+	return 0, nil, delay, clock
+}
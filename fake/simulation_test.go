@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package fake
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// instantClock records waited durations and fires timers immediately
+type instantClock struct {
+	mu     sync.Mutex
+	waited []time.Duration
+}
+
+func (c *instantClock) Now() time.Time { return time.Now() }
+
+func (c *instantClock) NewTimer(d time.Duration) passw0rd.Timer {
+	c.mu.Lock()
+	c.waited = append(c.waited, d)
+	c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return instantTimer(ch)
+}
+
+type instantTimer chan time.Time
+
+func (t instantTimer) C() <-chan time.Time { return t }
+func (t instantTimer) Stop() bool          { return false }
+
+func TestLatency(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, time.Second, ConstantLatency(time.Second)(r))
+
+		d := UniformLatency(10*time.Millisecond, 20*time.Millisecond)(r)
+		assert.True(t, d >= 10*time.Millisecond && d < 20*time.Millisecond, d)
+
+		assert.True(t, NormalLatency(time.Millisecond, time.Second)(r) >= 0)
+		assert.True(t, ExponentialLatency(time.Millisecond)(r) >= 0)
+	}
+}
+
+func TestSimulation_Throttle(t *testing.T) {
+	svc, err := New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	clock := &instantClock{}
+	svc.Simulate(&Simulation{Latency: ConstantLatency(50 * time.Millisecond), ThrottleRate: 1, RetryAfter: 1500 * time.Millisecond, Clock: clock})
+
+	server := httptest.NewServer(svc)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/phe/v1/enroll", strings.NewReader(""))
+	require.NoError(t, err)
+	req.Header.Set("AppToken", svc.AppToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	_, _, err = p.EnrollAccount("passw0rd")
+	require.Error(t, err)
+	assert.Equal(t, passw0rd.CodeServiceError, passw0rd.ErrorCode(err))
+
+	assert.Equal(t, SimulationStats{Requests: 2, Throttled: 2, Delay: 100 * time.Millisecond}, svc.SimulationStats())
+	assert.Equal(t, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond}, clock.waited)
+
+	svc.Simulate(nil)
+	_, _, err = p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, SimulationStats{}, svc.SimulationStats())
+}
+
+func TestSimulation_Retry(t *testing.T) {
+	svc, err := New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	svc.Simulate(&Simulation{UnavailableRate: 0.3, BurstLength: 2, ThrottleRate: 0.2, RetryAfter: time.Second, Seed: 1, Clock: &instantClock{}})
+	p.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{
+		Client:  svc,
+		Address: Address,
+		Retry:   &passw0rd.RetryPolicy{MaxAttempts: 10, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second},
+		Clock:   &instantClock{},
+	}
+
+	for i := 0; i < 20; i++ {
+		record, key, err := p.EnrollAccount("passw0rd")
+		require.NoError(t, err)
+		verified, err := p.VerifyPassword("passw0rd", record)
+		require.NoError(t, err)
+		require.Equal(t, key, verified)
+	}
+
+	stats := svc.SimulationStats()
+	assert.True(t, stats.Unavailable > 0, "%+v", stats)
+	assert.True(t, stats.Throttled > 0, "%+v", stats)
+	assert.Equal(t, 40, stats.Requests-stats.Unavailable-stats.Throttled)
+}
@@ -0,0 +1,74 @@
+//go:build passw0rdfaults
+// +build passw0rdfaults
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import "context"
+
+// Fault decides whether an operation fails at a fault point. It returns the error to fail with, or nil
+// to continue. Operation is one of OperationEnroll, OperationVerify and OperationUpdate
+type Fault func(operation string, point FaultPoint, version uint32) error
+
+type faultKey struct{}
+
+// WithFault returns a context which makes Protocol operations started with it fail as decided by fault.
+// It is only available in builds with the passw0rdfaults tag:
+//
+//	go test -tags passw0rdfaults ./...
+func WithFault(ctx context.Context, fault Fault) context.Context {
+	return context.WithValue(ctx, faultKey{}, fault)
+}
+
+// FailAt returns a Fault which fails operation at point with err
+func FailAt(operation string, point FaultPoint, err error) Fault {
+	return func(op string, p FaultPoint, version uint32) error {
+		if op == operation && p == point {
+			return err
+		}
+		return nil
+	}
+}
+
+func injectedFault(ctx context.Context, operation string, point FaultPoint, version uint32) error {
+	fault, _ := ctx.Value(faultKey{}).(Fault)
+	if fault == nil {
+		return nil
+	}
+	return fault(operation, point, version)
+}
@@ -0,0 +1,142 @@
+//go:build passw0rdfaults
+// +build passw0rdfaults
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected")
+
+func TestFault_Enroll(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	requests := 0
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return s.Do(req)
+	})
+
+	var events []*AuditEvent
+	p.AuditSink = AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) })
+
+	ctx := WithFault(context.Background(), FailAt(OperationEnroll, FaultBeforeServiceCall, errInjected))
+	_, _, err := p.EnrollAccountContext(ctx, "passw0rd")
+	assert.Equal(t, errInjected, err)
+	assert.Equal(t, 0, requests)
+
+	ctx = WithFault(context.Background(), FailAt(OperationEnroll, FaultAfterServiceCall, errInjected))
+	_, _, err = p.EnrollAccountContext(ctx, "passw0rd")
+	assert.Equal(t, errInjected, err)
+	assert.Equal(t, 1, requests)
+
+	ctx = WithFault(context.Background(), FailAt(OperationEnroll, FaultBeforeMarshal, errInjected))
+	rec, key, err := p.EnrollAccountContext(ctx, "passw0rd")
+	assert.EqualError(t, err, "could not serialize enrollment record: injected")
+	assert.Equal(t, errInjected, errors.Cause(err))
+	assert.Nil(t, rec)
+	assert.Nil(t, key)
+
+	assert.Empty(t, events)
+}
+
+func TestFault_Verify(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	p.Lockout = NewLockout(LockoutPolicy{MaxFailures: 1, LockDuration: time.Hour})
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	var events []*AuditEvent
+	p.AuditSink = AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) })
+
+	var versions []uint32
+	fault := func(operation string, point FaultPoint, version uint32) error {
+		if operation == OperationVerify && point == FaultAfterServiceCall {
+			versions = append(versions, version)
+			return errInjected
+		}
+		return nil
+	}
+
+	ctx := WithUserID(WithFault(context.Background(), fault), "alice")
+	_, err = p.VerifyPasswordContext(ctx, "passw0rd", rec)
+	assert.EqualError(t, err, "error while requesting service: injected")
+	assert.Equal(t, []uint32{1}, versions)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, AuditVerificationFailure, events[0].Type)
+
+	// injected failures are not wrong passwords and must not lock users out
+	key, err := p.VerifyPasswordContext(WithUserID(context.Background(), "alice"), "passw0rd", rec)
+	require.NoError(t, err)
+	assert.NotEmpty(t, key)
+}
+
+func TestFault_Update(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+
+	var events []*AuditEvent
+	p.AuditSink = AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) })
+
+	ctx := WithFault(context.Background(), FailAt(OperationUpdate, FaultBeforeMarshal, errInjected))
+	updated, err := p.UpdateEnrollmentRecordContext(ctx, rec)
+	assert.Equal(t, errInjected, err)
+	assert.Nil(t, updated)
+	assert.Empty(t, events)
+
+	updated, err = p.UpdateEnrollmentRecord(rec)
+	require.NoError(t, err)
+	assert.NotNil(t, updated)
+}
@@ -0,0 +1,238 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/phe-go"
+	"github.com/stretchr/testify/require"
+)
+
+// knownRecord marshals a self-test phe record into a database record of the given version
+func knownRecord(tb testing.TB, version uint32, rec string) []byte {
+	record, err := MarshalRecord(version, mustDecode(rec))
+	require.NoError(tb, err)
+	return record
+}
+
+func FuzzUnmarshalRecord(f *testing.F) {
+	f.Add(knownRecord(f, 1, selfTestRecord))
+	f.Add(knownRecord(f, 2, selfTestUpdatedRecord))
+	f.Add(mustDecode(selfTestRecord))
+	f.Add([]byte{})
+	f.Add([]byte{0x08, 0x00})
+
+	f.Fuzz(func(t *testing.T, record []byte) {
+		version, rec, err := UnmarshalRecord(record)
+		if err != nil {
+			if ErrorCode(err) != CodeInvalidRecord {
+				t.Fatalf("unexpected code %s: %v", ErrorCode(err), err)
+			}
+			return
+		}
+
+		again, err := MarshalRecord(version, rec)
+		require.NoError(t, err)
+
+		v2, rec2, err := UnmarshalRecord(again)
+		require.NoError(t, err)
+		require.Equal(t, version, v2)
+		require.Equal(t, rec, rec2)
+	})
+}
+
+// FuzzWireMessages checks that hand-written encoding agrees with the proto package
+func FuzzWireMessages(f *testing.F) {
+	f.Add(knownRecord(f, 1, selfTestRecord))
+	f.Add([]byte{0x08, 0x01, 0x12, 0x00, 0x20, 0x07})
+	f.Add([]byte{0x0b, 0x08, 0x01, 0x0c, 0x08, 0x02})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, msg := range []func() wireMessage{
+			func() wireMessage { return &DatabaseRecord{} },
+			func() wireMessage { return &VerifyPasswordRequest{} },
+			func() wireMessage { return &VerifyPasswordResponse{} },
+		} {
+			viaWire, viaProto := msg(), msg()
+			wireErr, protoErr := viaWire.unmarshalWire(b), proto.Unmarshal(b, viaProto)
+			if (wireErr == nil) != (protoErr == nil) {
+				t.Fatalf("%T: wire error %v, proto error %v", viaWire, wireErr, protoErr)
+			}
+			if wireErr != nil {
+				continue
+			}
+			if !proto.Equal(viaWire, viaProto) {
+				t.Fatalf("%T: decoded %v, proto decoded %v", viaWire, viaWire, viaProto)
+			}
+
+			again := viaWire.appendWire(nil)
+			want, err := proto.Marshal(viaProto)
+			require.NoError(t, err)
+			require.Equal(t, want, again)
+		}
+	})
+}
+
+func FuzzParseVersionAndContent(f *testing.F) {
+	f.Add("UT", "UT."+selfTestUpdateToken)
+	f.Add("SK", "SK.1."+selfTestClientKey)
+	f.Add("KMS", "KMS.1.")
+	f.Add("PK", "PK.0.AAAA")
+	f.Add("PK", "PK.-1.AAAA")
+	f.Add("PK", "PK.99999999999999999999.AAAA")
+
+	f.Fuzz(func(t *testing.T, prefix, str string) {
+		version, _, err := ParseVersionAndContent(prefix, str)
+		if err != nil {
+			if ErrorCode(err) != CodeInvalidCredential || err.Error() == "" {
+				t.Fatalf("unexpected code %s: %v", ErrorCode(err), err)
+			}
+			return
+		}
+		if version < 1 {
+			t.Fatalf("accepted version %d", version)
+		}
+	})
+}
+
+func FuzzDecryptCredential(f *testing.F) {
+	f.Add("KMS.1." + base64.StdEncoding.EncodeToString([]byte("SK.1."+selfTestClientKey)))
+	f.Add("KMS.2.AAAA")
+	f.Add("KMS.1.%%%")
+	f.Add("SK.1." + selfTestClientKey)
+
+	identity := DecrypterFunc(func(ciphertext []byte) ([]byte, error) { return ciphertext, nil })
+
+	f.Fuzz(func(t *testing.T, envelope string) {
+		credential, err := DecryptCredential(identity, envelope)
+		if err != nil {
+			return
+		}
+		if !IsKMSEnvelope(envelope) && credential != envelope {
+			t.Fatalf("plain credential %q changed to %q", envelope, credential)
+		}
+	})
+}
+
+func FuzzUpdateEnrollmentRecord(f *testing.F) {
+	f.Add(knownRecord(f, 1, selfTestRecord), "UT.2."+selfTestUpdateToken)
+	f.Add(knownRecord(f, 1, selfTestRecord), "UT.2.AAAA")
+	f.Add(knownRecord(f, 2, selfTestUpdatedRecord), "UT.2."+selfTestUpdateToken)
+	f.Add(knownRecord(f, 1, selfTestUpdatedRecord), "UT.2."+selfTestUpdateToken)
+	f.Add([]byte{0x08, 0x01, 0x12, 0x00}, "UT.2."+selfTestUpdateToken)
+
+	f.Fuzz(func(t *testing.T, record []byte, token string) {
+		_, _ = UpdateEnrollmentRecord(record, token)
+	})
+}
+
+func FuzzVerifyPasswordRecord(f *testing.F) {
+	f.Add(knownRecord(f, 1, selfTestRecord))
+	f.Add([]byte{0x08, 0x01, 0x12, 0x00})
+	f.Add([]byte{0x08, 0x01, 0x12, 0x02, 0x0a, 0x00})
+
+	s := newTestService(f)
+	p := s.protocol(f, "")
+
+	f.Fuzz(func(t *testing.T, record []byte) {
+		_, _ = p.VerifyPassword(selfTestPassword, record)
+	})
+}
+
+// FuzzServiceResponse feeds hostile service responses to enrollment and verification
+func FuzzServiceResponse(f *testing.F) {
+	s := newTestService(f)
+	p := s.protocol(f, "")
+	record, _, err := p.EnrollAccount(selfTestPassword)
+	require.NoError(f, err)
+
+	enrollment, err := phe.GetEnrollment(s.keypair(1))
+	require.NoError(f, err)
+	enrollResp, err := proto.Marshal(&EnrollmentResponse{Version: 1, Response: enrollment})
+	require.NoError(f, err)
+	httpErr, err := proto.Marshal(&HttpError{Code: 400, Message: "bad request"})
+	require.NoError(f, err)
+
+	f.Add(http.StatusOK, enrollResp)
+	f.Add(http.StatusOK, []byte{})
+	f.Add(http.StatusOK, []byte{0x0a, 0x00})
+	f.Add(http.StatusBadRequest, httpErr)
+	f.Add(http.StatusInternalServerError, []byte("oops"))
+	f.Add(http.StatusNotFound, []byte{})
+
+	f.Fuzz(func(t *testing.T, status int, body []byte) {
+		if status < 100 || status > 999 {
+			status = http.StatusOK
+		}
+		hostile := httpClientFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			}, nil
+		})
+
+		vc := &VirgilHTTPClient{Client: hostile, Address: "http://passw0rd.test"}
+		_, _ = vc.SendContext(context.Background(), "PT.test", http.MethodPost, "enroll", nil, &EnrollmentResponse{})
+		_, _ = vc.SendContext(context.Background(), "PT.test", http.MethodPost, "verify-password", nil, &VerifyPasswordResponse{})
+
+		hp := s.protocol(t, "")
+		hp.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+			if path.Base(req.URL.Path) == "enroll" {
+				return hostile(req)
+			}
+			return s.Do(req)
+		})
+		_, _, _ = hp.EnrollAccount(selfTestPassword)
+
+		hp.APIClient.HTTPClient.Client = hostile
+		if key, err := hp.VerifyPassword(selfTestPassword, record); err == nil && key != nil {
+			t.Fatalf("hostile verification response accepted: %d %x", status, body)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/passw0rd/phe-go"
+)
+
+// PanicError is returned in hardened mode when the PHE library panics, usually on malformed input
+type PanicError struct {
+	Op    string
+	Value string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s in %s: %s", ErrPHEPanic, e.Op, e.Value)
+}
+
+// Cause returns ErrPHEPanic so that errors.Cause can be used for checks
+func (e *PanicError) Cause() error {
+	return ErrPHEPanic
+}
+
+// pheUpdateRecord is phe.UpdateRecord, replaced in tests
+var pheUpdateRecord = phe.UpdateRecord
+
+// recoverPanic converts a panic of the PHE library in op into a PanicError returned in err. It guards the
+// paths which run without a Protocol, such as key rotation in CreateContext and record updates by Migrator,
+// so they are always hardened
+func recoverPanic(op string, err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Op: op, Value: fmt.Sprint(r)}
+	}
+}
+
+// updatePHERecord is phe.UpdateRecord converting panics into PanicError
+func updatePHERecord(record, token []byte) (newRecord []byte, err error) {
+	defer recoverPanic("UpdateRecord", &err)
+	return pheUpdateRecord(record, token)
+}
+
+// rotateClientKeys is phe.RotateClientKeys converting panics into PanicError
+func rotateClientKeys(pub, sk, token []byte) (nextSk, nextPub []byte, err error) {
+	defer recoverPanic("RotateClientKeys", &err)
+	return phe.RotateClientKeys(pub, sk, token)
+}
+
+// guard runs fn in a slot of WorkerPool converting panics into PanicError if the protocol is hardened.
+// PHE library errors get CodeCryptoFailure, ctx.Err() is returned if ctx is done before a slot is free
+func (p *Protocol) guard(ctx context.Context, op string, fn func() error) (err error) {
+	if err = p.WorkerPool.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.WorkerPool.release()
+
+	if p.Hardened {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Op: op, Value: fmt.Sprint(r)}
+				withCorrelation(ctx, p.logger()).Error("recovered panic in PHE library", F("op", op), F("panic", fmt.Sprint(r)))
+			}
+		}()
+	}
+
+	if err = fn(); err != nil {
+		return withCode(CodeCryptoFailure, err)
+	}
+	return nil
+}
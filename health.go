@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker guarding service requests
+type CircuitState string
+
+// Circuit breaker states
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// Status is a health report of a protocol, suitable for health endpoints
+type Status struct {
+	// Ready is true when the protocol has keys and the service is not known to be unreachable
+	Ready bool `json:"ready"`
+	// ServiceReachable is false when the last service call failed because of transport or service errors
+	ServiceReachable bool         `json:"service_reachable"`
+	LastSuccess      time.Time    `json:"last_success"`
+	LastFailure      time.Time    `json:"last_failure"`
+	LastError        string       `json:"last_error,omitempty"`
+	CurrentVersion   uint32       `json:"current_version"`
+	Versions         []uint32     `json:"versions"`
+	Circuit          CircuitState `json:"circuit"`
+}
+
+// health tracks outcomes of service calls
+type health struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+	unreachable bool
+}
+
+func (h *health) record(err error, now time.Time) {
+	code := ErrorCode(err)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch code {
+	case CodeTransport, CodeServiceError, CodeCircuitOpen:
+		h.lastFailure, h.lastError, h.unreachable = now, err.Error(), true
+	case CodeOK, CodeInvalidPassword:
+		h.lastSuccess, h.unreachable = now, false
+	}
+}
+
+// Status returns a health report of the protocol. It does not call the service, see Ping
+func (p *Protocol) Status() *Status {
+	state := p.snapshot()
+	client := p.getClient().getClient()
+
+	p.health.mu.Lock()
+	status := &Status{
+		ServiceReachable: !p.health.unreachable,
+		LastSuccess:      p.health.lastSuccess,
+		LastFailure:      p.health.lastFailure,
+		LastError:        p.health.lastError,
+		CurrentVersion:   state.version,
+		Versions:         p.Versions(),
+		Circuit:          client.Breaker.currentState(client.clock().Now()),
+	}
+	p.health.mu.Unlock()
+
+	status.Ready = status.ServiceReachable && state.currentClient() != nil
+	return status
+}
+
+// Ping requests an enrollment from the service to check that it is reachable, e.g. for readiness
+// gating before accepting logins. The enrollment is discarded
+func (p *Protocol) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := p.getClient().GetEnrollmentContext(ensureCorrelationID(ctx), &EnrollmentRequest{Version: p.CurrentVersion()})
+	p.health.record(err, p.now())
+	return err
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_Status(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, s.rotate(t))
+
+	status := p.Status()
+	assert.True(t, status.Ready)
+	assert.True(t, status.ServiceReachable)
+	assert.True(t, status.LastSuccess.IsZero())
+	assert.Equal(t, uint32(2), status.CurrentVersion)
+	assert.Equal(t, []uint32{1, 2}, status.Versions)
+	assert.Equal(t, CircuitClosed, status.Circuit)
+
+	require.NoError(t, p.Ping(context.Background()))
+	assert.False(t, p.Status().LastSuccess.IsZero())
+
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	_, _, err := p.EnrollAccount("passw0rd")
+	require.Error(t, err)
+
+	status = p.Status()
+	assert.False(t, status.Ready)
+	assert.False(t, status.ServiceReachable)
+	assert.Contains(t, status.LastError, "connection refused")
+
+	p.APIClient.HTTPClient.Client = s
+	require.NoError(t, p.Ping(context.Background()))
+	assert.True(t, p.Status().Ready)
+}
@@ -39,12 +39,14 @@ package passw0rd
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"sync"
 	"time"
 
@@ -53,85 +55,285 @@ import (
 	"github.com/pkg/errors"
 )
 
-// HTTPClient describes transport layer
+// HTTPClient describes transport layer. Like http.Client, implementations should close request
+// bodies once they are sent, so that request buffers can be reused
 type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
+// Replay protection headers
+const (
+	NonceHeader     = "X-Passw0rd-Nonce"
+	TimestampHeader = "X-Passw0rd-Timestamp"
+)
+
+// DefaultMaxResponseAge is used for replay protection when VirgilHTTPClient.MaxResponseAge is not set
+const DefaultMaxResponseAge = time.Minute
+
+// DefaultMaxIdleConns is the minimum number of idle connections per host kept by the default transport
+const DefaultMaxIdleConns = 16
+
 //VirgilHTTPClient implements transport layer
 type VirgilHTTPClient struct {
 	Client  HTTPClient
 	Address string
-	once    sync.Once
+	// ReplayProtection makes every request carry a random nonce and a timestamp. Successful responses
+	// must echo the nonce and carry a Date header not older than MaxResponseAge, otherwise
+	// ErrReplayDetected is returned. Use it when requests traverse gateways which could replay responses
+	ReplayProtection bool
+	MaxResponseAge   time.Duration
+	// Pins enables certificate pinning for the default transport. It is not used when Client is set
+	Pins *PinSet
+	// Logger receives rejected responses. Nothing is logged if it is nil
+	Logger Logger
+	// Debug dumps requests and responses to Logger at debug level with credentials and payloads redacted
+	Debug bool
+	// Retry, if set, repeats requests failed because of transport errors, 5xx responses or throttling
+	Retry *RetryPolicy
+	// Breaker, if set, suspends requests while the service keeps failing
+	Breaker *CircuitBreaker
+	// Clock, if set, replaces the system clock for retry backoff, the circuit breaker and replay protection
+	Clock Clock
+	// MaxIdleConns is the number of idle connections per host kept by the default transport,
+	// DefaultMaxIdleConns if it is lower. It is not used when Client is set
+	MaxIdleConns int
+	once         sync.Once
+
+	endpointsMu sync.RWMutex
+	endpoints   map[string]endpoint
 }
 
+// endpoint is a request URL resolved against the Address it was built from
+type endpoint struct {
+	address string
+	url     string
+}
+
+// Canonical forms of request header keys. They are set directly to skip canonicalization on every request
+const (
+	appTokenHeaderKey      = "Apptoken"
+	correlationIDHeaderKey = "X-Correlation-Id"
+)
+
 //Send performs http request with protobuf encoded payload & response
 func (vc *VirgilHTTPClient) Send(token string, method string, urlPath string, payload proto.Message, respObj proto.Message) (headers http.Header, err error) {
-	var body []byte
+	return vc.SendContext(context.Background(), token, method, urlPath, payload, respObj)
+}
+
+// SendContext is like Send but the request is bound to ctx. The correlation ID of ctx is sent in
+// CorrelationIDHeader and added to returned errors
+func (vc *VirgilHTTPClient) SendContext(ctx context.Context, token string, method string, urlPath string, payload proto.Message, respObj proto.Message) (headers http.Header, err error) {
+	defer func() { err = withCorrelationID(ctx, err) }()
+
+	var body *requestBody
 	if payload != nil {
-		body, err = proto.Marshal(payload)
+		body, err = marshalBody(payload)
 		if err != nil {
 			return nil, errors.Wrap(err, "VirgilHTTPClient.Send: marshal payload")
 		}
+		defer body.release()
 	}
 
-	u, err := url.Parse(vc.Address)
+	if err = vc.Breaker.allow(vc.clock().Now()); err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		var status int
+		headers, status, err = vc.send(ctx, token, method, urlPath, body, respObj)
+
+		failed := retryable(status, err)
+		if !failed || attempt >= vc.Retry.attempts() || ctx.Err() != nil {
+			return vc.done(ctx, headers, failed, err)
+		}
+
+		delay, ok := vc.Retry.delay(attempt, retryAfter(headers))
+		if !ok {
+			return vc.done(ctx, headers, failed, err)
+		}
+
+		withCorrelation(ctx, vc.logger()).Warn("retrying request", F("path", urlPath), F("attempt", attempt),
+			F("delay", delay.String()), F("error", err.Error()))
+		countRetry(ctx)
+
+		timer := vc.clock().NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return vc.done(ctx, headers, failed, err)
+		}
+	}
+}
+
+// done reports the outcome of a request to the circuit breaker
+func (vc *VirgilHTTPClient) done(ctx context.Context, headers http.Header, failed bool, err error) (http.Header, error) {
+	if vc.Breaker.record(failed, vc.clock().Now()) {
+		withCorrelation(ctx, vc.logger()).Warn("circuit opened", F("error", err.Error()))
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "VirgilHTTPClient.Send: URL parse")
+		return nil, err
 	}
+	return headers, nil
+}
 
-	u.Path = path.Join(u.Path, urlPath)
-	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+// send performs a single request. Response headers and status are returned on failure as well,
+// status is 0 if no response was received
+func (vc *VirgilHTTPClient) send(ctx context.Context, token string, method string, urlPath string, body *requestBody, respObj proto.Message) (http.Header, int, error) {
+	endpointURL, err := vc.endpoint(urlPath)
 	if err != nil {
-		return nil, errors.Wrap(err, "VirgilHTTPClient.Send: new request")
+		return nil, 0, withCode(CodeInvalidConfiguration, errors.Wrap(err, "VirgilHTTPClient.Send: URL parse"))
 	}
 
+	req, err := http.NewRequestWithContext(ctx, method, endpointURL, nil)
+	if err != nil {
+		return nil, 0, withCode(CodeInvalidConfiguration, errors.Wrap(err, "VirgilHTTPClient.Send: new request"))
+	}
+	body.attach(req)
+
 	if token != "" {
-		req.Header.Add("AppToken", token)
+		req.Header[appTokenHeaderKey] = []string{token}
+	}
+
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		req.Header[correlationIDHeaderKey] = []string{id}
+	}
+
+	var nonce string
+	if vc.ReplayProtection {
+		if nonce, err = makeNonce(); err != nil {
+			return nil, 0, withCode(CodeTransport, errors.Wrap(err, "VirgilHTTPClient.Send: generate nonce"))
+		}
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set(TimestampHeader, strconv.FormatInt(vc.clock().Now().Unix(), 10))
+	}
+
+	if vc.Debug {
+		vc.dump(ctx, "http: request", F("method", method), F("url", endpointURL),
+			F("headers", redactHeaders(req.Header)), F("body", redact(body.bytes())))
 	}
 
 	client := vc.getHTTPClient()
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "VirgilHTTPClient.Send: send request")
+		return nil, 0, withCode(CodeTransport, errors.Wrap(err, "VirgilHTTPClient.Send: send request"))
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, errors.New("not found")
+		vc.dumpResponse(ctx, resp, nil)
+		return resp.Header, resp.StatusCode, withCode(CodeServiceError, errors.New("not found"))
 	}
 	if resp.StatusCode == http.StatusOK {
+		if vc.ReplayProtection {
+			if err = vc.checkFreshness(resp, nonce); err != nil {
+				withCorrelation(ctx, vc.logger()).Warn("response rejected", F("path", urlPath), F("error", err.Error()))
+				return resp.Header, resp.StatusCode, err
+			}
+		}
+
 		if respObj != nil {
 
-			body, err = ioutil.ReadAll(resp.Body)
+			buf := bodyBuffers.Get().(*bytes.Buffer)
+			defer releaseBody(buf)
+
+			_, err = buf.ReadFrom(resp.Body)
 
 			if err != nil {
-				return nil, errors.Wrap(err, "VirgilHTTPClient.Send: read body")
+				return resp.Header, resp.StatusCode, withCode(CodeTransport, errors.Wrap(err, "VirgilHTTPClient.Send: read body"))
 			}
+			vc.dumpResponse(ctx, resp, buf.Bytes())
 
-			err = proto.Unmarshal(body, respObj)
+			err = unmarshalMessage(buf.Bytes(), respObj)
 			if err != nil {
-				return nil, errors.Wrap(err, "VirgilHTTPClient.Send: unmarshal response object")
+				return resp.Header, resp.StatusCode, withCode(CodeServiceError, errors.Wrap(err, "VirgilHTTPClient.Send: unmarshal response object"))
 			}
 		}
-		return resp.Header, nil
+		return resp.Header, resp.StatusCode, nil
 	}
 
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "VirgilHTTPClient.Send: read response body")
+		return resp.Header, resp.StatusCode, withCode(CodeTransport, errors.Wrap(err, "VirgilHTTPClient.Send: read response body"))
 	}
+	vc.dumpResponse(ctx, resp, respBody)
 
 	if len(respBody) > 0 {
 		httpErr := &HttpError{}
 		err = proto.Unmarshal(respBody, httpErr)
 		if err == nil {
 
-			return nil, httpErr
+			return resp.Header, resp.StatusCode, httpErr
 		}
 	}
 
-	return nil, fmt.Errorf("%d %s", resp.StatusCode, string(respBody))
+	return resp.Header, resp.StatusCode, withCode(CodeServiceError, fmt.Errorf("%d %s", resp.StatusCode, string(respBody)))
+}
+
+// endpoint returns the URL of urlPath relative to Address. URLs are cached until Address changes
+func (vc *VirgilHTTPClient) endpoint(urlPath string) (string, error) {
+	vc.endpointsMu.RLock()
+	e, ok := vc.endpoints[urlPath]
+	vc.endpointsMu.RUnlock()
+	if ok && e.address == vc.Address {
+		return e.url, nil
+	}
+
+	u, err := url.Parse(vc.Address)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, urlPath)
+	e = endpoint{address: vc.Address, url: u.String()}
+
+	vc.endpointsMu.Lock()
+	if vc.endpoints == nil {
+		vc.endpoints = make(map[string]endpoint)
+	}
+	vc.endpoints[urlPath] = e
+	vc.endpointsMu.Unlock()
+	return e.url, nil
+}
+
+func (vc *VirgilHTTPClient) checkFreshness(resp *http.Response, nonce string) error {
+	if resp.Header.Get(NonceHeader) != nonce {
+		return errors.Wrap(ErrReplayDetected, "nonce mismatch")
+	}
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return errors.Wrap(ErrReplayDetected, "missing or invalid Date header")
+	}
+
+	maxAge := vc.MaxResponseAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxResponseAge
+	}
+
+	age := vc.clock().Now().Sub(date)
+	if age > maxAge || age < -maxAge {
+		return errors.Wrapf(ErrReplayDetected, "response is %s old", age)
+	}
+	return nil
+}
+
+func (vc *VirgilHTTPClient) clock() Clock {
+	return clockOrSystem(vc.Clock)
+}
+
+func makeNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
+
+func (vc *VirgilHTTPClient) maxIdleConns() int {
+	if vc.MaxIdleConns < DefaultMaxIdleConns {
+		return DefaultMaxIdleConns
+	}
+	return vc.MaxIdleConns
 }
 
 func (vc *VirgilHTTPClient) getHTTPClient() HTTPClient {
@@ -140,21 +342,9 @@ func (vc *VirgilHTTPClient) getHTTPClient() HTTPClient {
 
 		if vc.Client == nil {
 
-			dialer := &net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 10 * time.Second,
-				DualStack: true,
-			}
-
-			var netTransport = &http.Transport{
-				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return dialer.DialContext(ctx, network, addr)
-				},
-				TLSHandshakeTimeout: 10 * time.Second,
-			}
 			var cli = &http.Client{
 				Timeout:   10 * time.Second,
-				Transport: netTransport,
+				Transport: vc.newTransport(),
 			}
 
 			vc.Client = cli
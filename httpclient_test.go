@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type httpClientFunc func(*http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestVirgilHTTPClient_ReplayProtection(t *testing.T) {
+	req := require.New(t)
+
+	var echo func(nonce string) string
+	date := time.Now()
+
+	vc := &VirgilHTTPClient{
+		Address:          "http://passw0rd.test",
+		ReplayProtection: true,
+		Client: httpClientFunc(func(r *http.Request) (*http.Response, error) {
+			req.NotEmpty(r.Header.Get(TimestampHeader))
+			h := http.Header{}
+			h.Set(NonceHeader, echo(r.Header.Get(NonceHeader)))
+			h.Set("Date", date.UTC().Format(http.TimeFormat))
+			return &http.Response{StatusCode: http.StatusOK, Header: h, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+		}),
+	}
+
+	echo = func(nonce string) string { return nonce }
+	_, err := vc.Send("", http.MethodPost, "enroll", nil, nil)
+	req.NoError(err)
+
+	echo = func(string) string { return "replayed" }
+	_, err = vc.Send("", http.MethodPost, "enroll", nil, nil)
+	req.Equal(ErrReplayDetected, errors.Cause(err))
+
+	echo = func(nonce string) string { return nonce }
+	date = time.Now().Add(-time.Hour)
+	_, err = vc.Send("", http.MethodPost, "enroll", nil, nil)
+	req.Equal(ErrReplayDetected, errors.Cause(err))
+}
+
+func TestVirgilHTTPClient_Headers(t *testing.T) {
+	req := require.New(t)
+
+	var got *http.Request
+	vc := &VirgilHTTPClient{
+		Address: "http://passw0rd.test/phe/v1",
+		Client: httpClientFunc(func(r *http.Request) (*http.Response, error) {
+			got = r
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+		}),
+	}
+
+	_, err := vc.SendContext(WithCorrelationID(context.Background(), "abc"), "PT.token", http.MethodPost, "enroll", nil, nil)
+	req.NoError(err)
+	req.Equal("http://passw0rd.test/phe/v1/enroll", got.URL.String())
+	req.Equal("PT.token", got.Header.Get("AppToken"))
+	req.Equal("abc", got.Header.Get(CorrelationIDHeader))
+
+	vc.Address = "http://other.test"
+	_, err = vc.Send("", http.MethodPost, "enroll", nil, nil)
+	req.NoError(err)
+	req.Equal("http://other.test/enroll", got.URL.String())
+	req.Empty(got.Header.Get("AppToken"))
+}
+
+func TestPinSet_Rotation(t *testing.T) {
+	req := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	pin := SPKIHash(server.Certificate())
+	now := time.Now()
+
+	get := func(pins *PinSet) error {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: transport.TLSClientConfig.RootCAs, VerifyPeerCertificate: pins.VerifyPeerCertificate}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	req.NoError(get(&PinSet{Pins: []Pin{{SHA256: "old"}, {SHA256: pin}}}))
+	req.Error(get(&PinSet{Pins: []Pin{{SHA256: "old"}, {SHA256: pin, NotBefore: now.Add(time.Hour)}}}))
+
+	var reported error
+	req.NoError(get(&PinSet{
+		Pins:       []Pin{{SHA256: "old"}},
+		Grace:      true,
+		OnMismatch: func(err error) { reported = err },
+	}))
+	req.Equal(ErrPinMismatch, reported)
+}
+
+func TestPinSet_Clock(t *testing.T) {
+	req := require.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	clock := newTestClock()
+	logger := &testLogger{}
+	vc := &VirgilHTTPClient{
+		Address: server.URL,
+		Clock:   clock,
+		Logger:  logger,
+		Pins: &PinSet{Pins: []Pin{
+			{SHA256: SPKIHash(server.Certificate()), NotAfter: clock.Now().Add(time.Hour)},
+			{SHA256: "next", NotBefore: clock.Now().Add(time.Hour)},
+		}},
+	}
+
+	get := func() error {
+		transport := vc.newTransport().(*http.Transport)
+		transport.TLSClientConfig.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	req.NoError(get())
+	clock.Advance(2 * time.Hour)
+	req.Error(get())
+	req.Empty(logger.lines)
+
+	vc.Pins.Grace = true
+	req.NoError(get())
+	req.Equal([]string{"warn certificate pin mismatch ignored in grace mode"}, logger.lines)
+}
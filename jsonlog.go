@@ -0,0 +1,237 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONLogSchema identifies the record schema written by JSONLog
+const JSONLogSchema = "passw0rd.log.v1"
+
+// JSONLogRecord is a single line written by JSONLog. The field set is stable, new fields may only be added:
+//
+//	schema          always JSONLogSchema
+//	time            RFC 3339 time with nanoseconds, UTC
+//	kind            "audit", "event" or "log"
+//	name            audit event type, event name (see Event.EventName) or log message
+//	level           log level for kind "log": "debug", "info", "warn" or "error"
+//	user_id         user identifier passed with WithUserID, if any
+//	version         key or record version, if any
+//	reason          failure reason, e.g. "invalid_password"
+//	correlation_id  correlation ID of the operation, if any
+//	attributes      other event or log fields
+type JSONLogRecord struct {
+	Schema        string                 `json:"schema"`
+	Time          string                 `json:"time"`
+	Kind          string                 `json:"kind"`
+	Name          string                 `json:"name"`
+	Level         string                 `json:"level,omitempty"`
+	UserID        string                 `json:"user_id,omitempty"`
+	Version       uint32                 `json:"version,omitempty"`
+	Reason        string                 `json:"reason,omitempty"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// JSONLog renders audit events, operational events and log messages as JSON lines.
+// It implements AuditSink and Logger, subscribe it to an EventBus with Publish:
+//
+//	jsonLog := passw0rd.NewJSONLog(os.Stdout)
+//	protocol.AuditSink, protocol.Logger = jsonLog, jsonLog
+//	protocol.Events.Subscribe(jsonLog.Publish)
+//
+// It is safe for concurrent use. Write errors are ignored
+type JSONLog struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewJSONLog creates JSONLog writing to w
+func NewJSONLog(w io.Writer) *JSONLog {
+	return &JSONLog{w: w}
+}
+
+// Audit implements AuditSink
+func (l *JSONLog) Audit(event *AuditEvent) {
+	l.write(&JSONLogRecord{
+		Time:          formatLogTime(event.Time),
+		Kind:          "audit",
+		Name:          string(event.Type),
+		UserID:        event.UserID,
+		Version:       event.Version,
+		Reason:        event.Reason,
+		CorrelationID: event.CorrelationID,
+	})
+}
+
+// Publish writes an operational event
+func (l *JSONLog) Publish(e Event) {
+	rec := &JSONLogRecord{
+		Time: formatLogTime(time.Now()),
+		Kind: "event",
+		Name: e.EventName(),
+	}
+
+	switch e := e.(type) {
+	case *RotationApplied:
+		rec.Time, rec.Version = formatLogTime(e.Time), e.Version
+		rec.Attributes = map[string]interface{}{"previous_version": e.PreviousVersion}
+	case *ServiceDegraded:
+		rec.Time, rec.CorrelationID = formatLogTime(e.Time), e.CorrelationID
+		rec.Attributes = map[string]interface{}{"operation": e.Operation, "error": errorString(e.Err)}
+	case *CircuitOpened:
+		rec.Time = formatLogTime(e.Time)
+		rec.Attributes = map[string]interface{}{"failures": e.Failures, "until": formatLogTime(e.Until)}
+	case *MigrationCompleted:
+		rec.Time, rec.Version = formatLogTime(e.Time), e.Version
+		rec.Attributes = map[string]interface{}{"migrated": e.Migrated, "failed": e.Failed, "duration": e.Duration.String()}
+	case *AccountLocked:
+		rec.UserID = e.UserID
+		rec.Attributes = map[string]interface{}{"until": formatLogTime(e.Until)}
+	case *AccountUnlocked:
+		rec.UserID = e.UserID
+	case *KeyPolicyViolated:
+		rec.Version, rec.Reason = e.Err.Version, e.Err.Kind
+		rec.Attributes = map[string]interface{}{"detail": e.Err.Detail}
+	case *PinMismatched:
+		rec.Attributes = map[string]interface{}{"error": errorString(e.Err)}
+	case *SecurityEvent:
+		rec.Time, rec.Reason, rec.CorrelationID = formatLogTime(e.Time), e.Reason, e.CorrelationID
+		rec.Attributes = map[string]interface{}{"user_hash": e.UserHash, "source": e.Source}
+	case *VersionSkew:
+		rec.Time, rec.Version, rec.CorrelationID = formatLogTime(e.Time), e.RecordVersion, e.CorrelationID
+		rec.Attributes = map[string]interface{}{"current_version": e.CurrentVersion, "lag": e.Lag}
+	case *VersionsReleased:
+		rec.Time, rec.Version = formatLogTime(e.Time), e.CurrentVersion
+		rec.Attributes = map[string]interface{}{"versions": e.Versions}
+	}
+
+	l.write(rec)
+}
+
+// Debug implements Logger
+func (l *JSONLog) Debug(msg string, fields ...Field) { l.log("debug", msg, fields) }
+
+// Info implements Logger
+func (l *JSONLog) Info(msg string, fields ...Field) { l.log("info", msg, fields) }
+
+// Warn implements Logger
+func (l *JSONLog) Warn(msg string, fields ...Field) { l.log("warn", msg, fields) }
+
+// Error implements Logger
+func (l *JSONLog) Error(msg string, fields ...Field) { l.log("error", msg, fields) }
+
+func (l *JSONLog) log(level, msg string, fields []Field) {
+	rec := &JSONLogRecord{
+		Time:  formatLogTime(time.Now()),
+		Kind:  "log",
+		Name:  msg,
+		Level: level,
+	}
+
+	for _, f := range fields {
+		switch f.Key {
+		case "version":
+			if v, ok := f.Value.(uint32); ok {
+				rec.Version = v
+				continue
+			}
+		case "reason":
+			if v, ok := f.Value.(string); ok {
+				rec.Reason = v
+				continue
+			}
+		case "correlation_id":
+			if v, ok := f.Value.(string); ok {
+				rec.CorrelationID = v
+				continue
+			}
+		}
+
+		if rec.Attributes == nil {
+			rec.Attributes = make(map[string]interface{}, len(fields))
+		}
+		rec.Attributes[f.Key] = logValue(f.Value)
+	}
+
+	l.write(rec)
+}
+
+func (l *JSONLog) write(rec *JSONLogRecord) {
+	rec.Schema = JSONLogSchema
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+func formatLogTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// logValue makes field values render predictably
+func logValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return formatLogTime(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
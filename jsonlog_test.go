@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := NewJSONLog(buf)
+
+	at := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	log.Audit(&AuditEvent{Type: AuditVerificationFailure, Time: at, UserID: "alice", Version: 2, Reason: "invalid_password", CorrelationID: "req-1"})
+	log.Publish(&RotationApplied{Version: 3, PreviousVersion: 2, Time: at})
+	log.Warn("slow password verification", F("version", uint32(2)), F("total", time.Second), F("correlation_id", "req-2"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+
+	assert.JSONEq(t, `{"schema":"passw0rd.log.v1","time":"2019-01-02T03:04:05Z","kind":"audit","name":"verification_failure",
+		"user_id":"alice","version":2,"reason":"invalid_password","correlation_id":"req-1"}`, lines[0])
+	assert.JSONEq(t, `{"schema":"passw0rd.log.v1","time":"2019-01-02T03:04:05Z","kind":"event","name":"rotation_applied",
+		"version":3,"attributes":{"previous_version":2}}`, lines[1])
+
+	assert.Contains(t, lines[2], `"kind":"log","name":"slow password verification","level":"warn","version":2,"correlation_id":"req-2","attributes":{"total":"1s"}}`)
+}
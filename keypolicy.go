@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// keyPolicyReportInterval limits how often the same kind of violation is reported
+const keyPolicyReportInterval = time.Hour
+
+// KeyPolicy encourages regular rotations by alarming when keys get too old
+// or verified records fall too many versions behind the current one
+type KeyPolicy struct {
+	// MaxAge is the maximum age of the current key version, see Context.AdoptedAt
+	MaxAge time.Duration
+	// MaxVersionLag is the maximum number of versions a verified record may be behind the current version
+	MaxVersionLag uint32
+	// Enforce makes operations fail with KeyPolicyError instead of only reporting violations
+	Enforce bool
+	// OnViolation receives violations, at most once per hour for each kind
+	OnViolation func(err *KeyPolicyError)
+
+	mu       sync.Mutex
+	reported map[string]time.Time
+}
+
+// KeyPolicyError describes a KeyPolicy violation
+type KeyPolicyError struct {
+	Kind    string
+	Version uint32
+	Detail  string
+}
+
+// Kinds of key policy violations
+const (
+	KeyPolicyMaxAge        = "max_age"
+	KeyPolicyMaxVersionLag = "max_version_lag"
+)
+
+func (e *KeyPolicyError) Error() string {
+	return fmt.Sprintf("%s: %s (version %d)", ErrKeyPolicyViolation, e.Detail, e.Version)
+}
+
+// Cause returns ErrKeyPolicyViolation so that errors.Cause can be used for checks
+func (e *KeyPolicyError) Cause() error {
+	return ErrKeyPolicyViolation
+}
+
+// KeyAge returns how long the current key version has been in use
+func (p *Protocol) KeyAge() time.Duration {
+	return p.now().Sub(p.snapshot().adoptedAt)
+}
+
+// checkKeyPolicy reports violations and returns an error if the policy is enforced.
+// recordVersion is zero for operations which do not involve existing records
+func (p *Protocol) checkKeyPolicy(ctx context.Context, state *keyState, recordVersion uint32) error {
+	policy := p.KeyPolicy
+	if policy == nil {
+		return nil
+	}
+
+	currentVersion, adoptedAt := state.version, state.adoptedAt
+
+	var violation *KeyPolicyError
+
+	now := p.now()
+	if age := now.Sub(adoptedAt); policy.MaxAge > 0 && age > policy.MaxAge {
+		violation = &KeyPolicyError{
+			Kind:    KeyPolicyMaxAge,
+			Version: currentVersion,
+			Detail:  fmt.Sprintf("keys are %s old, maximum is %s", age.Round(time.Second), policy.MaxAge),
+		}
+	}
+
+	if recordVersion != 0 && policy.MaxVersionLag > 0 && currentVersion > recordVersion &&
+		currentVersion-recordVersion > policy.MaxVersionLag {
+		violation = &KeyPolicyError{
+			Kind:    KeyPolicyMaxVersionLag,
+			Version: recordVersion,
+			Detail:  fmt.Sprintf("record is %d versions behind, maximum is %d", currentVersion-recordVersion, policy.MaxVersionLag),
+		}
+	}
+
+	if violation == nil {
+		return nil
+	}
+
+	if policy.report(violation, now) {
+		withCorrelation(ctx, p.logger()).Warn("key policy violation",
+			F("kind", violation.Kind), F("version", violation.Version), F("detail", violation.Detail), F("enforced", policy.Enforce))
+		p.Events.Publish(&KeyPolicyViolated{Err: violation})
+	}
+
+	if policy.Enforce {
+		return violation
+	}
+	return nil
+}
+
+func (policy *KeyPolicy) report(violation *KeyPolicyError, now time.Time) bool {
+	policy.mu.Lock()
+	if policy.reported == nil {
+		policy.reported = make(map[string]time.Time)
+	}
+	last, ok := policy.reported[violation.Kind]
+	due := !ok || now.Sub(last) >= keyPolicyReportInterval
+	if due {
+		policy.reported[violation.Kind] = now
+	}
+	policy.mu.Unlock()
+
+	if due && policy.OnViolation != nil {
+		policy.OnViolation(violation)
+	}
+	return due
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// keyState is an immutable snapshot of protocol keys. Every operation takes a snapshot once and uses it
+// until it finishes, rotations publish a new snapshot. This makes rotations linearizable: in-flight
+// operations complete with the keys they started with and operations started afterwards see the new version.
+// Snapshots are swapped atomically, so taking one involves no locking
+type keyState struct {
+	version uint32
+	// clients are indexed by version offset from base. Versions are consecutive in practice, so a slice
+	// is smaller than a map and takes no hashing. Missing and released versions are nil
+	base        uint32
+	clients     []PHEClient
+	updateToken *VersionedUpdateToken
+	adoptedAt   time.Time
+}
+
+func newKeyState(context *Context, now time.Time) *keyState {
+	adoptedAt := context.AdoptedAt
+	if adoptedAt.IsZero() {
+		adoptedAt = now
+	}
+
+	state := &keyState{
+		version:     context.Version,
+		updateToken: context.UpdateToken,
+		adoptedAt:   adoptedAt,
+	}
+	for version, client := range context.PHEClients {
+		state.setClient(version, client)
+	}
+	return state
+}
+
+func (s *keyState) client(version uint32) PHEClient {
+	if version < s.base || version-s.base >= uint32(len(s.clients)) {
+		return nil
+	}
+	return s.clients[version-s.base]
+}
+
+// setClient stores client of version, growing clients at either end. It must only be called
+// before the state is published
+func (s *keyState) setClient(version uint32, client PHEClient) {
+	if client == nil {
+		return
+	}
+
+	switch {
+	case len(s.clients) == 0:
+		s.base = version
+		s.clients = []PHEClient{client}
+		return
+	case version < s.base:
+		clients := make([]PHEClient, int(s.base-version)+len(s.clients))
+		copy(clients[s.base-version:], s.clients)
+		s.base, s.clients = version, clients
+	case version-s.base >= uint32(len(s.clients)):
+		s.clients = append(s.clients, make([]PHEClient, int(version-s.base)+1-len(s.clients))...)
+	}
+	s.clients[version-s.base] = client
+}
+
+// with returns a copy of s rotated to version with client. Callers set the update token and adoption time
+func (s *keyState) with(version uint32, client PHEClient) *keyState {
+	next := &keyState{version: version, base: s.base}
+	next.clients = make([]PHEClient, len(s.clients), len(s.clients)+1)
+	copy(next.clients, s.clients)
+	next.setClient(version, client)
+	return next
+}
+
+// without returns a copy of s without clients of versions other than the current one
+func (s *keyState) without(versions []uint32) *keyState {
+	next := *s
+	next.base, next.clients = 0, nil
+	for _, version := range s.versions() {
+		if version == s.version || !containsVersion(versions, version) {
+			next.setClient(version, s.client(version))
+		}
+	}
+	return &next
+}
+
+func containsVersion(versions []uint32, version uint32) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// versions returns versions which have clients, in ascending order
+func (s *keyState) versions() []uint32 {
+	versions := make([]uint32, 0, len(s.clients))
+	for i, client := range s.clients {
+		if client != nil {
+			versions = append(versions, s.base+uint32(i))
+		}
+	}
+	return versions
+}
+
+func (s *keyState) currentClient() PHEClient {
+	return s.client(s.version)
+}
+
+func (p *Protocol) snapshot() *keyState {
+	state, _ := p.state.Load().(*keyState)
+	return state
+}
+
+// publish replaces the snapshot. Callers hold rotateMu, so that concurrent rotations do not lose updates
+func (p *Protocol) publish(state *keyState) {
+	p.state.Store(state)
+}
+
+// CurrentVersion returns the key version new records are enrolled with
+func (p *Protocol) CurrentVersion() uint32 {
+	return p.snapshot().version
+}
+
+// Versions returns all key versions records can be verified with, in ascending order
+func (p *Protocol) Versions() []uint32 {
+	return p.snapshot().versions()
+}
+
+// AddUpdateToken rotates protocol keys using an update token for the next version.
+// Records of the previous versions are still accepted, new records are created with the new version.
+// It is safe to call while other operations are in flight
+func (p *Protocol) AddUpdateToken(updateToken string) error {
+
+	token, err := parseToken(updateToken)
+	if err != nil {
+		return withCode(CodeInvalidCredential, errors.Wrap(err, "could not parse update token"))
+	}
+
+	if token == nil {
+		return withCode(CodeNoUpdateToken, errors.New("update token is mandatory"))
+	}
+
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+
+	current := p.snapshot()
+
+	if token.Version != current.version+1 {
+		return withCode(CodeVersionMismatch, fmt.Errorf("incorrect token version %d", token.Version))
+	}
+
+	currentClient := current.currentClient()
+	if currentClient == nil {
+		return withCode(CodeUnknownKeyVersion, fmt.Errorf("unable to find keys for version %d", current.version))
+	}
+
+	var next PHEClient
+	if err = p.guard(context.Background(), "Rotate", func() (err error) {
+		next, err = rotateClient(currentClient, token.UpdateToken)
+		return
+	}); err != nil {
+		return withCode(CodeInvalidCredential, errors.Wrap(err, "could not update keys using token"))
+	}
+
+	state := current.with(token.Version, next)
+	state.updateToken, state.adoptedAt = token, p.now()
+	p.publish(state)
+
+	p.logger().Info("keys rotated", F("version", token.Version), F("previous_version", current.version))
+	p.Events.Publish(&RotationApplied{Version: token.Version, PreviousVersion: current.version, Time: p.now()})
+	p.audit(context.Background(), AuditRotationApplied, token.Version, nil)
+	return nil
+}
+
+// SetContext atomically replaces protocol keys with the ones from newContext, e.g. after keys were
+// updated in configuration. The app token must stay the same
+func (p *Protocol) SetContext(newContext *Context) error {
+	if newContext == nil || newContext.PHEClients == nil {
+		return withCode(CodeInvalidConfiguration, errors.New("invalid context"))
+	}
+
+	if newContext.AppToken.Reveal() != p.AppToken.Reveal() {
+		return withCode(CodeInvalidConfiguration, errors.New("context belongs to another application"))
+	}
+
+	if err := newContext.checkServiceKey(); err != nil {
+		return err
+	}
+
+	state := newKeyState(newContext, p.now())
+	if state.currentClient() == nil {
+		return withCode(CodeUnknownKeyVersion, fmt.Errorf("unable to find keys for version %d", state.version))
+	}
+
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+
+	previous := p.snapshot()
+	p.publish(state)
+
+	p.logger().Info("context replaced", F("version", state.version), F("previous_version", previous.version))
+	if state.version != previous.version {
+		p.Events.Publish(&RotationApplied{Version: state.version, PreviousVersion: previous.version, Time: p.now()})
+		p.audit(context.Background(), AuditRotationApplied, state.version, nil)
+	}
+	return nil
+}
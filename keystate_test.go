@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_RotationUnderLoad(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	const (
+		workers   = 8
+		rounds    = 4
+		rotations = 3
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*rounds)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				rec, key, err := p.EnrollAccount("passw0rd")
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				verified, err := p.VerifyPassword("passw0rd", rec)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !assert.Equal(t, key, verified) {
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < rotations; i++ {
+		require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, uint32(1+rotations), p.CurrentVersion())
+	assert.Equal(t, []uint32{1, 2, 3, 4}, p.Versions())
+}
+
+func TestProtocol_SetContext(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	ctx, err := CreateContext("PT.test", s.publicKey, s.clientSecret, s.rotate(t))
+	require.NoError(t, err)
+	require.NoError(t, p.SetContext(ctx))
+	assert.Equal(t, uint32(2), p.CurrentVersion())
+
+	verified, err := p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	other, err := CreateContext("PT.other", s.publicKey, s.clientSecret, "")
+	require.NoError(t, err)
+	assert.Error(t, p.SetContext(other))
+}
+
+func TestKeyState_Clients(t *testing.T) {
+	clients := map[uint32]PHEClient{}
+	for _, version := range []uint32{7, 5, 9} {
+		clients[version] = &stubPHEClient{version: version}
+	}
+
+	state := newKeyState(&Context{PHEClients: clients, Version: 9}, time.Now())
+	assert.Equal(t, []uint32{5, 7, 9}, state.versions())
+	assert.Len(t, state.clients, 5)
+	assert.Nil(t, state.client(4))
+	assert.Nil(t, state.client(6))
+	assert.Nil(t, state.client(10))
+	assert.Equal(t, clients[7], state.client(7))
+
+	next := state.with(10, &stubPHEClient{version: 10})
+	assert.Equal(t, uint32(10), next.version)
+	assert.Equal(t, []uint32{5, 7, 9, 10}, next.versions())
+	assert.Equal(t, []uint32{5, 7, 9}, state.versions())
+
+	released := next.without([]uint32{5, 9, 10})
+	assert.Equal(t, []uint32{7, 10}, released.versions())
+	assert.Equal(t, uint32(7), released.base)
+	assert.Len(t, released.clients, 4)
+	assert.Equal(t, []uint32{5, 7, 9, 10}, next.versions())
+}
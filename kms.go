@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Decrypter unwraps credentials which were encrypted with an external key management service
+// such as AWS KMS or Google Cloud KMS. Implementations usually call the provider's Decrypt API
+type Decrypter interface {
+	Decrypt(ciphertext []byte) (plaintext []byte, err error)
+}
+
+// Encrypter wraps credentials with an external key management service
+type Encrypter interface {
+	Encrypt(plaintext []byte) (ciphertext []byte, err error)
+}
+
+// DecrypterFunc allows an ordinary function to be used as a Decrypter
+type DecrypterFunc func(ciphertext []byte) ([]byte, error)
+
+// Decrypt calls f(ciphertext)
+func (f DecrypterFunc) Decrypt(ciphertext []byte) ([]byte, error) {
+	return f(ciphertext)
+}
+
+// EncrypterFunc allows an ordinary function to be used as an Encrypter
+type EncrypterFunc func(plaintext []byte) ([]byte, error)
+
+// Encrypt calls f(plaintext)
+func (f EncrypterFunc) Encrypt(plaintext []byte) ([]byte, error) {
+	return f(plaintext)
+}
+
+const (
+	kmsEnvelopePrefix  = "KMS"
+	kmsEnvelopeVersion = 1
+)
+
+// IsKMSEnvelope reports whether credential is a KMS envelope of form KMS.<version>.<base64 ciphertext>
+func IsKMSEnvelope(credential string) bool {
+	return strings.HasPrefix(credential, kmsEnvelopePrefix+".")
+}
+
+// EncryptCredential wraps credential (SK., UT. etc.) into a KMS envelope which is safe to be stored in configuration files
+func EncryptCredential(e Encrypter, credential string) (string, error) {
+	if e == nil {
+		return "", withCode(CodeInvalidConfiguration, errors.New("encrypter is mandatory"))
+	}
+	if credential == "" {
+		return "", withCode(CodeInvalidCredential, errors.New("empty credential"))
+	}
+
+	ciphertext, err := e.Encrypt([]byte(credential))
+	if err != nil {
+		return "", errors.Wrap(err, "could not encrypt credential")
+	}
+
+	return fmt.Sprintf("%s.%d.%s", kmsEnvelopePrefix, kmsEnvelopeVersion, base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// DecryptCredential unwraps a KMS envelope. Credentials which are not enveloped are returned as is,
+// so that configurations may mix plain and encrypted values during migration
+func DecryptCredential(d Decrypter, credential string) (string, error) {
+	if !IsKMSEnvelope(credential) {
+		return credential, nil
+	}
+
+	if d == nil {
+		return "", withCode(CodeInvalidConfiguration, errors.New("decrypter is mandatory for KMS envelopes"))
+	}
+
+	version, ciphertext, err := ParseVersionAndContent(kmsEnvelopePrefix, credential)
+	if err != nil {
+		return "", withCode(CodeInvalidCredential, errors.Wrap(err, "invalid KMS envelope"))
+	}
+
+	if version != kmsEnvelopeVersion {
+		return "", withCode(CodeInvalidCredential, fmt.Errorf("unsupported KMS envelope version %d", version))
+	}
+
+	plaintext, err := d.Decrypt(ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "could not decrypt credential")
+	}
+
+	return string(plaintext), nil
+}
+
+// CreateContextKMS works like CreateContext but accepts client secret key and update token as KMS envelopes.
+// They are decrypted in memory only and never leave the process in plaintext
+func CreateContextKMS(d Decrypter, appToken, servicePublicKey, clientSecretKey, updateToken string) (*Context, error) {
+
+	sk, err := DecryptCredential(d, clientSecretKey)
+	if err != nil {
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid secret key"))
+	}
+
+	token, err := DecryptCredential(d, updateToken)
+	if err != nil {
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid update token"))
+	}
+
+	return CreateContext(appToken, servicePublicKey, sk, token)
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKMS encrypts with AES-GCM like a key management service
+type testKMS struct {
+	aead cipher.AEAD
+}
+
+func newTestKMS(t *testing.T) *testKMS {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	return &testKMS{aead: aead}
+}
+
+func (k *testKMS) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (k *testKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < k.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce := ciphertext[:k.aead.NonceSize()]
+	return k.aead.Open(nil, nonce, ciphertext[len(nonce):], nil)
+}
+
+func TestCredential_KMSRoundTrip(t *testing.T) {
+	kms := newTestKMS(t)
+	const credential = "SK.1.WnAGmZjsPAHAnjHGNKtllzYe44N8UIfkmZ43A9FznZc="
+
+	envelope, err := EncryptCredential(kms, credential)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(envelope, "KMS.1."), envelope)
+	assert.NotContains(t, envelope, "WnAGmZjs")
+	assert.True(t, IsKMSEnvelope(envelope))
+
+	decrypted, err := DecryptCredential(kms, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, credential, decrypted)
+
+	_, err = EncryptCredential(nil, credential)
+	assert.Equal(t, CodeInvalidConfiguration, ErrorCode(err))
+	_, err = EncryptCredential(kms, "")
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+	_, err = EncryptCredential(EncrypterFunc(func([]byte) ([]byte, error) { return nil, errors.New("access denied") }), credential)
+	assert.EqualError(t, err, "could not encrypt credential: access denied")
+}
+
+func TestCredential_KMSTampered(t *testing.T) {
+	kms := newTestKMS(t)
+	envelope, err := EncryptCredential(kms, "UT.2.secret")
+	require.NoError(t, err)
+
+	_, ciphertext, err := ParseVersionAndContent("KMS", envelope)
+	require.NoError(t, err)
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = DecryptCredential(kms, "KMS.1."+base64.StdEncoding.EncodeToString(ciphertext))
+	assert.Error(t, err)
+
+	_, err = DecryptCredential(kms, "KMS.1.not base64!")
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+	_, err = DecryptCredential(kms, "KMS.2."+strings.SplitN(envelope, ".", 3)[2])
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+}
+
+func TestCredential_KMSPrefix(t *testing.T) {
+	for _, credential := range []string{"SK.1.c2VjcmV0", "kms.1.c2VjcmV0", "KMS1.c2VjcmV0", "PK.KMS.1", ""} {
+		assert.False(t, IsKMSEnvelope(credential), credential)
+
+		// credentials which are not enveloped need no decrypter
+		plain, err := DecryptCredential(nil, credential)
+		require.NoError(t, err)
+		assert.Equal(t, credential, plain)
+	}
+
+	_, err := DecryptCredential(nil, "KMS.1.c2VjcmV0")
+	assert.Equal(t, CodeInvalidConfiguration, ErrorCode(err))
+}
+
+func TestCredential_KMSDecrypterError(t *testing.T) {
+	denied := errors.New("access denied")
+	failing := DecrypterFunc(func([]byte) ([]byte, error) { return nil, denied })
+
+	_, err := DecryptCredential(failing, "KMS.1.c2VjcmV0")
+	assert.Equal(t, denied, errors.Cause(err))
+
+	s := newTestService(t)
+	_, err = CreateContextKMS(failing, "PT.test", s.publicKey, "KMS.1.c2VjcmV0", "")
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+}
+
+func TestCreateContextKMS(t *testing.T) {
+	kms := newTestKMS(t)
+	s := newTestService(t)
+	token := s.rotate(t)
+
+	sk, err := EncryptCredential(kms, s.clientSecret)
+	require.NoError(t, err)
+	ut, err := EncryptCredential(kms, token)
+	require.NoError(t, err)
+
+	ctx, err := CreateContextKMS(kms, "PT.test", s.publicKey, sk, ut)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), ctx.Version)
+
+	// plain values may be mixed with envelopes
+	ctx, err = CreateContextKMS(kms, "PT.test", s.publicKey, s.clientSecret, ut)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), ctx.Version)
+}
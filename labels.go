@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+// pprof label names set on goroutines of SDK background workers
+const (
+	LabelSubsystem = "passw0rd"
+	LabelOperation = "passw0rd.operation"
+	LabelTenant    = "passw0rd.tenant"
+	LabelVersion   = "passw0rd.version"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying a tenant name. Background workers started with ctx
+// carry it in their pprof labels
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// goLabeled runs fn in a new goroutine with pprof labels, so CPU and goroutine profiles attribute
+// the work to the SDK subsystem, operation, tenant and key version
+func goLabeled(ctx context.Context, operation string, version uint32, fn func(ctx context.Context)) {
+	go doLabeled(ctx, operation, version, fn)
+}
+
+// doLabeled runs fn in the current goroutine with labels, see goLabeled
+func doLabeled(ctx context.Context, operation string, version uint32, fn func(ctx context.Context)) {
+	pprof.Do(ctx, labelSet(ctx, operation, version), fn)
+}
+
+// withLabels returns ctx carrying the labels of goLabeled without applying them to the current goroutine,
+// for requests and goroutines which take ctx
+func withLabels(ctx context.Context, operation string, version uint32) context.Context {
+	return pprof.WithLabels(ctx, labelSet(ctx, operation, version))
+}
+
+func labelSet(ctx context.Context, operation string, version uint32) pprof.LabelSet {
+	labels := []string{
+		LabelSubsystem, "true",
+		LabelOperation, operation,
+		LabelVersion, strconv.FormatUint(uint64(version), 10),
+	}
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		labels = append(labels, LabelTenant, tenant)
+	}
+	return pprof.Labels(labels...)
+}
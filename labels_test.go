@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoLabeled(t *testing.T) {
+	labels := make(chan map[string]string, 1)
+
+	ctx := WithTenant(context.Background(), "acme")
+	goLabeled(ctx, "migration", 3, func(ctx context.Context) {
+		res := map[string]string{}
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			res[key] = value
+			return true
+		})
+		labels <- res
+	})
+
+	assert.Equal(t, map[string]string{
+		LabelSubsystem: "true",
+		LabelOperation: "migration",
+		LabelTenant:    "acme",
+		LabelVersion:   "3",
+	}, <-labels)
+}
+
+func TestLabels_Workers(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	ctx := WithTenant(context.Background(), "acme")
+
+	var mu sync.Mutex
+	operations := map[string]bool{}
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		operation, _ := pprof.Label(req.Context(), LabelOperation)
+		tenant, _ := pprof.Label(req.Context(), LabelTenant)
+		version, _ := pprof.Label(req.Context(), LabelVersion)
+		mu.Lock()
+		operations[operation+"/"+tenant+"/"+version] = true
+		mu.Unlock()
+		return s.Do(req)
+	})
+
+	enrolled := p.EnrollAccounts(ctx, []EnrollRequest{{Password: "passw0rd"}, {Password: "passw0rd"}})
+	require.NoError(t, enrolled[0].Err)
+	verified := p.VerifyPasswords(ctx, []VerifyRequest{{Password: "passw0rd", Record: enrolled[0].Record}})
+	require.NoError(t, verified[0].Err)
+	assert.Equal(t, map[string]bool{"enroll/acme/1": true, "verify/acme/1": true}, operations)
+
+	batches := make(chan string, 1)
+	svc := &batchService{testService: s}
+	p.Batcher = &VerifyBatcher{Service: batchVerifierFunc(func(ctx context.Context, reqs []*VerifyPasswordRequest) ([]*VerifyPasswordResponse, error) {
+		operation, _ := pprof.Label(ctx, LabelOperation)
+		batches <- operation
+		return svc.VerifyPasswordBatch(ctx, reqs)
+	}), MaxBatch: 1}
+	_, err := p.VerifyPassword("passw0rd", enrolled[0].Record)
+	require.NoError(t, err)
+	assert.Equal(t, "verify_batch", <-batches)
+}
+
+type batchVerifierFunc func(ctx context.Context, reqs []*VerifyPasswordRequest) ([]*VerifyPasswordResponse, error)
+
+func (f batchVerifierFunc) VerifyPasswordBatch(ctx context.Context, reqs []*VerifyPasswordRequest) ([]*VerifyPasswordResponse, error) {
+	return f(ctx, reqs)
+}
+
+func TestLabels_Migrator(t *testing.T) {
+	s := newTestService(t)
+	record, _, err := s.protocol(t, "").EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	// the goroutine profile shows the labels of the worker blocked in the update
+	profile := make(chan string, 1)
+	update := pheUpdateRecord
+	defer func() { pheUpdateRecord = update }()
+	pheUpdateRecord = func(record, token []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		_ = pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		profile <- buf.String()
+		return update(record, token)
+	}
+
+	store := &memoryRecords{ids: []string{"alice"}, records: map[string][]byte{"alice": record}}
+	m := &Migrator{UpdateToken: s.rotate(t), Workers: 1}
+	_, err = m.Migrate(WithTenant(context.Background(), "acme"), store, store)
+	require.NoError(t, err)
+
+	assert.Contains(t, <-profile, `"passw0rd.operation":"migrate", "passw0rd.tenant":"acme", "passw0rd.version":"2"`)
+}
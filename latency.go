@@ -0,0 +1,248 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyWindow is the sliding window used by LatencyTracker when Window is not set
+const DefaultLatencyWindow = 5 * time.Minute
+
+// defaultMaxLatencySamples bounds memory used for every operation, version and outcome
+const defaultMaxLatencySamples = 10000
+
+// LatencyPercentiles summarizes latency of operations observed within the window
+type LatencyPercentiles struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// LatencyReport holds percentiles for a single operation, key version and outcome
+type LatencyReport struct {
+	Operation string
+	Version   uint32
+	Outcome   string
+	LatencyPercentiles
+}
+
+// SLO is a latency objective: the given quantile, e.g. 0.99, must not exceed Objective
+type SLO struct {
+	Quantile  float64
+	Objective time.Duration
+}
+
+// LatencyTracker implements Metrics keeping operation latency over a sliding window, broken down by
+// record key version and outcome. It shows whether records of old key versions slow down logins.
+// The zero value is ready to use
+type LatencyTracker struct {
+	// Window is the period percentiles are computed over, DefaultLatencyWindow if zero
+	Window time.Duration
+	// MaxSamples bounds samples kept for every operation, version and outcome, 10000 if zero
+	MaxSamples int
+	// Clock, if set, replaces the system clock for the window
+	Clock Clock
+
+	mu      sync.Mutex
+	samples map[latencyKey][]latencySample
+}
+
+type latencyKey struct {
+	operation string
+	version   uint32
+	outcome   string
+}
+
+type latencySample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// ObserveOperation implements Metrics
+func (t *LatencyTracker) ObserveOperation(operation string, version uint32, outcome string, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.samples == nil {
+		t.samples = make(map[latencyKey][]latencySample)
+	}
+
+	now := t.getNow()
+	key := latencyKey{operation: operation, version: version, outcome: outcome}
+	samples := append(t.prune(t.samples[key], now), latencySample{at: now, duration: duration})
+
+	if max := t.maxSamples(); len(samples) > max {
+		samples = samples[len(samples)-max:]
+	}
+	t.samples[key] = samples
+}
+
+// Percentiles returns latency percentiles of an operation for records of the given key version.
+// An empty outcome includes all outcomes
+func (t *LatencyTracker) Percentiles(operation string, version uint32, outcome string) LatencyPercentiles {
+	return percentiles(t.durations(func(key latencyKey) bool {
+		return key.operation == operation && key.version == version && (outcome == "" || key.outcome == outcome)
+	}))
+}
+
+// Report returns percentiles for every operation, key version and outcome observed within the window
+func (t *LatencyTracker) Report() []LatencyReport {
+	t.mu.Lock()
+	keys := make([]latencyKey, 0, len(t.samples))
+	for key := range t.samples {
+		keys = append(keys, key)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		if keys[i].version != keys[j].version {
+			return keys[i].version < keys[j].version
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+
+	reports := make([]LatencyReport, 0, len(keys))
+	for _, key := range keys {
+		p := t.Percentiles(key.operation, key.version, key.outcome)
+		if p.Count == 0 {
+			continue
+		}
+		reports = append(reports, LatencyReport{
+			Operation:          key.operation,
+			Version:            key.version,
+			Outcome:            key.outcome,
+			LatencyPercentiles: p,
+		})
+	}
+	return reports
+}
+
+// CheckSLO reports whether an operation meets the objective over all versions and outcomes
+// and returns the observed latency at the objective quantile. An operation without samples meets any objective
+func (t *LatencyTracker) CheckSLO(operation string, slo SLO) (met bool, observed time.Duration) {
+	durations := t.durations(func(key latencyKey) bool {
+		return key.operation == operation
+	})
+	if len(durations) == 0 {
+		return true, 0
+	}
+
+	observed = quantile(durations, slo.Quantile)
+	return observed <= slo.Objective, observed
+}
+
+// durations returns sorted durations of samples within the window whose keys match
+func (t *LatencyTracker) durations(match func(latencyKey) bool) []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.getNow()
+	var res []time.Duration
+	for key, samples := range t.samples {
+		if !match(key) {
+			continue
+		}
+		samples = t.prune(samples, now)
+		if len(samples) == 0 {
+			delete(t.samples, key)
+			continue
+		}
+		t.samples[key] = samples
+		for _, s := range samples {
+			res = append(res, s.duration)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// prune drops samples which are older than the window, samples are ordered by time
+func (t *LatencyTracker) prune(samples []latencySample, now time.Time) []latencySample {
+	window := t.Window
+	if window <= 0 {
+		window = DefaultLatencyWindow
+	}
+
+	i := sort.Search(len(samples), func(i int) bool {
+		return now.Sub(samples[i].at) <= window
+	})
+	return samples[i:]
+}
+
+func (t *LatencyTracker) maxSamples() int {
+	if t.MaxSamples > 0 {
+		return t.MaxSamples
+	}
+	return defaultMaxLatencySamples
+}
+
+func (t *LatencyTracker) getNow() time.Time {
+	return clockOrSystem(t.Clock).Now()
+}
+
+func percentiles(sorted []time.Duration) LatencyPercentiles {
+	if len(sorted) == 0 {
+		return LatencyPercentiles{}
+	}
+	return LatencyPercentiles{
+		Count: len(sorted),
+		P50:   quantile(sorted, 0.5),
+		P95:   quantile(sorted, 0.95),
+		P99:   quantile(sorted, 0.99),
+	}
+}
+
+// quantile returns the nearest-rank quantile of sorted durations
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
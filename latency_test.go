@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	clock := newTestClock()
+	tracker := &LatencyTracker{Window: time.Minute, Clock: clock}
+
+	for i := 1; i <= 100; i++ {
+		tracker.ObserveOperation(OperationVerify, 1, OutcomeSuccess, time.Duration(i)*time.Millisecond)
+		tracker.ObserveOperation(OperationVerify, 2, OutcomeSuccess, time.Millisecond)
+	}
+	tracker.ObserveOperation(OperationVerify, 1, "error", time.Second)
+
+	assert.Equal(t, LatencyPercentiles{
+		Count: 100,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}, tracker.Percentiles(OperationVerify, 1, OutcomeSuccess))
+
+	assert.Equal(t, 101, tracker.Percentiles(OperationVerify, 1, "").Count)
+	assert.Equal(t, time.Millisecond, tracker.Percentiles(OperationVerify, 2, "").P99)
+
+	report := tracker.Report()
+	assert.Len(t, report, 3)
+	assert.Equal(t, uint32(1), report[0].Version)
+	assert.Equal(t, "error", report[0].Outcome)
+
+	met, observed := tracker.CheckSLO(OperationVerify, SLO{Quantile: 0.5, Objective: 10 * time.Millisecond})
+	assert.True(t, met)
+	assert.Equal(t, time.Millisecond, observed)
+
+	met, _ = tracker.CheckSLO(OperationVerify, SLO{Quantile: 0.99, Objective: 10 * time.Millisecond})
+	assert.False(t, met)
+
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, 0, tracker.Percentiles(OperationVerify, 1, "").Count)
+	assert.Empty(t, tracker.Report())
+
+	met, _ = tracker.CheckSLO(OperationVerify, SLO{Quantile: 0.99, Objective: time.Millisecond})
+	assert.True(t, met)
+}
+
+func TestLatencyTracker_MaxSamples(t *testing.T) {
+	tracker := &LatencyTracker{MaxSamples: 10}
+
+	for i := 1; i <= 20; i++ {
+		tracker.ObserveOperation(OperationEnroll, 1, OutcomeSuccess, time.Duration(i))
+	}
+
+	p := tracker.Percentiles(OperationEnroll, 1, OutcomeSuccess)
+	assert.Equal(t, 10, p.Count)
+	assert.Equal(t, time.Duration(15), p.P50)
+}
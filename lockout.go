@@ -0,0 +1,273 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy configures locking of accounts after repeated invalid passwords
+type LockoutPolicy struct {
+	// MaxFailures is the number of consecutive invalid passwords after which an account is locked
+	MaxFailures int
+	// LockDuration is the duration of the first lock. Every next lock without a successful
+	// verification in between is Backoff times longer, but not longer than MaxLockDuration
+	LockDuration    time.Duration
+	Backoff         float64
+	MaxLockDuration time.Duration
+	// FailureWindow is how long failures and locks are remembered after the last failure once an account is
+	// not locked, DefaultFailureWindow if not set. Accounts without failures in the window start over
+	FailureWindow time.Duration
+	// PendingRetryAfter is the retry hint of attempts which are throttled while the remaining ones are in
+	// flight, DefaultPendingRetryAfter if not set
+	PendingRetryAfter time.Duration
+	// OnLock is called when an account gets locked
+	OnLock func(userID string, until time.Time)
+	// OnUnlock is called when an account is unlocked with Lockout.Unlock
+	OnUnlock func(userID string)
+	// Events, if set, receives AccountLocked and AccountUnlocked events
+	Events *EventBus
+}
+
+// DefaultFailureWindow is the FailureWindow of policies which do not set it
+const DefaultFailureWindow = 24 * time.Hour
+
+// DefaultPendingRetryAfter is the PendingRetryAfter of policies which do not set it
+const DefaultPendingRetryAfter = time.Second
+
+const lockoutSweepInterval = 1024
+
+// AccountLockedError is returned for verification attempts of locked accounts
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrAccountLocked, e.Until.Format(time.RFC3339))
+}
+
+// Cause returns ErrAccountLocked so that errors.Cause can be used for checks
+func (e *AccountLockedError) Cause() error {
+	return ErrAccountLocked
+}
+
+// Lockout applies LockoutPolicy to verification attempts. It is safe for concurrent use
+type Lockout struct {
+	policy  LockoutPolicy
+	mu      sync.Mutex
+	states  map[string]*lockoutState
+	updates int
+}
+
+type lockoutState struct {
+	failures int
+	// pending counts attempts reserved with Reserve and not yet resolved
+	pending     int
+	locks       int
+	until       time.Time
+	lastFailure time.Time
+}
+
+// NewLockout creates a Lockout which keeps its state in memory
+func NewLockout(policy LockoutPolicy) *Lockout {
+	if policy.Backoff < 1 {
+		policy.Backoff = 1
+	}
+	if policy.FailureWindow <= 0 {
+		policy.FailureWindow = DefaultFailureWindow
+	}
+	if policy.PendingRetryAfter <= 0 {
+		policy.PendingRetryAfter = DefaultPendingRetryAfter
+	}
+	return &Lockout{
+		policy: policy,
+		states: make(map[string]*lockoutState),
+	}
+}
+
+// Check returns AccountLockedError if userID is currently locked. Verifications use Reserve instead,
+// which also counts attempts in flight
+func (l *Lockout) Check(userID string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.states[userID]
+	if !ok || !now.Before(state.until) {
+		return nil
+	}
+	return &AccountLockedError{Until: state.until}
+}
+
+// Reserve returns AccountLockedError if userID is locked, or else reserves one of its remaining attempts,
+// so that concurrent guesses can not get past MaxFailures before their failures are registered. Attempts
+// beyond the remaining ones fail with RateLimitedError until those in flight are resolved, the account
+// is not locked yet. Every successful Reserve must be followed by Success, Failure or Release
+func (l *Lockout) Reserve(userID string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state(userID, now)
+	if now.Before(state.until) {
+		return &AccountLockedError{Until: state.until}
+	}
+	if l.policy.MaxFailures > 0 && state.failures+state.pending >= l.policy.MaxFailures {
+		return &RateLimitedError{RetryAfter: l.policy.PendingRetryAfter}
+	}
+	state.pending++
+	return nil
+}
+
+// Release gives back an attempt reserved with Reserve which did not tell whether the password was valid,
+// e.g. because the service was unavailable
+func (l *Lockout) Release(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if state, ok := l.states[userID]; ok && state.pending > 0 {
+		state.pending--
+	}
+}
+
+// state returns the state of userID, forgetting failures and locks which are older than FailureWindow.
+// Every lockoutSweepInterval calls, states which have been forgotten are dropped. l.mu must be held
+func (l *Lockout) state(userID string, now time.Time) *lockoutState {
+	l.updates++
+	if l.updates%lockoutSweepInterval == 0 {
+		l.sweep(now)
+	}
+
+	state, ok := l.states[userID]
+	switch {
+	case !ok:
+		state = &lockoutState{}
+		l.states[userID] = state
+	case l.expired(state, now):
+		*state = lockoutState{pending: state.pending}
+	}
+	return state
+}
+
+func (l *Lockout) expired(state *lockoutState, now time.Time) bool {
+	return !now.Before(state.until) && now.Sub(state.lastFailure) >= l.policy.FailureWindow
+}
+
+// sweep drops states without attempts in flight which have been forgotten
+func (l *Lockout) sweep(now time.Time) {
+	for userID, state := range l.states {
+		if state.pending == 0 && l.expired(state, now) {
+			delete(l.states, userID)
+		}
+	}
+}
+
+// Failure registers an invalid password and locks the account once MaxFailures is reached.
+// It resolves an attempt reserved with Reserve
+func (l *Lockout) Failure(userID string, now time.Time) {
+	l.mu.Lock()
+	state := l.state(userID, now)
+	if state.pending > 0 {
+		state.pending--
+	}
+	if l.policy.MaxFailures < 1 {
+		l.mu.Unlock()
+		return
+	}
+
+	state.failures++
+	state.lastFailure = now
+	if state.failures < l.policy.MaxFailures {
+		l.mu.Unlock()
+		return
+	}
+
+	state.failures = 0
+	state.locks++
+	state.until = now.Add(l.lockDuration(state.locks))
+	until := state.until
+	l.mu.Unlock()
+
+	if l.policy.OnLock != nil {
+		l.policy.OnLock(userID, until)
+	}
+	l.policy.Events.Publish(&AccountLocked{UserID: userID, Until: until})
+}
+
+// Success resets failures and backoff of userID. It resolves an attempt reserved with Reserve
+func (l *Lockout) Success(userID string) {
+	l.reset(userID, true)
+}
+
+// Unlock removes a lock from userID, e.g. after an administrator's decision
+func (l *Lockout) Unlock(userID string) {
+	l.reset(userID, false)
+
+	if l.policy.OnUnlock != nil {
+		l.policy.OnUnlock(userID)
+	}
+	l.policy.Events.Publish(&AccountUnlocked{UserID: userID})
+}
+
+// reset forgets failures and locks of userID but keeps its other attempts in flight
+func (l *Lockout) reset(userID string, resolved bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.states[userID]
+	if !ok {
+		return
+	}
+	pending := state.pending
+	if resolved && pending > 0 {
+		pending--
+	}
+	if pending == 0 {
+		delete(l.states, userID)
+		return
+	}
+	*state = lockoutState{pending: pending}
+}
+
+func (l *Lockout) lockDuration(locks int) time.Duration {
+	d := time.Duration(float64(l.policy.LockDuration) * math.Pow(l.policy.Backoff, float64(locks-1)))
+	if l.policy.MaxLockDuration > 0 && (d > l.policy.MaxLockDuration || d < 0) {
+		d = l.policy.MaxLockDuration
+	}
+	return d
+}
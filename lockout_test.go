@@ -0,0 +1,184 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockout_ProgressiveBackoff(t *testing.T) {
+	req := require.New(t)
+
+	var unlocked string
+	lockout := NewLockout(LockoutPolicy{
+		MaxFailures:     2,
+		LockDuration:    time.Minute,
+		Backoff:         2,
+		MaxLockDuration: 3 * time.Minute,
+		OnUnlock:        func(userID string) { unlocked = userID },
+	})
+	now := time.Unix(1500000000, 0)
+
+	lockout.Failure("alice", now)
+	req.NoError(lockout.Check("alice", now))
+	lockout.Failure("alice", now)
+
+	err := lockout.Check("alice", now)
+	req.Equal(ErrAccountLocked, errors.Cause(err))
+	req.Equal(now.Add(time.Minute), err.(*AccountLockedError).Until)
+
+	now = now.Add(time.Minute)
+	req.NoError(lockout.Check("alice", now))
+
+	lockout.Failure("alice", now)
+	lockout.Failure("alice", now)
+	req.Equal(now.Add(2*time.Minute), lockout.Check("alice", now).(*AccountLockedError).Until)
+
+	now = now.Add(2 * time.Minute)
+	lockout.Failure("alice", now)
+	lockout.Failure("alice", now)
+	req.Equal(now.Add(3*time.Minute), lockout.Check("alice", now).(*AccountLockedError).Until)
+
+	lockout.Unlock("alice")
+	req.Equal("alice", unlocked)
+	req.NoError(lockout.Check("alice", now))
+}
+
+func TestLockout_FailureWindow(t *testing.T) {
+	req := require.New(t)
+
+	lockout := NewLockout(LockoutPolicy{
+		MaxFailures:   2,
+		LockDuration:  time.Minute,
+		Backoff:       2,
+		FailureWindow: time.Hour,
+	})
+	now := time.Unix(1500000000, 0)
+
+	lockout.Failure("alice", now)
+	now = now.Add(time.Hour)
+	lockout.Failure("alice", now)
+	req.NoError(lockout.Check("alice", now))
+
+	lockout.Failure("alice", now)
+	req.Equal(now.Add(time.Minute), lockout.Check("alice", now).(*AccountLockedError).Until)
+
+	// the backoff is forgotten too
+	now = now.Add(time.Minute + time.Hour)
+	lockout.Failure("alice", now)
+	lockout.Failure("alice", now)
+	req.Equal(now.Add(time.Minute), lockout.Check("alice", now).(*AccountLockedError).Until)
+}
+
+func TestLockout_Sweep(t *testing.T) {
+	req := require.New(t)
+
+	lockout := NewLockout(LockoutPolicy{MaxFailures: 3, LockDuration: time.Minute, FailureWindow: time.Hour})
+	now := time.Unix(1500000000, 0)
+
+	for i := 0; i < lockoutSweepInterval; i++ {
+		lockout.Failure(strconv.Itoa(i), now)
+	}
+	req.Equal(lockoutSweepInterval, len(lockout.states))
+
+	now = now.Add(time.Hour)
+	lockout.Failure("alice", now)
+	for i := 0; i < lockoutSweepInterval-1; i++ {
+		req.NoError(lockout.Reserve("bob", now))
+		lockout.Success("bob")
+	}
+	req.Equal(1, len(lockout.states))
+	req.Contains(lockout.states, "alice")
+}
+
+func TestLockout_Reserve(t *testing.T) {
+	req := require.New(t)
+
+	lockout := NewLockout(LockoutPolicy{MaxFailures: 3, LockDuration: time.Minute})
+	now := time.Unix(1500000000, 0)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := lockout.Reserve("alice", now); err != nil {
+				req.Equal(&RateLimitedError{RetryAfter: DefaultPendingRetryAfter}, err)
+				return
+			}
+			mu.Lock()
+			reserved++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	req.Equal(3, reserved)
+
+	lockout.Release("alice")
+	req.NoError(lockout.Reserve("alice", now))
+
+	lockout.Failure("alice", now)
+	lockout.Failure("alice", now)
+	err := lockout.Reserve("alice", now)
+	req.Equal(CodeRateLimited, ErrorCode(err))
+	req.NoError(lockout.Check("alice", now))
+	status, retryAfter := (&LoginHandler{}).ErrorStatus(err)
+	req.Equal(http.StatusTooManyRequests, status)
+	req.Equal(time.Second, retryAfter)
+	lockout.Failure("alice", now)
+	req.Equal(now.Add(time.Minute), lockout.Check("alice", now).(*AccountLockedError).Until)
+	req.Len(lockout.states, 1)
+
+	req.NoError(lockout.Reserve("bob", now))
+	req.NoError(lockout.Reserve("bob", now))
+	lockout.Success("bob")
+	req.Equal(1, lockout.states["bob"].pending)
+	lockout.Failure("bob", now)
+	req.NoError(lockout.Check("bob", now))
+	req.Equal(1, lockout.states["bob"].failures)
+}
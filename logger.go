@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+)
+
+// Field is a structured key-value pair attached to a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is a shorthand for creating a Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives SDK decisions such as rotations, lockouts and rejected responses.
+// Adapters for log/slog, zap and logrus are available in the passw0rdslog, passw0rdzap
+// and passw0rdlogrus packages. Implementations must be safe for concurrent use
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+// NopLogger discards all messages. It is used when no logger is configured
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+
+func (p *Protocol) logger() Logger {
+	if p.Logger == nil {
+		return NopLogger
+	}
+	return p.Logger
+}
+
+func (vc *VirgilHTTPClient) logger() Logger {
+	if vc.Logger == nil {
+		return NopLogger
+	}
+	return vc.Logger
+}
+
+// withCorrelation adds the correlation ID of ctx to all messages of l
+func withCorrelation(ctx context.Context, l Logger) Logger {
+	id := CorrelationIDFromContext(ctx)
+	if id == "" || l == NopLogger {
+		return l
+	}
+	return &fieldLogger{logger: l, fields: []Field{F("correlation_id", id)}}
+}
+
+// fieldLogger appends fields to every message
+type fieldLogger struct {
+	logger Logger
+	fields []Field
+}
+
+func (l *fieldLogger) with(fields []Field) []Field {
+	return append(append(make([]Field, 0, len(fields)+len(l.fields)), fields...), l.fields...)
+}
+
+func (l *fieldLogger) Debug(msg string, fields ...Field) { l.logger.Debug(msg, l.with(fields)...) }
+func (l *fieldLogger) Info(msg string, fields ...Field)  { l.logger.Info(msg, l.with(fields)...) }
+func (l *fieldLogger) Warn(msg string, fields ...Field)  { l.logger.Warn(msg, l.with(fields)...) }
+func (l *fieldLogger) Error(msg string, fields ...Field) { l.logger.Error(msg, l.with(fields)...) }
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct {
+	sync.Mutex
+	lines  []string
+	fields []Field
+}
+
+func (l *testLogger) log(level, msg string, fields []Field) {
+	l.Lock()
+	defer l.Unlock()
+	l.lines = append(l.lines, level+" "+msg)
+	l.fields = append(l.fields, fields...)
+}
+
+func (l *testLogger) Debug(msg string, fields ...Field) { l.log("debug", msg, fields) }
+func (l *testLogger) Info(msg string, fields ...Field)  { l.log("info", msg, fields) }
+func (l *testLogger) Warn(msg string, fields ...Field)  { l.log("warn", msg, fields) }
+func (l *testLogger) Error(msg string, fields ...Field) { l.log("error", msg, fields) }
+
+func TestProtocol_Logger(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	logger := &testLogger{}
+	p.Logger = logger
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+
+	_, err = p.VerifyPassword("wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+
+	assert.Equal(t, []string{
+		"info keys rotated",
+		"debug password verification failed",
+	}, logger.lines)
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxLoginBody limits login request bodies
+const maxLoginBody = 64 << 10
+
+// RecordStore looks up stored records for LoginHandler. Implementations must be safe for concurrent use
+type RecordStore interface {
+	// Record returns the record of username, or nil if there is no such user
+	Record(ctx context.Context, username string) ([]byte, error)
+}
+
+// VerifiedUser is a user whose password LoginHandler verified
+type VerifiedUser struct {
+	Username string
+	// Key is the record encryption key
+	Key []byte
+}
+
+// LoginHandler verifies passwords of POST requests with a form or JSON body:
+//
+//	http.Handle("/login", &passw0rd.LoginHandler{Protocol: p, Records: store, OnSuccess: startSession})
+//
+// The username is passed to Protocol with WithUserID, so that its RateLimitStore and Lockout throttle
+// attempts. Unknown users are verified against a record of a random password, so that they get the same
+// response, take the same service round trip and are throttled like wrong passwords
+type LoginHandler struct {
+	Protocol *Protocol
+	// Records holds the records of users. If it is also a RecordSink, records of verified users which are
+	// behind the update token of Protocol are updated and saved with the user ID as id
+	Records RecordStore
+	// UsernameField and PasswordField name the form fields and JSON keys, "username" and "password" by default
+	UsernameField string
+	PasswordField string
+	// Source, if set, tags security events of the handler, see WithSource
+	Source string
+	// OnSuccess writes the response for a verified user, e.g. starts a session. The response is
+	// 204 No Content if it is nil
+	OnSuccess func(w http.ResponseWriter, r *http.Request, user *VerifiedUser)
+	// OnError, if set, writes the response for failed logins instead of a plain text one.
+	// Status is 400, 401, 405, 429 or 500 for problems of the request, the user, throttling or storage,
+	// and 502 for errors of the SDK and the service. Throttled requests have Retry-After set
+	OnError func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+	dummyMu sync.Mutex
+	dummy   []byte
+}
+
+type verifiedUserKey struct{}
+
+// VerifiedUserFromContext returns the user verified by LoginHandler.Middleware, or nil
+func VerifiedUserFromContext(ctx context.Context) *VerifiedUser {
+	user, _ := ctx.Value(verifiedUserKey{}).(*VerifiedUser)
+	return user
+}
+
+// ServeHTTP verifies the credentials of r and calls OnSuccess
+func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.verify(w, r)
+	if !ok {
+		return
+	}
+	if h.OnSuccess == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.OnSuccess(w, r, user)
+}
+
+// Middleware verifies the credentials of requests and passes verified ones on to next,
+// which gets the user with VerifiedUserFromContext
+func (h *LoginHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := h.verify(w, r)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), verifiedUserKey{}, user)))
+	})
+}
+
+// verify checks the credentials of r and writes the error response if they are not valid
+func (h *LoginHandler) verify(w http.ResponseWriter, r *http.Request) (*VerifiedUser, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.fail(w, r, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return nil, false
+	}
+
+	username, password, err := h.credentials(w, r)
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	user, err := h.Login(r.Context(), username, password)
+	if err != nil {
+		status, retryAfter := h.ErrorStatus(err)
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", RetryAfterSeconds(retryAfter))
+		}
+		h.fail(w, r, status, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// Login verifies the password of username the way ServeHTTP does, for handlers of other HTTP frameworks.
+// Unknown users fail with ErrInvalidPassword
+func (h *LoginHandler) Login(ctx context.Context, username, password string) (*VerifiedUser, error) {
+	userCtx := WithUserID(ctx, username)
+	if h.Source != "" {
+		userCtx = WithSource(userCtx, h.Source)
+	}
+
+	record, err := h.Records.Record(userCtx, username)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load record")
+	}
+	if record == nil {
+		if record, err = h.dummyRecord(ctx); err != nil {
+			return nil, err
+		}
+		if _, err = h.Protocol.VerifyPasswordContext(userCtx, password, record); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidPassword
+	}
+	ctx = userCtx
+
+	key, err := h.Protocol.VerifyPasswordContext(ctx, password, record)
+	if err != nil {
+		return nil, err
+	}
+
+	if sink, ok := h.Records.(RecordSink); ok {
+		h.updateRecord(ctx, sink, username, record)
+	}
+	return &VerifiedUser{Username: username, Key: key}, nil
+}
+
+// dummyRecord returns the record of a random password which unknown users are verified against. It is
+// enrolled on first use and again after key rotations
+func (h *LoginHandler) dummyRecord(ctx context.Context) ([]byte, error) {
+	h.dummyMu.Lock()
+	defer h.dummyMu.Unlock()
+
+	if h.dummy != nil {
+		if version, _, err := UnmarshalRecord(h.dummy); err == nil && version == h.Protocol.CurrentVersion() {
+			return h.dummy, nil
+		}
+	}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, errors.Wrap(err, "could not generate password")
+	}
+	record, _, err := h.Protocol.EnrollAccountContext(ctx, base64.StdEncoding.EncodeToString(password))
+	if err != nil {
+		return nil, err
+	}
+	h.dummy = record
+	return record, nil
+}
+
+// updateRecord saves the record of a verified user updated to the current token version. Failures
+// only leave the record behind for Migrator or the next login, so they are logged rather than returned
+func (h *LoginHandler) updateRecord(ctx context.Context, sink RecordSink, username string, record []byte) {
+	if h.Protocol.snapshot().updateToken == nil {
+		return
+	}
+
+	updated, err := h.Protocol.UpdateEnrollmentRecordContext(ctx, record)
+	if err == nil && updated != nil {
+		err = sink.Save(ctx, username, record, updated)
+	}
+	if err != nil {
+		h.Protocol.logger().Warn("could not update record after login", F("error", err.Error()))
+	}
+}
+
+// ErrorStatus returns the HTTP status for an error of Login and, for throttled attempts, when to retry:
+// 401 for wrong passwords, 429 for throttling, 500 for RecordStore errors and 502 for other SDK errors
+func (h *LoginHandler) ErrorStatus(err error) (status int, retryAfter time.Duration) {
+	switch e := err.(type) {
+	case *RateLimitedError:
+		retryAfter = e.RetryAfter
+	case *AccountLockedError:
+		retryAfter = e.Until.Sub(h.Protocol.now())
+	}
+
+	switch ErrorCode(err) {
+	case CodeInvalidPassword:
+		return http.StatusUnauthorized, 0
+	case CodeRateLimited, CodeAccountLocked:
+		return http.StatusTooManyRequests, retryAfter
+	case CodeUnknown:
+		return http.StatusInternalServerError, 0
+	}
+	return http.StatusBadGateway, 0
+}
+
+// RetryAfterSeconds formats d as the value of a Retry-After header
+func RetryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// credentials reads the username and password of a JSON or form body
+func (h *LoginHandler) credentials(w http.ResponseWriter, r *http.Request) (username, password string, err error) {
+	usernameField, passwordField := h.UsernameField, h.PasswordField
+	if usernameField == "" {
+		usernameField = "username"
+	}
+	if passwordField == "" {
+		passwordField = "password"
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxLoginBody)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var body map[string]interface{}
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return "", "", errors.Wrap(err, "invalid JSON body")
+		}
+		username, _ = body[usernameField].(string)
+		password, _ = body[passwordField].(string)
+	} else {
+		if err = r.ParseForm(); err != nil {
+			return "", "", errors.Wrap(err, "invalid form body")
+		}
+		username, password = r.PostForm.Get(usernameField), r.PostForm.Get(passwordField)
+	}
+
+	if username == "" || password == "" {
+		return "", "", errors.Errorf("%s and %s are required", usernameField, passwordField)
+	}
+	return username, password, nil
+}
+
+func (h *LoginHandler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.OnError != nil {
+		h.OnError(w, r, status, err)
+		return
+	}
+
+	message := http.StatusText(status)
+	if status == http.StatusUnauthorized {
+		message = "invalid username or password"
+	}
+	http.Error(w, message, status)
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryRecordStore map[string][]byte
+
+func (s memoryRecordStore) Record(ctx context.Context, username string) ([]byte, error) {
+	if username == "broken" {
+		return nil, errors.New("connection reset")
+	}
+	return s[username], nil
+}
+
+func TestLoginHandler(t *testing.T) {
+	p := newTestService(t).protocol(t, "")
+	p.Lockout = NewLockout(LockoutPolicy{MaxFailures: 2, LockDuration: time.Minute})
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	var verified *VerifiedUser
+	h := &LoginHandler{
+		Protocol: p,
+		Records:  memoryRecordStore{"alice": rec, "bob": rec},
+		OnSuccess: func(w http.ResponseWriter, r *http.Request, user *VerifiedUser) {
+			verified = user
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+
+	form := func(username, password string) *http.Request {
+		body := url.Values{"username": {username}, "password": {password}}.Encode()
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, serve(form("alice", "passw0rd")).Code)
+	assert.Equal(t, &VerifiedUser{Username: "alice", Key: key}, verified)
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username": "bob", "password": "passw0rd"}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	require.Equal(t, http.StatusOK, serve(r).Code)
+	assert.Equal(t, "bob", verified.Username)
+
+	unknown := serve(form("carol", "passw0rd"))
+	wrong := serve(form("alice", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, unknown.Body.String(), wrong.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, serve(form("alice", "wrong")).Code)
+	locked := serve(form("alice", "passw0rd"))
+	assert.Equal(t, http.StatusTooManyRequests, locked.Code)
+	assert.Equal(t, "60", locked.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusBadRequest, serve(form("alice", "")).Code)
+	assert.Equal(t, http.StatusInternalServerError, serve(form("broken", "passw0rd")).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(httptest.NewRequest(http.MethodGet, "/login", nil)).Code)
+}
+
+func TestLoginHandler_Middleware(t *testing.T) {
+	p := newTestService(t).protocol(t, "")
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	var status int
+	h := &LoginHandler{
+		Protocol:      p,
+		Records:       memoryRecordStore{"alice": rec},
+		UsernameField: "email",
+		OnError: func(w http.ResponseWriter, r *http.Request, s int, err error) {
+			status = s
+			w.WriteHeader(s)
+		},
+	}
+	next := h.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(VerifiedUserFromContext(r.Context()).Username))
+	}))
+
+	body := url.Values{"email": {"alice"}, "password": {"passw0rd"}}.Encode()
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	next.ServeHTTP(w, r)
+	assert.Equal(t, "alice", w.Body.String())
+
+	r = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "alice", "password": "wrong"}`))
+	r.Header.Set("Content-Type", "application/json")
+	next.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Nil(t, VerifiedUserFromContext(context.Background()))
+}
+
+type savingRecordStore struct {
+	memoryRecordStore
+}
+
+func (s savingRecordStore) Save(ctx context.Context, id string, old, updated []byte) error {
+	s.memoryRecordStore[id] = updated
+	return nil
+}
+
+func TestLoginHandler_UpdatesRecords(t *testing.T) {
+	s := newTestService(t)
+	rec, key, err := s.protocol(t, "").EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	p := s.protocol(t, s.rotate(t))
+	store := savingRecordStore{memoryRecordStore{"alice": rec}}
+	h := &LoginHandler{Protocol: p, Records: store}
+
+	user, err := h.Login(context.Background(), "alice", "passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, key, user.Key)
+
+	version, _, err := UnmarshalRecord(store.memoryRecordStore["alice"])
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+
+	_, err = h.Login(context.Background(), "alice", "passw0rd")
+	require.NoError(t, err)
+}
+
+func TestLoginHandler_UnknownUsers(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	p.Lockout = NewLockout(LockoutPolicy{MaxFailures: 2, LockDuration: time.Minute})
+
+	var enrollments, verifications int
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		switch path.Base(req.URL.Path) {
+		case "enroll":
+			enrollments++
+		case "verify-password":
+			verifications++
+		}
+		return s.Do(req)
+	})
+	h := &LoginHandler{Protocol: p, Records: memoryRecordStore{}}
+	ctx := context.Background()
+
+	// unknown users take a service round trip like known ones, the dummy record is enrolled once
+	_, err := h.Login(ctx, "carol", "passw0rd")
+	assert.Equal(t, ErrInvalidPassword, err)
+	_, err = h.Login(ctx, "carol", "passw0rd")
+	assert.Equal(t, ErrInvalidPassword, err)
+	assert.Equal(t, 1, enrollments)
+	assert.Equal(t, 2, verifications)
+
+	// and are locked out like known ones
+	_, err = h.Login(ctx, "carol", "passw0rd")
+	assert.Equal(t, CodeAccountLocked, ErrorCode(err))
+	status, _ := h.ErrorStatus(err)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, 2, verifications)
+
+	// the dummy record follows key rotations
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+	_, err = h.Login(ctx, "dave", "passw0rd")
+	assert.Equal(t, ErrInvalidPassword, err)
+	assert.Equal(t, 2, enrollments)
+	version, _, err := UnmarshalRecord(h.dummy)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+}
+
+func TestLoginHandler_UnknownUsersRateLimited(t *testing.T) {
+	p := newTestService(t).protocol(t, "")
+	p.RateLimitStore = NewMemoryRateLimitStore()
+	p.RateLimit = RateLimit{Strategy: SlidingWindow, Limit: 1, Window: time.Minute}
+	h := &LoginHandler{Protocol: p, Records: memoryRecordStore{}}
+
+	_, err := h.Login(context.Background(), "carol", "passw0rd")
+	assert.Equal(t, ErrInvalidPassword, err)
+	_, err = h.Login(context.Background(), "carol", "passw0rd")
+	assert.Equal(t, CodeRateLimited, ErrorCode(err))
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Operations reported to Metrics
+const (
+	OperationEnroll = "enroll"
+	OperationVerify = "verify"
+	OperationUpdate = "update"
+)
+
+// OutcomeSuccess is reported to Metrics for successful operations. Failed operations are reported
+// with the same reasons as audit events: invalid_password, rate_limited, account_locked or error
+const OutcomeSuccess = "success"
+
+// Metrics receives the outcome and latency of every protocol operation. The passw0rdprom package
+// provides a Prometheus collector. Implementations must be safe for concurrent use
+type Metrics interface {
+	ObserveOperation(operation string, version uint32, outcome string, duration time.Duration)
+}
+
+// MultiMetrics returns Metrics which reports to all given metrics, e.g. to a Prometheus
+// collector and a LatencyTracker
+func MultiMetrics(metrics ...Metrics) Metrics {
+	return multiMetrics(metrics)
+}
+
+type multiMetrics []Metrics
+
+func (m multiMetrics) ObserveOperation(operation string, version uint32, outcome string, duration time.Duration) {
+	for _, metrics := range m {
+		metrics.ObserveOperation(operation, version, outcome, duration)
+	}
+}
+
+func (m multiMetrics) ObserveVersionSkew(recordVersion, currentVersion uint32) {
+	for _, metrics := range m {
+		if observer, ok := metrics.(VersionSkewObserver); ok {
+			observer.ObserveVersionSkew(recordVersion, currentVersion)
+		}
+	}
+}
+
+// VersionLabel formats a key version for use as a metric label, 0 means that the version is unknown
+func VersionLabel(version uint32) string {
+	if version == 0 {
+		return "unknown"
+	}
+	return strconv.FormatUint(uint64(version), 10)
+}
+
+func (p *Protocol) observe(operation string, version uint32, start time.Time, err error) {
+	if p.Metrics == nil {
+		return
+	}
+
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = auditReason(err)
+	}
+	p.Metrics.ObserveOperation(operation, version, outcome, p.now().Sub(start))
+}
+
+// finish reports the result of an operation to metrics and health status and publishes ServiceDegraded
+// for service failures
+func (p *Protocol) finish(ctx context.Context, operation string, version uint32, start time.Time, err error) {
+	p.observe(operation, version, start, err)
+	if operation != OperationUpdate {
+		p.health.record(err, p.now())
+	}
+	p.reportError(ctx, operation, version, err)
+
+	if p.Events == nil || err == nil {
+		return
+	}
+
+	switch ErrorCode(err) {
+	case CodeTransport, CodeServiceError:
+		p.Events.Publish(&ServiceDegraded{
+			Operation:     operation,
+			Err:           err,
+			CorrelationID: CorrelationIDFromContext(ctx),
+			Time:          p.now(),
+		})
+	}
+}
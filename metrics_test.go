@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetrics struct {
+	sync.Mutex
+	observed []string
+}
+
+func (m *testMetrics) ObserveOperation(operation string, version uint32, outcome string, duration time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.observed = append(m.observed, fmt.Sprintf("%s %s %s", operation, VersionLabel(version), outcome))
+}
+
+func TestProtocol_Metrics(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	metrics := &testMetrics{}
+	p.Metrics = metrics
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	_, err = p.VerifyPassword("wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+
+	_, err = p.VerifyPassword("passw0rd", []byte("garbage"))
+	require.Error(t, err)
+
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+
+	_, err = p.UpdateEnrollmentRecord(rec)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"enroll 1 success",
+		"verify 1 invalid_password",
+		"verify unknown error",
+		"update 2 success",
+	}, metrics.observed)
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RecordSource yields stored records to Migrator. Next returns io.EOF after the last record
+type RecordSource interface {
+	Next(ctx context.Context) (id string, record []byte, err error)
+}
+
+// RecordSink stores records updated by Migrator. Old is the record as read from the source, sinks should
+// only replace a record if it is still stored, so that records enrolled meanwhile are not overwritten,
+// and return ErrRecordChanged otherwise
+type RecordSink interface {
+	Save(ctx context.Context, id string, old, updated []byte) error
+}
+
+// MigrationProgress counts records processed by Migrator
+type MigrationProgress struct {
+	// Version is the key version of the update token records are migrated to
+	Version uint32
+	// Done is set once every record of the source has been processed
+	Done bool
+	// Processed is the number of records read from the source and updated or failed
+	Processed int
+	// Migrated records were updated and saved, UpToDate records already had the token version
+	Migrated int
+	UpToDate int
+	// Failed records could not be updated, e.g. because they are corrupt or more than one version behind
+	Failed int
+	// Changed records were replaced after they were read, e.g. by a login which updated them, and were
+	// not saved. Migrating again picks them up if they still need an update
+	Changed int
+	Elapsed time.Duration
+	// Workers is the number of records allowed to update concurrently when the progress was reported
+	Workers int
+}
+
+// Complete reports whether every record of the source has the key version of the update token: all
+// of them were processed, none failed and none changed meanwhile. The keys of earlier versions are
+// then no longer needed for records of the source, see Protocol.ReleaseMigrated
+func (p MigrationProgress) Complete() bool {
+	return p.Done && p.Failed == 0 && p.Changed == 0
+}
+
+// Migrator updates stored records to the version of an update token. It needs no credentials
+// and no service access, so it can run as an offline job against the database:
+//
+//	m := &passw0rd.Migrator{UpdateToken: "UT.2....", Workers: 4}
+//	progress, err := m.Migrate(ctx, source, sink)
+//
+// Next and Save are called from the goroutine of Migrate, records are updated by Workers goroutines
+type Migrator struct {
+	UpdateToken string
+	// Workers is the number of records updated concurrently. If it is not set, it starts at GOMAXPROCS
+	// and is halved while updates take markedly longer than the fastest one, i.e. while the host is saturated
+	Workers int
+	// WorkerPool, if set, caps the number of updates running at once together with other users
+	// of the pool, so that a migration does not starve the host service
+	WorkerPool *WorkerPool
+	// Progress, if set, is called after every processed record
+	Progress func(MigrationProgress)
+	// OnError, if set, is called for every record which failed to update
+	OnError func(id string, err error)
+	// Events, if set, receives MigrationCompleted when Migrate returns
+	Events *EventBus
+	// Clock measures elapsed time, SystemClock if nil
+	Clock Clock
+	// Profile, if set, captures pprof profiles of every Migrate call
+	Profile *Profile
+	// ReuseBuffers makes Migrator reuse the buffers of updated records once Save returns, saving
+	// an allocation per record. Sinks must then copy updated records they retain after Save
+	ReuseBuffers bool
+}
+
+type migrationJob struct {
+	id      string
+	record  []byte
+	updated []byte
+	err     error
+	// buf holds updated if it is reused, see ReuseBuffers
+	buf *[]byte
+}
+
+// Migrate updates all records of source and saves updated records to sink. Records which fail to update
+// or changed meanwhile are counted and reported to OnError, other errors of source and sink stop the
+// migration and are returned
+func (m *Migrator) Migrate(ctx context.Context, source RecordSource, sink RecordSink) (progress MigrationProgress, err error) {
+	token, err := parseToken(m.UpdateToken)
+	if err != nil {
+		return progress, withCode(CodeInvalidCredential, errors.Wrap(err, "could not parse update token"))
+	}
+	if token == nil {
+		return progress, withCode(CodeNoUpdateToken, errors.New("update token is mandatory"))
+	}
+	progress.Version = token.Version
+
+	defer m.Profile.start("migrate")()
+
+	clock := clockOrSystem(m.Clock)
+	start := clock.Now()
+	defer func() {
+		m.Events.Publish(&MigrationCompleted{
+			Version:  token.Version,
+			Migrated: progress.Migrated,
+			Failed:   progress.Failed,
+			Duration: progress.Elapsed,
+			Time:     clock.Now(),
+		})
+	}()
+
+	workers := m.Workers
+	var limit *adaptiveLimit
+	if workers < 1 {
+		limit = &adaptiveLimit{}
+		workers = limit.max()
+	}
+
+	jobs := make(chan *migrationJob)
+	results := make(chan *migrationJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		goLabeled(ctx, "migrate", token.Version, func(ctx context.Context) {
+			defer wg.Done()
+			for job := range jobs {
+				if limit != nil {
+					if job.err = limit.acquire(ctx); job.err != nil {
+						results <- job
+						continue
+					}
+				}
+
+				began := clock.Now()
+				job.err = m.WorkerPool.Do(ctx, func() (err error) {
+					var dst []byte
+					if m.ReuseBuffers {
+						job.buf = migrationBuffers.Get().(*[]byte)
+						dst = (*job.buf)[:0]
+					}
+					job.updated, err = m.update(dst, job.record, token)
+					return
+				})
+
+				if limit != nil {
+					cost := clock.Now().Sub(began)
+					limit.release(cost, cost)
+				}
+				results <- job
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	defer func() {
+		close(jobs)
+		for range results {
+		}
+	}()
+
+	var next *migrationJob
+	pending, eof := 0, false
+	for {
+		if err = ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		if next == nil && !eof {
+			id, record, err := source.Next(ctx)
+			switch {
+			case err == io.EOF:
+				eof = true
+			case err != nil:
+				return progress, errors.Wrap(err, "could not read records")
+			default:
+				next = &migrationJob{id: id, record: record}
+			}
+		}
+
+		if eof && pending == 0 {
+			progress.Done = true
+			return progress, nil
+		}
+
+		var send chan *migrationJob
+		if next != nil {
+			send = jobs
+		}
+
+		select {
+		case send <- next:
+			next = nil
+			pending++
+		case job := <-results:
+			pending--
+			if err = m.finish(ctx, sink, job, &progress); err != nil {
+				return progress, err
+			}
+			progress.Elapsed = clock.Now().Sub(start)
+			progress.Workers = workers
+			if limit != nil {
+				progress.Workers = limit.current()
+			}
+			if m.Progress != nil {
+				m.Progress(progress)
+			}
+		case <-ctx.Done():
+			return progress, ctx.Err()
+		}
+	}
+}
+
+// update appends a single record updated with the token parsed once by Migrate to dst
+func (m *Migrator) update(dst, record []byte, token *VersionedUpdateToken) ([]byte, error) {
+	dbRecord, err := acquireRecord(record)
+	if err != nil {
+		return nil, withCode(CodeInvalidRecord, errors.Wrap(err, "invalid record"))
+	}
+	defer releaseRecord(dbRecord)
+	return updateRecord(dst, dbRecord, token)
+}
+
+// finish saves the result of job and counts it. The buffer of job is reused afterwards
+func (m *Migrator) finish(ctx context.Context, sink RecordSink, job *migrationJob, progress *MigrationProgress) error {
+	if job.buf != nil {
+		defer func() {
+			if job.updated != nil {
+				*job.buf = job.updated[:0]
+			}
+			if cap(*job.buf) <= maxPooledBuffer {
+				migrationBuffers.Put(job.buf)
+			}
+		}()
+	}
+
+	if job.err != nil && job.err == ctx.Err() {
+		return job.err
+	}
+	progress.Processed++
+
+	switch {
+	case job.err != nil:
+		progress.Failed++
+		if m.OnError != nil {
+			m.OnError(job.id, job.err)
+		}
+	case job.updated == nil:
+		progress.UpToDate++
+	default:
+		err := sink.Save(ctx, job.id, job.record, job.updated)
+		if errors.Cause(err) == ErrRecordChanged {
+			progress.Changed++
+			if m.OnError != nil {
+				m.OnError(job.id, err)
+			}
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not save record %s", job.id)
+		}
+		progress.Migrated++
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRecords is a RecordSource and RecordSink over a map
+type memoryRecords struct {
+	ids     []string
+	records map[string][]byte
+	saveErr error
+	// copyUpdated copies updated records, as required by Migrator.ReuseBuffers
+	copyUpdated bool
+	mu          sync.Mutex
+}
+
+func (m *memoryRecords) Next(ctx context.Context) (string, []byte, error) {
+	if len(m.ids) == 0 {
+		return "", nil, io.EOF
+	}
+	id := m.ids[0]
+	m.ids = m.ids[1:]
+	return id, m.records[id], nil
+}
+
+func (m *memoryRecords) Save(ctx context.Context, id string, old, updated []byte) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.copyUpdated {
+		updated = append([]byte(nil), updated...)
+	}
+	if !bytes.Equal(m.records[id], old) {
+		return ErrRecordChanged
+	}
+	m.records[id] = updated
+	return nil
+}
+
+func TestMigrator(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	store := &memoryRecords{records: map[string][]byte{}}
+	for i := 0; i < 20; i++ {
+		rec, _, err := p.EnrollAccount(fmt.Sprintf("password-%d", i))
+		require.NoError(t, err)
+		id := fmt.Sprint(i)
+		store.ids, store.records[id] = append(store.ids, id), rec
+	}
+	store.ids, store.records["corrupt"] = append(store.ids, "corrupt"), []byte("corrupt")
+
+	token := s.rotate(t)
+	updated, err := UpdateEnrollmentRecord(store.records["0"], token)
+	require.NoError(t, err)
+	store.records["0"] = updated
+
+	bus := &EventBus{}
+	var completed []*MigrationCompleted
+	bus.Subscribe(func(e Event) {
+		if e, ok := e.(*MigrationCompleted); ok {
+			completed = append(completed, e)
+		}
+	})
+
+	var failed []string
+	calls := 0
+	m := &Migrator{
+		UpdateToken: token,
+		Workers:     4,
+		WorkerPool:  NewWorkerPool(2),
+		Progress:    func(MigrationProgress) { calls++ },
+		OnError:     func(id string, err error) { failed = append(failed, id) },
+		Events:      bus,
+	}
+
+	progress, err := m.Migrate(context.Background(), store, store)
+	require.NoError(t, err)
+	assert.Equal(t, 21, progress.Processed)
+	assert.Equal(t, 19, progress.Migrated)
+	assert.Equal(t, 1, progress.UpToDate)
+	assert.Equal(t, 1, progress.Failed)
+	assert.Equal(t, 21, calls)
+	assert.Equal(t, 4, progress.Workers)
+	assert.Equal(t, []string{"corrupt"}, failed)
+	assert.True(t, progress.Done)
+	assert.False(t, progress.Complete())
+
+	require.Len(t, completed, 1)
+	assert.Equal(t, uint32(2), completed[0].Version)
+	assert.Equal(t, 19, completed[0].Migrated)
+
+	require.NoError(t, p.AddUpdateToken(token))
+	for i := 0; i < 20; i++ {
+		version, _, err := UnmarshalRecord(store.records[fmt.Sprint(i)])
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), version)
+
+		_, err = p.VerifyPassword(fmt.Sprintf("password-%d", i), store.records[fmt.Sprint(i)])
+		require.NoError(t, err)
+	}
+}
+
+func TestMigrator_ReuseBuffers(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	store := &memoryRecords{records: map[string][]byte{}, copyUpdated: true}
+	keys := map[string][]byte{}
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprint(i)
+		rec, key, err := p.EnrollAccount("password-" + id)
+		require.NoError(t, err)
+		store.ids, store.records[id], keys[id] = append(store.ids, id), rec, key
+	}
+
+	token := s.rotate(t)
+	m := &Migrator{UpdateToken: token, Workers: 4, ReuseBuffers: true}
+	progress, err := m.Migrate(context.Background(), store, store)
+	require.NoError(t, err)
+	assert.Equal(t, 20, progress.Migrated)
+
+	require.NoError(t, p.AddUpdateToken(token))
+	for id, rec := range store.records {
+		key, err := p.VerifyPassword("password-"+id, rec)
+		require.NoError(t, err)
+		assert.Equal(t, keys[id], key)
+	}
+}
+
+func TestMigrator_Errors(t *testing.T) {
+	_, err := (&Migrator{UpdateToken: "UT.bad"}).Migrate(context.Background(), &memoryRecords{}, &memoryRecords{})
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	token := s.rotate(t)
+
+	store := &memoryRecords{ids: []string{"1", "2"}, records: map[string][]byte{"1": rec, "2": rec}, saveErr: errors.New("disk full")}
+	progress, err := (&Migrator{UpdateToken: token, Workers: 1}).Migrate(context.Background(), store, store)
+	assert.EqualError(t, err, "could not save record 1: disk full")
+	assert.Equal(t, 1, progress.Processed)
+	assert.Equal(t, 0, progress.Migrated)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store = &memoryRecords{ids: []string{"1"}, records: map[string][]byte{"1": rec}}
+	_, err = (&Migrator{UpdateToken: token}).Migrate(ctx, store, store)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMigrator_Changed(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	other, _, err := p.EnrollAccount("other")
+	require.NoError(t, err)
+	token := s.rotate(t)
+
+	source := &memoryRecords{ids: []string{"1", "2"}, records: map[string][]byte{"1": rec, "2": rec}}
+	sink := &memoryRecords{records: map[string][]byte{"1": rec, "2": other}}
+
+	var reported []error
+	m := &Migrator{UpdateToken: token, Workers: 1, OnError: func(id string, err error) { reported = append(reported, err) }}
+	progress, err := m.Migrate(context.Background(), source, sink)
+	require.NoError(t, err)
+	assert.Equal(t, 2, progress.Processed)
+	assert.Equal(t, 1, progress.Migrated)
+	assert.Equal(t, 1, progress.Changed)
+	assert.Equal(t, 0, progress.Failed)
+	assert.Equal(t, []error{ErrRecordChanged}, reported)
+	assert.False(t, progress.Complete())
+	assert.Equal(t, other, sink.records["2"])
+}
+
+func TestMigrator_Panics(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	store := &memoryRecords{records: map[string][]byte{}}
+	for _, id := range []string{"good", "malformed"} {
+		rec, _, err := p.EnrollAccount("passw0rd")
+		require.NoError(t, err)
+		store.ids, store.records[id] = append(store.ids, id), rec
+	}
+	malformed := store.records["malformed"]
+
+	update := pheUpdateRecord
+	defer func() { pheUpdateRecord = update }()
+	pheUpdateRecord = func(record, token []byte) ([]byte, error) {
+		if bytes.Contains(malformed, record) {
+			panic("invalid point")
+		}
+		return update(record, token)
+	}
+
+	failed := map[string]error{}
+	m := &Migrator{
+		UpdateToken: s.rotate(t),
+		Workers:     2,
+		OnError:     func(id string, err error) { failed[id] = err },
+	}
+	progress, err := m.Migrate(context.Background(), store, store)
+	require.NoError(t, err)
+	assert.Equal(t, 1, progress.Migrated)
+	assert.Equal(t, 1, progress.Failed)
+
+	require.Contains(t, failed, "malformed")
+	assert.Equal(t, CodePHEPanic, ErrorCode(failed["malformed"]))
+	assert.EqualError(t, failed["malformed"], ErrPHEPanic.Error()+" in UpdateRecord: invalid point")
+}
@@ -23,6 +23,7 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 type DatabaseRecord struct {
 	Version              uint32   `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
 	Record               []byte   `protobuf:"bytes,2,opt,name=record,proto3" json:"record,omitempty"`
+	PepperVersion        uint32   `protobuf:"varint,3,opt,name=pepper_version,json=pepperVersion,proto3" json:"pepper_version,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -67,6 +68,13 @@ func (m *DatabaseRecord) GetRecord() []byte {
 	return nil
 }
 
+func (m *DatabaseRecord) GetPepperVersion() uint32 {
+	if m != nil {
+		return m.PepperVersion
+	}
+	return 0
+}
+
 type EnrollmentRequest struct {
 	Version              uint32   `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -346,22 +354,23 @@ func init() {
 func init() { proto.RegisterFile("passw0rd.proto", fileDescriptor_ea098cf24212aa17) }
 
 var fileDescriptor_ea098cf24212aa17 = []byte{
-	// 259 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x91, 0x41, 0x4b, 0x03, 0x31,
-	0x10, 0x85, 0x59, 0x91, 0xda, 0x8e, 0xb5, 0x60, 0xd0, 0xb2, 0x78, 0xaa, 0x39, 0xf5, 0xa2, 0x08,
-	0x7a, 0xf1, 0x2a, 0x16, 0x44, 0x2f, 0x12, 0xb5, 0x57, 0x49, 0x9b, 0x51, 0x8a, 0x6d, 0x26, 0xce,
-	0x64, 0x15, 0xff, 0xbd, 0xec, 0x6e, 0x56, 0x4b, 0xc1, 0xf5, 0x96, 0x47, 0xbe, 0x7c, 0xf3, 0x92,
-	0xc0, 0x20, 0x58, 0x91, 0xcf, 0x33, 0x76, 0xa7, 0x81, 0x29, 0x92, 0xea, 0x36, 0x59, 0x5f, 0xc1,
-	0xe0, 0xda, 0x46, 0x3b, 0xb3, 0x82, 0x06, 0xe7, 0xc4, 0x4e, 0xe5, 0xb0, 0xf3, 0x81, 0x2c, 0x0b,
-	0xf2, 0x79, 0x36, 0xca, 0xc6, 0x7b, 0xa6, 0x89, 0x6a, 0x08, 0x1d, 0xae, 0x98, 0x7c, 0x6b, 0x94,
-	0x8d, 0xfb, 0x26, 0x25, 0x7d, 0x02, 0xfb, 0x13, 0xcf, 0xb4, 0x5c, 0xae, 0xd0, 0x47, 0x83, 0xef,
-	0x05, 0x4a, 0xfc, 0x5b, 0xa3, 0x6f, 0x41, 0xad, 0xe3, 0x12, 0xc8, 0x0b, 0xb6, 0x8c, 0x3d, 0x82,
-	0x2e, 0x27, 0x2a, 0x0d, 0xfe, 0xc9, 0xfa, 0x0e, 0x0e, 0xa7, 0xc8, 0x8b, 0x97, 0xaf, 0xfb, 0xf2,
-	0x42, 0xc4, 0xee, 0xdf, 0xf1, 0xe5, 0x0e, 0xd7, 0x50, 0xb2, 0x35, 0x51, 0x5f, 0xc0, 0x70, 0x53,
-	0x96, 0xca, 0xad, 0x57, 0xc8, 0x36, 0x2a, 0x3c, 0xc0, 0xc1, 0xb4, 0x56, 0xa3, 0x7b, 0x0a, 0xce,
-	0x46, 0x7c, 0xa4, 0x37, 0xf4, 0x2d, 0x0d, 0x8e, 0xa1, 0x5f, 0x54, 0xe0, 0x73, 0x2c, 0xc9, 0x54,
-	0x63, 0xb7, 0xf8, 0x3d, 0xac, 0x2f, 0xa1, 0x77, 0x13, 0x63, 0x98, 0x30, 0x13, 0x2b, 0x05, 0xdb,
-	0x73, 0x72, 0x98, 0x34, 0xd5, 0xba, 0xb4, 0xaf, 0x50, 0xc4, 0xbe, 0xd6, 0x6f, 0xd2, 0x33, 0x4d,
-	0x9c, 0x75, 0xaa, 0x2f, 0x3e, 0xff, 0x0e, 0x00, 0x00, 0xff, 0xff, 0x6c, 0x48, 0x72, 0xb4, 0xf4,
-	0x01, 0x00, 0x00,
+	// 275 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0xc1, 0x4b, 0x33, 0x31,
+	0x10, 0xc5, 0xd9, 0xef, 0x93, 0xda, 0x8e, 0xed, 0x82, 0x41, 0xcb, 0xe2, 0xa9, 0x06, 0x84, 0x5e,
+	0x14, 0x41, 0x2f, 0xde, 0x2d, 0x88, 0x5e, 0x64, 0xd5, 0x5e, 0x4b, 0xda, 0x8c, 0xb2, 0xd8, 0x66,
+	0xe2, 0x24, 0xab, 0xf8, 0xdf, 0xcb, 0x66, 0x13, 0x2d, 0x05, 0xeb, 0x2d, 0x6f, 0xf2, 0xe6, 0xcd,
+	0x2f, 0x43, 0x20, 0xb7, 0xca, 0xb9, 0x8f, 0x73, 0xd6, 0x67, 0x96, 0xc9, 0x93, 0xe8, 0x26, 0x2d,
+	0x2b, 0xc8, 0xaf, 0x95, 0x57, 0x73, 0xe5, 0xb0, 0xc4, 0x05, 0xb1, 0x16, 0x05, 0xec, 0xbe, 0x23,
+	0xbb, 0x8a, 0x4c, 0x91, 0x8d, 0xb2, 0xf1, 0xa0, 0x4c, 0x52, 0x0c, 0xa1, 0xc3, 0xc1, 0x53, 0xfc,
+	0x1b, 0x65, 0xe3, 0x7e, 0x19, 0x95, 0x38, 0x81, 0xdc, 0xa2, 0xb5, 0xc8, 0xb3, 0xd4, 0xf8, 0x3f,
+	0x34, 0x0e, 0xda, 0xea, 0xb4, 0x2d, 0xca, 0x53, 0xd8, 0x9f, 0x18, 0xa6, 0xe5, 0x72, 0x85, 0xc6,
+	0x97, 0xf8, 0x56, 0xa3, 0xf3, 0xbf, 0x4f, 0x93, 0xb7, 0x20, 0xd6, 0xed, 0xce, 0x92, 0x71, 0xb8,
+	0x85, 0xee, 0x08, 0xba, 0x1c, 0x5d, 0x91, 0xef, 0x5b, 0xcb, 0x3b, 0x38, 0x9c, 0x22, 0x57, 0xcf,
+	0x9f, 0xf7, 0xcd, 0xbb, 0x89, 0xf5, 0x9f, 0xe3, 0x9b, 0x1b, 0x6e, 0x4d, 0x31, 0x2d, 0x49, 0x79,
+	0x09, 0xc3, 0xcd, 0xb0, 0x08, 0xb7, 0x8e, 0x90, 0x6d, 0x20, 0x3c, 0xc0, 0x41, 0x5c, 0x04, 0xea,
+	0x27, 0xab, 0x95, 0xc7, 0x47, 0x7a, 0x45, 0xb3, 0x85, 0xe0, 0x18, 0xfa, 0x75, 0x30, 0xce, 0x7c,
+	0xe3, 0x8c, 0x18, 0x7b, 0xf5, 0x4f, 0xb3, 0xbc, 0x82, 0xde, 0x8d, 0xf7, 0x76, 0xc2, 0x4c, 0x2c,
+	0x04, 0xec, 0x2c, 0x48, 0x63, 0x8c, 0x09, 0xe7, 0x26, 0x7d, 0x85, 0xce, 0xa9, 0x97, 0x76, 0x27,
+	0xbd, 0x32, 0xc9, 0x79, 0x27, 0xfc, 0x84, 0x8b, 0xaf, 0x01, 0x00, 0x37, 0x59, 0x0b, 0x2b, 0x1b,
+	0x02, 0x00, 0x00,
 }
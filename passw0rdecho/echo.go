@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdecho adapts passw0rd login and signup flows to Echo:
+//
+//	e.POST("/login", startSession, passw0rdecho.Login(loginHandler))
+//	e.POST("/signup", saveUser, passw0rdecho.Signup(protocol))
+//
+// The middlewares bind Credentials from JSON or form bodies, run the SDK with the request context and
+// return failures as *echo.HTTPError for the HTTP error handler. Handlers get the result with User or Enrolled
+package passw0rdecho
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/passw0rd/sdk-go"
+)
+
+const (
+	userKey       = "passw0rd.user"
+	enrollmentKey = "passw0rd.enrollment"
+)
+
+// Credentials is the request body of Login and Signup
+type Credentials struct {
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+}
+
+// Enrollment is the result of Signup. Record must be stored for the user, Key encrypts user data
+type Enrollment struct {
+	Username string
+	Record   []byte
+	Key      []byte
+}
+
+// Login returns a middleware which verifies Credentials with h.Login and stores the verified user for User.
+// Wrong passwords and unknown users fail with 401, throttled attempts with 429 and Retry-After
+func Login(h *passw0rd.LoginHandler) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cred, err := bind(c)
+			if err != nil {
+				return err
+			}
+
+			user, err := h.Login(c.Request().Context(), cred.Username, cred.Password)
+			if err != nil {
+				status, retryAfter := h.ErrorStatus(err)
+				if retryAfter > 0 {
+					c.Response().Header().Set("Retry-After", passw0rd.RetryAfterSeconds(retryAfter))
+				}
+				return httpError(status, err)
+			}
+			c.Set(userKey, user)
+			return next(c)
+		}
+	}
+}
+
+// Signup returns a middleware which enrolls the password of Credentials with p and stores the result for Enrolled
+func Signup(p *passw0rd.Protocol) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cred, err := bind(c)
+			if err != nil {
+				return err
+			}
+
+			record, key, err := p.EnrollAccountContext(c.Request().Context(), cred.Password)
+			if err != nil {
+				return httpError(http.StatusBadGateway, err)
+			}
+			c.Set(enrollmentKey, &Enrollment{Username: cred.Username, Record: record, Key: key})
+			return next(c)
+		}
+	}
+}
+
+// User returns the user verified by Login, or nil
+func User(c echo.Context) *passw0rd.VerifiedUser {
+	user, _ := c.Get(userKey).(*passw0rd.VerifiedUser)
+	return user
+}
+
+// Enrolled returns the enrollment of Signup, or nil
+func Enrolled(c echo.Context) *Enrollment {
+	enrollment, _ := c.Get(enrollmentKey).(*Enrollment)
+	return enrollment
+}
+
+func bind(c echo.Context) (*Credentials, error) {
+	cred := &Credentials{}
+	if err := c.Bind(cred); err != nil || cred.Username == "" || cred.Password == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "username and password are required")
+	}
+	return cred, nil
+}
+
+// httpError hides errors of the service from the client, they stay available as Internal
+func httpError(status int, err error) *echo.HTTPError {
+	message := http.StatusText(status)
+	if status == http.StatusUnauthorized {
+		message = "invalid username or password"
+	}
+	return echo.NewHTTPError(status, message).SetInternal(err)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdecho
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type records map[string][]byte
+
+func (r records) Record(ctx context.Context, username string) ([]byte, error) {
+	return r[username], nil
+}
+
+func TestLoginSignup(t *testing.T) {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+	p.Lockout = passw0rd.NewLockout(passw0rd.LockoutPolicy{MaxFailures: 1, LockDuration: time.Minute})
+
+	store := records{}
+	e := echo.New()
+	e.POST("/signup", func(c echo.Context) error {
+		enrollment := Enrolled(c)
+		store[enrollment.Username] = enrollment.Record
+		return c.NoContent(http.StatusCreated)
+	}, Signup(p))
+	e.POST("/login", func(c echo.Context) error {
+		return c.String(http.StatusOK, User(c).Username)
+	}, Login(&passw0rd.LoginHandler{Protocol: p, Records: store}))
+
+	post := func(path, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, contentType)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, post("/signup", echo.MIMEApplicationForm, "username=alice&password=passw0rd").Code)
+	require.Contains(t, store, "alice")
+
+	w := post("/login", echo.MIMEApplicationJSON, `{"username": "alice", "password": "passw0rd"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, post("/login", echo.MIMEApplicationJSON, `{"username": "alice", "password": "wrong"}`).Code)
+	w = post("/login", echo.MIMEApplicationJSON, `{"username": "alice", "password": "passw0rd"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusBadRequest, post("/signup", echo.MIMEApplicationJSON, `{"password": "passw0rd"}`).Code)
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdgin adapts passw0rd login and signup flows to Gin:
+//
+//	router.POST("/login", passw0rdgin.Login(loginHandler), startSession)
+//	router.POST("/signup", passw0rdgin.Signup(protocol), saveUser)
+//
+// Handlers bind Credentials from JSON or form bodies, run the SDK with the request context and abort
+// failed requests with a JSON error body. Following handlers get the result with User or Enrolled
+package passw0rdgin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/passw0rd/sdk-go"
+)
+
+const (
+	userKey       = "passw0rd.user"
+	enrollmentKey = "passw0rd.enrollment"
+)
+
+// Credentials is the request body of Login and Signup
+type Credentials struct {
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+}
+
+// Enrollment is the result of Signup. Record must be stored for the user, Key encrypts user data
+type Enrollment struct {
+	Username string
+	Record   []byte
+	Key      []byte
+}
+
+// Login returns a handler which verifies Credentials with h.Login and stores the verified user for User.
+// Wrong passwords and unknown users abort with 401, throttled attempts with 429 and Retry-After
+func Login(h *passw0rd.LoginHandler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred, ok := bind(c)
+		if !ok {
+			return
+		}
+
+		user, err := h.Login(c.Request.Context(), cred.Username, cred.Password)
+		if err != nil {
+			status, retryAfter := h.ErrorStatus(err)
+			if retryAfter > 0 {
+				c.Header("Retry-After", passw0rd.RetryAfterSeconds(retryAfter))
+			}
+			abort(c, status, err)
+			return
+		}
+		c.Set(userKey, user)
+	}
+}
+
+// Signup returns a handler which enrolls the password of Credentials with p and stores the result for Enrolled
+func Signup(p *passw0rd.Protocol) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred, ok := bind(c)
+		if !ok {
+			return
+		}
+
+		record, key, err := p.EnrollAccountContext(c.Request.Context(), cred.Password)
+		if err != nil {
+			abort(c, http.StatusBadGateway, err)
+			return
+		}
+		c.Set(enrollmentKey, &Enrollment{Username: cred.Username, Record: record, Key: key})
+	}
+}
+
+// User returns the user verified by Login, or nil
+func User(c *gin.Context) *passw0rd.VerifiedUser {
+	value, _ := c.Get(userKey)
+	user, _ := value.(*passw0rd.VerifiedUser)
+	return user
+}
+
+// Enrolled returns the enrollment of Signup, or nil
+func Enrolled(c *gin.Context) *Enrollment {
+	value, _ := c.Get(enrollmentKey)
+	enrollment, _ := value.(*Enrollment)
+	return enrollment
+}
+
+func bind(c *gin.Context) (*Credentials, bool) {
+	cred := &Credentials{}
+	if err := c.ShouldBind(cred); err != nil || cred.Username == "" || cred.Password == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "username and password are required"})
+		return nil, false
+	}
+	return cred, true
+}
+
+// abort ends the request with status, errors of the service are not passed on to the client
+func abort(c *gin.Context, status int, err error) {
+	_ = c.Error(err)
+	message := http.StatusText(status)
+	if status == http.StatusUnauthorized {
+		message = "invalid username or password"
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
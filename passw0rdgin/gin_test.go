@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdgin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type records map[string][]byte
+
+func (r records) Record(ctx context.Context, username string) ([]byte, error) {
+	return r[username], nil
+}
+
+func TestLoginSignup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, err := fake.New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	store := records{}
+	router := gin.New()
+	router.POST("/signup", Signup(p), func(c *gin.Context) {
+		enrollment := Enrolled(c)
+		store[enrollment.Username] = enrollment.Record
+		c.Status(http.StatusCreated)
+	})
+	router.POST("/login", Login(&passw0rd.LoginHandler{Protocol: p, Records: store}), func(c *gin.Context) {
+		c.String(http.StatusOK, User(c).Username)
+	})
+
+	post := func(path, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, post("/signup", "application/json", `{"username": "alice", "password": "passw0rd"}`).Code)
+	require.Contains(t, store, "alice")
+
+	w := post("/login", "application/x-www-form-urlencoded", "username=alice&password=passw0rd")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = post("/login", "application/json", `{"username": "alice", "password": "wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "invalid username or password"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, post("/login", "application/json", `{"username": "alice"}`).Code)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdlogrus adapts logrus loggers to passw0rd.Logger
+package passw0rdlogrus
+
+import (
+	"github.com/passw0rd/sdk-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger logs SDK messages with a logrus.FieldLogger, e.g. *logrus.Logger or *logrus.Entry
+type Logger struct {
+	Logger logrus.FieldLogger
+}
+
+// New returns an adapter for l, or for the logrus standard logger if l is nil
+func New(l logrus.FieldLogger) *Logger {
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+	return &Logger{Logger: l}
+}
+
+func (l *Logger) Debug(msg string, fields ...passw0rd.Field) { l.entry(fields).Debug(msg) }
+func (l *Logger) Info(msg string, fields ...passw0rd.Field)  { l.entry(fields).Info(msg) }
+func (l *Logger) Warn(msg string, fields ...passw0rd.Field)  { l.entry(fields).Warn(msg) }
+func (l *Logger) Error(msg string, fields ...passw0rd.Field) { l.entry(fields).Error(msg) }
+
+func (l *Logger) entry(fields []passw0rd.Field) logrus.FieldLogger {
+	if len(fields) == 0 {
+		return l.Logger
+	}
+	res := make(logrus.Fields, len(fields))
+	for _, f := range fields {
+		res[f.Key] = f.Value
+	}
+	return l.Logger.WithFields(res)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdmock
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMocks(t *testing.T) {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+
+	client := &HTTPClientMock{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}}
+	logger := &LoggerMock{
+		DebugFunc: func(msg string, fields ...passw0rd.Field) {},
+		InfoFunc:  func(msg string, fields ...passw0rd.Field) {},
+		WarnFunc:  func(msg string, fields ...passw0rd.Field) {},
+		ErrorFunc: func(msg string, fields ...passw0rd.Field) {},
+	}
+	metrics := &MetricsMock{ObserveOperationFunc: func(operation string, version uint32, outcome string, duration time.Duration) {}}
+
+	p.APIClient.HTTPClient.Client = client
+	p.Logger = logger
+	p.Metrics = metrics
+
+	_, _, err = p.EnrollAccount("passw0rd")
+	require.Error(t, err)
+
+	require.Len(t, client.DoCalls(), 1)
+	assert.Equal(t, "/phe/v1/enroll", client.DoCalls()[0].Request.URL.Path)
+	require.Len(t, metrics.ObserveOperationCalls(), 1)
+	assert.Equal(t, passw0rd.OperationEnroll, metrics.ObserveOperationCalls()[0].Operation)
+	assert.Equal(t, "error", metrics.ObserveOperationCalls()[0].Outcome)
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdoauth verifies passwords with passw0rd in OAuth2 resource owner password credentials
+// grants (RFC 6749, section 4.3) and in logins of OpenID Connect identity providers. Tokens are issued
+// by the caller, e.g. with a JWT signer or the storage of an OAuth2 server:
+//
+//	http.Handle("/token", &passw0rdoauth.TokenHandler{
+//		Login:              &passw0rd.LoginHandler{Protocol: p, Records: store},
+//		Issuer:             passw0rdoauth.IssuerFunc(issueTokens),
+//		AuthenticateClient: clients.Authenticate,
+//	})
+//
+// If the record store is also a passw0rd.RecordSink, records of users who log in are updated to the
+// current key version, see passw0rd.LoginHandler
+package passw0rdoauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// Error codes of token responses, RFC 6749 section 5.2
+const (
+	ErrInvalidRequest         = "invalid_request"
+	ErrInvalidClient          = "invalid_client"
+	ErrInvalidGrant           = "invalid_grant"
+	ErrUnsupportedGrantType   = "unsupported_grant_type"
+	ErrServerError            = "server_error"
+	ErrTemporarilyUnavailable = "temporarily_unavailable"
+)
+
+// TokenRequest is a password grant whose password was verified
+type TokenRequest struct {
+	ClientID string
+	Username string
+	Scopes   []string
+}
+
+// Token is a successful token response. IDToken is set by OpenID Connect providers for the "openid" scope
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Issuer issues tokens for verified users. User.Key is the record encryption key, e.g. for unlocking
+// data the tokens give access to; it must not be put into tokens
+type Issuer interface {
+	Issue(ctx context.Context, req *TokenRequest, user *passw0rd.VerifiedUser) (*Token, error)
+}
+
+// IssuerFunc adapts a function to Issuer
+type IssuerFunc func(ctx context.Context, req *TokenRequest, user *passw0rd.VerifiedUser) (*Token, error)
+
+// Issue calls f
+func (f IssuerFunc) Issue(ctx context.Context, req *TokenRequest, user *passw0rd.VerifiedUser) (*Token, error) {
+	return f(ctx, req, user)
+}
+
+// TokenHandler serves the token endpoint for the password grant
+type TokenHandler struct {
+	Login  *passw0rd.LoginHandler
+	Issuer Issuer
+	// AuthenticateClient checks client credentials given with HTTP Basic authentication or the client_id and
+	// client_secret parameters. Public clients have an empty secret. All clients are rejected if it is nil
+	AuthenticateClient func(ctx context.Context, clientID, clientSecret string) bool
+}
+
+// errorResponse is the body of failed token requests
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// ServeHTTP handles a token request
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, ErrInvalidRequest, "use POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidRequest, "invalid form body")
+		return
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if !basic {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || h.AuthenticateClient == nil || !h.AuthenticateClient(r.Context(), clientID, clientSecret) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		writeError(w, http.StatusUnauthorized, ErrInvalidClient, "client authentication failed")
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "password" {
+		writeError(w, http.StatusBadRequest, ErrUnsupportedGrantType, "only the password grant is supported")
+		return
+	}
+	username, password := r.PostForm.Get("username"), r.PostForm.Get("password")
+	if username == "" || password == "" {
+		writeError(w, http.StatusBadRequest, ErrInvalidRequest, "username and password are required")
+		return
+	}
+
+	user, validPassword, err := Authenticate(r.Context(), h.Login, username, password)
+	if err != nil {
+		status, retryAfter := h.Login.ErrorStatus(err)
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", passw0rd.RetryAfterSeconds(retryAfter))
+			writeError(w, status, ErrTemporarilyUnavailable, "too many attempts")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrServerError, "")
+		return
+	}
+	if !validPassword {
+		writeError(w, http.StatusBadRequest, ErrInvalidGrant, "invalid username or password")
+		return
+	}
+
+	token, err := h.Issuer.Issue(r.Context(), &TokenRequest{
+		ClientID: clientID,
+		Username: username,
+		Scopes:   strings.Fields(r.PostForm.Get("scope")),
+	}, user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrServerError, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, token)
+}
+
+// Authenticate verifies a password for identity providers which take username and password from their
+// own login page, in the shape of their password connectors: validPassword is false for wrong passwords
+// and unknown users, err is set for other failures including throttling
+func Authenticate(ctx context.Context, login *passw0rd.LoginHandler, username, password string) (user *passw0rd.VerifiedUser, validPassword bool, err error) {
+	user, err = login.Login(ctx, username, password)
+	if passw0rd.ErrorCode(err) == passw0rd.CodeInvalidPassword {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, &errorResponse{Error: code, Description: description})
+}
+
+// writeJSON writes a token endpoint response, which must not be cached
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdoauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type records struct {
+	mu      sync.Mutex
+	records map[string][]byte
+}
+
+func (r *records) Record(ctx context.Context, username string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.records[username], nil
+}
+
+func (r *records) Save(ctx context.Context, id string, old, updated []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[id] = updated
+	return nil
+}
+
+func TestTokenHandler(t *testing.T) {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	_, err = svc.Rotate()
+	require.NoError(t, err)
+	p, err = svc.Protocol()
+	require.NoError(t, err)
+
+	store := &records{records: map[string][]byte{"alice": rec}}
+	var issued *TokenRequest
+	h := &TokenHandler{
+		Login: &passw0rd.LoginHandler{Protocol: p, Records: store},
+		Issuer: IssuerFunc(func(ctx context.Context, req *TokenRequest, user *passw0rd.VerifiedUser) (*Token, error) {
+			assert.Equal(t, key, user.Key)
+			issued = req
+			return &Token{AccessToken: "token-" + user.Username, TokenType: "Bearer", ExpiresIn: 3600}, nil
+		}),
+		AuthenticateClient: func(ctx context.Context, clientID, clientSecret string) bool {
+			return clientID == "app" && clientSecret == "secret"
+		},
+	}
+
+	request := func(form url.Values, basic bool) (*httptest.ResponseRecorder, map[string]interface{}) {
+		r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basic {
+			r.SetBasicAuth("app", "secret")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w, body
+	}
+	grant := url.Values{"grant_type": {"password"}, "username": {"alice"}, "password": {"passw0rd"}, "scope": {"openid profile"}}
+
+	w, body := request(grant, true)
+	require.Equal(t, http.StatusOK, w.Code, body)
+	assert.Equal(t, "token-alice", body["access_token"])
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, &TokenRequest{ClientID: "app", Username: "alice", Scopes: []string{"openid", "profile"}}, issued)
+
+	version, _, err := passw0rd.UnmarshalRecord(store.records["alice"])
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version, "the record is updated on login")
+
+	wrong := url.Values{"grant_type": {"password"}, "username": {"alice"}, "password": {"wrong"},
+		"client_id": {"app"}, "client_secret": {"secret"}}
+	w, body = request(wrong, false)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrInvalidGrant, body["error"])
+
+	wrong.Set("client_secret", "guess")
+	w, body = request(wrong, false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrInvalidClient, body["error"])
+
+	w, body = request(url.Values{"grant_type": {"client_credentials"}}, true)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrUnsupportedGrantType, body["error"])
+}
+
+func TestAuthenticate(t *testing.T) {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+	p.Lockout = passw0rd.NewLockout(passw0rd.LockoutPolicy{MaxFailures: 1, LockDuration: time.Minute})
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	login := &passw0rd.LoginHandler{Protocol: p, Records: &records{records: map[string][]byte{"alice": rec}}}
+	ctx := context.Background()
+
+	user, valid, err := Authenticate(ctx, login, "alice", "passw0rd")
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.Equal(t, "alice", user.Username)
+
+	_, valid, err = Authenticate(ctx, login, "bob", "passw0rd")
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	_, valid, err = Authenticate(ctx, login, "alice", "wrong")
+	require.NoError(t, err)
+	assert.False(t, valid)
+
+	_, valid, err = Authenticate(ctx, login, "alice", "passw0rd")
+	assert.Equal(t, passw0rd.CodeAccountLocked, passw0rd.ErrorCode(err))
+	assert.False(t, valid)
+}
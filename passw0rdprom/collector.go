@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdprom exports passw0rd protocol metrics to Prometheus
+package passw0rdprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector counts protocol operations by key version and outcome and records their latency.
+// Register it with a prometheus.Registerer and assign it to Protocol.Metrics:
+//
+//	collector := passw0rdprom.NewCollector("myapp")
+//	prometheus.MustRegister(collector)
+//	protocol.Metrics = collector
+type Collector struct {
+	operations *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	skew       *prometheus.CounterVec
+}
+
+// NewCollector creates a collector with metrics in the given namespace, which may be empty
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "passw0rd",
+			Name:      "operations_total",
+			Help:      "Number of passw0rd operations by operation, key version and outcome.",
+		}, []string{"operation", "version", "outcome"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "passw0rd",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of passw0rd operations by operation and key version.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation", "version"}),
+		skew: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "passw0rd",
+			Name:      "version_skew_total",
+			Help:      "Number of verified records older than the current key version by record version and lag.",
+		}, []string{"version", "lag"}),
+	}
+}
+
+// ObserveOperation implements passw0rd.Metrics
+func (c *Collector) ObserveOperation(operation string, version uint32, outcome string, duration time.Duration) {
+	v := passw0rd.VersionLabel(version)
+	c.operations.WithLabelValues(operation, v, outcome).Inc()
+	c.latency.WithLabelValues(operation, v).Observe(duration.Seconds())
+}
+
+// ObserveVersionSkew implements passw0rd.VersionSkewObserver
+func (c *Collector) ObserveVersionSkew(recordVersion, currentVersion uint32) {
+	c.skew.WithLabelValues(passw0rd.VersionLabel(recordVersion), strconv.FormatUint(uint64(currentVersion-recordVersion), 10)).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.latency.Describe(ch)
+	c.skew.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.latency.Collect(ch)
+	c.skew.Collect(ch)
+}
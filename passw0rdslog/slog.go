@@ -0,0 +1,74 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdslog adapts log/slog loggers to passw0rd.Logger
+package passw0rdslog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/passw0rd/sdk-go"
+)
+
+// Logger logs SDK messages with a slog.Logger
+type Logger struct {
+	Logger *slog.Logger
+}
+
+// New returns an adapter for l, or for slog.Default() if l is nil
+func New(l *slog.Logger) *Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &Logger{Logger: l}
+}
+
+func (l *Logger) Debug(msg string, fields ...passw0rd.Field) { l.log(slog.LevelDebug, msg, fields) }
+func (l *Logger) Info(msg string, fields ...passw0rd.Field)  { l.log(slog.LevelInfo, msg, fields) }
+func (l *Logger) Warn(msg string, fields ...passw0rd.Field)  { l.log(slog.LevelWarn, msg, fields) }
+func (l *Logger) Error(msg string, fields ...passw0rd.Field) { l.log(slog.LevelError, msg, fields) }
+
+func (l *Logger) log(level slog.Level, msg string, fields []passw0rd.Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	l.Logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
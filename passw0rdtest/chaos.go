@@ -0,0 +1,243 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdtest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDropped is returned by FaultTransport for dropped requests
+var ErrDropped = errors.New("passw0rdtest: connection dropped")
+
+// FaultTransport injects faults into requests to the service, so that timeouts, retries and circuit
+// breakers can be checked against a misbehaving network. It is an http.RoundTripper for use in an
+// http.Client, which is needed to test client timeouts, and an HTTPClient of its own:
+//
+//	faults := &passw0rdtest.FaultTransport{ErrorRate: 0.2, BurstLength: 3, Seed: 1}
+//	protocol.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{
+//		Address: server.URL,
+//		Client:  &http.Client{Transport: faults, Timeout: time.Second},
+//		Retry:   &passw0rd.RetryPolicy{},
+//	}
+//
+// Rates are probabilities from 0 to 1 checked in the order of the fields. It is safe for concurrent use
+type FaultTransport struct {
+	// Base performs requests which are not failed, http.DefaultTransport if nil
+	Base http.RoundTripper
+	// Latency is added to every request, plus a random amount up to Jitter
+	Latency time.Duration
+	Jitter  time.Duration
+	// DropRate fails requests with ErrDropped without sending them
+	DropRate float64
+	// ErrorRate starts bursts of BurstLength 503 responses, BurstLength is 1 if not set
+	ErrorRate   float64
+	BurstLength int
+	// ThrottleRate returns 429 responses with a Retry-After of RetryAfter
+	ThrottleRate float64
+	RetryAfter   time.Duration
+	// TruncateRate cuts response bodies in half, reading them fails with io.ErrUnexpectedEOF
+	TruncateRate float64
+	// Seed makes injected faults reproducible, a time based seed is used if zero
+	Seed int64
+
+	once  sync.Once
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	burst int
+	stats FaultStats
+}
+
+// FaultStats counts requests and injected faults
+type FaultStats struct {
+	Requests  int
+	Dropped   int
+	Errors    int
+	Throttled int
+	Truncated int
+}
+
+// Stats returns the counters of injected faults
+func (t *FaultTransport) Stats() FaultStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+// closeBody closes the body of a request which is not passed to the base transport, as
+// http.RoundTripper requires
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// Do implements passw0rd.HTTPClient
+func (t *FaultTransport) Do(req *http.Request) (*http.Response, error) {
+	return t.RoundTrip(req)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, delay := t.decide()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch fault {
+	case faultDrop:
+		closeBody(req)
+		return nil, ErrDropped
+	case faultError:
+		closeBody(req)
+		return response(req, Error(http.StatusServiceUnavailable, "service unavailable")), nil
+	case faultThrottle:
+		closeBody(req)
+		return response(req, Throttle(t.RetryAfter)), nil
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || fault != faultTruncate {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body[:len(body)/2]), errReader{io.ErrUnexpectedEOF}))
+	return resp, nil
+}
+
+type fault int
+
+const (
+	faultNone fault = iota
+	faultDrop
+	faultError
+	faultThrottle
+	faultTruncate
+)
+
+// decide picks the fault and the latency of the next request
+func (t *FaultTransport) decide() (fault, time.Duration) {
+	t.once.Do(func() {
+		seed := t.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		t.rnd = rand.New(rand.NewSource(seed))
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stats.Requests++
+
+	delay := t.Latency
+	if t.Jitter > 0 {
+		delay += time.Duration(t.rnd.Int63n(int64(t.Jitter)))
+	}
+
+	switch {
+	case t.burst > 0:
+		t.burst--
+		t.stats.Errors++
+		return faultError, delay
+	case t.rnd.Float64() < t.DropRate:
+		t.stats.Dropped++
+		return faultDrop, delay
+	case t.rnd.Float64() < t.ErrorRate:
+		t.burst = t.BurstLength - 1
+		if t.burst < 0 {
+			t.burst = 0
+		}
+		t.stats.Errors++
+		return faultError, delay
+	case t.rnd.Float64() < t.ThrottleRate:
+		t.stats.Throttled++
+		return faultThrottle, delay
+	case t.rnd.Float64() < t.TruncateRate:
+		t.stats.Truncated++
+		return faultTruncate, delay
+	}
+	return faultNone, delay
+}
+
+// response builds an http.Response to req from a scripted response
+func response(req *http.Request, r Response) *http.Response {
+	header := http.Header{}
+	for name, values := range r.Header {
+		header[name] = values
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(r.Status) + " " + http.StatusText(r.Status),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func faultyProtocol(t *testing.T, server *Server, faults *FaultTransport, timeout time.Duration) *passw0rd.Protocol {
+	p, err := server.Protocol()
+	require.NoError(t, err)
+
+	p.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{
+		Address: server.URL,
+		Client:  &http.Client{Transport: faults, Timeout: timeout},
+	}
+	return p
+}
+
+func TestFaultTransport_Bursts(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	faults := &FaultTransport{ErrorRate: 1, BurstLength: 2, Seed: 1}
+	p := faultyProtocol(t, server, faults, time.Second)
+
+	_, _, err := p.EnrollAccount("passw0rd")
+	assert.Equal(t, passw0rd.CodeServiceError, passw0rd.ErrorCode(err))
+
+	faults.ErrorRate = 0
+	p.APIClient.HTTPClient.Retry = &passw0rd.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+	_, _, err = p.EnrollAccount("passw0rd")
+	require.NoError(t, err, "the rest of the burst is retried")
+
+	assert.Equal(t, FaultStats{Requests: 3, Errors: 2}, faults.Stats())
+	assert.Len(t, server.Requests(), 1)
+}
+
+func TestFaultTransport_Faults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	cases := map[string]struct {
+		faults *FaultTransport
+		code   passw0rd.Code
+	}{
+		"drop":     {&FaultTransport{DropRate: 1}, passw0rd.CodeTransport},
+		"throttle": {&FaultTransport{ThrottleRate: 1, RetryAfter: time.Minute}, passw0rd.CodeServiceError},
+		"truncate": {&FaultTransport{TruncateRate: 1}, passw0rd.CodeTransport},
+		"latency":  {&FaultTransport{Latency: time.Second}, passw0rd.CodeTransport},
+	}
+
+	for name, c := range cases {
+		p := faultyProtocol(t, server, c.faults, 50*time.Millisecond)
+		_, _, err := p.EnrollAccount("passw0rd")
+		assert.Equal(t, c.code, passw0rd.ErrorCode(err), name)
+		assert.Equal(t, 1, c.faults.Stats().Requests, name)
+	}
+}
+
+func TestFaultTransport_CircuitBreaker(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	faults := &FaultTransport{DropRate: 0.5, Seed: 42}
+	p := faultyProtocol(t, server, faults, time.Second)
+	breaker := &passw0rd.CircuitBreaker{Threshold: 1, Cooldown: time.Hour}
+	p.APIClient.HTTPClient.Breaker = breaker
+
+	for i := 0; i < 20 && breaker.State() == passw0rd.CircuitClosed; i++ {
+		_, _, _ = p.EnrollAccount("passw0rd")
+	}
+	require.Equal(t, passw0rd.CircuitOpen, breaker.State())
+
+	requests := faults.Stats().Requests
+	_, _, err := p.EnrollAccount("passw0rd")
+	assert.Equal(t, passw0rd.CodeCircuitOpen, passw0rd.ErrorCode(err))
+	assert.Equal(t, requests, faults.Stats().Requests)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+
+	first, second := clock.NewTimer(time.Second), clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	assert.Equal(t, 2, clock.Timers())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-first.C())
+	assert.Equal(t, 1, clock.Timers())
+	assert.False(t, first.Stop())
+
+	select {
+	case <-second.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	clock.Set(start.Add(time.Hour))
+	assert.Equal(t, start.Add(time.Hour), <-second.C())
+	assert.Equal(t, start.Add(time.Hour), clock.Now())
+	assert.Equal(t, 0, clock.Timers())
+}
+
+func TestClock_Retry(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	p, err := server.Protocol()
+	require.NoError(t, err)
+
+	clock := NewClock(time.Now())
+	p.APIClient.HTTPClient = &passw0rd.VirgilHTTPClient{
+		Address: server.URL,
+		Retry:   &passw0rd.RetryPolicy{Backoff: time.Hour, MaxBackoff: 2 * time.Hour},
+		Clock:   clock,
+	}
+	server.Enqueue(Error(http.StatusServiceUnavailable, "unavailable"))
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := p.EnrollAccount("passw0rd")
+		errs <- err
+	}()
+
+	clock.BlockUntil(1)
+	assert.Len(t, server.Requests(), 1)
+
+	clock.Advance(time.Hour)
+	require.NoError(t, <-errs)
+	assert.Len(t, server.Requests(), 2)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdtest
+
+import (
+	"bytes"
+	"testing"
+	"testing/quick"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/require"
+)
+
+// properties holds a service rotated up to MaxQuickVersion and a protocol knowing all versions
+type properties struct {
+	svc *fake.Service
+	gen *fake.Generator
+	p   *passw0rd.Protocol
+}
+
+func newProperties(t *testing.T) *properties {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	for svc.CurrentVersion() < MaxQuickVersion {
+		_, err = svc.Rotate()
+		require.NoError(t, err)
+	}
+
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+	return &properties{svc: svc, gen: svc.Generator(), p: p}
+}
+
+func quickConfig() *quick.Config {
+	if testing.Short() {
+		return &quick.Config{MaxCount: 5}
+	}
+	return &quick.Config{MaxCount: 30}
+}
+
+func TestProperty_VerifyYieldsEnrollmentKey(t *testing.T) {
+	props := newProperties(t)
+
+	property := func(version Version, pwd Password) bool {
+		record, key, err := props.gen.Record(uint32(version), string(pwd))
+		if err != nil {
+			return false
+		}
+		verified, err := props.p.VerifyPassword(string(pwd), record)
+		return err == nil && bytes.Equal(key, verified)
+	}
+	require.NoError(t, quick.Check(property, quickConfig()))
+}
+
+func TestProperty_UpdateThenVerifyYieldsSameKey(t *testing.T) {
+	props := newProperties(t)
+	tokens := props.svc.UpdateTokens()
+
+	property := func(version Version, pwd Password) bool {
+		record, key, err := props.gen.Record(uint32(version), string(pwd))
+		if err != nil {
+			return false
+		}
+
+		for _, token := range tokens[version-1:] {
+			if record, err = passw0rd.UpdateEnrollmentRecord(record, token); err != nil {
+				return false
+			}
+			verified, err := props.p.VerifyPassword(string(pwd), record)
+			if err != nil || !bytes.Equal(key, verified) {
+				return false
+			}
+		}
+
+		updated, _, err := passw0rd.UnmarshalRecord(record)
+		return err == nil && updated == MaxQuickVersion
+	}
+	require.NoError(t, quick.Check(property, quickConfig()))
+}
+
+func TestProperty_WrongPasswordNeverYieldsKey(t *testing.T) {
+	props := newProperties(t)
+
+	property := func(version Version, pair PasswordPair) bool {
+		record, _, err := props.gen.Record(uint32(version), string(pair.Password))
+		if err != nil {
+			return false
+		}
+		key, err := props.p.VerifyPassword(string(pair.Wrong), record)
+		return key == nil && err == passw0rd.ErrInvalidPassword
+	}
+	require.NoError(t, quick.Check(property, quickConfig()))
+}
+
+func TestProperty_EnrollmentsAreUnique(t *testing.T) {
+	props := newProperties(t)
+
+	property := func(pwd Password) bool {
+		record1, key1, err1 := props.p.EnrollAccount(string(pwd))
+		record2, key2, err2 := props.p.EnrollAccount(string(pwd))
+		return err1 == nil && err2 == nil && !bytes.Equal(record1, record2) && !bytes.Equal(key1, key2)
+	}
+	require.NoError(t, quick.Check(property, quickConfig()))
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdtest
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+)
+
+// MaxQuickVersion bounds key versions produced by Version
+const MaxQuickVersion = 4
+
+// Password is a password generator for testing/quick. Besides random ASCII strings it produces
+// the empty password, unicode, whitespace and long passwords
+type Password string
+
+// Generate implements quick.Generator
+func (Password) Generate(r *rand.Rand, size int) reflect.Value {
+	var pwd string
+	switch r.Intn(6) {
+	case 0:
+		pwd = ""
+	case 1:
+		pwd = randomString(r, size, "пароль密码🔑ßçé")
+	case 2:
+		pwd = " " + randomString(r, size, asciiChars) + "\t"
+	case 3:
+		pwd = strings.Repeat(randomString(r, 8, asciiChars), 64)
+	default:
+		pwd = randomString(r, size, asciiChars)
+	}
+	return reflect.ValueOf(Password(pwd))
+}
+
+// PasswordPair is a password along with a different one, for invariants of wrong passwords.
+// Wrong is often a near miss of Password: a different case, a trailing space or a single changed character
+type PasswordPair struct {
+	Password Password
+	Wrong    Password
+}
+
+// Generate implements quick.Generator
+func (PasswordPair) Generate(r *rand.Rand, size int) reflect.Value {
+	pwd := string(Password("").Generate(r, size).Interface().(Password))
+
+	var wrong string
+	switch r.Intn(4) {
+	case 0:
+		wrong = pwd + " "
+	case 1:
+		wrong = strings.ToUpper(pwd)
+	case 2:
+		if len(pwd) > 0 {
+			b := []byte(pwd)
+			b[r.Intn(len(b))] ^= 1
+			wrong = string(b)
+		}
+	default:
+		wrong = string(Password("").Generate(r, size).Interface().(Password))
+	}
+
+	if wrong == pwd {
+		wrong = pwd + "x"
+	}
+	return reflect.ValueOf(PasswordPair{Password: Password(pwd), Wrong: Password(wrong)})
+}
+
+// Version is a key version in [1, MaxQuickVersion] for testing/quick
+type Version uint32
+
+// Generate implements quick.Generator
+func (Version) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(Version(1 + r.Intn(MaxQuickVersion)))
+}
+
+const asciiChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-_=+[]{};:'\",.<>/?`~\\| "
+
+func randomString(r *rand.Rand, size int, chars string) string {
+	runes := []rune(chars)
+	n := r.Intn(size + 1)
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = runes[r.Intn(len(runes))]
+	}
+	return string(b)
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdtest provides an HTTP server speaking the passw0rd wire protocol for testing
+// transport behavior. By default requests are served by a fake service with generated keys,
+// scripted responses such as errors and throttling can be queued in front of it:
+//
+//	server := passw0rdtest.NewServer()
+//	defer server.Close()
+//
+//	protocol, err := server.Protocol()
+//	...
+//	server.Enqueue(passw0rdtest.Throttle(time.Second), passw0rdtest.Error(http.StatusBadGateway, "bad gateway"))
+package passw0rdtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+)
+
+// Response is a scripted response
+type Response struct {
+	// Path, if set, limits the response to one endpoint, e.g. "enroll" or "verify-password".
+	// Requests to other endpoints are served as if the response was not queued
+	Path   string
+	Status int
+	Header http.Header
+	Body   []byte
+	// Delay is waited before responding
+	Delay time.Duration
+}
+
+// Error returns a response with an HttpError body
+func Error(status int, message string) Response {
+	return Canned(status, &passw0rd.HttpError{Code: uint32(status), Message: message})
+}
+
+// Throttle returns a 429 response with a Retry-After header
+func Throttle(retryAfter time.Duration) Response {
+	resp := Error(http.StatusTooManyRequests, "too many requests")
+	resp.Header.Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+	return resp
+}
+
+// Canned returns a response with a protobuf encoded body
+func Canned(status int, msg proto.Message) Response {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return Response{Status: status, Header: http.Header{}, Body: body}
+}
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Server is a running test server
+type Server struct {
+	*httptest.Server
+	// Fake serves requests without scripted responses
+	Fake *fake.Service
+
+	mu       sync.Mutex
+	script   []Response
+	requests []*Request
+}
+
+// NewServer starts a server backed by a new fake service. Close it when done
+func NewServer() *Server {
+	svc, err := fake.New()
+	if err != nil {
+		panic("passw0rdtest: " + err.Error())
+	}
+
+	s := &Server{Fake: svc}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Protocol creates a protocol with the credentials of the fake service talking to the server
+func (s *Server) Protocol() (*passw0rd.Protocol, error) {
+	ctx, err := s.Fake.Context()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := passw0rd.NewProtocol(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.APIClient = &passw0rd.APIClient{AppToken: p.AppToken, URL: s.URL}
+	return p, nil
+}
+
+// Enqueue adds responses which are returned in order to the next matching requests
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, responses...)
+}
+
+// Pending returns the number of queued responses which were not returned yet
+func (s *Server) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.script)
+}
+
+// Requests returns all requests received by the server
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoint := path.Base(r.URL.Path)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, &Request{Method: r.Method, Path: endpoint, Header: r.Header, Body: body})
+	resp, ok := s.next(endpoint)
+	s.mu.Unlock()
+
+	if !ok {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		s.Fake.ServeHTTP(w, r)
+		return
+	}
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+// next removes and returns the first queued response matching endpoint
+func (s *Server) next(endpoint string) (Response, bool) {
+	for i, resp := range s.script {
+		if resp.Path == "" || resp.Path == endpoint {
+			s.script = append(s.script[:i], s.script[i+1:]...)
+			return resp, true
+		}
+	}
+	return Response{}, false
+}
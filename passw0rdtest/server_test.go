@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rdtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/passw0rd/sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	p, err := server.Protocol()
+	require.NoError(t, err)
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	server.Enqueue(Throttle(2*time.Second), Error(http.StatusBadGateway, "bad gateway"))
+
+	_, err = p.VerifyPassword("passw0rd", rec)
+	require.Error(t, err)
+	assert.Equal(t, passw0rd.CodeServiceError, passw0rd.ErrorCode(err))
+	assert.Contains(t, err.Error(), "too many requests")
+
+	_, err = p.VerifyPassword("passw0rd", rec)
+	assert.Contains(t, err.Error(), "bad gateway")
+	assert.Equal(t, 0, server.Pending())
+
+	verified, err := p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+
+	requests := server.Requests()
+	require.Len(t, requests, 4)
+	assert.Equal(t, "enroll", requests[0].Path)
+	assert.Equal(t, "verify-password", requests[3].Path)
+	assert.Equal(t, server.Fake.AppToken, requests[3].Header.Get("AppToken"))
+}
+
+func TestServer_Path(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	p, err := server.Protocol()
+	require.NoError(t, err)
+
+	resp := Error(http.StatusServiceUnavailable, "unavailable")
+	resp.Path = "verify-password"
+	server.Enqueue(resp)
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.Pending())
+
+	_, err = p.VerifyPassword("passw0rd", rec)
+	assert.Contains(t, err.Error(), "unavailable")
+}
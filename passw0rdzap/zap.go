@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package passw0rdzap adapts zap loggers to passw0rd.Logger
+package passw0rdzap
+
+import (
+	"github.com/passw0rd/sdk-go"
+	"go.uber.org/zap"
+)
+
+// Logger logs SDK messages with a zap.Logger
+type Logger struct {
+	Logger *zap.Logger
+}
+
+// New returns an adapter for l
+func New(l *zap.Logger) *Logger {
+	return &Logger{Logger: l}
+}
+
+func (l *Logger) Debug(msg string, fields ...passw0rd.Field) { l.Logger.Debug(msg, convert(fields)...) }
+func (l *Logger) Info(msg string, fields ...passw0rd.Field)  { l.Logger.Info(msg, convert(fields)...) }
+func (l *Logger) Warn(msg string, fields ...passw0rd.Field)  { l.Logger.Warn(msg, convert(fields)...) }
+func (l *Logger) Error(msg string, fields ...passw0rd.Field) { l.Logger.Error(msg, convert(fields)...) }
+
+func convert(fields []passw0rd.Field) []zap.Field {
+	res := make([]zap.Field, len(fields))
+	for i, f := range fields {
+		res[i] = zap.Any(f.Key, f.Value)
+	}
+	return res
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const minPepperLength = 16
+
+// ParsePepper parses an application pepper of form PP.<version>.<base64 content>.
+// Peppers kept in KMS can be unwrapped with DecryptCredential first
+func ParsePepper(pepper string) (version uint32, value SecretBytes, err error) {
+	version, content, err := ParseVersionAndContent("PP", pepper)
+	if err != nil {
+		return 0, nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid pepper"))
+	}
+
+	if len(content) < minPepperLength {
+		return 0, nil, withCode(CodeInvalidCredential, fmt.Errorf("pepper must be at least %d bytes long", minPepperLength))
+	}
+
+	return version, SecretBytes(content), nil
+}
+
+// NeedsPepperRotation reports whether record was enrolled with a pepper other than the current one.
+// Peppers can not be applied to existing records offline, so such records should be re-enrolled
+// after the next successful verification
+func (p *Protocol) NeedsPepperRotation(record []byte) (bool, error) {
+	dbRecord, err := unmarshalRecord(record)
+	if err != nil {
+		return false, withCode(CodeInvalidRecord, errors.Wrap(err, "invalid record"))
+	}
+
+	return dbRecord.PepperVersion != p.PepperVersion, nil
+}
+
+// pepperPassword mixes the pepper of the given version into password. Version 0 means no pepper
+func (p *Protocol) pepperPassword(pepperVersion uint32, password string) ([]byte, error) {
+	if pepperVersion == 0 {
+		return []byte(password), nil
+	}
+
+	pepper, ok := p.Peppers[pepperVersion]
+	if !ok {
+		return nil, withCode(CodeUnknownKeyVersion, fmt.Errorf("unable to find pepper for version %d", pepperVersion))
+	}
+
+	return p.pepperMACs.sum(pepperVersion, pepper, password), nil
+}
+
+// pepperMACs keeps keyed HMACs per pepper version, so that the key schedule is computed once per
+// version rather than on every call. Peppers replaced in Protocol.Peppers are picked up on next use
+type pepperMACs struct {
+	mu   sync.RWMutex
+	macs map[uint32]*pepperMAC
+}
+
+type pepperMAC struct {
+	pepper SecretBytes
+	pool   sync.Pool
+}
+
+func (c *pepperMACs) sum(version uint32, pepper SecretBytes, password string) []byte {
+	pm := c.get(version, pepper)
+
+	mac := pm.pool.Get().(hash.Hash)
+	_, _ = mac.Write([]byte(password))
+	sum := mac.Sum(nil)
+	mac.Reset()
+	pm.pool.Put(mac)
+	return sum
+}
+
+func (c *pepperMACs) get(version uint32, pepper SecretBytes) *pepperMAC {
+	c.mu.RLock()
+	pm := c.macs[version]
+	c.mu.RUnlock()
+	if pm != nil && hmac.Equal(pm.pepper, pepper) {
+		return pm
+	}
+
+	key := append(SecretBytes(nil), pepper...)
+	pm = &pepperMAC{pepper: key}
+	pm.pool.New = func() interface{} { return hmac.New(sha256.New, key) }
+
+	c.mu.Lock()
+	if c.macs == nil {
+		c.macs = make(map[uint32]*pepperMAC)
+	}
+	c.macs[version] = pm
+	c.mu.Unlock()
+	return pm
+}
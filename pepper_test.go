@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_Pepper(t *testing.T) {
+	req := require.New(t)
+
+	service := newTestService(t)
+	proto := service.protocol(t, "")
+
+	_, pepper1, err := ParsePepper("PP.1." + base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")))
+	req.NoError(err)
+	_, pepper2, err := ParsePepper("PP.2." + base64.StdEncoding.EncodeToString([]byte("fedcba9876543210")))
+	req.NoError(err)
+
+	proto.Peppers = map[uint32]SecretBytes{1: pepper1}
+	proto.PepperVersion = 1
+
+	const pwd = "p@ssw0Rd"
+	rec, key, err := proto.EnrollAccount(pwd)
+	req.NoError(err)
+
+	unpeppered := service.protocol(t, "")
+	_, err = unpeppered.VerifyPassword(pwd, rec)
+	req.Error(err)
+
+	proto.Peppers[2] = pepper2
+	proto.PepperVersion = 2
+
+	needsRotation, err := proto.NeedsPepperRotation(rec)
+	req.NoError(err)
+	req.True(needsRotation)
+
+	updated, err := UpdateEnrollmentRecord(rec, service.rotate(t))
+	req.NoError(err)
+	req.NoError(proto.AddUpdateToken(service.tokens[0]))
+
+	key1, err := proto.VerifyPassword(pwd, updated)
+	req.NoError(err)
+	req.Equal(key, key1)
+
+	_, _, err = ParsePepper("PP.1." + base64.StdEncoding.EncodeToString([]byte("short")))
+	req.Error(err)
+}
+
+func TestProtocol_PepperMACs(t *testing.T) {
+	req := require.New(t)
+
+	p := &Protocol{Peppers: map[uint32]SecretBytes{1: SecretBytes("0123456789abcdef")}}
+
+	mac := hmac.New(sha256.New, []byte("0123456789abcdef"))
+	_, _ = mac.Write([]byte("password"))
+	want := mac.Sum(nil)
+
+	for i := 0; i < 3; i++ {
+		got, err := p.pepperPassword(1, "password")
+		req.NoError(err)
+		req.Equal(want, got)
+	}
+
+	p.Peppers[1] = SecretBytes("fedcba9876543210")
+	got, err := p.pepperPassword(1, "password")
+	req.NoError(err)
+	req.NotEqual(want, got)
+}
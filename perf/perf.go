@@ -0,0 +1,211 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package perf compares Go benchmark results to catch performance regressions between SDK versions,
+// like benchstat but with thresholds, see testdata/perf/README.md:
+//
+//	old, err := perf.ParseFile("testdata/perf/baseline.txt")
+//	...
+//	deltas := perf.Compare(old, new, perf.DefaultThresholds)
+//	perf.Format(os.Stdout, deltas)
+//	if len(perf.Regressions(deltas)) > 0 {
+//		os.Exit(1)
+//	}
+package perf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Set holds measurements of benchmarks by benchmark name and unit, e.g. "ns/op". Every run of a
+// benchmark, e.g. with go test -count, adds a sample
+type Set map[string]map[string][]float64
+
+// Add adds a sample of unit to the benchmark name
+func (s Set) Add(name, unit string, value float64) {
+	if s[name] == nil {
+		s[name] = map[string][]float64{}
+	}
+	s[name][unit] = append(s[name][unit], value)
+}
+
+// Parse reads benchmark results in the format of go test -bench. Other lines are skipped.
+// The GOMAXPROCS suffix is removed from benchmark names, so results of different hosts compare
+func Parse(r io.Reader) (Set, error) {
+	set := Set{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		name := trimProcs(fields[0])
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, errors.Errorf("%s: invalid %s value %q", name, fields[i+1], fields[i])
+			}
+			set.Add(name, fields[i+1], value)
+		}
+	}
+	return set, errors.Wrap(scanner.Err(), "could not read benchmark results")
+}
+
+// ParseFile is Parse for the file at path
+func ParseFile(path string) (Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set, err := Parse(f)
+	return set, errors.Wrap(err, path)
+}
+
+// trimProcs removes the -N suffix go test adds for GOMAXPROCS other than 1
+func trimProcs(name string) string {
+	if i := strings.LastIndexByte(name, '-'); i > 0 {
+		if _, err := strconv.Atoi(name[i+1:]); err == nil {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// Thresholds are relative increases of measurements by unit which count as regressions, e.g. 0.1
+// for 10%. Units without a threshold are compared but never regress
+type Thresholds map[string]float64
+
+// DefaultThresholds flag 10% slower or larger benchmarks and any additional allocation
+var DefaultThresholds = Thresholds{"ns/op": 0.1, "B/op": 0.1, "allocs/op": 0}
+
+// Delta is the change of a measurement of a benchmark between two sets. Old and New are medians of
+// the samples, which are robust against the odd outlier of a noisy host
+type Delta struct {
+	Name string  `json:"name"`
+	Unit string  `json:"unit"`
+	Old  float64 `json:"old"`
+	New  float64 `json:"new"`
+	// Change is relative to Old, 0.1 means New is 10% higher
+	Change     float64 `json:"change"`
+	Regression bool    `json:"regression"`
+}
+
+// Compare returns deltas of measurements which both sets have, sorted by benchmark name and unit
+func Compare(old, new Set, thresholds Thresholds) []Delta {
+	var deltas []Delta
+	for name, units := range new {
+		for unit, samples := range units {
+			oldSamples := old[name][unit]
+			if len(oldSamples) == 0 || len(samples) == 0 {
+				continue
+			}
+
+			d := Delta{Name: name, Unit: unit, Old: median(oldSamples), New: median(samples)}
+			switch {
+			case d.Old != 0:
+				d.Change = (d.New - d.Old) / d.Old
+			case d.New != 0:
+				d.Change = 1
+			}
+			if threshold, ok := thresholds[unit]; ok {
+				d.Regression = d.Change > threshold
+			}
+			deltas = append(deltas, d)
+		}
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Name != deltas[j].Name {
+			return deltas[i].Name < deltas[j].Name
+		}
+		return deltas[i].Unit < deltas[j].Unit
+	})
+	return deltas
+}
+
+// Regressions returns the deltas which regressed
+func Regressions(deltas []Delta) []Delta {
+	var regressions []Delta
+	for _, d := range deltas {
+		if d.Regression {
+			regressions = append(regressions, d)
+		}
+	}
+	return regressions
+}
+
+// Format writes deltas as a table, regressions are marked with an exclamation mark
+func Format(w io.Writer, deltas []Delta) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tunit\told\tnew\tdelta\t")
+	for _, d := range deltas {
+		mark := ""
+		if d.Regression {
+			mark = " !"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%+.1f%%%s\t\n", d.Name, d.Unit, formatValue(d.Old), formatValue(d.New), d.Change*100, mark)
+	}
+	return tw.Flush()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func median(samples []float64) float64 {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
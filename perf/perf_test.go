@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package perf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const oldResults = `goos: linux
+goarch: amd64
+pkg: github.com/passw0rd/sdk-go
+BenchmarkMarshalRecord-8   	 5000000	       240 ns/op	     112 B/op	       2 allocs/op
+BenchmarkMarshalRecord-8   	 5000000	       250 ns/op	     112 B/op	       2 allocs/op
+BenchmarkMarshalRecord-8   	 5000000	       900 ns/op	     112 B/op	       2 allocs/op
+BenchmarkRecordEncoding/wire-8   	 5000000	       160 ns/op	     96 B/op	       2 allocs/op
+BenchmarkSnapshot   	 1000000	       2.5 ns/op
+PASS
+ok  	github.com/passw0rd/sdk-go	3.011s
+`
+
+const newResults = `BenchmarkMarshalRecord-16   	 5000000	       245 ns/op	     112 B/op	       3 allocs/op
+BenchmarkRecordEncoding/wire-16   	 5000000	       200 ns/op	     96 B/op	       2 allocs/op
+BenchmarkSnapshot-16   	 1000000	       2.4 ns/op
+BenchmarkNew-16   	 1000000	       10 ns/op
+`
+
+func TestParse(t *testing.T) {
+	set, err := Parse(strings.NewReader(oldResults))
+	require.NoError(t, err)
+
+	assert.Len(t, set, 3)
+	assert.Equal(t, []float64{240, 250, 900}, set["BenchmarkMarshalRecord"]["ns/op"])
+	assert.Equal(t, []float64{2}, set["BenchmarkRecordEncoding/wire"]["allocs/op"])
+	assert.Equal(t, []float64{2.5}, set["BenchmarkSnapshot"]["ns/op"])
+
+	_, err = Parse(strings.NewReader("BenchmarkBroken-8 100 fast ns/op\n"))
+	assert.Error(t, err)
+}
+
+func TestCompare(t *testing.T) {
+	old, err := Parse(strings.NewReader(oldResults))
+	require.NoError(t, err)
+	new, err := Parse(strings.NewReader(newResults))
+	require.NoError(t, err)
+
+	deltas := Compare(old, new, DefaultThresholds)
+	require.Len(t, deltas, 7)
+
+	// the median ignores the 900ns outlier
+	assert.Equal(t, Delta{Name: "BenchmarkMarshalRecord", Unit: "ns/op", Old: 250, New: 245, Change: -0.02}, deltas[2])
+
+	var regressed []string
+	for _, d := range Regressions(deltas) {
+		regressed = append(regressed, d.Name+" "+d.Unit)
+	}
+	assert.Equal(t, []string{"BenchmarkMarshalRecord allocs/op", "BenchmarkRecordEncoding/wire ns/op"}, regressed)
+
+	var out bytes.Buffer
+	require.NoError(t, Format(&out, deltas))
+	assert.Contains(t, out.String(), "+50.0% !")
+	assert.Contains(t, out.String(), "-4.0%")
+}
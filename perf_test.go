@@ -0,0 +1,82 @@
+//go:build perf
+// +build perf
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/passw0rd/sdk-go/perf"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPerformanceBaseline fails when the benchmarks of testdata/perf/baseline.txt allocate more than
+// recorded there. Timings depend on the host and are only logged, see testdata/perf/README.md
+func TestPerformanceBaseline(t *testing.T) {
+	baseline, err := perf.ParseFile("testdata/perf/baseline.txt")
+	require.NoError(t, err)
+
+	benchmarks := map[string]func(*testing.B){
+		"BenchmarkMarshalRecord":         BenchmarkMarshalRecord,
+		"BenchmarkUnmarshalRecord":       BenchmarkUnmarshalRecord,
+		"BenchmarkVerifyPassword_SDK":    BenchmarkVerifyPassword_SDK,
+		"BenchmarkVirgilHTTPClient_Send": BenchmarkVirgilHTTPClient_Send,
+		"BenchmarkProtocol_Snapshot":     BenchmarkProtocol_Snapshot,
+	}
+
+	current := perf.Set{}
+	for name, bench := range benchmarks {
+		r := testing.Benchmark(bench)
+		current.Add(name, "ns/op", float64(r.NsPerOp()))
+		current.Add(name, "B/op", float64(r.AllocedBytesPerOp()))
+		current.Add(name, "allocs/op", float64(r.AllocsPerOp()))
+	}
+
+	deltas := perf.Compare(baseline, current, perf.Thresholds{"B/op": 0.1, "allocs/op": 0})
+	require.Len(t, deltas, 3*len(benchmarks), "benchmarks are missing from the baseline")
+
+	var table bytes.Buffer
+	require.NoError(t, perf.Format(&table, deltas))
+	t.Log("\n" + table.String())
+
+	for _, d := range perf.Regressions(deltas) {
+		t.Errorf("%s %s regressed from %v to %v", d.Name, d.Unit, d.Old, d.New)
+	}
+}
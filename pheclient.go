@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/passw0rd/phe-go"
+)
+
+// PHEClient is the part of phe.Client used by Protocol. *phe.Client implements it, stubs allow to unit
+// test version routing and error paths without real key material
+type PHEClient interface {
+	EnrollAccount(password, enrollmentResponse []byte) (record, key []byte, err error)
+	CreateVerifyPasswordRequest(password, record []byte) (request []byte, err error)
+	// CheckResponseAndDecrypt returns the record key, or an empty key with no error if the password is wrong
+	CheckResponseAndDecrypt(password, record, response []byte) (key []byte, err error)
+}
+
+// PHEClientRotator is implemented by PHE clients which derive clients of the next key version.
+// Protocol.AddUpdateToken requires it from clients other than *phe.Client
+type PHEClientRotator interface {
+	RotateClient(updateToken []byte) (PHEClient, error)
+}
+
+// rotateClient returns the client of the next key version, leaving client untouched
+// for operations on previous version records
+func rotateClient(client PHEClient, updateToken []byte) (PHEClient, error) {
+	switch c := client.(type) {
+	case *phe.Client:
+		// phe.Client.Rotate replaces key fields instead of mutating them, so a shallow copy is enough
+		next := *c
+		if err := next.Rotate(updateToken); err != nil {
+			return nil, err
+		}
+		return &next, nil
+	case PHEClientRotator:
+		return c.RotateClient(updateToken)
+	}
+	return nil, fmt.Errorf("%T does not implement PHEClientRotator", client)
+}
+
+// LazyPHEClient returns a client which calls build on first use and delegates to the client it returns.
+// Use it in Context.PHEClients for historical key versions, so that startup does not pay for clients
+// of versions no record is verified with. Build errors are returned by every call of the client
+func LazyPHEClient(build func() (PHEClient, error)) PHEClient {
+	return &lazyClient{build: build}
+}
+
+type lazyClient struct {
+	once   sync.Once
+	build  func() (PHEClient, error)
+	client PHEClient
+	err    error
+}
+
+func (c *lazyClient) get() (PHEClient, error) {
+	c.once.Do(func() {
+		c.client, c.err = c.build()
+		c.build = nil
+	})
+	return c.client, c.err
+}
+
+func (c *lazyClient) EnrollAccount(password, enrollmentResponse []byte) ([]byte, []byte, error) {
+	client, err := c.get()
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.EnrollAccount(password, enrollmentResponse)
+}
+
+func (c *lazyClient) CreateVerifyPasswordRequest(password, record []byte) ([]byte, error) {
+	client, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return client.CreateVerifyPasswordRequest(password, record)
+}
+
+func (c *lazyClient) CheckResponseAndDecrypt(password, record, response []byte) ([]byte, error) {
+	client, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return client.CheckResponseAndDecrypt(password, record, response)
+}
+
+// RotateClient implements PHEClientRotator
+func (c *lazyClient) RotateClient(updateToken []byte) (PHEClient, error) {
+	client, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return rotateClient(client, updateToken)
+}
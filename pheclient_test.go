@@ -0,0 +1,232 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPHEClient produces readable records and keys, records only verify with the password they were enrolled with
+type stubPHEClient struct {
+	version uint32
+	err     error
+	calls   []string
+}
+
+func (c *stubPHEClient) EnrollAccount(password, enrollmentResponse []byte) ([]byte, []byte, error) {
+	c.calls = append(c.calls, "EnrollAccount")
+	return append([]byte("record:"), password...), append([]byte("key:"), password...), c.err
+}
+
+func (c *stubPHEClient) CreateVerifyPasswordRequest(password, record []byte) ([]byte, error) {
+	c.calls = append(c.calls, "CreateVerifyPasswordRequest")
+	return record, c.err
+}
+
+func (c *stubPHEClient) CheckResponseAndDecrypt(password, record, response []byte) ([]byte, error) {
+	c.calls = append(c.calls, "CheckResponseAndDecrypt")
+	if !bytes.Equal(record, append([]byte("record:"), password...)) {
+		return nil, c.err
+	}
+	return append([]byte("key:"), password...), c.err
+}
+
+type stubPHERotator struct {
+	*stubPHEClient
+}
+
+func (c stubPHERotator) RotateClient(updateToken []byte) (PHEClient, error) {
+	return stubPHERotator{&stubPHEClient{version: c.version + 1}}, nil
+}
+
+// stubProtocol creates a protocol with clients of the given versions and a service which answers
+// enrollments with enrollmentVersion, or the requested version if it is zero
+func stubProtocol(t *testing.T, current uint32, enrollmentVersion uint32, clients ...PHEClient) *Protocol {
+	ctx := &Context{AppToken: "PT.test", PHEClients: map[uint32]PHEClient{}, Version: current}
+	for i, client := range clients {
+		ctx.PHEClients[uint32(i+1)] = client
+	}
+
+	p, err := NewProtocol(ctx)
+	require.NoError(t, err)
+
+	p.APIClient = &APIClient{
+		AppToken: p.AppToken,
+		HTTPClient: &VirgilHTTPClient{Address: "http://passw0rd.test", Client: httpClientFunc(func(req *http.Request) (*http.Response, error) {
+			var resp proto.Message = &VerifyPasswordResponse{Response: []byte("response")}
+			if path.Base(req.URL.Path) == "enroll" {
+				body, err := ioutil.ReadAll(req.Body)
+				require.NoError(t, err)
+				enrollReq := &EnrollmentRequest{}
+				require.NoError(t, proto.Unmarshal(body, enrollReq))
+
+				version := enrollmentVersion
+				if version == 0 {
+					version = enrollReq.Version
+				}
+				resp = &EnrollmentResponse{Version: version, Response: []byte("enrollment")}
+			}
+
+			body, err := proto.Marshal(resp)
+			require.NoError(t, err)
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+		})},
+	}
+	return p
+}
+
+func TestProtocol_PHEClientRouting(t *testing.T) {
+	v1, v2 := &stubPHEClient{version: 1}, &stubPHEClient{version: 2}
+	p := stubProtocol(t, 2, 0, v1, v2)
+
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key:passw0rd"), key)
+	assert.Equal(t, []string{"EnrollAccount"}, v2.calls)
+
+	version, _, err := UnmarshalRecord(rec)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+
+	old, err := marshalRecord(1, 0, []byte("record:passw0rd"))
+	require.NoError(t, err)
+	key, err = p.VerifyPassword("passw0rd", old)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key:passw0rd"), key)
+	assert.Equal(t, []string{"CreateVerifyPasswordRequest", "CheckResponseAndDecrypt"}, v1.calls)
+
+	_, err = p.VerifyPassword("wrong", rec)
+	assert.Equal(t, ErrInvalidPassword, err)
+
+	unknown, err := marshalRecord(3, 0, []byte("record:passw0rd"))
+	require.NoError(t, err)
+	_, err = p.VerifyPassword("passw0rd", unknown)
+	assert.Equal(t, CodeUnknownKeyVersion, ErrorCode(err))
+}
+
+func TestProtocol_PHEClientErrors(t *testing.T) {
+	client := &stubPHEClient{version: 1}
+	p := stubProtocol(t, 1, 2, client)
+
+	_, _, err := p.EnrollAccount("passw0rd")
+	assert.Equal(t, CodeUnknownKeyVersion, ErrorCode(err))
+	assert.Empty(t, client.calls)
+
+	p = stubProtocol(t, 1, 0, client)
+	client.err = errors.New("broken")
+
+	_, _, err = p.EnrollAccount("passw0rd")
+	assert.EqualError(t, err, "could not enroll account: broken")
+
+	rec, err := marshalRecord(1, 0, []byte("record:passw0rd"))
+	require.NoError(t, err)
+	_, err = p.VerifyPassword("passw0rd", rec)
+	assert.EqualError(t, err, "could not create verify password request: broken")
+}
+
+func TestProtocol_PHEClientRotation(t *testing.T) {
+	token := "UT.2." + base64.StdEncoding.EncodeToString([]byte("token"))
+
+	p := stubProtocol(t, 1, 0, &stubPHEClient{version: 1})
+	err := p.AddUpdateToken(token)
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+	assert.Equal(t, uint32(1), p.CurrentVersion())
+
+	p = stubProtocol(t, 1, 0, stubPHERotator{&stubPHEClient{version: 1}})
+	require.NoError(t, p.AddUpdateToken(token))
+	assert.Equal(t, []uint32{1, 2}, p.Versions())
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	version, _, err := UnmarshalRecord(rec)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+	assert.Equal(t, []string{"EnrollAccount"}, p.snapshot().client(2).(stubPHERotator).calls)
+}
+
+func TestLazyPHEClient(t *testing.T) {
+	builds := 0
+	client := LazyPHEClient(func() (PHEClient, error) {
+		builds++
+		return stubPHERotator{&stubPHEClient{version: 1}}, nil
+	})
+	assert.Equal(t, 0, builds)
+
+	rec, _, err := client.EnrollAccount([]byte("passw0rd"), nil)
+	require.NoError(t, err)
+	key, err := client.CheckResponseAndDecrypt([]byte("passw0rd"), rec, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key:passw0rd"), key)
+
+	next, err := rotateClient(client, []byte("token"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), next.(stubPHERotator).version)
+	assert.Equal(t, 1, builds)
+
+	failing := LazyPHEClient(func() (PHEClient, error) {
+		return nil, withCode(CodeInvalidCredential, errors.New("bad keys"))
+	})
+	_, err = failing.CreateVerifyPasswordRequest([]byte("passw0rd"), rec)
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+}
+
+func TestCreateContext_LazyPreviousVersion(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	rec, key, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	ctx, err := CreateContext("PT.test", s.publicKey, s.clientSecret, s.rotate(t))
+	require.NoError(t, err)
+	require.IsType(t, &lazyClient{}, ctx.PHEClients[1])
+	assert.Nil(t, ctx.PHEClients[1].(*lazyClient).client)
+
+	p = s.protocol(t, s.tokens[0])
+	verified, err := p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, verified)
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Pin is a base64 encoded SHA-256 hash of a certificate's SubjectPublicKeyInfo.
+// NotBefore and NotAfter optionally limit the period the pin is accepted in
+type Pin struct {
+	SHA256    string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+func (p Pin) validAt(now time.Time) bool {
+	if !p.NotBefore.IsZero() && now.Before(p.NotBefore) {
+		return false
+	}
+	if !p.NotAfter.IsZero() && now.After(p.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// PinSet pins passw0rd service certificates. A connection is accepted if any certificate of the
+// verified chain matches any currently valid pin, which allows configuring the next certificate's
+// pin ahead of a rotation
+type PinSet struct {
+	Pins []Pin
+	// Grace makes mismatches reported to OnMismatch instead of failing the connection.
+	// Use it while rolling out a new pin set
+	Grace      bool
+	OnMismatch func(err error)
+	// Events, if set, receives PinMismatched events
+	Events *EventBus
+	// Clock, if set, replaces the system clock for pin validity periods. The default transport of
+	// VirgilHTTPClient uses its Clock when it is not set
+	Clock Clock
+	// Logger receives mismatches ignored in grace mode. The default transport of VirgilHTTPClient
+	// uses its Logger when it is not set
+	Logger Logger
+}
+
+// SPKIHash returns the pin value for a certificate
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPeerCertificate is used as tls.Config.VerifyPeerCertificate
+func (ps *PinSet) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	err := ps.verify(rawCerts, verifiedChains, clockOrSystem(ps.Clock).Now())
+	if err == nil {
+		return nil
+	}
+
+	if ps.OnMismatch != nil {
+		ps.OnMismatch(err)
+	}
+	ps.Events.Publish(&PinMismatched{Err: err})
+
+	if ps.Grace {
+		if ps.Logger != nil {
+			ps.Logger.Warn("certificate pin mismatch ignored in grace mode", F("error", err.Error()))
+		}
+		return nil
+	}
+	return err
+}
+
+// withDefaults returns a copy of ps which uses clock and logger unless ps sets its own
+func (ps *PinSet) withDefaults(clock Clock, logger Logger) *PinSet {
+	pins := *ps
+	if pins.Clock == nil {
+		pins.Clock = clock
+	}
+	if pins.Logger == nil {
+		pins.Logger = logger
+	}
+	return &pins
+}
+
+func (ps *PinSet) verify(rawCerts [][]byte, verifiedChains [][]*x509.Certificate, now time.Time) error {
+	valid := make(map[string]bool, len(ps.Pins))
+	for _, pin := range ps.Pins {
+		if pin.validAt(now) {
+			valid[pin.SHA256] = true
+		}
+	}
+
+	if len(valid) == 0 {
+		return errors.Wrap(ErrPinMismatch, "no pins are valid at this time")
+	}
+
+	var certs []*x509.Certificate
+	for _, chain := range verifiedChains {
+		certs = append(certs, chain...)
+	}
+
+	if len(certs) == 0 {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return withCode(CodeTransport, errors.Wrap(err, "could not parse peer certificate"))
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	for _, cert := range certs {
+		if valid[SPKIHash(cert)] {
+			return nil
+		}
+	}
+
+	return ErrPinMismatch
+}
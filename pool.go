@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// maxPooledBuffer limits the capacity of buffers kept in pools, so that a single large message
+// does not stay in memory
+const maxPooledBuffer = 64 << 10
+
+// bodyBuffers holds buffers for reading successful responses. Unmarshaling copies bytes fields,
+// so buffers are reused once the response object is decoded
+var bodyBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func releaseBody(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bodyBuffers.Put(buf)
+}
+
+// requestBodies holds serialized request payloads
+var requestBodies = sync.Pool{New: func() interface{} { return newRequestBody() }}
+
+// requestBody is a serialized request payload shared by all attempts of a request. A transport may
+// still be writing it after the response has arrived, so it is reference counted: the sender and
+// every unclosed reader hold a reference, and the buffer is reused after the last one is released
+type requestBody struct {
+	buf     *proto.Buffer
+	refs    int32
+	getBody func() (io.ReadCloser, error)
+}
+
+func newRequestBody() *requestBody {
+	body := &requestBody{buf: proto.NewBuffer(nil)}
+	body.getBody = func() (io.ReadCloser, error) { return body.reader(), nil }
+	return body
+}
+
+// marshalBody serializes msg into a pooled body. The caller must release it
+func marshalBody(msg proto.Message) (*requestBody, error) {
+	body := requestBodies.Get().(*requestBody)
+	body.buf.Reset()
+	body.refs = 1
+
+	if w, ok := msg.(wireMessage); ok {
+		body.buf.SetBuf(w.appendWire(body.buf.Bytes()))
+		return body, nil
+	}
+	if err := body.buf.Marshal(msg); err != nil {
+		body.release()
+		return nil, err
+	}
+	return body, nil
+}
+
+func (b *requestBody) bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.buf.Bytes()
+}
+
+// attach sets b as the body of req. A nil or empty b leaves req without a body
+func (b *requestBody) attach(req *http.Request) {
+	if len(b.bytes()) == 0 {
+		return
+	}
+	req.Body = b.reader()
+	req.GetBody = b.getBody
+	req.ContentLength = int64(len(b.bytes()))
+}
+
+// reader returns a reader of b which holds a reference until it is closed
+func (b *requestBody) reader() io.ReadCloser {
+	atomic.AddInt32(&b.refs, 1)
+	r := &bodyReader{body: b}
+	r.Reset(b.bytes())
+	return r
+}
+
+func (b *requestBody) release() {
+	if atomic.AddInt32(&b.refs, -1) != 0 || cap(b.bytes()) > maxPooledBuffer {
+		return
+	}
+	requestBodies.Put(b)
+}
+
+type bodyReader struct {
+	bytes.Reader
+	body   *requestBody
+	closed int32
+}
+
+func (r *bodyReader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.body.release()
+	}
+	return nil
+}
+
+// verifyRequests holds request envelopes of password verifications. They are released once the
+// request is serialized, so only the request bytes produced by the PHE client are referenced
+var verifyRequests = sync.Pool{New: func() interface{} { return &VerifyPasswordRequest{} }}
+
+func releaseVerifyRequest(req *VerifyPasswordRequest) {
+	req.Reset()
+	verifyRequests.Put(req)
+}
+
+// records holds database record envelopes decoded by operations which do not return them
+var records = sync.Pool{New: func() interface{} { return &DatabaseRecord{} }}
+
+// acquireRecord is like unmarshalRecord but decodes into a pooled envelope. It must be returned with
+// releaseRecord once the operation no longer uses it
+func acquireRecord(record []byte) (*DatabaseRecord, error) {
+	dbRecord := records.Get().(*DatabaseRecord)
+	if err := decodeRecord(record, dbRecord); err != nil {
+		releaseRecord(dbRecord)
+		return nil, err
+	}
+	return dbRecord, nil
+}
+
+func releaseRecord(dbRecord *DatabaseRecord) {
+	dbRecord.Reset()
+	records.Put(dbRecord)
+}
+
+// migrationBuffers holds output buffers of updated records for Migrator.ReuseBuffers
+var migrationBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBody_References(t *testing.T) {
+	req := require.New(t)
+
+	body, err := marshalBody(&VerifyPasswordRequest{Version: 1, Request: []byte("request")})
+	req.NoError(err)
+	payload := append([]byte(nil), body.bytes()...)
+
+	r := body.reader()
+	body.release()
+	req.Equal(int32(1), body.refs)
+
+	read, err := ioutil.ReadAll(r)
+	req.NoError(err)
+	req.Equal(payload, read)
+
+	req.NoError(r.Close())
+	req.NoError(r.Close())
+	req.Equal(int32(0), body.refs)
+}
+
+func TestVirgilHTTPClient_RetryBody(t *testing.T) {
+	req := require.New(t)
+
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		req.NoError(err)
+		req.Equal(int64(len(body)), r.ContentLength)
+		bodies = append(bodies, body)
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	vc := &VirgilHTTPClient{Address: server.URL, Retry: &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}}
+	_, err := vc.Send("", http.MethodPost, "verify-password", &VerifyPasswordRequest{Version: 1, Request: []byte("request")}, nil)
+	req.NoError(err)
+
+	req.Len(bodies, 2)
+	req.NotEmpty(bodies[0])
+	req.Equal(bodies[0], bodies[1])
+}
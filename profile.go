@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Profile captures pprof profiles of bulk operations: Migrator.Migrate, Protocol.VerifyPasswords and
+// Protocol.EnrollAccounts. Every operation writes <Dir>/<operation>-<time>.cpu.pprof while it runs and
+// <Dir>/<operation>-<time>.heap.pprof when it ends, for go tool pprof:
+//
+//	migrator.Profile = &passw0rd.Profile{Dir: "/var/tmp/passw0rd", CPU: true, Heap: true}
+//
+// Only one CPU profile can run in a process at a time, operations which overlap another CPU profile
+// skip theirs. Capture failures are logged and do not fail operations. A nil profile captures nothing
+type Profile struct {
+	// Dir receives profiles, the working directory if it is empty
+	Dir  string
+	CPU  bool
+	Heap bool
+	// Logger receives capture failures. Nothing is logged if it is nil
+	Logger Logger
+}
+
+// start begins capturing operation and returns a function which ends it
+func (pr *Profile) start(operation string) (stop func()) {
+	if pr == nil || (!pr.CPU && !pr.Heap) {
+		return func() {}
+	}
+
+	base := filepath.Join(pr.Dir, fmt.Sprintf("%s-%s", operation, time.Now().UTC().Format("20060102T150405.000")))
+
+	var cpu *os.File
+	if pr.CPU {
+		cpu = pr.create(base + ".cpu.pprof")
+		if cpu != nil {
+			if err := pprof.StartCPUProfile(cpu); err != nil {
+				pr.failed(cpu.Name(), err)
+				cpu.Close()
+				os.Remove(cpu.Name())
+				cpu = nil
+			}
+		}
+	}
+
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				pr.failed(cpu.Name(), err)
+			}
+		}
+
+		if pr.Heap {
+			if heap := pr.create(base + ".heap.pprof"); heap != nil {
+				runtime.GC()
+				err := pprof.WriteHeapProfile(heap)
+				if closeErr := heap.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					pr.failed(heap.Name(), err)
+				}
+			}
+		}
+	}
+}
+
+func (pr *Profile) create(path string) *os.File {
+	f, err := os.Create(path)
+	if err != nil {
+		pr.failed(path, err)
+		return nil
+	}
+	return f
+}
+
+func (pr *Profile) logger() Logger {
+	if pr.Logger == nil {
+		return NopLogger
+	}
+	return pr.Logger
+}
+
+func (pr *Profile) failed(path string, err error) {
+	pr.logger().Warn("profile capture failed", F("path", path), F("error", err.Error()))
+}
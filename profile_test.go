@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passw0rd-profile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	p.Profile = &Profile{Dir: dir, CPU: true, Heap: true}
+	results := p.VerifyPasswords(context.Background(), []VerifyRequest{{Password: "passw0rd", Record: rec}})
+	require.NoError(t, results[0].Err)
+
+	cpu, err := filepath.Glob(filepath.Join(dir, "verify-passwords-*.cpu.pprof"))
+	require.NoError(t, err)
+	assert.Len(t, cpu, 1)
+	heap, err := filepath.Glob(filepath.Join(dir, "verify-passwords-*.heap.pprof"))
+	require.NoError(t, err)
+	require.Len(t, heap, 1)
+	info, err := os.Stat(heap[0])
+	require.NoError(t, err)
+	assert.NotZero(t, info.Size())
+
+	// CPU profiles of overlapping operations are skipped
+	require.NoError(t, pprof.StartCPUProfile(ioutil.Discard))
+	logger := &testLogger{}
+	stop := (&Profile{Dir: dir, CPU: true, Logger: logger}).start("migrate")
+	stop()
+	pprof.StopCPUProfile()
+	assert.Equal(t, []string{"warn profile capture failed"}, logger.lines)
+	cpu, err = filepath.Glob(filepath.Join(dir, "migrate-*"))
+	require.NoError(t, err)
+	assert.Empty(t, cpu)
+
+	var nilProfile *Profile
+	nilProfile.start("migrate")()
+}
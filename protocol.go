@@ -37,139 +37,459 @@
 package passw0rd
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/passw0rd/phe-go"
 	"github.com/pkg/errors"
 )
 
 // Protocol implements passw0rd client-server protocol
+//
+// Protocol is safe for concurrent use. Keys may be rotated with AddUpdateToken or SetContext
+// while other operations are in flight. Exported fields must be set before the protocol is used
+// and not changed afterwards; hooks such as Logger, Metrics and AuditSink are called concurrently
 type Protocol struct {
-	AppToken       string
-	PHEClients     map[uint32]*phe.Client
-	APIClient      *APIClient
-	CurrentVersion uint32
-	UpdateToken    *VersionedUpdateToken
-	once           sync.Once
+	AppToken  SecretString
+	APIClient *APIClient
+	// URL, if set, replaces the passw0rd service address of the default APIClient, e.g. with PureKitURL
+	URL       string
+	AuditSink AuditSink
+	// Peppers holds application peppers by version. When PepperVersion is not zero, passwords are mixed
+	// with the corresponding pepper before being hardened, so that database and PHE keys are insufficient
+	// for attacking them. Records remember their pepper version, previous peppers must stay configured
+	// until all records which use them are re-enrolled
+	Peppers       map[uint32]SecretBytes
+	PepperVersion uint32
+	// RateLimitStore, if set, limits verification attempts per user identifier passed with WithUserID
+	RateLimitStore RateLimitStore
+	RateLimit      RateLimit
+	// Lockout, if set, locks users passed with WithUserID after repeated invalid passwords
+	Lockout *Lockout
+	// SlowThreshold, if set, makes verifications which take longer than it log a warning with
+	// a breakdown of time spent queued, on the network and in PHE computations
+	SlowThreshold time.Duration
+	// MinVerifyDuration pads every VerifyPassword call to at least this duration, whatever the outcome,
+	// so that response time does not reveal whether a record exists or why verification failed
+	MinVerifyDuration time.Duration
+	// KeyPolicy, if set, alarms when keys or verified records are too old
+	KeyPolicy *KeyPolicy
+	// Hardened converts panics inside the PHE library into PanicError, so that a single
+	// corrupted record can not crash the service
+	Hardened bool
+	// WorkerPool, if set, caps the number of PHE computations running at once. Operations wait for
+	// a free slot or until their context is done
+	WorkerPool *WorkerPool
+	// Batcher, if set, sends verification requests to its BatchVerifier in batches instead of one by one.
+	// The passw0rd service has no batch endpoint, so it is only useful with self-hosted or test services
+	// which implement one. Verifications fail with CodeInvalidConfiguration if its Service is not set
+	Batcher *VerifyBatcher
+	// Profile, if set, captures pprof profiles of VerifyPasswords and EnrollAccounts batches
+	Profile *Profile
+	// WarmupConns is the number of connections opened by Warmup, DefaultWarmupConns if zero. The default
+	// HTTP client keeps at least as many idle connections. WarmupInterval, if set, makes Warmup reopen
+	// them periodically
+	WarmupConns    int
+	WarmupInterval time.Duration
+	// OnSecurityEvent receives anonymized verification failures. It must not block, see SecurityEventChannel.
+	// SecurityEventSalt keys user identifier hashes; a random per-process salt is used if it is empty
+	OnSecurityEvent   func(*SecurityEvent)
+	SecurityEventSalt SecretBytes
+	// Logger receives SDK decisions such as rotations and failed verifications. Nothing is logged if it is nil
+	Logger Logger
+	// Metrics, if set, receives the outcome and latency of every operation
+	Metrics Metrics
+	// Tracer, if set, creates a span for every operation
+	Tracer Tracer
+	// ErrorReporter, if set, receives unexpected failures for crash and error trackers
+	ErrorReporter ErrorReporter
+	// Events, if set, receives operational events such as RotationApplied and ServiceDegraded
+	Events *EventBus
+	// Debug dumps internal state transitions and, for the default HTTP client, service traffic to Logger
+	// at debug level. Key material and enrollment payloads are replaced by their length and a short hash
+	Debug bool
+	// Clock, if set, replaces the system clock for rate limits, lockouts, key policy checks and
+	// verification padding. It is passed on to the default HTTP client for retries and the circuit breaker
+	Clock Clock
+
+	once          sync.Once
+	rotateMu      sync.Mutex
+	state         atomic.Value // *keyState
+	health        health
+	serviceErrors serviceErrors
+	pepperMACs    pepperMACs
+	verifyLimit   adaptiveLimit
 }
 
 //NewProtocol initializes new protocol instance with proper Context
 func NewProtocol(context *Context) (*Protocol, error) {
 
 	if context == nil || context.AppToken == "" || context.PHEClients == nil {
-		return nil, errors.New("invalid context")
-	}
-	return &Protocol{
-		AppToken:       context.AppToken,
-		PHEClients:     context.PHEClients,
-		CurrentVersion: context.Version,
-		UpdateToken:    context.UpdateToken,
-	}, nil
+		return nil, withCode(CodeInvalidConfiguration, errors.New("invalid context"))
+	}
+
+	if err := context.checkServiceKey(); err != nil {
+		return nil, err
+	}
+
+	if context.SelfTest {
+		if err := RunSelfTest(); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &Protocol{
+		AppToken: context.AppToken,
+		URL:      context.URL,
+	}
+	p.publish(newKeyState(context, time.Now()))
+
+	if context.VerifyServiceKey {
+		if err := p.verifyServiceKeyAt(context.URL); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
 }
 
 //EnrollAccount requests pseudo-random data from server and uses it to protect password and daa encryption key
 func (p *Protocol) EnrollAccount(password string) (enrollmentRecord []byte, encryptionKey []byte, err error) {
+	return p.EnrollAccountContext(context.Background(), password)
+}
+
+// EnrollAccountContext is like EnrollAccount but also accepts a context which may carry a user identifier for audit events
+func (p *Protocol) EnrollAccountContext(ctx context.Context, password string) (enrollmentRecord []byte, encryptionKey []byte, err error) {
+	state := p.snapshot()
+	return p.enrollAccount(ensureCorrelationID(ctx), state, password, func(ctx context.Context) (*EnrollmentResponse, error) {
+		return p.fetchEnrollment(ctx, state.version)
+	})
+}
+
+// fetchEnrollment requests an enrollment of version from the service
+func (p *Protocol) fetchEnrollment(ctx context.Context, version uint32) (*EnrollmentResponse, error) {
+	p.dump(ctx, "enroll: requesting enrollment", F("version", version), F("pepper_version", p.PepperVersion))
+	if err := injectedFault(ctx, OperationEnroll, FaultBeforeServiceCall, version); err != nil {
+		return nil, err
+	}
+	resp, err := p.getClient().GetEnrollmentContext(ctx, &EnrollmentRequest{Version: version})
+	if err == nil {
+		err = injectedFault(ctx, OperationEnroll, FaultAfterServiceCall, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.dump(ctx, "enroll: enrollment received", F("version", resp.Version), F("response", redact(resp.Response)))
+	return resp, nil
+}
+
+// enrollAccount enrolls password with the enrollment returned by fetch. EnrollAccounts passes enrollments
+// fetched ahead of time, so that network round trips overlap with computations of other accounts
+func (p *Protocol) enrollAccount(ctx context.Context, state *keyState, password string, fetch func(ctx context.Context) (*EnrollmentResponse, error)) (enrollmentRecord []byte, encryptionKey []byte, err error) {
+	defer func(start time.Time) { p.finish(ctx, OperationEnroll, state.version, start, err) }(p.now())
+
+	ctx, span := p.startSpan(ctx, OperationEnroll)
+	defer func() { endSpan(ctx, span, err) }()
+	span.SetAttribute(AttributeVersion, state.version)
+
+	if err = p.checkKeyPolicy(ctx, state, 0); err != nil {
+		return nil, nil, err
+	}
+
+	currentVersion := state.version
+
+	pwd, err := p.pepperPassword(p.PepperVersion, password)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	req := &EnrollmentRequest{Version: p.CurrentVersion}
-	resp, err := p.getClient().GetEnrollment(req)
+	resp, err := fetch(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	pheImpl := p.getPHE(resp.Version)
+	pheImpl := state.client(resp.Version)
 
 	if pheImpl == nil {
-		err = fmt.Errorf("unable to find keys for version %d", resp.Version)
+		err = withCode(CodeUnknownKeyVersion, fmt.Errorf("unable to find keys for version %d", resp.Version))
 		return
 	}
 
-	rec, key, err := pheImpl.EnrollAccount([]byte(password), resp.Response)
+	var rec, key []byte
+	err = p.guard(ctx, "EnrollAccount", func() (err error) {
+		rec, key, err = pheImpl.EnrollAccount(pwd, resp.Response)
+		return
+	})
 
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "could not enroll account")
 	}
 
-	enrollmentRecord, err = MarshalRecord(p.CurrentVersion, rec)
+	if err = injectedFault(ctx, OperationEnroll, FaultBeforeMarshal, currentVersion); err == nil {
+		enrollmentRecord, err = marshalRecord(currentVersion, p.PepperVersion, rec)
+	}
 
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "could not serialize enrollment record")
 	}
 
-	return enrollmentRecord, key, nil
+	p.dump(ctx, "enroll: record created", F("version", currentVersion), F("record", redact(enrollmentRecord)))
+	p.audit(ctx, AuditEnrollment, currentVersion, nil)
 
+	return enrollmentRecord, key, nil
 }
 
 //VerifyPassword verifies a password against enrollment record using passw0rd service
 func (p *Protocol) VerifyPassword(password string, enrollmentRecord []byte) (key []byte, err error) {
+	return p.VerifyPasswordContext(context.Background(), password, enrollmentRecord)
+}
+
+// VerifyPasswordContext is like VerifyPassword but also accepts a context which may carry a user identifier for audit events
+func (p *Protocol) VerifyPasswordContext(ctx context.Context, password string, enrollmentRecord []byte) (key []byte, err error) {
+	return p.verifyPasswordTimed(ctx, &verifyTiming{clock: p.clock(), start: p.now()}, password, enrollmentRecord)
+}
+
+// verifyPasswordTimed is VerifyPasswordContext which breaks down the time it takes into timing
+func (p *Protocol) verifyPasswordTimed(ctx context.Context, timing *verifyTiming, password string, enrollmentRecord []byte) (key []byte, err error) {
+
+	ctx = ensureCorrelationID(ctx)
+	if p.MinVerifyDuration > 0 {
+		defer padDuration(p.clock(), timing.start, p.MinVerifyDuration)
+	}
+
+	var version uint32
+	defer func(start time.Time) { p.finish(ctx, OperationVerify, version, start, err) }(timing.start)
+	defer func() { p.warnSlow(ctx, version, timing) }()
+
+	ctx, span := p.startSpan(ctx, OperationVerify)
+	defer func() { endSpan(ctx, span, err) }()
+
+	userID := UserIDFromContext(ctx)
+
+	if err = p.takeAttempt(userID); err != nil {
+		p.verificationFailed(ctx, 0, err)
+		return nil, err
+	}
+
+	reserved := false
+	if p.Lockout != nil && userID != "" {
+		if err = p.Lockout.Reserve(userID, p.now()); err != nil {
+			p.verificationFailed(ctx, 0, err)
+			return nil, err
+		}
+		reserved = true
+		defer func() {
+			if reserved {
+				p.Lockout.Release(userID)
+			}
+		}()
+	}
+
+	dbRecord, err := acquireRecord(enrollmentRecord)
+
+	if err != nil {
+		err = withCode(CodeInvalidRecord, errors.Wrap(err, "invalid record"))
+		p.verificationFailed(ctx, 0, err)
+		return nil, err
+	}
+	defer releaseRecord(dbRecord)
+	version = dbRecord.Version
+	span.SetAttribute(AttributeRecordVersion, version)
+
+	state := p.snapshot()
+	span.SetAttribute(AttributeVersion, state.version)
+	p.versionSkew(ctx, version, state.version)
+
+	if err = p.checkKeyPolicy(ctx, state, dbRecord.Version); err != nil {
+		p.verificationFailed(ctx, dbRecord.Version, err)
+		return nil, err
+	}
+
+	timing.since(&timing.queue, timing.start)
+
+	key, err = p.verifyPassword(ctx, state, timing, password, dbRecord)
+	if err != nil {
+		if err == ErrInvalidPassword && reserved {
+			reserved = false
+			p.Lockout.Failure(userID, p.now())
+		}
+		p.verificationFailed(ctx, dbRecord.Version, err)
+		return nil, err
+	}
+
+	if reserved {
+		reserved = false
+		p.Lockout.Success(userID)
+	}
+
+	p.audit(ctx, AuditVerificationSuccess, dbRecord.Version, nil)
+	return key, nil
+}
 
-	version, record, err := UnmarshalRecord(enrollmentRecord)
+func (p *Protocol) verifyPassword(ctx context.Context, state *keyState, timing *verifyTiming, password string, dbRecord *DatabaseRecord) (key []byte, err error) {
+
+	version, record := dbRecord.Version, dbRecord.Record
+	if p.Debug {
+		p.dump(ctx, "verify: record parsed", F("version", version), F("current_version", state.version),
+			F("pepper_version", dbRecord.PepperVersion), F("record", redact(record)))
+	}
 
+	pwd, err := p.pepperPassword(dbRecord.PepperVersion, password)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid record")
+		return nil, err
 	}
 
-	pheImpl := p.getPHE(version)
+	pheImpl := state.client(version)
 	if pheImpl == nil {
-		return nil, errors.New("unable to find keys corresponding to this record's version")
+		return nil, withCode(CodeUnknownKeyVersion, errors.New("unable to find keys corresponding to this record's version"))
 	}
 
-	req, err := pheImpl.CreateVerifyPasswordRequest([]byte(password), record)
+	var req []byte
+	from := p.now()
+	err = p.guard(ctx, "CreateVerifyPasswordRequest", func() (err error) {
+		req, err = pheImpl.CreateVerifyPasswordRequest(pwd, record)
+		return
+	})
+	from = timing.since(&timing.compute, from)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create verify password request")
 	}
 
-	versionedReq := &VerifyPasswordRequest{
-		Version: uint32(version),
-		Request: req,
-	}
+	versionedReq := verifyRequests.Get().(*VerifyPasswordRequest)
+	versionedReq.Version, versionedReq.Request = uint32(version), req
+	defer releaseVerifyRequest(versionedReq)
 
-	resp, err := p.getClient().VerifyPassword(versionedReq)
-	if err != nil || resp == nil {
+	if p.Debug {
+		p.dump(ctx, "verify: requesting service", F("version", version), F("request", redact(req)))
+	}
+	if err = injectedFault(ctx, OperationVerify, FaultBeforeServiceCall, version); err != nil {
+		return nil, err
+	}
+	var resp *VerifyPasswordResponse
+	if p.Batcher != nil {
+		resp, err = p.Batcher.verify(ctx, versionedReq)
+	} else {
+		resp, err = p.getClient().VerifyPasswordContext(ctx, versionedReq)
+	}
+	from = timing.since(&timing.network, from)
+	if err == nil {
+		err = injectedFault(ctx, OperationVerify, FaultAfterServiceCall, version)
+	}
+	if err == nil && resp == nil {
+		err = withCode(CodeServiceError, errors.New("empty response"))
+	}
+	if err != nil {
 		return nil, errors.Wrap(err, "error while requesting service")
 	}
+	if p.Debug {
+		p.dump(ctx, "verify: response received", F("version", version), F("response", redact(resp.Response)))
+	}
 
-	key, err = pheImpl.CheckResponseAndDecrypt([]byte(password), record, resp.Response)
+	err = p.guard(ctx, "CheckResponseAndDecrypt", func() (err error) {
+		key, err = pheImpl.CheckResponseAndDecrypt(pwd, record, resp.Response)
+		return
+	})
+	timing.since(&timing.compute, from)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "error after requesting service")
 	}
 
 	if len(key) == 0 {
+		if p.Debug {
+			p.dump(ctx, "verify: password rejected", F("version", version))
+		}
 		return nil, ErrInvalidPassword
 	}
 
+	if p.Debug {
+		p.dump(ctx, "verify: password accepted", F("version", version), F("key", redact(key)))
+	}
 	return key, nil
 }
 
-func (p *Protocol) getClient() *APIClient {
-	p.once.Do(func() {
-		if p.APIClient == nil {
-			p.APIClient = &APIClient{
-				AppToken: p.AppToken,
-			}
-		}
-	})
-	return p.APIClient
+// UpdateEnrollmentRecord updates a record using the update token this protocol was configured with.
+// It returns nil if the record is already up to date
+func (p *Protocol) UpdateEnrollmentRecord(oldRecord []byte) (newRecord []byte, err error) {
+	return p.UpdateEnrollmentRecordContext(context.Background(), oldRecord)
 }
 
-func (p *Protocol) getPHE(version uint32) *phe.Client {
+// UpdateEnrollmentRecordContext is like UpdateEnrollmentRecord but also accepts a context which may carry a user identifier for audit events
+func (p *Protocol) UpdateEnrollmentRecordContext(ctx context.Context, oldRecord []byte) (newRecord []byte, err error) {
 
-	pheImpl, ok := p.PHEClients[version]
-	if !ok {
-		return nil
+	ctx = ensureCorrelationID(ctx)
+	token := p.snapshot().updateToken
+
+	if token == nil {
+		return nil, withCode(CodeNoUpdateToken, errors.New("protocol has no update token"))
 	}
 
-	return pheImpl
-}
+	defer func(start time.Time) { p.finish(ctx, OperationUpdate, token.Version, start, err) }(p.now())
+
+	ctx, span := p.startSpan(ctx, OperationUpdate)
+	defer func() { endSpan(ctx, span, err) }()
+	span.SetAttribute(AttributeVersion, token.Version)
+
+	dbRecord, err := unmarshalRecord(oldRecord)
+	if err != nil {
+		return nil, withCode(CodeInvalidRecord, errors.Wrap(err, "invalid record"))
+	}
+	recordVersion := dbRecord.Version
+	span.SetAttribute(AttributeRecordVersion, recordVersion)
+
+	if recordVersion == token.Version {
+		return nil, nil
+	}
 
-func (p *Protocol) getToken(version uint32) []byte {
-	if p.UpdateToken != nil || p.UpdateToken.Version == version {
-		return p.UpdateToken.UpdateToken
+	if recordVersion+1 != token.Version {
+		return nil, withCode(CodeVersionMismatch, errors.Errorf("Record and update token versions mismatch: %d and %d", recordVersion, token.Version))
 	}
-	return nil
+
+	var newRec []byte
+	err = p.guard(ctx, "UpdateRecord", func() (err error) {
+		newRec, err = pheUpdateRecord(dbRecord.Record, token.UpdateToken)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = injectedFault(ctx, OperationUpdate, FaultBeforeMarshal, token.Version); err != nil {
+		return nil, err
+	}
+
+	newRecord, err = marshalRecord(token.Version, dbRecord.PepperVersion, newRec)
+	if err != nil {
+		return nil, err
+	}
+
+	p.dump(ctx, "update: record updated", F("version", recordVersion), F("new_version", token.Version),
+		F("record", redact(oldRecord)), F("new_record", redact(newRecord)))
+	p.audit(ctx, AuditRecordUpdated, token.Version, nil)
+	return newRecord, nil
+}
+
+// padDuration sleeps until at least d has passed since start
+func padDuration(clock Clock, start time.Time, d time.Duration) {
+	sleep(clock, d-clock.Now().Sub(start))
 }
 
-func (p *Protocol) getCurrentPHE() *phe.Client {
-	return p.PHEClients[p.CurrentVersion]
+func (p *Protocol) getClient() *APIClient {
+	p.once.Do(func() {
+		if p.APIClient == nil {
+			p.APIClient = &APIClient{
+				AppToken: p.AppToken,
+				URL:      p.URL,
+			}
+			p.APIClient.HTTPClient = &VirgilHTTPClient{
+				Address:      p.APIClient.getURL(),
+				Logger:       p.Logger,
+				Debug:        p.Debug,
+				Clock:        p.Clock,
+				MaxIdleConns: p.WarmupConns,
+			}
+		}
+	})
+	return p.APIClient
 }
@@ -37,9 +37,17 @@
 package passw0rd
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"sync"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -67,7 +75,7 @@ func TestProtocol_EnrollAccount(t *testing.T) {
 
 	if address != "" {
 		proto.APIClient = &APIClient{
-			AppToken: appToken,
+			AppToken: SecretString(appToken),
 			URL:      address,
 		}
 	}
@@ -94,7 +102,7 @@ func TestProtocol_EnrollAccount(t *testing.T) {
 
 	if address != "" {
 		proto.APIClient = &APIClient{
-			AppToken: appToken,
+			AppToken: SecretString(appToken),
 			URL:      address,
 		}
 	}
@@ -107,3 +115,100 @@ func TestProtocol_EnrollAccount(t *testing.T) {
 	req.Equal(key, key3)
 
 }
+
+func TestRunSelfTest(t *testing.T) {
+	req := require.New(t)
+	req.NoError(RunSelfTest())
+
+	service := newTestService(t)
+	req.NoError(service.protocol(t, "").VerifyServiceKey())
+
+	other := newTestService(t)
+	proto := other.protocol(t, "")
+	proto.APIClient.HTTPClient.Client = service
+	req.Error(proto.VerifyServiceKey())
+}
+
+func TestNewProtocol_VerifyServiceKey(t *testing.T) {
+	req := require.New(t)
+
+	service := newTestService(t)
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, path.Base(r.URL.Path))
+		mu.Unlock()
+		resp, err := service.Do(r)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, err = io.Copy(w, resp.Body)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	ctx, err := CreateContext("PT.test", service.publicKey, service.clientSecret, "")
+	req.NoError(err)
+	ctx.URL = server.URL
+	ctx.VerifyServiceKey = true
+
+	p, err := NewProtocol(ctx)
+	req.NoError(err)
+	mu.Lock()
+	req.Equal([]string{"enroll"}, requests)
+	mu.Unlock()
+
+	// the protocol's own client is set up once it is used, with fields set after NewProtocol
+	logger := &testLogger{}
+	p.Logger = logger
+	p.Debug = true
+	_, _, err = p.EnrollAccount("passw0rd")
+	req.NoError(err)
+	req.Equal(logger, p.getClient().HTTPClient.Logger)
+
+	server.Close()
+	_, err = NewProtocol(ctx)
+	req.Equal(CodeSelfTestFailed, ErrorCode(err))
+}
+
+func TestProtocol_Hardened(t *testing.T) {
+	req := require.New(t)
+
+	p := &Protocol{Hardened: true}
+	err := p.guard(context.Background(), "test", func() error { panic("malformed") })
+	req.Equal(ErrPHEPanic, errors.Cause(err))
+	req.Contains(err.Error(), "malformed")
+
+	p.Hardened = false
+	req.Panics(func() { _ = p.guard(context.Background(), "test", func() error { panic("malformed") }) })
+}
+
+func TestNewProtocol_KnownServiceKeys(t *testing.T) {
+	req := require.New(t)
+
+	service := newTestService(t)
+	fp, err := ServiceKeyFingerprint(service.publicKey)
+	req.NoError(err)
+
+	ctx, err := CreateContext("PT.test", service.publicKey, service.clientSecret, "")
+	req.NoError(err)
+	_, err = NewProtocol(ctx)
+	req.NoError(err)
+
+	ctx.KnownServiceKeys = []KnownServiceKey{{Environment: "self-hosted", Fingerprint: fp}}
+	_, err = NewProtocol(ctx)
+	req.NoError(err)
+
+	ctx.KnownServiceKeys = []KnownServiceKey{{Environment: "self-hosted", Fingerprint: "00"}}
+	_, err = NewProtocol(ctx)
+	req.Equal(ErrUnknownServiceKey, err)
+
+	ctx.KnownServiceKeys = []KnownServiceKey{}
+	_, err = NewProtocol(ctx)
+	req.Equal(CodeInvalidConfiguration, ErrorCode(err))
+}
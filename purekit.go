@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// PureKitURL is the PHE service address of Virgil PureKit deployments
+const PureKitURL = "https://api.virgilsecurity.com/phe/v1"
+
+// CreatePureKitContext is CreateContext for the credentials of a Virgil PureKit application.
+// PureKit records use the DatabaseRecord format, key versions and update tokens of this SDK,
+// so protocols created from the context verify, enroll and update them against the PureKit service
+func CreatePureKitContext(appToken, servicePublicKey, clientSecretKey, updateToken string) (*Context, error) {
+	ctx, err := CreateContext(appToken, servicePublicKey, clientSecretKey, updateToken)
+	if err != nil {
+		return nil, err
+	}
+	ctx.URL = PureKitURL
+	return ctx, nil
+}
+
+// PureKitMigration moves users of a Virgil PureKit deployment to Protocol as they log in.
+// Keys of PureKit records are held by the PureKit service, so a record can only move once its password
+// is known: it is verified with PureKit and enrolled again with Protocol
+type PureKitMigration struct {
+	PureKit  *Protocol
+	Protocol *Protocol
+}
+
+// PureKitLogin is the result of a password verified by PureKitMigration
+type PureKitLogin struct {
+	// Key is the encryption key of the PureKit record
+	Key []byte
+	// Record and NewKey replace the PureKit record and Key. Data encrypted with Key must be re-encrypted
+	// with NewKey before Record is stored. Both are nil if enrollment failed, the user is migrated on
+	// a later login then
+	Record []byte
+	NewKey []byte
+}
+
+// VerifyPassword verifies password against a PureKit record and enrolls it with Protocol
+func (m *PureKitMigration) VerifyPassword(password string, record []byte) (*PureKitLogin, error) {
+	return m.VerifyPasswordContext(context.Background(), password, record)
+}
+
+// VerifyPasswordContext is like VerifyPassword but bound to ctx
+func (m *PureKitMigration) VerifyPasswordContext(ctx context.Context, password string, record []byte) (*PureKitLogin, error) {
+	if m.PureKit == nil || m.Protocol == nil {
+		return nil, withCode(CodeInvalidConfiguration, errors.New("PureKit and Protocol are mandatory"))
+	}
+
+	key, err := m.PureKit.VerifyPasswordContext(ctx, password, record)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &PureKitLogin{Key: key}
+	newRecord, newKey, err := m.Protocol.EnrollAccountContext(ctx, password)
+	if err != nil {
+		m.Protocol.logger().Warn("PureKit record migration failed", F("error", err.Error()))
+		return login, nil
+	}
+
+	login.Record, login.NewKey = newRecord, newKey
+	return login, nil
+}
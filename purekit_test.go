@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePureKitContext(t *testing.T) {
+	s := newTestService(t)
+
+	ctx, err := CreatePureKitContext("AT.test", s.publicKey, s.clientSecret, "")
+	require.NoError(t, err)
+	assert.Equal(t, PureKitURL, ctx.URL)
+
+	p, err := NewProtocol(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, PureKitURL, p.getClient().HTTPClient.Address)
+
+	_, err = CreatePureKitContext("AT.test", s.publicKey, "SK.1.invalid", "")
+	assert.Equal(t, CodeInvalidCredential, ErrorCode(err))
+}
+
+func TestPureKitMigration(t *testing.T) {
+	pureKit := newTestService(t).protocol(t, "")
+	target := newTestService(t).protocol(t, "")
+	m := &PureKitMigration{PureKit: pureKit, Protocol: target}
+
+	rec, key, err := pureKit.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	login, err := m.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, login.Key)
+	require.NotNil(t, login.Record)
+
+	newKey, err := target.VerifyPassword("passw0rd", login.Record)
+	require.NoError(t, err)
+	assert.Equal(t, login.NewKey, newKey)
+
+	_, err = m.VerifyPassword("wrong", rec)
+	assert.Equal(t, ErrInvalidPassword, err)
+
+	target.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	login, err = m.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Equal(t, key, login.Key)
+	assert.Nil(t, login.Record)
+	assert.Nil(t, login.NewKey)
+
+	_, err = (&PureKitMigration{PureKit: pureKit}).VerifyPassword("passw0rd", rec)
+	assert.Equal(t, CodeInvalidConfiguration, ErrorCode(err))
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateLimitStrategy selects how authentication attempts are counted
+type RateLimitStrategy int
+
+// Rate limiting strategies
+const (
+	// SlidingWindow allows Limit attempts within any Window long period
+	SlidingWindow RateLimitStrategy = iota
+	// TokenBucket allows bursts of up to Limit attempts, refilling Limit tokens per Window
+	TokenBucket
+)
+
+// RateLimit configures per-user attempt limits
+type RateLimit struct {
+	Strategy RateLimitStrategy
+	Limit    int
+	Window   time.Duration
+}
+
+func (l RateLimit) validate() error {
+	if l.Limit < 1 || l.Window <= 0 {
+		return withCode(CodeInvalidConfiguration, errors.New("rate limit must have positive limit and window"))
+	}
+	if l.Strategy != SlidingWindow && l.Strategy != TokenBucket {
+		return withCode(CodeInvalidConfiguration, fmt.Errorf("unknown rate limit strategy %d", l.Strategy))
+	}
+	return nil
+}
+
+// RateLimitStore keeps attempt counters. Stores backed by shared storage such as Redis or DynamoDB
+// make limits consistent across multiple service instances. Implementations must be safe for concurrent use
+type RateLimitStore interface {
+	// Take registers an attempt for key and reports whether it is allowed and, if not, when to retry
+	Take(key string, limit RateLimit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitedError is returned when an attempt exceeds the configured rate limit
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+// Cause returns ErrRateLimited so that errors.Cause can be used for checks
+func (e *RateLimitedError) Cause() error {
+	return ErrRateLimited
+}
+
+// MemoryRateLimitStore is a RateLimitStore for single instance deployments
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]*rateLimitEntry
+	takes   int
+}
+
+type rateLimitEntry struct {
+	// sliding window: attempts in current and previous fixed windows
+	windowStart time.Time
+	current     int
+	previous    int
+	// token bucket
+	tokens     float64
+	lastRefill time.Time
+	window     time.Duration
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: make(map[string]*rateLimitEntry),
+	}
+}
+
+const rateLimitSweepInterval = 1024
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	if err := limit.validate(); err != nil {
+		return false, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.takes++
+	if s.takes%rateLimitSweepInterval == 0 {
+		s.sweep(now)
+	}
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{windowStart: now, lastRefill: now, tokens: float64(limit.Limit)}
+		s.entries[key] = entry
+	}
+	entry.window = limit.Window
+
+	if limit.Strategy == TokenBucket {
+		allowed, retryAfter := entry.takeToken(limit, now)
+		return allowed, retryAfter, nil
+	}
+
+	allowed, retryAfter := entry.takeSliding(limit, now)
+	return allowed, retryAfter, nil
+}
+
+// takeSliding approximates a sliding window by weighting the previous fixed window
+// with the part of it which still overlaps the sliding one
+func (e *rateLimitEntry) takeSliding(limit RateLimit, now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(e.windowStart)
+	if elapsed >= limit.Window {
+		windows := int64(elapsed / limit.Window)
+		if windows == 1 {
+			e.previous = e.current
+		} else {
+			e.previous = 0
+		}
+		e.current = 0
+		e.windowStart = e.windowStart.Add(time.Duration(windows) * limit.Window)
+		elapsed = now.Sub(e.windowStart)
+	}
+
+	overlap := 1 - float64(elapsed)/float64(limit.Window)
+	estimate := float64(e.previous)*overlap + float64(e.current)
+
+	if estimate+1 > float64(limit.Limit) {
+		return false, limit.Window - elapsed
+	}
+
+	e.current++
+	return true, 0
+}
+
+func (e *rateLimitEntry) takeToken(limit RateLimit, now time.Time) (bool, time.Duration) {
+	rate := float64(limit.Limit) / float64(limit.Window)
+
+	if now.After(e.lastRefill) {
+		e.tokens += float64(now.Sub(e.lastRefill)) * rate
+		if e.tokens > float64(limit.Limit) {
+			e.tokens = float64(limit.Limit)
+		}
+		e.lastRefill = now
+	}
+
+	if e.tokens < 1 {
+		return false, time.Duration((1 - e.tokens) / rate)
+	}
+
+	e.tokens--
+	return true, 0
+}
+
+// sweep drops entries which have been idle long enough to be back to the initial state
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if now.Sub(entry.windowStart) > 2*entry.window && now.Sub(entry.lastRefill) > entry.window {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (p *Protocol) takeAttempt(userID string) error {
+	if p.RateLimitStore == nil || userID == "" {
+		return nil
+	}
+
+	allowed, retryAfter, err := p.RateLimitStore.Take("verify:"+userID, p.RateLimit, p.now())
+	if err != nil {
+		return errors.Wrap(err, "rate limit store")
+	}
+
+	if !allowed {
+		return &RateLimitedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
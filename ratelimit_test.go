@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	req := require.New(t)
+
+	store := NewMemoryRateLimitStore()
+	now := time.Unix(1500000000, 0)
+
+	sliding := RateLimit{Strategy: SlidingWindow, Limit: 3, Window: time.Minute}
+	for i := 0; i < 3; i++ {
+		allowed, _, err := store.Take("sliding", sliding, now)
+		req.NoError(err)
+		req.True(allowed)
+	}
+	allowed, retryAfter, err := store.Take("sliding", sliding, now.Add(time.Second))
+	req.NoError(err)
+	req.False(allowed)
+	req.True(retryAfter > 0)
+
+	// previous window still weighs in half way through the next one
+	allowed, _, _ = store.Take("sliding", sliding, now.Add(90*time.Second))
+	req.True(allowed)
+	allowed, _, _ = store.Take("sliding", sliding, now.Add(90*time.Second))
+	req.False(allowed)
+
+	allowed, _, _ = store.Take("sliding", sliding, now.Add(3*time.Minute))
+	req.True(allowed)
+
+	bucket := RateLimit{Strategy: TokenBucket, Limit: 2, Window: time.Minute}
+	allowed, _, _ = store.Take("bucket", bucket, now)
+	req.True(allowed)
+	allowed, _, _ = store.Take("bucket", bucket, now)
+	req.True(allowed)
+	allowed, retryAfter, _ = store.Take("bucket", bucket, now)
+	req.False(allowed)
+	req.Equal(30*time.Second, retryAfter)
+	allowed, _, _ = store.Take("bucket", bucket, now.Add(30*time.Second))
+	req.True(allowed)
+
+	_, _, err = store.Take("bucket", RateLimit{}, now)
+	req.Error(err)
+}
+
+func TestProtocol_RateLimit(t *testing.T) {
+	req := require.New(t)
+
+	service := newTestService(t)
+	proto := service.protocol(t, "")
+	proto.RateLimitStore = NewMemoryRateLimitStore()
+	proto.RateLimit = RateLimit{Strategy: TokenBucket, Limit: 1, Window: time.Hour}
+
+	rec, _, err := proto.EnrollAccount("p@ssw0Rd")
+	req.NoError(err)
+
+	ctx := WithUserID(context.Background(), "alice")
+	_, err = proto.VerifyPasswordContext(ctx, "wrong", rec)
+	req.Equal(ErrInvalidPassword, err)
+
+	_, err = proto.VerifyPasswordContext(ctx, "p@ssw0Rd", rec)
+	req.Equal(ErrRateLimited, errors.Cause(err))
+	limited, ok := err.(*RateLimitedError)
+	req.True(ok)
+	req.True(limited.RetryAfter > 0)
+
+	_, err = proto.VerifyPasswordContext(WithUserID(context.Background(), "bob"), "p@ssw0Rd", rec)
+	req.NoError(err)
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// RecordWriter writes records to a file, e.g. for export from a database.
+// Flush must be called after the last record
+type RecordWriter interface {
+	Write(id string, record []byte) error
+	Flush() error
+}
+
+// recordLine is a line of NDJSON record files
+type recordLine struct {
+	ID     string `json:"id"`
+	Record []byte `json:"record"`
+}
+
+// NDJSONRecordReader reads records stored as newline delimited JSON objects
+// {"id": "...", "record": "<base64>"}. It implements RecordSource
+type NDJSONRecordReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewNDJSONRecordReader returns a reader of r
+func NewNDJSONRecordReader(r io.Reader) *NDJSONRecordReader {
+	return &NDJSONRecordReader{r: bufio.NewReader(r)}
+}
+
+// Next implements RecordSource, empty lines are skipped
+func (nr *NDJSONRecordReader) Next(ctx context.Context) (string, []byte, error) {
+	for {
+		data, err := nr.r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(data) == 0) {
+			return "", nil, err
+		}
+		nr.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		var line recordLine
+		if err = json.Unmarshal(data, &line); err != nil {
+			return "", nil, withCode(CodeInvalidRecord, errors.Wrapf(err, "line %d", nr.line))
+		}
+		if line.ID == "" {
+			return "", nil, withCode(CodeInvalidRecord, errors.Errorf("line %d: id is missing", nr.line))
+		}
+		return line.ID, line.Record, nil
+	}
+}
+
+// NDJSONRecordWriter writes records read by NDJSONRecordReader
+type NDJSONRecordWriter struct {
+	w *bufio.Writer
+}
+
+// NewNDJSONRecordWriter returns a writer to w
+func NewNDJSONRecordWriter(w io.Writer) *NDJSONRecordWriter {
+	return &NDJSONRecordWriter{w: bufio.NewWriter(w)}
+}
+
+// Write implements RecordWriter
+func (nw *NDJSONRecordWriter) Write(id string, record []byte) error {
+	data, err := json.Marshal(&recordLine{ID: id, Record: record})
+	if err != nil {
+		return err
+	}
+	if _, err = nw.w.Write(data); err != nil {
+		return err
+	}
+	return nw.w.WriteByte('\n')
+}
+
+// Flush implements RecordWriter
+func (nw *NDJSONRecordWriter) Flush() error {
+	return nw.w.Flush()
+}
+
+// csvHeader is the first row of CSV record files
+var csvHeader = []string{"id", "record"}
+
+// CSVRecordReader reads records stored as CSV rows of id and base64 encoded record, after an optional
+// id,record header row. It implements RecordSource
+type CSVRecordReader struct {
+	r    *csv.Reader
+	line int
+}
+
+// NewCSVRecordReader returns a reader of r
+func NewCSVRecordReader(r io.Reader) *CSVRecordReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	cr.ReuseRecord = true
+	return &CSVRecordReader{r: cr}
+}
+
+// Next implements RecordSource
+func (cr *CSVRecordReader) Next(ctx context.Context) (string, []byte, error) {
+	for {
+		row, err := cr.r.Read()
+		if err == io.EOF {
+			return "", nil, err
+		}
+		if err != nil {
+			return "", nil, withCode(CodeInvalidRecord, err)
+		}
+		cr.line++
+
+		if cr.line == 1 && row[0] == csvHeader[0] && row[1] == csvHeader[1] {
+			continue
+		}
+		if row[0] == "" {
+			return "", nil, withCode(CodeInvalidRecord, errors.Errorf("row %d: id is missing", cr.line))
+		}
+
+		record, err := base64.StdEncoding.DecodeString(row[1])
+		if err != nil {
+			return "", nil, withCode(CodeInvalidRecord, errors.Wrapf(err, "row %d", cr.line))
+		}
+		return row[0], record, nil
+	}
+}
+
+// CSVRecordWriter writes records read by CSVRecordReader. The header row is written before
+// the first record unless SkipHeader is set, e.g. when appending to a file
+type CSVRecordWriter struct {
+	SkipHeader bool
+
+	w   *csv.Writer
+	row []string
+}
+
+// NewCSVRecordWriter returns a writer to w
+func NewCSVRecordWriter(w io.Writer) *CSVRecordWriter {
+	return &CSVRecordWriter{w: csv.NewWriter(w), row: make([]string, len(csvHeader))}
+}
+
+// Write implements RecordWriter
+func (cw *CSVRecordWriter) Write(id string, record []byte) error {
+	if !cw.SkipHeader {
+		if err := cw.w.Write(csvHeader); err != nil {
+			return err
+		}
+		cw.SkipHeader = true
+	}
+
+	cw.row[0], cw.row[1] = id, base64.StdEncoding.EncodeToString(record)
+	return cw.w.Write(cw.row)
+}
+
+// Flush implements RecordWriter
+func (cw *CSVRecordWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
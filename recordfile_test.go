@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordEntry struct {
+	id     string
+	record []byte
+}
+
+var recordEntries = []recordEntry{
+	{"1", []byte{1, 2, 3}},
+	{"user,with \"quotes\"", []byte("record")},
+	{"3", []byte{}},
+}
+
+func readRecords(t *testing.T, source RecordSource) []recordEntry {
+	var entries []recordEntry
+	for {
+		id, record, err := source.Next(context.Background())
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, recordEntry{id, record})
+	}
+}
+
+func TestRecordFiles(t *testing.T) {
+	formats := []struct {
+		name   string
+		writer func(io.Writer) RecordWriter
+		reader func(io.Reader) RecordSource
+	}{
+		{"ndjson", func(w io.Writer) RecordWriter { return NewNDJSONRecordWriter(w) }, func(r io.Reader) RecordSource { return NewNDJSONRecordReader(r) }},
+		{"csv", func(w io.Writer) RecordWriter { return NewCSVRecordWriter(w) }, func(r io.Reader) RecordSource { return NewCSVRecordReader(r) }},
+	}
+
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := format.writer(buf)
+			for _, e := range recordEntries {
+				require.NoError(t, w.Write(e.id, e.record))
+			}
+			require.NoError(t, w.Flush())
+
+			entries := readRecords(t, format.reader(bytes.NewReader(buf.Bytes())))
+			require.Len(t, entries, len(recordEntries))
+			for i, e := range recordEntries {
+				assert.Equal(t, e.id, entries[i].id)
+				assert.Equal(t, string(e.record), string(entries[i].record))
+			}
+		})
+	}
+}
+
+func TestRecordFiles_Append(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewCSVRecordWriter(buf)
+	require.NoError(t, w.Write("1", []byte("a")))
+	require.NoError(t, w.Flush())
+
+	w = NewCSVRecordWriter(buf)
+	w.SkipHeader = true
+	require.NoError(t, w.Write("2", []byte("b")))
+	require.NoError(t, w.Flush())
+
+	assert.Equal(t, "id,record\n1,YQ==\n2,Yg==\n", buf.String())
+	assert.Len(t, readRecords(t, NewCSVRecordReader(buf)), 2)
+}
+
+func TestRecordFiles_Invalid(t *testing.T) {
+	sources := map[string]RecordSource{
+		"ndjson syntax":     NewNDJSONRecordReader(strings.NewReader("{\"id\":\"1\",\"record\":\"AA==\"}\n\n{\"id\":")),
+		"ndjson missing id": NewNDJSONRecordReader(strings.NewReader(`{"record":"AA=="}`)),
+		"ndjson base64":     NewNDJSONRecordReader(strings.NewReader(`{"id":"1","record":"%%%"}`)),
+		"csv columns":       NewCSVRecordReader(strings.NewReader("1,AA==,x\n")),
+		"csv base64":        NewCSVRecordReader(strings.NewReader("id,record\n1,%%%\n")),
+		"csv missing id":    NewCSVRecordReader(strings.NewReader(",AA==\n")),
+	}
+
+	for name, source := range sources {
+		var err error
+		for err == nil {
+			_, _, err = source.Next(context.Background())
+		}
+		assert.Equal(t, CodeInvalidRecord, ErrorCode(err), name)
+	}
+}
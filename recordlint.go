@@ -0,0 +1,291 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RecordSchemaVersion is the version of the record interchange format LintRecord checks records against.
+// The format is described in testdata/records/README.md
+const RecordSchemaVersion = 1
+
+// LintSeverity tells whether a record issue keeps the SDK from reading the record
+type LintSeverity string
+
+// Severities of record issues. Records with errors are rejected by the SDK, records with warnings
+// are readable but were not written the way the format requires
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// Checks of LintRecord, the names are stable
+const (
+	LintCheckEncoding     = "encoding"
+	LintCheckMalformed    = "malformed"
+	LintCheckMissing      = "missing"
+	LintCheckWireType     = "wire_type"
+	LintCheckRange        = "range"
+	LintCheckSize         = "size"
+	LintCheckPoint        = "point"
+	LintCheckUnknownField = "unknown_field"
+	LintCheckNonCanonical = "non_canonical"
+)
+
+// LintIssue is a deviation of a record from the interchange format. Field is the path of the
+// field, such as record.t0, and empty for issues of the whole record
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	Check    string       `json:"check"`
+	Field    string       `json:"field,omitempty"`
+	Message  string       `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	if i.Field == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Field, i.Message)
+}
+
+// RecordLint is the result of LintRecord. Version and PepperVersion are the decoded fields, 0 if
+// they could not be decoded
+type RecordLint struct {
+	Schema        int         `json:"schema"`
+	Size          int         `json:"size"`
+	Version       uint32      `json:"version"`
+	PepperVersion uint32      `json:"pepper_version"`
+	Issues        []LintIssue `json:"issues"`
+}
+
+// Valid reports whether the record has no errors
+func (l *RecordLint) Valid() bool {
+	return l.Err() == nil
+}
+
+// Err returns the first error of the record with CodeInvalidRecord, or nil if it has only warnings
+func (l *RecordLint) Err() error {
+	errs := 0
+	var first LintIssue
+	for _, i := range l.Issues {
+		if i.Severity != LintError {
+			continue
+		}
+		if errs == 0 {
+			first = i
+		}
+		errs++
+	}
+	switch errs {
+	case 0:
+		return nil
+	case 1:
+		return withCode(CodeInvalidRecord, errors.New(first.String()))
+	}
+	return withCode(CodeInvalidRecord, errors.Errorf("%s, %d errors in total", first, errs))
+}
+
+func (l *RecordLint) add(severity LintSeverity, check, field, format string, args ...interface{}) {
+	l.Issues = append(l.Issues, LintIssue{
+		Severity: severity,
+		Check:    check,
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lintField describes a field of the interchange format. Size is the required length of bytes fields, 0 for any
+type lintField struct {
+	num      int
+	name     string
+	typ      int
+	size     int
+	required bool
+}
+
+var databaseRecordFields = []lintField{
+	{num: 1, name: "version", typ: wireVarint, required: true},
+	{num: 2, name: "record", typ: wireBytes, required: true},
+	{num: 3, name: "pepper_version", typ: wireVarint},
+}
+
+// enrollmentRecordFields are the fields of the PHE enrollment record. T0 and t1 are uncompressed P-256 points
+var enrollmentRecordFields = []lintField{
+	{num: 1, name: "ns", typ: wireBytes, size: 32, required: true},
+	{num: 2, name: "nc", typ: wireBytes, size: 32, required: true},
+	{num: 3, name: "t0", typ: wireBytes, size: 65, required: true},
+	{num: 4, name: "t1", typ: wireBytes, size: 65, required: true},
+}
+
+// LintRecord checks a record as stored in a database against the interchange format, so that records
+// written elsewhere are known to be readable by this SDK. It needs no keys and never contacts the
+// service, so it does not tell whether a record belongs to an app
+func LintRecord(record []byte) *RecordLint {
+	l := &RecordLint{Schema: RecordSchemaVersion, Size: len(record), Issues: []LintIssue{}}
+
+	fields, ok := l.lintMessage("", record, databaseRecordFields)
+	if !ok {
+		return l
+	}
+	l.Version = uint32(fields[1].varint)
+	l.PepperVersion = uint32(fields[3].varint)
+
+	inner, ok := fields[2]
+	if !ok || len(inner.bytes) == 0 {
+		return l
+	}
+	points, ok := l.lintMessage("record.", inner.bytes, enrollmentRecordFields)
+	if !ok {
+		return l
+	}
+	for _, num := range []int{3, 4} {
+		f, present := points[num]
+		if !present || len(f.bytes) != enrollmentRecordFields[num-1].size {
+			continue
+		}
+		if x, _ := elliptic.Unmarshal(elliptic.P256(), f.bytes); x == nil {
+			l.add(LintError, LintCheckPoint, "record."+enrollmentRecordFields[num-1].name, "not an uncompressed P-256 point")
+		}
+	}
+	return l
+}
+
+// LintEncodedRecord is like LintRecord for a record in its text form, standard base64 with padding
+func LintEncodedRecord(encoded string) *RecordLint {
+	record, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		l := &RecordLint{Schema: RecordSchemaVersion, Issues: []LintIssue{}}
+		l.add(LintError, LintCheckEncoding, "", "not standard base64: %v%s", err, encodingHint(encoded))
+		return l
+	}
+
+	l := LintRecord(record)
+	if base64.StdEncoding.EncodeToString(record) != encoded {
+		l.add(LintWarning, LintCheckNonCanonical, "", "base64 contains line breaks or unused bits")
+	}
+	return l
+}
+
+// encodingHint names the encoding a record was written with by mistake
+func encodingHint(encoded string) string {
+	switch {
+	case encoded == "":
+		return ", the record is empty"
+	case len(encoded)%2 == 0 && isHex(encoded):
+		return ", it looks hex encoded"
+	case strings.ContainsAny(encoded, "-_"):
+		return ", it looks URL-safe base64 encoded"
+	case len(encoded)%4 != 0 && !strings.HasSuffix(encoded, "="):
+		return ", padding is missing"
+	}
+	return ""
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// lintMessage checks the fields of an encoded message and returns the last occurrence of each known
+// field. Ok is false if the message could not be decoded
+func (l *RecordLint) lintMessage(prefix string, b []byte, known []lintField) (fields map[int]wireField, ok bool) {
+	fields = map[int]wireField{}
+	mistyped := map[int]bool{}
+	canonical := true
+	last := 0
+	for rest := b; len(rest) > 0; {
+		f, next, err := nextField(rest)
+		if err != nil {
+			l.add(LintError, LintCheckMalformed, strings.TrimSuffix(prefix, "."), "not a protobuf message: %v", err)
+			return nil, false
+		}
+		tagSize := len(rest) - len(next) - len(f.value)
+		rest = next
+
+		if tagSize != varintSize(uint64(f.num)<<3|uint64(f.typ)) || f.num <= last {
+			canonical = false
+		}
+		last = f.num
+
+		if f.num > len(known) || known[f.num-1].num != f.num {
+			l.add(LintWarning, LintCheckUnknownField, prefix+fmt.Sprint(f.num), "unknown field, written by a newer SDK and dropped when the record is updated")
+			continue
+		}
+		field := known[f.num-1]
+		if f.typ != field.typ {
+			l.add(LintError, LintCheckWireType, prefix+field.name, "wire type %d instead of %d", f.typ, field.typ)
+			mistyped[f.num] = true
+			continue
+		}
+		switch f.typ {
+		case wireVarint:
+			if len(f.value) != varintSize(f.varint) || f.varint == 0 {
+				canonical = false
+			}
+			if f.varint > math.MaxUint32 {
+				l.add(LintError, LintCheckRange, prefix+field.name, "%d does not fit into 32 bits", f.varint)
+			}
+		case wireBytes:
+			if len(f.value) != varintSize(uint64(len(f.bytes)))+len(f.bytes) || len(f.bytes) == 0 {
+				canonical = false
+			}
+		}
+		fields[f.num] = f
+	}
+
+	for _, field := range known {
+		f, present := fields[field.num]
+		switch {
+		case field.required && f.varint == 0 && len(f.bytes) == 0 && !mistyped[field.num]:
+			l.add(LintError, LintCheckMissing, prefix+field.name, "required field is missing or empty")
+		case present && field.size != 0 && len(f.bytes) != field.size:
+			l.add(LintError, LintCheckSize, prefix+field.name, "%d bytes instead of %d", len(f.bytes), field.size)
+		}
+	}
+	if !canonical {
+		l.add(LintWarning, LintCheckNonCanonical, strings.TrimSuffix(prefix, "."), "fields are out of order, repeated, zero or not minimally encoded")
+	}
+	return fields, true
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordFixture is a record fixture, see testdata/records/README.md
+type recordFixture struct {
+	Description string      `json:"description"`
+	Record      string      `json:"record"`
+	Valid       bool        `json:"valid"`
+	Issues      []LintIssue `json:"issues"`
+}
+
+func TestLintRecord_Fixtures(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "records", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		f := &recordFixture{}
+		require.NoError(t, json.Unmarshal(data, f), file)
+
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			l := LintEncodedRecord(f.Record)
+
+			type issue struct{ severity, check, field string }
+			var want, got []issue
+			for _, i := range f.Issues {
+				want = append(want, issue{string(i.Severity), i.Check, i.Field})
+			}
+			for _, i := range l.Issues {
+				got = append(got, issue{string(i.Severity), i.Check, i.Field})
+			}
+			assert.ElementsMatch(t, want, got, "%v", l.Issues)
+			assert.Equal(t, f.Valid, l.Valid())
+
+			if !f.Valid {
+				assert.Equal(t, CodeInvalidRecord, ErrorCode(l.Err()))
+				return
+			}
+			record, err := base64.StdEncoding.DecodeString(f.Record)
+			require.NoError(t, err)
+			version, _, err := UnmarshalRecord(record)
+			require.NoError(t, err)
+			assert.Equal(t, l.Version, version)
+		})
+	}
+}
+
+func TestRecordLint_Err(t *testing.T) {
+	l := LintRecord(nil)
+	assert.Equal(t, RecordSchemaVersion, l.Schema)
+	require.Len(t, l.Issues, 2)
+	assert.EqualError(t, l.Err(), "error: version: required field is missing or empty, 2 errors in total")
+	assert.False(t, l.Valid())
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Service failures are reported once per window when at least serviceErrorBurst of them happen within it
+const (
+	serviceErrorBurst  = 5
+	serviceErrorWindow = time.Minute
+)
+
+// ErrorReport describes an unexpected failure for crash and error trackers. It carries no
+// passwords, keys, records or user identifiers
+type ErrorReport struct {
+	Code      Code
+	Operation string
+	Version   uint32
+	Message   string
+	// Count is the number of failures within the burst for service failures, 1 otherwise
+	Count int
+	Time  time.Time
+	// CorrelationID is the correlation ID of the failed operation, for service failures of the last one
+	CorrelationID string
+}
+
+// ErrorReporter receives unexpected failures: malformed records, PHE library errors and panics
+// recovered in hardened mode, unknown errors and bursts of service failures.
+// Expected outcomes such as invalid passwords, rate limits and locks are not reported
+type ErrorReporter interface {
+	ReportError(report *ErrorReport)
+}
+
+// ErrorReporterFunc allows an ordinary function to be used as an ErrorReporter
+type ErrorReporterFunc func(report *ErrorReport)
+
+// ReportError calls f(report)
+func (f ErrorReporterFunc) ReportError(report *ErrorReport) {
+	f(report)
+}
+
+// serviceErrors counts service failures for burst detection
+type serviceErrors struct {
+	mu       sync.Mutex
+	start    time.Time
+	count    int
+	reported bool
+}
+
+// add registers a failure and returns the failure count if a burst should be reported
+func (s *serviceErrors) add(now time.Time) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.start) > serviceErrorWindow {
+		s.start, s.count, s.reported = now, 0, false
+	}
+
+	s.count++
+	if s.count < serviceErrorBurst || s.reported {
+		return 0, false
+	}
+
+	s.reported = true
+	return s.count, true
+}
+
+func (p *Protocol) reportError(ctx context.Context, operation string, version uint32, err error) {
+	if p.ErrorReporter == nil || err == nil {
+		return
+	}
+
+	now := p.now()
+	report := &ErrorReport{
+		Code:      ErrorCode(err),
+		Operation: operation,
+		Version:   version,
+		Message:   err.Error(),
+		Count:     1,
+		Time:      now,
+
+		CorrelationID: CorrelationIDFromContext(ctx),
+	}
+
+	switch report.Code {
+	case CodeInvalidRecord, CodeCryptoFailure, CodePHEPanic, CodeUnknown:
+	case CodeTransport, CodeServiceError:
+		count, burst := p.serviceErrors.add(now)
+		if !burst {
+			return
+		}
+		report.Count = count
+	default:
+		return
+	}
+
+	p.ErrorReporter.ReportError(report)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocol_ErrorReporter(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	var reports []*ErrorReport
+	p.ErrorReporter = ErrorReporterFunc(func(report *ErrorReport) { reports = append(reports, report) })
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	_, err = p.VerifyPassword("wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+	assert.Empty(t, reports)
+
+	_, err = p.VerifyPassword("passw0rd", []byte("garbage"))
+	require.Error(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, CodeInvalidRecord, reports[0].Code)
+	assert.Equal(t, OperationVerify, reports[0].Operation)
+
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	for i := 0; i < 2*serviceErrorBurst; i++ {
+		_, _, err = p.EnrollAccount("passw0rd")
+		require.Error(t, err)
+	}
+
+	require.Len(t, reports, 2)
+	assert.Equal(t, CodeTransport, reports[1].Code)
+	assert.Equal(t, serviceErrorBurst, reports[1].Count)
+	assert.NotContains(t, reports[1].Message, "PT.test")
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Retry and circuit breaker defaults
+const (
+	DefaultRetryAttempts    = 3
+	DefaultRetryBackoff     = 100 * time.Millisecond
+	DefaultRetryMaxBackoff  = 2 * time.Second
+	DefaultCircuitThreshold = 5
+	DefaultCircuitCooldown  = 30 * time.Second
+)
+
+// RetryPolicy repeats service requests which failed because of transport errors, 5xx responses or throttling.
+// Other errors, including rejected credentials and replay protection failures, are returned immediately.
+// Note that a retried verification may be counted twice by service side rate limits if the first
+// response was lost on its way back
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one, DefaultRetryAttempts if not set
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every next retry up to MaxBackoff
+	// and is randomized by up to a half to spread retries of concurrent clients.
+	// A Retry-After of a throttled response is waited instead if it is longer, requests
+	// are not retried if it exceeds MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (r *RetryPolicy) attempts() int {
+	if r == nil {
+		return 1
+	}
+	if r.MaxAttempts <= 0 {
+		return DefaultRetryAttempts
+	}
+	return r.MaxAttempts
+}
+
+// delay returns how long to wait before the retry following attempt, false if it must not be retried
+func (r *RetryPolicy) delay(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	backoff, maxBackoff := r.Backoff, r.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	d := backoff << uint(attempt-1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	d -= time.Duration(rand.Int63n(int64(d)/2 + 1))
+
+	if retryAfter > d {
+		if retryAfter > maxBackoff {
+			return 0, false
+		}
+		d = retryAfter
+	}
+	return d, true
+}
+
+// retryable reports whether a request which ended with status and err may succeed if repeated
+func retryable(status int, err error) bool {
+	if err == nil {
+		return false
+	}
+	return ErrorCode(err) == CodeTransport || status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// retryAfter parses the Retry-After header given in seconds
+func retryAfter(headers http.Header) time.Duration {
+	seconds, err := strconv.Atoi(headers.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// CircuitBreaker suspends service requests after Threshold consecutive failures, so that an unavailable
+// service is not hammered and callers fail fast with ErrCircuitOpen. After Cooldown a single trial
+// request is let through, it closes the circuit on success and opens it again on failure.
+// Failures are counted as by RetryPolicy, after all retries of a request. It is safe for concurrent use
+// and may be shared by several clients
+type CircuitBreaker struct {
+	// Threshold is DefaultCircuitThreshold if not set
+	Threshold int
+	// Cooldown is DefaultCircuitCooldown if not set
+	Cooldown time.Duration
+	// Events, if set, receives CircuitOpened events
+	Events *EventBus
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// State returns the current state of the circuit by the system clock. A nil breaker is always closed
+func (b *CircuitBreaker) State() CircuitState {
+	return b.currentState(time.Now())
+}
+
+// currentState is like State but takes the current time from the caller, which may use a custom Clock
+func (b *CircuitBreaker) currentState(now time.Time) CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateAt(now)
+}
+
+func (b *CircuitBreaker) stateAt(now time.Time) CircuitState {
+	switch {
+	case b.state == "":
+		return CircuitClosed
+	case b.state == CircuitOpen && !now.Before(b.openUntil):
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow returns ErrCircuitOpen if the request must not be sent
+func (b *CircuitBreaker) allow(now time.Time) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.stateAt(now) {
+	case CircuitOpen:
+		return errors.Wrapf(ErrCircuitOpen, "retry after %s", b.openUntil.Sub(now))
+	case CircuitHalfOpen:
+		if b.trial {
+			return errors.Wrap(ErrCircuitOpen, "trial request in progress")
+		}
+		b.state, b.trial = CircuitHalfOpen, true
+	}
+	return nil
+}
+
+// record counts the outcome of an allowed request and reports whether it opened the circuit
+func (b *CircuitBreaker) record(failed bool, now time.Time) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	trial := b.trial
+	b.trial = false
+
+	if !failed {
+		b.state, b.failures = CircuitClosed, 0
+		b.mu.Unlock()
+		return false
+	}
+
+	b.failures++
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = DefaultCircuitThreshold
+	}
+	if !trial && b.failures < threshold {
+		b.mu.Unlock()
+		return false
+	}
+
+	cooldown := b.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitCooldown
+	}
+	b.state, b.openUntil = CircuitOpen, now.Add(cooldown)
+	event := &CircuitOpened{Failures: b.failures, Until: b.openUntil, Time: now}
+	b.mu.Unlock()
+
+	b.Events.Publish(event)
+	return true
+}
+
+type retryCounterKey struct{}
+
+// withRetryCounter returns a context counting retries of requests made with it
+func withRetryCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryCounterKey{}, new(int32))
+}
+
+func countRetry(ctx context.Context) {
+	expvars.retries.Add(1)
+	if n, ok := ctx.Value(retryCounterKey{}).(*int32); ok {
+		atomic.AddInt32(n, 1)
+	}
+}
+
+func retriesFromContext(ctx context.Context) int {
+	if n, ok := ctx.Value(retryCounterKey{}).(*int32); ok {
+		return int(atomic.LoadInt32(n))
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flaky fails the first n requests with status, or with a transport error if status is 0
+func flaky(s *testService, n int32, status int, header http.Header) (HTTPClient, *int32) {
+	var calls int32
+	return httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) > n {
+			return s.Do(req)
+		}
+		if status == 0 {
+			return nil, errors.New("connection reset")
+		}
+		resp, err := s.reply(status, &HttpError{Code: uint32(status), Message: http.StatusText(status)})
+		for name, values := range header {
+			resp.Header[name] = values
+		}
+		return resp, err
+	}), &calls
+}
+
+func TestVirgilHTTPClient_Retry(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	vc := p.APIClient.HTTPClient
+	vc.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	var calls *int32
+	vc.Client, calls = flaky(s, 2, http.StatusServiceUnavailable, nil)
+	_, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *calls)
+
+	vc.Client, calls = flaky(s, 3, 0, nil)
+	_, _, err = p.EnrollAccount("passw0rd")
+	assert.Equal(t, CodeTransport, ErrorCode(err))
+	assert.Equal(t, int32(3), *calls)
+
+	vc.Client, calls = flaky(s, 1, http.StatusBadRequest, nil)
+	_, _, err = p.EnrollAccount("passw0rd")
+	assert.Equal(t, CodeServiceError, ErrorCode(err))
+	assert.Equal(t, int32(1), *calls)
+
+	vc.Client, calls = flaky(s, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+	_, _, err = p.EnrollAccount("passw0rd")
+	assert.Error(t, err, "Retry-After beyond MaxBackoff is not waited")
+	assert.Equal(t, int32(1), *calls)
+}
+
+func TestVirgilHTTPClient_RetrySpanAttribute(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	tracer := &testTracer{}
+	p.Tracer = tracer
+	p.APIClient.HTTPClient.Retry = &RetryPolicy{Backoff: time.Millisecond}
+	p.APIClient.HTTPClient.Client, _ = flaky(s, 1, http.StatusBadGateway, nil)
+
+	_, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	require.Len(t, tracer.spans, 1)
+	assert.Equal(t, 1, tracer.spans[0].attributes[AttributeRetries])
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	bus := NewEventBus()
+	events, cancel := bus.Channel(1)
+	defer cancel()
+
+	breaker := &CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond, Events: bus}
+	vc := p.APIClient.HTTPClient
+	vc.Breaker = breaker
+
+	var calls *int32
+	vc.Client, calls = flaky(s, 3, 0, nil)
+	for i := 0; i < 2; i++ {
+		_, _, err := p.EnrollAccount("passw0rd")
+		assert.Equal(t, CodeTransport, ErrorCode(err))
+	}
+	assert.Equal(t, CircuitOpen, breaker.State())
+	assert.Equal(t, CircuitOpen, p.Status().Circuit)
+	opened := (<-events).(*CircuitOpened)
+	assert.Equal(t, 2, opened.Failures)
+
+	_, _, err := p.EnrollAccount("passw0rd")
+	assert.Equal(t, ErrCircuitOpen, errors.Cause(err))
+	assert.Equal(t, CodeCircuitOpen, ErrorCode(err))
+	assert.Equal(t, int32(2), *calls)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	_, _, err = p.EnrollAccount("passw0rd")
+	assert.Equal(t, CodeTransport, ErrorCode(err), "failed trial opens the circuit again")
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	time.Sleep(60 * time.Millisecond)
+	_, _, err = p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	r := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		d, ok := r.delay(attempt+1, 0)
+		assert.True(t, ok)
+		assert.True(t, d <= max*time.Millisecond && d >= max*time.Millisecond/2, "attempt %d: %s", attempt+1, d)
+	}
+
+	d, ok := r.delay(1, 500*time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, d)
+
+	_, ok = r.delay(1, 2*time.Second)
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, (*RetryPolicy)(nil).attempts())
+	assert.Equal(t, DefaultRetryAttempts, (&RetryPolicy{}).attempts())
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretString holds sensitive text such as app tokens. Its value is never printed by fmt,
+// marshaled to JSON or text, or shown in panic messages. Use Reveal to get the actual value.
+//
+// The SDK keeps app tokens, peppers and the security event salt in secret types. Passwords,
+// derived account keys and Context.UpdateToken are plain values and are not redacted
+type SecretString string
+
+// Reveal returns the underlying value
+func (s SecretString) Reveal() string {
+	return string(s)
+}
+
+// String implements fmt.Stringer
+func (s SecretString) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer
+func (s SecretString) GoString() string {
+	return redacted
+}
+
+// Format implements fmt.Formatter so that no verb can reveal the value
+func (s SecretString) Format(f fmt.State, verb rune) {
+	_, _ = io.WriteString(f, redacted)
+}
+
+// MarshalJSON implements json.Marshaler
+func (s SecretString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s SecretString) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// SecretBytes holds sensitive binary data such as peppers.
+// It redacts itself the same way SecretString does
+type SecretBytes []byte
+
+// Reveal returns the underlying value
+func (s SecretBytes) Reveal() []byte {
+	return []byte(s)
+}
+
+// Wipe overwrites the underlying value with zeroes
+func (s SecretBytes) Wipe() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+// String implements fmt.Stringer
+func (s SecretBytes) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer
+func (s SecretBytes) GoString() string {
+	return redacted
+}
+
+// Format implements fmt.Formatter so that no verb can reveal the value
+func (s SecretBytes) Format(f fmt.State, verb rune) {
+	_, _ = io.WriteString(f, redacted)
+}
+
+// MarshalJSON implements json.Marshaler
+func (s SecretBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s SecretBytes) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SecurityEvent is an anonymized verification failure for fraud and anomaly detection systems
+type SecurityEvent struct {
+	// UserHash is HMAC-SHA256 of the user identifier keyed with Protocol.SecurityEventSalt
+	UserHash string    `json:"user_hash,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"time"`
+	// CorrelationID is the correlation ID of the failed operation, see WithCorrelationID
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+type sourceKey struct{}
+
+// WithSource returns a copy of ctx carrying a source tag (e.g. "web", "mobile", client IP class) for security events
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFromContext returns the source tag set by WithSource
+func SourceFromContext(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
+
+// SecurityEventChannel returns a callback for Protocol.OnSecurityEvent which delivers events
+// into a buffered channel. Events are dropped rather than blocking verifications when the buffer is full
+func SecurityEventChannel(size int) (func(*SecurityEvent), <-chan *SecurityEvent) {
+	ch := make(chan *SecurityEvent, size)
+	return func(event *SecurityEvent) {
+		select {
+		case ch <- event:
+		default:
+		}
+	}, ch
+}
+
+var (
+	processSaltOnce sync.Once
+	processSalt     []byte
+)
+
+func (p *Protocol) userHash(userID string) string {
+	if userID == "" {
+		return ""
+	}
+
+	salt := p.SecurityEventSalt.Reveal()
+	if len(salt) == 0 {
+		processSaltOnce.Do(func() {
+			processSalt = make([]byte, 32)
+			_, _ = rand.Read(processSalt)
+		})
+		salt = processSalt
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	_, _ = mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verificationFailed reports a failed verification to the audit sink and the security event stream
+func (p *Protocol) verificationFailed(ctx context.Context, version uint32, err error) {
+	p.audit(ctx, AuditVerificationFailure, version, err)
+
+	reason := auditReason(err)
+	log := withCorrelation(ctx, p.logger())
+	switch reason {
+	case "invalid_password":
+		log.Debug("password verification failed", F("version", version), F("reason", reason))
+	case "error":
+		log.Error("password verification failed", F("version", version), F("reason", reason), F("error", err.Error()))
+	default:
+		log.Warn("password verification rejected", F("version", version), F("reason", reason))
+	}
+
+	if p.OnSecurityEvent == nil && p.Events == nil {
+		return
+	}
+
+	event := &SecurityEvent{
+		UserHash: p.userHash(UserIDFromContext(ctx)),
+		Source:   SourceFromContext(ctx),
+		Reason:   reason,
+		Time:     p.now().UTC(),
+
+		CorrelationID: CorrelationIDFromContext(ctx),
+	}
+
+	if p.OnSecurityEvent != nil {
+		p.OnSecurityEvent(event)
+	}
+	p.Events.Publish(event)
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/passw0rd/phe-go"
+	"github.com/pkg/errors"
+)
+
+// known answer vectors produced with a fixed server keypair and client key
+const (
+	selfTestServerKeypair = "CkEEHvqkhMhhkt+mxk/m3hkjxQZJszggvGCtcr7O6hZ8Ec3oasJ70NXtcGSRRgz7vYRQnODWFNXclEjMyEcJAfoc7RIgRo8jNrp09D/NY7ed9UuAHzGBPXKyksTmPzEtNIRHzvE="
+	selfTestClientKey     = "WnAGmZjsPAHAnjHGNKtllzYe44N8UIfkmZ43A9FznZc="
+	selfTestPassword      = "passw0rd"
+	selfTestRecord        = "CiD/QFnNHAq7JqzlERtTyuwivIb/8VJEtC2CtZ2d6VkOwxIgAvvh4/e87vGozrtXgxeXJRISvnWeu1WLJHBP3H42RhMaQQRb6EVcf0/i5Po42DfSRAibNOjosBTVuD0hurCG206Xi8ug5JASAsuPx+1BWkwC76rhTSnxzkMDLmh5Jlwahr/bIkEEnV9+aNum28JQ/bXz7zXyiOxcqnhQmUxqejZd/+LQCjBcC1p9ZP6oFH/X/TXEnYkubbez1mTT6XUu4u58YOAVHw=="
+	selfTestKey           = "39fNbE498Fa173ufvwCQYccM7oO8lhfhFT7gQzzNFXA="
+	selfTestUpdateToken   = "CiDM5AHQG8lZvK1r0OEMT8aFgOdMov9Gb7DHmlMZCbSb4xIgsZr99QYG80aMHXZ2ppEtQLZfEH6JlzfAwNqCXnkTTGc="
+	selfTestUpdatedRecord = "CiD/QFnNHAq7JqzlERtTyuwivIb/8VJEtC2CtZ2d6VkOwxIgAvvh4/e87vGozrtXgxeXJRISvnWeu1WLJHBP3H42RhMaQQT/OstdllKO3bM9L2IgTUdo7kfUfazsUcvtEu1SlCq/XKX4x5rc5MimbHamT9l0eGpn4uYnn/ADyONRN5eneA1nIkEEv8/lpIN98sWVfbzu+Rk2iYSfoalJExD1n2XDgLJlVqdoY2ixL0wTWj1vjQD6hHs+ZYGOdv9AOa94u0WZB7nrPA=="
+)
+
+// RunSelfTest checks that this environment is able to run the protocol: the randomness source is healthy,
+// known answer vectors reproduce, and a full enrollment and verification cycle against a local PHE server succeeds.
+// It is run by NewProtocol when Context.SelfTest is set
+func RunSelfTest() error {
+	if err := checkRandom(); err != nil {
+		return withCode(CodeSelfTestFailed, errors.Wrap(err, "self-test: randomness source"))
+	}
+
+	if err := checkKnownAnswers(); err != nil {
+		return withCode(CodeSelfTestFailed, errors.Wrap(err, "self-test: known answer test"))
+	}
+
+	if err := checkCycle(); err != nil {
+		return withCode(CodeSelfTestFailed, errors.Wrap(err, "self-test: enrollment cycle"))
+	}
+	return nil
+}
+
+// VerifyServiceKey requests an enrollment for the current version and checks the service's proof against
+// the configured service public key, as checkCycle does for the local keypair. It catches misconfigured or
+// tampered keys before the first user is enrolled. No record is created, so nothing is audited or counted.
+// It is run by NewProtocol when Context.VerifyServiceKey is set
+func (p *Protocol) VerifyServiceKey() error {
+	return p.VerifyServiceKeyContext(context.Background())
+}
+
+// VerifyServiceKeyContext is like VerifyServiceKey but the enrollment request is bound to ctx
+func (p *Protocol) VerifyServiceKeyContext(ctx context.Context) error {
+	return p.verifyServiceKey(ctx, p.getClient())
+}
+
+// verifyServiceKeyAt is VerifyServiceKey with a client of its own for the service at url. NewProtocol uses it,
+// so that the client of the protocol is set up only after callers configured it
+func (p *Protocol) verifyServiceKeyAt(url string) error {
+	return p.verifyServiceKey(context.Background(), &APIClient{AppToken: p.AppToken, URL: url})
+}
+
+// verifyServiceKey is VerifyServiceKeyContext which requests the enrollment with api
+func (p *Protocol) verifyServiceKey(ctx context.Context, api *APIClient) error {
+	state := p.snapshot()
+	resp, err := api.GetEnrollmentContext(ctx, &EnrollmentRequest{Version: state.version})
+	if err != nil {
+		return withCode(CodeSelfTestFailed, errors.Wrap(err, "service key verification: could not request enrollment"))
+	}
+
+	client := state.client(resp.Version)
+	if client == nil {
+		return withCode(CodeSelfTestFailed, fmt.Errorf("service key verification: unable to find keys for version %d", resp.Version))
+	}
+
+	password := make([]byte, 32)
+	if _, err = rand.Read(password); err != nil {
+		return errors.Wrap(err, "could not generate password")
+	}
+
+	if _, _, err = enrollLocally(client, password, resp.Response); err != nil {
+		return withCode(CodeSelfTestFailed, errors.Wrap(err, "service key verification failed"))
+	}
+	return nil
+}
+
+func checkRandom() error {
+	a, b := make([]byte, 32), make([]byte, 32)
+	if _, err := rand.Read(a); err != nil {
+		return err
+	}
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	if bytes.Equal(a, b) || bytes.Equal(a, make([]byte, 32)) {
+		return errors.New("random source returns repeated data")
+	}
+	return nil
+}
+
+func checkKnownAnswers() error {
+	kp, client, err := selfTestKeys()
+	if err != nil {
+		return err
+	}
+
+	record := mustDecode(selfTestRecord)
+
+	key, err := verifyLocally(kp, client, []byte(selfTestPassword), record)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, mustDecode(selfTestKey)) {
+		return errors.New("derived key mismatch")
+	}
+
+	updated, err := phe.UpdateRecord(record, mustDecode(selfTestUpdateToken))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(updated, mustDecode(selfTestUpdatedRecord)) {
+		return errors.New("updated record mismatch")
+	}
+	return nil
+}
+
+func checkCycle() error {
+	kp, client, err := selfTestKeys()
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := phe.GetEnrollment(kp)
+	if err != nil {
+		return err
+	}
+
+	record, key, err := enrollLocally(client, []byte(selfTestPassword), enrollment)
+	if err != nil {
+		return err
+	}
+
+	key1, err := verifyLocally(kp, client, []byte(selfTestPassword), record)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, key1) {
+		return errors.New("derived key mismatch")
+	}
+
+	key2, err := verifyLocally(kp, client, []byte("not "+selfTestPassword), record)
+	if err != nil {
+		return err
+	}
+	if len(key2) != 0 {
+		return errors.New("invalid password accepted")
+	}
+	return nil
+}
+
+// enrollLocally enrolls password with enrollment, which fails unless its proof matches the service public key of client
+func enrollLocally(client PHEClient, password, enrollment []byte) (record, key []byte, err error) {
+	defer recoverPanic("EnrollAccount", &err)
+
+	return client.EnrollAccount(password, enrollment)
+}
+
+func selfTestKeys() (kp []byte, client *phe.Client, err error) {
+	kp = mustDecode(selfTestServerKeypair)
+	pub, err := phe.GetPublicKey(kp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err = phe.NewClient(mustDecode(selfTestClientKey), pub)
+	return kp, client, err
+}
+
+func verifyLocally(kp []byte, client *phe.Client, password, record []byte) ([]byte, error) {
+	req, err := client.CreateVerifyPasswordRequest(password, record)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := phe.VerifyPassword(kp, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.CheckResponseAndDecrypt(password, record, resp)
+}
+
+func mustDecode(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/phe-go"
+	"github.com/stretchr/testify/require"
+)
+
+// testService emulates passw0rd service on top of phe server functions
+type testService struct {
+	sync.Mutex
+	keypairs     map[uint32][]byte
+	current      uint32
+	clientSecret string
+	publicKey    string
+	tokens       []string
+}
+
+func newTestService(t testing.TB) *testService {
+	kp, err := phe.GenerateServerKeypair()
+	require.NoError(t, err)
+
+	pub, err := phe.GetPublicKey(kp)
+	require.NoError(t, err)
+
+	return &testService{
+		keypairs:     map[uint32][]byte{1: kp},
+		current:      1,
+		clientSecret: "SK.1." + base64.StdEncoding.EncodeToString(phe.GenerateClientKey()),
+		publicKey:    "PK.1." + base64.StdEncoding.EncodeToString(pub),
+	}
+}
+
+// rotate generates next server keypair and returns corresponding update token
+func (s *testService) rotate(t testing.TB) string {
+	s.Lock()
+	defer s.Unlock()
+
+	token, kp, err := phe.Rotate(s.keypairs[s.current])
+	require.NoError(t, err)
+
+	s.current++
+	s.keypairs[s.current] = kp
+
+	ut := fmt.Sprintf("UT.%d.%s", s.current, base64.StdEncoding.EncodeToString(token))
+	s.tokens = append(s.tokens, ut)
+	return ut
+}
+
+func (s *testService) protocol(t testing.TB, updateToken string) *Protocol {
+	ctx, err := CreateContext("PT.test", s.publicKey, s.clientSecret, updateToken)
+	require.NoError(t, err)
+
+	p, err := NewProtocol(ctx)
+	require.NoError(t, err)
+
+	p.APIClient = &APIClient{
+		AppToken:   p.AppToken,
+		HTTPClient: &VirgilHTTPClient{Client: s, Address: "http://passw0rd.test"},
+	}
+	return p
+}
+
+func (s *testService) keypair(version uint32) []byte {
+	s.Lock()
+	defer s.Unlock()
+	return s.keypairs[version]
+}
+
+func (s *testService) Do(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp proto.Message
+	switch path.Base(req.URL.Path) {
+	case "enroll":
+		enrollReq := &EnrollmentRequest{}
+		if err = proto.Unmarshal(body, enrollReq); err != nil {
+			return s.reply(http.StatusBadRequest, &HttpError{Code: 400, Message: err.Error()})
+		}
+		enrollment, err := phe.GetEnrollment(s.keypair(enrollReq.Version))
+		if err != nil {
+			return s.reply(http.StatusBadRequest, &HttpError{Code: 400, Message: err.Error()})
+		}
+		resp = &EnrollmentResponse{Version: enrollReq.Version, Response: enrollment}
+	case "verify-password":
+		verifyReq := &VerifyPasswordRequest{}
+		if err = proto.Unmarshal(body, verifyReq); err != nil {
+			return s.reply(http.StatusBadRequest, &HttpError{Code: 400, Message: err.Error()})
+		}
+		verifyResp, err := phe.VerifyPassword(s.keypair(verifyReq.Version), verifyReq.Request)
+		if err != nil {
+			return s.reply(http.StatusBadRequest, &HttpError{Code: 400, Message: err.Error()})
+		}
+		resp = &VerifyPasswordResponse{Response: verifyResp}
+	default:
+		return s.reply(http.StatusNotFound, nil)
+	}
+
+	return s.reply(http.StatusOK, resp)
+}
+
+func (s *testService) reply(status int, msg proto.Message) (*http.Response, error) {
+	var body []byte
+	if msg != nil {
+		var err error
+		if body, err = proto.Marshal(msg); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// KnownServiceKey is a trusted service public key fingerprint, see ServiceKeyFingerprint
+type KnownServiceKey struct {
+	Environment string
+	Fingerprint string
+}
+
+// ServiceKeyFingerprint returns hex encoded SHA-256 of a service public key PK.<version>.<key>
+func ServiceKeyFingerprint(servicePublicKey string) (string, error) {
+	_, content, err := ParseVersionAndContent("PK", servicePublicKey)
+	if err != nil {
+		return "", withCode(CodeInvalidCredential, errors.Wrap(err, "invalid public key"))
+	}
+
+	return fingerprint(content), nil
+}
+
+func fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkServiceKey returns ErrUnknownServiceKey if c has known keys and the service public key
+// it was created with is not one of them
+func (c *Context) checkServiceKey() error {
+	if c.KnownServiceKeys == nil || c.servicePublicKey == nil {
+		return nil
+	}
+	if len(c.KnownServiceKeys) == 0 {
+		return withCode(CodeInvalidConfiguration, errors.New("known service keys are set but empty"))
+	}
+
+	fp := fingerprint(c.servicePublicKey)
+	for _, known := range c.KnownServiceKeys {
+		if known.Fingerprint == fp {
+			return nil
+		}
+	}
+	return ErrUnknownServiceKey
+}
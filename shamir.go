@@ -0,0 +1,224 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Shamir's secret sharing over GF(2^8) with the AES polynomial. Every byte of the secret
+// is shared independently, a share of form SH.<threshold>.<base64(x || y...)> holds
+// the x coordinate and one y coordinate per secret byte
+
+const sharePrefix = "SH"
+
+var gfExp, gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		// multiply by generator 3
+		x ^= x<<1 ^ byte(int8(x)>>7)&0x1b
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])-int(gfLog[b])+255)%255]
+}
+
+// SplitSecret splits secret (usually a client secret key SK.<version>.<key>) into n shares,
+// any threshold of which reconstruct it with CombineShares
+func SplitSecret(secret string, n, threshold int) ([]string, error) {
+	if secret == "" {
+		return nil, withCode(CodeInvalidConfiguration, errors.New("empty secret"))
+	}
+	if threshold < 2 || n < threshold || n > 255 {
+		return nil, withCode(CodeInvalidConfiguration, errors.New("shares must satisfy 2 <= threshold <= n <= 255"))
+	}
+
+	coefficients := make([]byte, len(secret)*(threshold-1))
+	if _, err := rand.Read(coefficients); err != nil {
+		return nil, errors.Wrap(err, "could not generate coefficients")
+	}
+
+	shares := make([]string, n)
+	for i := range shares {
+		x := byte(i + 1)
+		share := make([]byte, 1+len(secret))
+		share[0] = x
+
+		for j := 0; j < len(secret); j++ {
+			poly := coefficients[j*(threshold-1) : (j+1)*(threshold-1)]
+			// Horner's method, secret byte is the free term
+			var y byte
+			for k := len(poly) - 1; k >= 0; k-- {
+				y = gfMul(y, x) ^ poly[k]
+			}
+			share[1+j] = gfMul(y, x) ^ secret[j]
+		}
+
+		shares[i] = fmt.Sprintf("%s.%d.%s", sharePrefix, threshold, base64.StdEncoding.EncodeToString(share))
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from at least threshold shares produced by SplitSecret
+func CombineShares(shares []string) (string, error) {
+	if len(shares) == 0 {
+		return "", withCode(CodeInvalidCredential, errors.New("no shares"))
+	}
+
+	xs := make([]byte, 0, len(shares))
+	ys := make([][]byte, 0, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	var threshold uint32
+
+	for _, s := range shares {
+		t, share, err := ParseVersionAndContent(sharePrefix, strings.TrimSpace(s))
+		if err != nil {
+			return "", withCode(CodeInvalidCredential, errors.Wrap(err, "invalid share"))
+		}
+		if len(share) < 2 || share[0] == 0 {
+			return "", withCode(CodeInvalidCredential, errors.New("invalid share"))
+		}
+		if threshold != 0 && (t != threshold || len(share)-1 != len(ys[0])) {
+			return "", withCode(CodeInvalidCredential, errors.New("shares belong to different secrets"))
+		}
+		if seen[share[0]] {
+			continue
+		}
+		seen[share[0]] = true
+		threshold = t
+		xs = append(xs, share[0])
+		ys = append(ys, share[1:])
+	}
+
+	if uint32(len(xs)) < threshold {
+		return "", withCode(CodeInvalidCredential, fmt.Errorf("%d shares are required, got %d", threshold, len(xs)))
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, len(ys[0]))
+	for i, xi := range xs {
+		basis := byte(1)
+		for j, xj := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(xj, xj^xi))
+			}
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(ys[i][k], basis)
+		}
+	}
+
+	return string(secret), nil
+}
+
+// ShareSource supplies one share of a split secret
+type ShareSource func() (string, error)
+
+// EnvShare reads a share from environment variable name
+func EnvShare(name string) ShareSource {
+	return func() (string, error) {
+		share, ok := os.LookupEnv(name)
+		if !ok {
+			return "", withCode(CodeInvalidConfiguration, fmt.Errorf("environment variable %s is not set", name))
+		}
+		return share, nil
+	}
+}
+
+// FileShare reads a share from a file
+func FileShare(path string) ShareSource {
+	return func() (string, error) {
+		share, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrap(err, "could not read share")
+		}
+		return string(share), nil
+	}
+}
+
+// KMSShare decrypts a share stored as a KMS envelope
+func KMSShare(d Decrypter, envelope string) ShareSource {
+	return func() (string, error) {
+		return DecryptCredential(d, envelope)
+	}
+}
+
+// CombineSecretKey reconstructs a client secret key from shares supplied by different sources
+// so that no single operator or secret store holds the full key
+func CombineSecretKey(sources ...ShareSource) (string, error) {
+	shares := make([]string, 0, len(sources))
+	for _, source := range sources {
+		share, err := source()
+		if err != nil {
+			return "", err
+		}
+		shares = append(shares, share)
+	}
+
+	sk, err := CombineShares(shares)
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, err = ParseVersionAndContent("SK", sk); err != nil {
+		return "", withCode(CodeInvalidCredential, errors.Wrap(err, "shares do not reconstruct a secret key"))
+	}
+	return sk, nil
+}
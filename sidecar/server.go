@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package sidecar serves the passw0rd protocol over gRPC and REST, so that services written in other
+// languages can verify passwords through a local process running the SDK, see cmd/passw0rd-sidecar
+package sidecar
+
+//go:generate protoc --go_out=plugins=grpc:. sidecar.proto
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/sdk-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBody limits REST request bodies, records are well below 1 KiB
+const maxBody = 64 << 10
+
+// Server implements Passw0rdServer and the REST API with Protocol
+type Server struct {
+	Protocol *passw0rd.Protocol
+}
+
+// Enroll enrolls a new password
+func (s *Server) Enroll(ctx context.Context, req *EnrollRequest) (*EnrollResponse, error) {
+	if req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	record, key, err := s.Protocol.EnrollAccountContext(ctx, req.Password)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &EnrollResponse{Record: record, Key: key}, nil
+}
+
+// Verify verifies a password against its record. Wrong passwords fail with codes.Unauthenticated
+func (s *Server) Verify(ctx context.Context, req *VerifyRequest) (*VerifyResponse, error) {
+	if req.Password == "" || len(req.Record) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "password and record are required")
+	}
+	if req.UserId != "" {
+		ctx = passw0rd.WithUserID(ctx, req.UserId)
+	}
+
+	key, err := s.Protocol.VerifyPasswordContext(ctx, req.Password, req.Record)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &VerifyResponse{Key: key}, nil
+}
+
+// Update updates a record with the update token of Protocol
+func (s *Server) Update(ctx context.Context, req *UpdateRequest) (*UpdateResponse, error) {
+	if len(req.Record) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "record is required")
+	}
+
+	record, err := s.Protocol.UpdateEnrollmentRecordContext(ctx, req.Record)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &UpdateResponse{Record: record}, nil
+}
+
+// statusCodes maps SDK error codes to gRPC codes, others are codes.Unavailable
+var statusCodes = map[passw0rd.Code]codes.Code{
+	passw0rd.CodeInvalidPassword:   codes.Unauthenticated,
+	passw0rd.CodeRateLimited:       codes.ResourceExhausted,
+	passw0rd.CodeAccountLocked:     codes.ResourceExhausted,
+	passw0rd.CodeInvalidRecord:     codes.InvalidArgument,
+	passw0rd.CodeVersionMismatch:   codes.FailedPrecondition,
+	passw0rd.CodeUnknownKeyVersion: codes.FailedPrecondition,
+	passw0rd.CodeNoUpdateToken:     codes.FailedPrecondition,
+	passw0rd.CodePHEPanic:          codes.Internal,
+	passw0rd.CodeCryptoFailure:     codes.Internal,
+	passw0rd.CodeUnknown:           codes.Internal,
+}
+
+// httpStatuses maps gRPC codes to REST responses
+var httpStatuses = map[codes.Code]int{
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusBadGateway,
+	codes.Unimplemented:      http.StatusMethodNotAllowed,
+}
+
+// statusError converts an SDK error into a gRPC status whose message starts with the SDK error code name,
+// e.g. "invalid_password: ..."
+func statusError(err error) error {
+	code := passw0rd.ErrorCode(err)
+	grpcCode, ok := statusCodes[code]
+	if !ok {
+		grpcCode = codes.Unavailable
+	}
+	return status.Error(grpcCode, code.String()+": "+err.Error())
+}
+
+// Handler returns the REST API: POST /v1/enroll, /v1/verify and /v1/update accept and return the messages
+// of the gRPC API as JSON, bytes fields are base64 encoded. Errors are {"error": "...", "code": "..."}
+// with the gRPC code name
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/enroll", rest(func(ctx context.Context) (proto.Message, func() (proto.Message, error)) {
+		req := &EnrollRequest{}
+		return req, func() (proto.Message, error) { return s.Enroll(ctx, req) }
+	}))
+	mux.Handle("/v1/verify", rest(func(ctx context.Context) (proto.Message, func() (proto.Message, error)) {
+		req := &VerifyRequest{}
+		return req, func() (proto.Message, error) { return s.Verify(ctx, req) }
+	}))
+	mux.Handle("/v1/update", rest(func(ctx context.Context) (proto.Message, func() (proto.Message, error)) {
+		req := &UpdateRequest{}
+		return req, func() (proto.Message, error) { return s.Update(ctx, req) }
+	}))
+	return mux
+}
+
+// rest adapts a gRPC method to REST. method returns the request to decode the body into and the call
+func rest(method func(ctx context.Context) (proto.Message, func() (proto.Message, error))) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, status.Error(codes.Unimplemented, "use POST"))
+			return
+		}
+
+		req, call := method(r.Context())
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(req); err != nil {
+			writeError(w, status.Error(codes.InvalidArgument, "invalid request body"))
+			return
+		}
+
+		resp, err := call()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code, ok := httpStatuses[st.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	writeJSON(w, code, map[string]string{"error": st.Message(), "code": st.Code().String()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
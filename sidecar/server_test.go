@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func newServer(t *testing.T) (*Server, *fake.Service) {
+	svc, err := fake.New()
+	require.NoError(t, err)
+	_, err = svc.Rotate()
+	require.NoError(t, err)
+
+	p, err := svc.Protocol()
+	require.NoError(t, err)
+	return &Server{Protocol: p}, svc
+}
+
+func TestServer_GRPC(t *testing.T) {
+	srv, _ := newServer(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	gs := grpc.NewServer()
+	RegisterPassw0rdServer(gs, srv)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := NewPassw0rdClient(conn)
+	ctx := context.Background()
+
+	enrolled, err := client.Enroll(ctx, &EnrollRequest{Password: "passw0rd"})
+	require.NoError(t, err)
+
+	verified, err := client.Verify(ctx, &VerifyRequest{Password: "passw0rd", Record: enrolled.Record, UserId: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, enrolled.Key, verified.Key)
+
+	_, err = client.Verify(ctx, &VerifyRequest{Password: "wrong", Record: enrolled.Record})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "invalid_password")
+
+	updated, err := client.Update(ctx, &UpdateRequest{Record: enrolled.Record})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Record, "records of the current version are up to date")
+
+	_, err = client.Update(ctx, &UpdateRequest{Record: []byte("garbage")})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Enroll(ctx, &EnrollRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_REST(t *testing.T) {
+	srv, _ := newServer(t)
+	hs := httptest.NewServer(srv.Handler())
+	defer hs.Close()
+
+	post := func(path string, req, resp interface{}) int {
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+		r, err := http.Post(hs.URL+path, "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer r.Body.Close()
+		require.NoError(t, json.NewDecoder(r.Body).Decode(resp))
+		return r.StatusCode
+	}
+
+	enrolled := &EnrollResponse{}
+	require.Equal(t, http.StatusOK, post("/v1/enroll", &EnrollRequest{Password: "passw0rd"}, enrolled))
+
+	verified := &VerifyResponse{}
+	require.Equal(t, http.StatusOK, post("/v1/verify", &VerifyRequest{Password: "passw0rd", Record: enrolled.Record}, verified))
+	assert.Equal(t, enrolled.Key, verified.Key)
+
+	var failure map[string]string
+	assert.Equal(t, http.StatusUnauthorized, post("/v1/verify", &VerifyRequest{Password: "wrong", Record: enrolled.Record}, &failure))
+	assert.Equal(t, "Unauthenticated", failure["code"])
+
+	r, err := http.Get(hs.URL + "/v1/enroll")
+	require.NoError(t, err)
+	r.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, r.StatusCode)
+}
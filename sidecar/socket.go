@@ -0,0 +1,311 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package sidecar
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxFrame limits frames of the socket protocol
+const MaxFrame = 1 << 20
+
+// SocketRequest is a request frame of the socket protocol. Method is "enroll", "verify" or "update",
+// the other fields are those of the corresponding gRPC request
+type SocketRequest struct {
+	Method   string `json:"method"`
+	Password string `json:"password,omitempty"`
+	Record   []byte `json:"record,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+}
+
+// SocketResponse is a response frame of the socket protocol. Failed requests have Code set to
+// the name of their gRPC code, e.g. "Unauthenticated", and Error to the status message
+type SocketResponse struct {
+	Record []byte `json:"record,omitempty"`
+	Key    []byte `json:"key,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ServeSocket serves the socket protocol on lis, usually a unix socket, until lis is closed, which also
+// closes open connections and cancels their calls. Every frame is a JSON document preceded by its length
+// as a 4 byte big endian integer, requests of a connection are answered in order. The socket protocol lets
+// short-lived processes such as PHP-FPM workers or serverless functions reuse the parsed keys and service
+// connections of a long-lived daemon
+func (s *Server) ServeSocket(lis net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		conns = map[net.Conn]bool{}
+		wg    sync.WaitGroup
+	)
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			cancel()
+			mu.Lock()
+			for conn := range conns {
+				conn.Close()
+			}
+			mu.Unlock()
+			wg.Wait()
+			return err
+		}
+
+		mu.Lock()
+		conns[conn] = true
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		req := &SocketRequest{}
+		if err := readFrame(r, req); err != nil {
+			if err != io.EOF {
+				_ = writeFrame(conn, socketError(status.Error(codes.InvalidArgument, err.Error())))
+			}
+			return
+		}
+		if err := writeFrame(conn, s.handle(ctx, req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, req *SocketRequest) *SocketResponse {
+	switch req.Method {
+	case "enroll":
+		resp, err := s.Enroll(ctx, &EnrollRequest{Password: req.Password})
+		if err != nil {
+			return socketError(err)
+		}
+		return &SocketResponse{Record: resp.Record, Key: resp.Key}
+	case "verify":
+		resp, err := s.Verify(ctx, &VerifyRequest{Password: req.Password, Record: req.Record, UserId: req.UserID})
+		if err != nil {
+			return socketError(err)
+		}
+		return &SocketResponse{Key: resp.Key}
+	case "update":
+		resp, err := s.Update(ctx, &UpdateRequest{Record: req.Record})
+		if err != nil {
+			return socketError(err)
+		}
+		return &SocketResponse{Record: resp.Record}
+	}
+	return socketError(status.Errorf(codes.Unimplemented, "unknown method %q", req.Method))
+}
+
+func socketError(err error) *SocketResponse {
+	st := status.Convert(err)
+	return &SocketResponse{Code: st.Code().String(), Error: st.Message()}
+}
+
+func readFrame(r io.Reader, v interface{}) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MaxFrame {
+		return errors.Errorf("frame of %d bytes exceeds %d", n, MaxFrame)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return errors.Wrap(err, "truncated frame")
+	}
+	return errors.Wrap(json.Unmarshal(data, v), "invalid frame")
+}
+
+func writeFrame(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	_, err = w.Write(append(frame, data...))
+	return err
+}
+
+// SocketClient talks to ServeSocket. Calls are serialized, processes which need parallel calls
+// open one client per worker. Errors are gRPC status errors like those of Passw0rdClient
+type SocketClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	// broken is returned by all calls after a call failed
+	broken error
+}
+
+// DialSocket connects to a socket served by ServeSocket, e.g. DialSocket("unix", "/run/passw0rd.sock")
+func DialSocket(network, address string) (*SocketClient, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &SocketClient{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// Enroll enrolls a new password
+func (c *SocketClient) Enroll(ctx context.Context, req *EnrollRequest) (*EnrollResponse, error) {
+	resp, err := c.call(ctx, &SocketRequest{Method: "enroll", Password: req.Password})
+	if err != nil {
+		return nil, err
+	}
+	return &EnrollResponse{Record: resp.Record, Key: resp.Key}, nil
+}
+
+// Verify verifies a password against its record
+func (c *SocketClient) Verify(ctx context.Context, req *VerifyRequest) (*VerifyResponse, error) {
+	resp, err := c.call(ctx, &SocketRequest{Method: "verify", Password: req.Password, Record: req.Record, UserID: req.UserId})
+	if err != nil {
+		return nil, err
+	}
+	return &VerifyResponse{Key: resp.Key}, nil
+}
+
+// Update updates a record with the update token of the daemon
+func (c *SocketClient) Update(ctx context.Context, req *UpdateRequest) (*UpdateResponse, error) {
+	resp, err := c.call(ctx, &SocketRequest{Method: "update", Record: req.Record})
+	if err != nil {
+		return nil, err
+	}
+	return &UpdateResponse{Record: resp.Record}, nil
+}
+
+// Close closes the connection
+func (c *SocketClient) Close() error {
+	return c.conn.Close()
+}
+
+// call sends req and reads its response before ctx is done. A connection which failed a call, e.g.
+// because it missed a deadline, is out of sync: it is closed and fails all further calls
+func (c *SocketClient) call(ctx context.Context, req *SocketRequest) (*SocketResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.broken != nil {
+		return nil, c.broken
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	resp := &SocketResponse{}
+	if err := c.roundTrip(ctx, req, resp); err != nil {
+		c.conn.Close()
+		c.broken = status.Error(codes.Unavailable, "connection is out of sync after a failed call: "+err.Error())
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, status.FromContextError(ctxErr).Err()
+		}
+		// the connection's deadline may pass slightly before ctx is done
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if resp.Code != "" {
+		return nil, status.Error(parseCode(resp.Code), resp.Error)
+	}
+	return resp, nil
+}
+
+// roundTrip writes req and reads resp, interrupting both once ctx is done
+func (c *SocketClient) roundTrip(ctx context.Context, req *SocketRequest, resp *SocketResponse) error {
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if done := ctx.Done(); done != nil {
+		finished, stopped := make(chan struct{}), make(chan struct{})
+		defer func() {
+			close(finished)
+			<-stopped
+		}()
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				c.conn.SetDeadline(time.Now())
+			case <-finished:
+			}
+		}()
+	}
+
+	if err := writeFrame(c.conn, req); err != nil {
+		return err
+	}
+	return readFrame(c.r, resp)
+}
+
+// parseCode returns the gRPC code named name, codes.Unknown for unknown names
+func parseCode(name string) codes.Code {
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if code.String() == name {
+			return code
+		}
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package sidecar
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServeSocket(t *testing.T) {
+	srv, _ := newServer(t)
+
+	path := filepath.Join(t.TempDir(), "passw0rd.sock")
+	lis, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- srv.ServeSocket(lis) }()
+
+	c, err := DialSocket("unix", path)
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	enrolled, err := c.Enroll(ctx, &EnrollRequest{Password: "passw0rd"})
+	require.NoError(t, err)
+
+	verified, err := c.Verify(ctx, &VerifyRequest{Password: "passw0rd", Record: enrolled.Record, UserId: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, enrolled.Key, verified.Key)
+
+	_, err = c.Verify(ctx, &VerifyRequest{Password: "wrong", Record: enrolled.Record})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	updated, err := c.Update(ctx, &UpdateRequest{Record: enrolled.Record})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Record)
+
+	resp, err := c.call(ctx, &SocketRequest{Method: "delete"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	// oversized frames are rejected and end the connection
+	raw, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer raw.Close()
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], MaxFrame+1)
+	_, err = raw.Write(size[:])
+	require.NoError(t, err)
+	failure := &SocketResponse{}
+	require.NoError(t, readFrame(raw, failure))
+	assert.Equal(t, "InvalidArgument", failure.Code)
+
+	require.NoError(t, lis.Close())
+	assert.Error(t, <-served)
+	_, err = c.Verify(ctx, &VerifyRequest{Password: "passw0rd", Record: enrolled.Record})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// slowSocket answers every request with its password as the key once release is closed
+func slowSocket(t *testing.T, release chan struct{}) *SocketClient {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		r := bufio.NewReader(server)
+		for {
+			req := &SocketRequest{}
+			if err := readFrame(r, req); err != nil {
+				return
+			}
+			<-release
+			if err := writeFrame(server, &SocketResponse{Key: []byte(req.Password)}); err != nil {
+				return
+			}
+		}
+	}()
+	return &SocketClient{conn: client, r: bufio.NewReader(client)}
+}
+
+func TestSocketClient_Broken(t *testing.T) {
+	release := make(chan struct{})
+	c := slowSocket(t, release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Verify(ctx, &VerifyRequest{Password: "alice"})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	close(release)
+	resp, err := c.Verify(context.Background(), &VerifyRequest{Password: "bob"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "out of sync")
+}
+
+func TestSocketClient_Cancel(t *testing.T) {
+	c := slowSocket(t, make(chan struct{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := c.Verify(ctx, &VerifyRequest{Password: "alice"})
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	_, err = c.Verify(context.Background(), &VerifyRequest{Password: "alice"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
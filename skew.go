@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VersionSkewObserver may be implemented by Metrics to count verifications of records
+// older than the current key version, a live view of migration debt
+type VersionSkewObserver interface {
+	ObserveVersionSkew(recordVersion, currentVersion uint32)
+}
+
+// VersionSkew is published when a verification encounters a record older than the current key version
+type VersionSkew struct {
+	RecordVersion  uint32
+	CurrentVersion uint32
+	// Lag is the number of versions the record is behind
+	Lag           uint32
+	CorrelationID string
+	Time          time.Time
+}
+
+// EventName implements Event
+func (*VersionSkew) EventName() string { return "version_skew" }
+
+// VersionsReleased is published when keys of old versions are released, see Protocol.ReleaseVersions
+type VersionsReleased struct {
+	Versions       []uint32
+	CurrentVersion uint32
+	Time           time.Time
+}
+
+// EventName implements Event
+func (*VersionsReleased) EventName() string { return "versions_released" }
+
+func (p *Protocol) versionSkew(ctx context.Context, recordVersion, currentVersion uint32) {
+	if recordVersion == 0 || recordVersion >= currentVersion {
+		return
+	}
+
+	if observer, ok := p.Metrics.(VersionSkewObserver); ok {
+		observer.ObserveVersionSkew(recordVersion, currentVersion)
+	}
+
+	p.Events.Publish(&VersionSkew{
+		RecordVersion:  recordVersion,
+		CurrentVersion: currentVersion,
+		Lag:            currentVersion - recordVersion,
+		CorrelationID:  CorrelationIDFromContext(ctx),
+		Time:           p.now(),
+	})
+}
+
+// ReleaseVersions releases the keys of old versions, so that deployments with many historical versions
+// only keep the ones in use. Records of released versions fail with CodeUnknownKeyVersion, so versions
+// must only be released once no records of them remain, see ReleaseMigrated. Keys are never released
+// on their own, a user who did not log in for a long time still has a record of an old version
+func (p *Protocol) ReleaseVersions(versions ...uint32) error {
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+
+	return p.release(p.snapshot(), versions)
+}
+
+// ReleaseMigrated releases the keys of the versions before progress.Version, given the result of a Migrator
+// run over all stored records. It fails with CodeInvalidConfiguration unless the migration is Complete, as
+// records of earlier versions may remain otherwise. Records enrolled by instances which did not have the
+// update token yet are not covered, so migrate once every instance has it:
+//
+//	progress, err := m.Migrate(ctx, source, sink)
+//	if err == nil && progress.Complete() {
+//		err = protocol.ReleaseMigrated(progress)
+//	}
+func (p *Protocol) ReleaseMigrated(progress MigrationProgress) error {
+	switch {
+	case !progress.Done:
+		return withCode(CodeInvalidConfiguration, errors.Errorf("migration to key version %d did not process every record", progress.Version))
+	case !progress.Complete():
+		return withCode(CodeInvalidConfiguration, errors.Errorf("migration to key version %d left %d failed and %d changed records",
+			progress.Version, progress.Failed, progress.Changed))
+	}
+
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+
+	state := p.snapshot()
+	if state.client(progress.Version) == nil {
+		return withCode(CodeUnknownKeyVersion, errors.Errorf("key version %d of the migration is not configured", progress.Version))
+	}
+	var versions []uint32
+	for _, version := range state.versions() {
+		if version < progress.Version {
+			versions = append(versions, version)
+		}
+	}
+	return p.release(state, versions)
+}
+
+// release publishes state without versions. p.rotateMu must be held
+func (p *Protocol) release(state *keyState, versions []uint32) error {
+	for _, version := range versions {
+		if version == state.version {
+			return withCode(CodeInvalidConfiguration, errors.Errorf("current key version %d can not be released", version))
+		}
+		if state.client(version) == nil {
+			return withCode(CodeUnknownKeyVersion, errors.Errorf("key version %d is not configured", version))
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	p.publish(state.without(versions))
+	p.logger().Info("key versions released", F("versions", versions), F("current_version", state.version))
+	p.Events.Publish(&VersionsReleased{Versions: versions, CurrentVersion: state.version, Time: p.now()})
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSkewMetrics struct {
+	testMetrics
+	skews [][2]uint32
+}
+
+func (m *testSkewMetrics) ObserveVersionSkew(recordVersion, currentVersion uint32) {
+	m.skews = append(m.skews, [2]uint32{recordVersion, currentVersion})
+}
+
+func TestProtocol_VersionSkew(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	metrics := &testSkewMetrics{}
+	p.Metrics = MultiMetrics(metrics)
+	p.Events = NewEventBus()
+	events, _ := p.Events.Channel(10)
+
+	rec, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+
+	_, err = p.VerifyPassword("passw0rd", rec)
+	require.NoError(t, err)
+	assert.Empty(t, metrics.skews)
+
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+
+	_, err = p.VerifyPassword("wrong", rec)
+	require.Equal(t, ErrInvalidPassword, err)
+	assert.Equal(t, [][2]uint32{{1, 3}}, metrics.skews)
+
+	var skew *VersionSkew
+	for len(events) > 0 {
+		if e, ok := (<-events).(*VersionSkew); ok {
+			skew = e
+		}
+	}
+	require.NotNil(t, skew)
+	assert.Equal(t, uint32(2), skew.Lag)
+	assert.NotEmpty(t, skew.CorrelationID)
+}
+
+func TestProtocol_ReleaseVersions(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	clock := newTestClock()
+	p.Clock = clock
+	p.Events = NewEventBus()
+	events, _ := p.Events.Channel(10)
+
+	old, _, err := p.EnrollAccount("passw0rd")
+	require.NoError(t, err)
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+	require.NoError(t, p.AddUpdateToken(s.rotate(t)))
+
+	// records of old versions stay verifiable however long their users are away
+	clock.Advance(365 * 24 * time.Hour)
+	_, err = p.VerifyPassword("passw0rd", old)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2, 3}, p.Versions())
+
+	assert.Equal(t, CodeInvalidConfiguration, ErrorCode(p.ReleaseVersions(3)))
+	assert.Equal(t, CodeUnknownKeyVersion, ErrorCode(p.ReleaseVersions(2, 4)))
+	assert.Equal(t, []uint32{1, 2, 3}, p.Versions())
+
+	require.NoError(t, p.ReleaseVersions(1, 2))
+	assert.Equal(t, []uint32{3}, p.Versions())
+	_, err = p.VerifyPassword("passw0rd", old)
+	assert.Equal(t, CodeUnknownKeyVersion, ErrorCode(err))
+
+	var released *VersionsReleased
+	for len(events) > 0 {
+		if e, ok := (<-events).(*VersionsReleased); ok {
+			released = e
+		}
+	}
+	require.NotNil(t, released)
+	assert.Equal(t, []uint32{1, 2}, released.Versions)
+	assert.Equal(t, uint32(3), released.CurrentVersion)
+}
+
+func TestProtocol_ReleaseMigrated(t *testing.T) {
+	s := newTestService(t)
+	p := s.protocol(t, "")
+
+	store := &memoryRecords{records: map[string][]byte{}}
+	for i := 0; i < 3; i++ {
+		rec, _, err := p.EnrollAccount(fmt.Sprintf("password-%d", i))
+		require.NoError(t, err)
+		id := fmt.Sprint(i)
+		store.ids, store.records[id] = append(store.ids, id), rec
+	}
+	first := s.rotate(t)
+	second := s.rotate(t)
+	require.NoError(t, p.AddUpdateToken(first))
+
+	// a migration which has not finished or left records behind releases nothing
+	assert.Equal(t, CodeInvalidConfiguration, ErrorCode(p.ReleaseMigrated(MigrationProgress{Version: 2})))
+	assert.Equal(t, CodeInvalidConfiguration, ErrorCode(p.ReleaseMigrated(MigrationProgress{Version: 2, Done: true, Failed: 1})))
+	assert.Equal(t, CodeUnknownKeyVersion, ErrorCode(p.ReleaseMigrated(MigrationProgress{Version: 3, Done: true})))
+
+	progress, err := (&Migrator{UpdateToken: first, Workers: 1}).Migrate(context.Background(), store, store)
+	require.NoError(t, err)
+	require.True(t, progress.Complete())
+	assert.Equal(t, uint32(2), progress.Version)
+
+	require.NoError(t, p.AddUpdateToken(second))
+	require.NoError(t, p.ReleaseMigrated(progress))
+	assert.Equal(t, []uint32{2, 3}, p.Versions())
+	for i := 0; i < 3; i++ {
+		_, err = p.VerifyPassword(fmt.Sprintf("password-%d", i), store.records[fmt.Sprint(i)])
+		require.NoError(t, err)
+	}
+}
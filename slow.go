@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"time"
+)
+
+// verifyTiming breaks down the duration of a verification
+type verifyTiming struct {
+	clock Clock
+	start time.Time
+	// queue is spent before the verification itself: rate limiting, lockout and key policy checks
+	queue   time.Duration
+	network time.Duration
+	compute time.Duration
+}
+
+// since adds the time passed since from to d and returns now, to be used as the next from
+func (t *verifyTiming) since(d *time.Duration, from time.Time) time.Time {
+	now := t.clock.Now()
+	*d += now.Sub(from)
+	return now
+}
+
+// warnSlow logs a warning with the timing breakdown if the verification took longer than SlowThreshold
+func (p *Protocol) warnSlow(ctx context.Context, version uint32, t *verifyTiming) {
+	if p.SlowThreshold <= 0 {
+		return
+	}
+
+	total := t.clock.Now().Sub(t.start)
+	if total < p.SlowThreshold {
+		return
+	}
+
+	withCorrelation(ctx, p.logger()).Warn("slow password verification",
+		F("version", version),
+		F("total", total),
+		F("queue", t.queue),
+		F("network", t.network),
+		F("compute", t.compute),
+		F("threshold", p.SlowThreshold))
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// wireModels are all models which are sent to the service, stored by applications or consumed by
+// other systems. Their JSON encoding is compared to testdata/golden/<name>.json, so that renamed
+// fields and changed tags fail the build. Run "go test -run TestWireModels -update" after
+// intended changes and review the diff
+var wireModels = map[string]interface{}{
+	"database_record":          &DatabaseRecord{},
+	"enrollment_request":       &EnrollmentRequest{},
+	"enrollment_response":      &EnrollmentResponse{},
+	"verify_password_request":  &VerifyPasswordRequest{},
+	"verify_password_response": &VerifyPasswordResponse{},
+	"versioned_update_token":   &VersionedUpdateToken{},
+	"http_error":               &HttpError{},
+	"audit_event":              &AuditEvent{},
+	"security_event":           &SecurityEvent{},
+	"health_status":            &Status{},
+	"json_log_record":          &JSONLogRecord{},
+}
+
+func TestWireModels(t *testing.T) {
+	for name, model := range wireModels {
+		t.Run(name, func(t *testing.T) {
+			populate(reflect.ValueOf(model).Elem(), 1)
+
+			actual, err := json.MarshalIndent(model, "", "  ")
+			require.NoError(t, err)
+			actual = append(actual, '\n')
+
+			file := filepath.Join("testdata", "golden", name+".json")
+			if *updateGolden {
+				require.NoError(t, ioutil.WriteFile(file, actual, 0644))
+				return
+			}
+
+			expected, err := ioutil.ReadFile(file)
+			require.NoError(t, err, "run go test -run TestWireModels -update to create it")
+			assert.Equal(t, string(expected), string(actual), "wire format of %T changed", model)
+
+			decoded := reflect.New(reflect.TypeOf(model).Elem()).Interface()
+			require.NoError(t, json.Unmarshal(expected, decoded))
+			roundTrip, err := json.MarshalIndent(decoded, "", "  ")
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSuffix(string(expected), "\n"), string(roundTrip), "%T does not decode its golden file", model)
+		})
+	}
+}
+
+// populate sets every exported field of v to a deterministic non-zero value derived from its name,
+// so that new fields show up in snapshots too
+func populate(v reflect.Value, n int) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2018, 11, 1, 12, 0, 0, 0, time.UTC).Add(time.Duration(n) * time.Second)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" || strings.HasPrefix(field.Name, "XXX_") {
+				continue
+			}
+			populateNamed(v.Field(i), field.Name, n+i)
+		}
+	default:
+		populateNamed(v, v.Type().Name(), n)
+	}
+}
+
+func populateNamed(v reflect.Value, name string, n int) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(strings.ToLower(name))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(n))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(strings.ToLower(name)))
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		populateNamed(s.Index(0), name, n)
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key := reflect.New(v.Type().Key()).Elem()
+		populateNamed(key, "key", n)
+		m.SetMapIndex(key, reflect.ValueOf(strings.ToLower(name)).Convert(v.Type().Elem()))
+		v.Set(m)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		populate(v.Elem(), n)
+	case reflect.Struct:
+		populate(v, n)
+	}
+}
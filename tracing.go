@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+)
+
+// Span attributes set on protocol operation spans
+const (
+	AttributeVersion       = "passw0rd.version"
+	AttributeRecordVersion = "passw0rd.record_version"
+	AttributeOutcome       = "passw0rd.outcome"
+	AttributeRetries       = "passw0rd.retries"
+)
+
+// Tracer starts spans around protocol operations. Spans are named "passw0rd.<operation>" and are
+// distinct from HTTP-level spans of the transport. The passw0rdotel package provides an OpenTelemetry tracer.
+// Implementations must be safe for concurrent use
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single protocol operation in a trace
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End finishes the span, err is the operation result
+	End(err error)
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, interface{}) {}
+func (nopSpan) End(error)                        {}
+
+func (p *Protocol) startSpan(ctx context.Context, operation string) (context.Context, Span) {
+	if p.Tracer == nil {
+		return ctx, nopSpan{}
+	}
+	return p.Tracer.Start(withRetryCounter(ctx), "passw0rd."+operation)
+}
+
+func endSpan(ctx context.Context, span Span, err error) {
+	if _, ok := span.(nopSpan); ok {
+		return
+	}
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = auditReason(err)
+	}
+	span.SetAttribute(AttributeOutcome, outcome)
+	span.SetAttribute(AttributeRetries, retriesFromContext(ctx))
+	span.End(err)
+}
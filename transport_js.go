@@ -0,0 +1,63 @@
+//go:build js && wasm
+// +build js,wasm
+
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// newTransport returns the transport of the default HTTP client. On js/wasm an http.Transport without
+// dialers sends requests with the fetch API of the browser or worker runtime, which also owns TLS.
+// Outside of them, e.g. in Node.js, it falls back to the runtime's network
+func (vc *VirgilHTTPClient) newTransport() http.RoundTripper {
+	if vc.Pins != nil {
+		return pinsUnsupported{}
+	}
+	return &http.Transport{MaxIdleConnsPerHost: vc.maxIdleConns()}
+}
+
+// pinsUnsupported fails requests rather than sending them without the configured certificate pins
+type pinsUnsupported struct{}
+
+func (pinsUnsupported) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, withCode(CodeInvalidConfiguration, errors.New("certificate pinning is not available on js/wasm"))
+}
@@ -39,40 +39,69 @@ package passw0rd
 import (
 	"fmt"
 
-	"github.com/passw0rd/phe-go"
-
-	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 )
 
 //MarshalRecord serializes enrolment record to protobuf
 func MarshalRecord(version uint32, rec []byte) ([]byte, error) {
+	return marshalRecord(version, 0, rec)
+}
+
+func marshalRecord(version, pepperVersion uint32, rec []byte) ([]byte, error) {
+	return appendRecord(nil, version, pepperVersion, rec)
+}
+
+// appendRecord appends the serialized record to dst, growing it at most once
+func appendRecord(dst []byte, version, pepperVersion uint32, rec []byte) ([]byte, error) {
 	if version < 1 {
-		return nil, errors.New("invalid version")
+		return nil, withCode(CodeInvalidRecord, errors.New("invalid version"))
 	}
 	dbRec := &DatabaseRecord{
-		Version: version,
-		Record:  rec,
+		Version:       version,
+		Record:        rec,
+		PepperVersion: pepperVersion,
 	}
 
-	return proto.Marshal(dbRec)
+	if size := len(dst) + dbRec.wireSize(); cap(dst) < size {
+		dst = append(make([]byte, 0, size), dst...)
+	}
+	return dbRec.appendWire(dst), nil
 }
 
 //UnmarshalRecord deserializes record from protobuf
 func UnmarshalRecord(record []byte) (version uint32, rec []byte, err error) {
 
+	dbRecord, err := unmarshalRecord(record)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return dbRecord.Version, dbRecord.Record, nil
+}
+
+func unmarshalRecord(record []byte) (*DatabaseRecord, error) {
+
 	dbRecord := &DatabaseRecord{}
-	err = proto.Unmarshal(record, dbRecord)
+	if err := decodeRecord(record, dbRecord); err != nil {
+		return nil, err
+	}
+
+	return dbRecord, nil
+}
+
+func decodeRecord(record []byte, dbRecord *DatabaseRecord) error {
+
+	err := unmarshalMessage(record, dbRecord)
 
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "invalid db record")
+		return withCode(CodeInvalidRecord, errors.Wrap(err, "invalid db record"))
 	}
 
 	if int(dbRecord.Version) < 1 {
-		return 0, nil, errors.New("invalid record version")
+		return withCode(CodeInvalidRecord, errors.New("invalid record version"))
 	}
 
-	return dbRecord.Version, dbRecord.Record, nil
+	return nil
 }
 
 func (m *HttpError) Error() string {
@@ -81,25 +110,31 @@ func (m *HttpError) Error() string {
 
 //UpdateEnrollmentRecord increments record version and updates it using provided update token
 func UpdateEnrollmentRecord(oldRecord []byte, updateToken string) (newRecord []byte, err error) {
-	recordVersion, record, err := UnmarshalRecord(oldRecord)
+	dbRecord, err := unmarshalRecord(oldRecord)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid recotd")
+		return nil, withCode(CodeInvalidRecord, errors.Wrap(err, "invalid recotd"))
 	}
 	tokenVersion, token, err := ParseVersionAndContent("UT", updateToken)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid update token")
+		return nil, withCode(CodeInvalidCredential, errors.Wrap(err, "invalid update token"))
 	}
+	return updateRecord(nil, dbRecord, &VersionedUpdateToken{Version: tokenVersion, UpdateToken: token})
+}
+
+// updateRecord is UpdateEnrollmentRecord for a decoded record and a parsed token. The updated record is appended to dst
+func updateRecord(dst []byte, dbRecord *DatabaseRecord, token *VersionedUpdateToken) (newRecord []byte, err error) {
+	recordVersion, tokenVersion := dbRecord.Version, token.Version
 	if (recordVersion + 1) == tokenVersion {
-		newRec, err := phe.UpdateRecord(record, token)
+		newRec, err := updatePHERecord(dbRecord.Record, token.UpdateToken)
 		if err != nil {
 			return nil, err
 		}
-		return MarshalRecord(tokenVersion, newRec)
+		return appendRecord(dst, tokenVersion, dbRecord.PepperVersion, newRec)
 	}
 
 	if recordVersion == tokenVersion {
 		return nil, nil
 	}
 
-	return nil, errors.Errorf("Record and update token versions mismatch: %d and %d", recordVersion, tokenVersion)
+	return nil, withCode(CodeVersionMismatch, errors.Errorf("Record and update token versions mismatch: %d and %d", recordVersion, tokenVersion))
 }
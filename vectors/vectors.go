@@ -0,0 +1,307 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+// Package vectors generates and verifies cross-SDK test vectors, see testdata/vectors/README.md.
+// Vectors generated by one SDK must verify in every other SDK, which makes them the first tool
+// for interoperability issues:
+//
+//	v, err := vectors.Generate(vectors.Options{Password: "passw0rd", Rotate: true})
+//	...
+//	err = vectors.Verify(v)
+package vectors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/passw0rd/phe-go"
+	"github.com/passw0rd/sdk-go"
+	"github.com/passw0rd/sdk-go/fake"
+	"github.com/pkg/errors"
+)
+
+// Vector is a test vector. Binary values are standard base64, keys and tokens use the SDK string formats
+type Vector struct {
+	Description      string   `json:"description"`
+	ServerKeypair    string   `json:"server_keypair"`
+	ServicePublicKey string   `json:"service_public_key"`
+	ClientSecretKey  string   `json:"client_secret_key"`
+	Password         string   `json:"password"`
+	WrongPasswords   []string `json:"wrong_passwords,omitempty"`
+	Record           string   `json:"record"`
+	RecordVersion    uint32   `json:"record_version"`
+	DerivedKey       string   `json:"derived_key"`
+	// VerifyRequest is the VerifyPasswordRequest sent to the service to verify Password, optional
+	VerifyRequest string `json:"verify_request,omitempty"`
+	UpdateToken   string `json:"update_token,omitempty"`
+	UpdatedRecord string `json:"updated_record,omitempty"`
+}
+
+// Options configures Generate
+type Options struct {
+	Description string
+	// Version is the key version of the vector, 1 if not set
+	Version uint32
+	// ServerKeypair and ClientSecretKey are the keys of Version. Missing keys are generated
+	ServerKeypair   []byte
+	ClientSecretKey []byte
+	Password        string
+	WrongPasswords  []string
+	// UpdateToken, if set, is used to produce the updated record. Otherwise Rotate makes Generate
+	// rotate the service keys to get one
+	UpdateToken string
+	Rotate      bool
+}
+
+// Generate creates a vector by running the protocol against a service emulated with the given keys
+func Generate(opts Options) (*Vector, error) {
+	version := opts.Version
+	if version == 0 {
+		version = 1
+	}
+
+	kp := opts.ServerKeypair
+	if kp == nil {
+		var err error
+		if kp, err = phe.GenerateServerKeypair(); err != nil {
+			return nil, errors.Wrap(err, "could not generate server keypair")
+		}
+	}
+
+	sk := opts.ClientSecretKey
+	if sk == nil {
+		sk = phe.GenerateClientKey()
+	}
+
+	svc, err := fake.NewWithKeys(version, kp, sk)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := svc.Protocol()
+	if err != nil {
+		return nil, err
+	}
+
+	record, key, err := p.EnrollAccount(opts.Password)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not enroll password")
+	}
+
+	verifyRequest, err := createVerifyRequest(svc, opts.Password, record)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vector{
+		Description:      opts.Description,
+		ServerKeypair:    encode(kp),
+		ServicePublicKey: svc.ServicePublicKey,
+		ClientSecretKey:  svc.ClientSecretKey,
+		Password:         opts.Password,
+		WrongPasswords:   opts.WrongPasswords,
+		Record:           encode(record),
+		RecordVersion:    version,
+		DerivedKey:       encode(key),
+		VerifyRequest:    encode(verifyRequest),
+		UpdateToken:      opts.UpdateToken,
+	}
+
+	if v.UpdateToken == "" && opts.Rotate {
+		if v.UpdateToken, err = svc.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.UpdateToken != "" {
+		updated, err := passw0rd.UpdateEnrollmentRecord(record, v.UpdateToken)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not update record")
+		}
+		v.UpdatedRecord = encode(updated)
+	}
+
+	// a vector which does not verify here is useless for others
+	if err = Verify(v); err != nil {
+		return nil, errors.Wrap(err, "generated vector does not verify")
+	}
+	return v, nil
+}
+
+// Verify checks that the vector agrees with this SDK. All mismatches are reported in the returned error
+func Verify(v *Vector) error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	kp, err := decode("server_keypair", v.ServerKeypair)
+	if err != nil {
+		return err
+	}
+	record, err := decode("record", v.Record)
+	if err != nil {
+		return err
+	}
+	derivedKey, err := decode("derived_key", v.DerivedKey)
+	if err != nil {
+		return err
+	}
+
+	skVersion, sk, err := passw0rd.ParseVersionAndContent("SK", v.ClientSecretKey)
+	if err != nil {
+		return errors.Wrap(err, "invalid client_secret_key")
+	}
+	if skVersion != v.RecordVersion {
+		fail("client_secret_key version %d differs from record_version %d", skVersion, v.RecordVersion)
+	}
+
+	svc, err := fake.NewWithKeys(v.RecordVersion, kp, sk)
+	if err != nil {
+		return err
+	}
+	if svc.ServicePublicKey != v.ServicePublicKey {
+		fail("service_public_key does not match server_keypair: expected %s", svc.ServicePublicKey)
+	}
+
+	p, err := svc.Protocol()
+	if err != nil {
+		return err
+	}
+
+	if version, _, err := passw0rd.UnmarshalRecord(record); err != nil {
+		fail("record can not be parsed: %v", err)
+	} else if version != v.RecordVersion {
+		fail("record has version %d, expected %d", version, v.RecordVersion)
+	}
+
+	if key, err := p.VerifyPassword(v.Password, record); err != nil {
+		fail("password is rejected: %v", err)
+	} else if !bytes.Equal(key, derivedKey) {
+		fail("derived_key mismatch: got %s", encode(key))
+	}
+
+	for _, wrong := range v.WrongPasswords {
+		if _, err := p.VerifyPassword(wrong, record); err != passw0rd.ErrInvalidPassword {
+			fail("wrong password %q is not rejected: %v", wrong, err)
+		}
+	}
+
+	if v.VerifyRequest != "" {
+		if req, err := createVerifyRequest(svc, v.Password, record); err != nil {
+			fail("verify request can not be created: %v", err)
+		} else if encode(req) != v.VerifyRequest {
+			fail("verify_request mismatch: got %s", encode(req))
+		}
+	}
+
+	if v.UpdateToken != "" {
+		if updated, err := passw0rd.UpdateEnrollmentRecord(record, v.UpdateToken); err != nil {
+			fail("record can not be updated: %v", err)
+		} else if encode(updated) != v.UpdatedRecord {
+			fail("updated_record mismatch: got %s", encode(updated))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Load reads a vector from a JSON file
+func Load(file string) (*Vector, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vector{}
+	if err = json.Unmarshal(data, v); err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", file)
+	}
+	return v, nil
+}
+
+// Marshal encodes a vector as indented JSON
+func (v *Vector) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// createVerifyRequest returns the VerifyPasswordRequest a protocol sends to verify password
+func createVerifyRequest(svc *fake.Service, password string, record []byte) ([]byte, error) {
+	ctx, err := svc.Context()
+	if err != nil {
+		return nil, err
+	}
+
+	version, rec, err := passw0rd.UnmarshalRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	client := ctx.PHEClients[version]
+	if client == nil {
+		return nil, fmt.Errorf("no keys for version %d", version)
+	}
+
+	req, err := client.CreateVerifyPasswordRequest([]byte(password), rec)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create verify password request")
+	}
+	return proto.Marshal(&passw0rd.VerifyPasswordRequest{Version: version, Request: req})
+}
+
+func encode(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decode(field, s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", field)
+	}
+	return b, nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package vectors
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	v, err := Generate(Options{Description: "test", Version: 3, Password: "passw0rd", WrongPasswords: []string{"wrong"}, Rotate: true})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), v.RecordVersion)
+	assert.Contains(t, v.UpdateToken, "UT.4.")
+	assert.NotEmpty(t, v.VerifyRequest)
+	assert.NotEmpty(t, v.UpdatedRecord)
+
+	again, err := Generate(Options{
+		Version:         3,
+		ServerKeypair:   mustDecode(t, v.ServerKeypair),
+		ClientSecretKey: mustDecode(t, v.ClientSecretKey[len("SK.3."):]),
+		Password:        "passw0rd",
+		UpdateToken:     v.UpdateToken,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, v.ServicePublicKey, again.ServicePublicKey)
+	assert.Equal(t, v.UpdateToken, again.UpdateToken)
+
+	tampered := *v
+	tampered.DerivedKey = again.DerivedKey
+	tampered.WrongPasswords = []string{"passw0rd"}
+	err = Verify(&tampered)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "derived_key mismatch")
+	assert.Contains(t, err.Error(), `wrong password "passw0rd" is not rejected`)
+}
+
+func TestVerify_Testdata(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "vectors", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		v, err := Load(file)
+		require.NoError(t, err)
+		assert.NoError(t, Verify(v), file)
+	}
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	b, err := decode("test", s)
+	require.NoError(t, err)
+	return b
+}
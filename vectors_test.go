@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testVector is a cross-SDK test vector, see testdata/vectors/README.md
+type testVector struct {
+	Description      string   `json:"description"`
+	ServerKeypair    string   `json:"server_keypair"`
+	ServicePublicKey string   `json:"service_public_key"`
+	ClientSecretKey  string   `json:"client_secret_key"`
+	Password         string   `json:"password"`
+	WrongPasswords   []string `json:"wrong_passwords"`
+	Record           string   `json:"record"`
+	RecordVersion    uint32   `json:"record_version"`
+	DerivedKey       string   `json:"derived_key"`
+	VerifyRequest    string   `json:"verify_request"`
+	UpdateToken      string   `json:"update_token"`
+	UpdatedRecord    string   `json:"updated_record"`
+}
+
+func loadTestVectors(t *testing.T) map[string]*testVector {
+	files, err := filepath.Glob(filepath.Join("testdata", "vectors", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	vectors := make(map[string]*testVector, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+
+		v := &testVector{}
+		require.NoError(t, json.Unmarshal(data, v), file)
+		vectors[filepath.Base(file)] = v
+	}
+	return vectors
+}
+
+func TestVectors(t *testing.T) {
+	for name, v := range loadTestVectors(t) {
+		v := v
+		t.Run(name, func(t *testing.T) {
+			decode := func(s string) []byte {
+				b, err := base64.StdEncoding.DecodeString(s)
+				require.NoError(t, err)
+				return b
+			}
+
+			s := &testService{
+				keypairs:     map[uint32][]byte{v.RecordVersion: decode(v.ServerKeypair)},
+				current:      v.RecordVersion,
+				clientSecret: v.ClientSecretKey,
+				publicKey:    v.ServicePublicKey,
+			}
+			p := s.protocol(t, "")
+			record := decode(v.Record)
+
+			version, _, err := UnmarshalRecord(record)
+			require.NoError(t, err)
+			assert.Equal(t, v.RecordVersion, version)
+
+			key, err := p.VerifyPassword(v.Password, record)
+			require.NoError(t, err)
+			assert.Equal(t, decode(v.DerivedKey), key)
+
+			if v.VerifyRequest != "" {
+				dbRecord, err := unmarshalRecord(record)
+				require.NoError(t, err)
+				req, err := p.snapshot().client(version).CreateVerifyPasswordRequest([]byte(v.Password), dbRecord.Record)
+				require.NoError(t, err)
+				wire, err := proto.Marshal(&VerifyPasswordRequest{Version: version, Request: req})
+				require.NoError(t, err)
+				assert.Equal(t, decode(v.VerifyRequest), wire)
+			}
+
+			for _, wrong := range v.WrongPasswords {
+				_, err = p.VerifyPassword(wrong, record)
+				assert.Equal(t, ErrInvalidPassword, err, "%q", wrong)
+			}
+
+			enrolled, key, err := p.EnrollAccount(v.Password)
+			require.NoError(t, err)
+			verified, err := p.VerifyPassword(v.Password, enrolled)
+			require.NoError(t, err)
+			assert.Equal(t, key, verified)
+
+			if v.UpdateToken == "" {
+				return
+			}
+
+			updated, err := UpdateEnrollmentRecord(record, v.UpdateToken)
+			require.NoError(t, err)
+			assert.Equal(t, decode(v.UpdatedRecord), updated)
+
+			p = s.protocol(t, v.UpdateToken)
+			updated, err = p.UpdateEnrollmentRecord(record)
+			require.NoError(t, err)
+			assert.Equal(t, decode(v.UpdatedRecord), updated)
+		})
+	}
+}
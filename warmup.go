@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultWarmupConns is the number of connections opened by Warmup when Protocol.WarmupConns is not set
+const DefaultWarmupConns = 4
+
+// maxWarmupBody bounds how much of an unexpected response body is drained to reuse the connection
+const maxWarmupBody = 4 << 10
+
+// Warmup opens WarmupConns connections to the service before the first logins arrive, so that they
+// do not pay for TCP and TLS handshakes. The default HTTP client keeps them idle for reuse, a custom
+// one must allow as many idle connections per host. Warmup returns the first connection failure.
+//
+// If WarmupInterval is set, connections are reopened at that interval in the background until ctx
+// is done, so that they are not dropped by idle timeouts of proxies and load balancers
+func (p *Protocol) Warmup(ctx context.Context) error {
+	conns := p.WarmupConns
+	if conns <= 0 {
+		conns = DefaultWarmupConns
+	}
+
+	vc := p.getClient().getClient()
+	err := vc.warmup(ctx, conns)
+
+	if p.WarmupInterval > 0 {
+		goLabeled(ctx, "warmup", p.CurrentVersion(), func(ctx context.Context) {
+			p.keepWarm(ctx, vc, conns)
+		})
+	}
+	return err
+}
+
+// keepWarm reopens conns connections every WarmupInterval until ctx is done
+func (p *Protocol) keepWarm(ctx context.Context, vc *VirgilHTTPClient, conns int) {
+	for {
+		timer := p.clock().NewTimer(p.WarmupInterval)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		if err := vc.warmup(ctx, conns); err != nil && ctx.Err() == nil {
+			p.logger().Warn("connection warmup failed", F("error", err.Error()))
+		}
+	}
+}
+
+// warmup sends conns concurrent HEAD requests to Address, so that the transport dials as many
+// connections and keeps them idle. Any response counts as success, the requests bypass retries
+// and the circuit breaker
+func (vc *VirgilHTTPClient) warmup(ctx context.Context, conns int) error {
+	address, err := vc.endpoint("")
+	if err != nil {
+		return withCode(CodeInvalidConfiguration, errors.Wrap(err, "VirgilHTTPClient.warmup: URL parse"))
+	}
+
+	client := vc.getHTTPClient()
+	errs := make(chan error, conns)
+	for i := 0; i < conns; i++ {
+		go func() {
+			errs <- warmupRequest(ctx, client, address)
+		}()
+	}
+
+	var first error
+	for i := 0; i < conns; i++ {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func warmupRequest(ctx context.Context, client HTTPClient, address string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, address, nil)
+	if err != nil {
+		return withCode(CodeInvalidConfiguration, errors.Wrap(err, "VirgilHTTPClient.warmup: new request"))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return withCode(CodeTransport, errors.Wrap(err, "VirgilHTTPClient.warmup: send request"))
+	}
+
+	// the connection is only returned to the pool once the body is drained
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxWarmupBody))
+	return resp.Body.Close()
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// warmupServer holds HEAD requests until conns of them arrive, so that every request of a round
+// needs its own connection
+type warmupServer struct {
+	*httptest.Server
+	conns    int
+	dials    int32
+	requests int32
+
+	mu      sync.Mutex
+	waiting int
+	release chan struct{}
+}
+
+func newWarmupServer(conns int) *warmupServer {
+	s := &warmupServer{conns: conns, release: make(chan struct{})}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+
+		s.mu.Lock()
+		release := s.release
+		if s.waiting++; s.waiting == s.conns {
+			close(s.release)
+			s.release, s.waiting = make(chan struct{}), 0
+		}
+		s.mu.Unlock()
+
+		<-release
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&s.dials, 1)
+		}
+	}
+	s.Start()
+	return s
+}
+
+func TestProtocol_Warmup(t *testing.T) {
+	const conns = DefaultMaxIdleConns + 4
+	server := newWarmupServer(conns)
+	defer server.Close()
+
+	p := newTestService(t).protocol(t, "")
+	p.WarmupConns = conns
+	p.APIClient.HTTPClient = &VirgilHTTPClient{Address: server.URL, MaxIdleConns: conns}
+
+	require.NoError(t, p.Warmup(context.Background()))
+	assert.Equal(t, int32(conns), atomic.LoadInt32(&server.dials))
+
+	// warmed connections stay idle and are reused
+	require.NoError(t, p.Warmup(context.Background()))
+	assert.Equal(t, int32(conns), atomic.LoadInt32(&server.dials))
+	assert.Equal(t, int32(2*conns), atomic.LoadInt32(&server.requests))
+}
+
+func TestProtocol_WarmupInterval(t *testing.T) {
+	server := newWarmupServer(DefaultWarmupConns)
+	defer server.Close()
+
+	clock := heldClock{fire: make(chan time.Time)}
+	p := newTestService(t).protocol(t, "")
+	p.Clock = clock
+	p.WarmupInterval = time.Minute
+	p.APIClient.HTTPClient = &VirgilHTTPClient{Address: server.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, p.Warmup(ctx))
+
+	clock.fire <- time.Now()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&server.requests) == 2*DefaultWarmupConns
+	}, time.Second, time.Millisecond)
+}
+
+func TestProtocol_WarmupUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	p := newTestService(t).protocol(t, "")
+	p.APIClient.HTTPClient = &VirgilHTTPClient{Address: server.URL}
+
+	assert.Equal(t, CodeTransport, ErrorCode(p.Warmup(context.Background())))
+}
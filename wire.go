@@ -0,0 +1,318 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Hand-written protobuf encoding of the models on the enroll and verify paths. It writes the same
+// bytes as the proto package, keeps unknown fields in XXX_unrecognized and avoids the reflection of
+// the table-driven codec. Models implementing wireMessage are encoded with it automatically, others
+// fall back to the proto package
+
+// wireMessage is implemented by models with hand-written encoding
+type wireMessage interface {
+	proto.Message
+	wireSize() int
+	appendWire(b []byte) []byte
+	unmarshalWire(b []byte) error
+}
+
+// Wire types of the protobuf encoding
+const (
+	wireVarint     = 0
+	wireFixed64    = 1
+	wireBytes      = 2
+	wireStartGroup = 3
+	wireEndGroup   = 4
+	wireFixed32    = 5
+)
+
+const maxFieldNumber = 1<<29 - 1
+
+var (
+	errIllegalTag   = errors.New("proto: illegal tag")
+	errBadWireType  = errors.New("proto: illegal wire type")
+	errVarintLength = errors.New("proto: integer overflow")
+)
+
+// unmarshalMessage decodes b into m with its hand-written encoding if it has one.
+// Like proto.Unmarshal, it resets m first and copies bytes fields out of b
+func unmarshalMessage(b []byte, m proto.Message) error {
+	if w, ok := m.(wireMessage); ok {
+		return w.unmarshalWire(b)
+	}
+	return proto.Unmarshal(b, m)
+}
+
+// wireField is a single field of an encoded message
+type wireField struct {
+	num, typ int
+	varint   uint64
+	bytes    []byte
+	// value is the encoded field without its tag
+	value []byte
+}
+
+// nextField decodes the field at the start of b and returns the rest of b
+func nextField(b []byte) (wireField, []byte, error) {
+	f, rest, err := readField(b)
+	if err == nil && f.typ == wireEndGroup {
+		err = errBadWireType
+	}
+	return f, rest, err
+}
+
+func readField(b []byte) (f wireField, rest []byte, err error) {
+	tag, n := binary.Uvarint(b)
+	if n <= 0 {
+		return f, nil, varintError(n)
+	}
+	f.num, f.typ = int(tag>>3), int(tag&7)
+	if tag>>3 == 0 || tag>>3 > maxFieldNumber {
+		return f, nil, errIllegalTag
+	}
+
+	rest = b[n:]
+	switch f.typ {
+	case wireVarint:
+		f.varint, n = binary.Uvarint(rest)
+		if n <= 0 {
+			return f, nil, varintError(n)
+		}
+	case wireFixed64:
+		n = 8
+	case wireFixed32:
+		n = 4
+	case wireBytes:
+		var size uint64
+		size, n = binary.Uvarint(rest)
+		if n <= 0 {
+			return f, nil, varintError(n)
+		}
+		if size > uint64(len(rest)-n) {
+			return f, nil, io.ErrUnexpectedEOF
+		}
+		f.bytes = rest[n : n+int(size)]
+		n += int(size)
+	case wireStartGroup:
+		if n, err = groupSize(rest, f.num); err != nil {
+			return f, nil, err
+		}
+	case wireEndGroup:
+		n = 0
+	default:
+		return f, nil, errBadWireType
+	}
+
+	if n > len(rest) {
+		return f, nil, io.ErrUnexpectedEOF
+	}
+	f.value = rest[:n]
+	return f, rest[n:], nil
+}
+
+// groupSize returns the length of the group fields of b up to and including the end group tag of num
+func groupSize(b []byte, num int) (int, error) {
+	for rest := b; ; {
+		f, next, err := readField(rest)
+		if err != nil {
+			return 0, err
+		}
+		rest = next
+		if f.typ == wireEndGroup {
+			if f.num != num {
+				return 0, errBadWireType
+			}
+			return len(b) - len(rest), nil
+		}
+	}
+}
+
+// appendUnknown keeps an unknown field. Its tag is written in minimal form, as the proto package does
+func appendUnknown(b []byte, f wireField) []byte {
+	b = binary.AppendUvarint(b, uint64(f.num)<<3|uint64(f.typ))
+	return append(b, f.value...)
+}
+
+func varintError(n int) error {
+	if n == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return errVarintLength
+}
+
+func varintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// uint32FieldSize and bytesFieldSize return the encoded size of proto3 fields numbered below 16
+func uint32FieldSize(v uint32) int {
+	if v == 0 {
+		return 0
+	}
+	return 1 + varintSize(uint64(v))
+}
+
+func bytesFieldSize(v []byte) int {
+	if len(v) == 0 {
+		return 0
+	}
+	return 1 + varintSize(uint64(len(v))) + len(v)
+}
+
+func appendUint32Field(b []byte, num int, v uint32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+func appendBytesField(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// copyBytes copies a decoded bytes field. Present fields are never nil, as with the proto package
+func copyBytes(v []byte) []byte {
+	return append([]byte{}, v...)
+}
+
+func (m *DatabaseRecord) wireSize() int {
+	return uint32FieldSize(m.Version) + bytesFieldSize(m.Record) + uint32FieldSize(m.PepperVersion) + len(m.XXX_unrecognized)
+}
+
+func (m *DatabaseRecord) appendWire(b []byte) []byte {
+	b = appendUint32Field(b, 1, m.Version)
+	b = appendBytesField(b, 2, m.Record)
+	b = appendUint32Field(b, 3, m.PepperVersion)
+	return append(b, m.XXX_unrecognized...)
+}
+
+func (m *DatabaseRecord) unmarshalWire(b []byte) error {
+	m.Reset()
+	for len(b) > 0 {
+		f, rest, err := nextField(b)
+		if err != nil {
+			return err
+		}
+		switch {
+		case f.num == 1 && f.typ == wireVarint:
+			m.Version = uint32(f.varint)
+		case f.num == 2 && f.typ == wireBytes:
+			m.Record = copyBytes(f.bytes)
+		case f.num == 3 && f.typ == wireVarint:
+			m.PepperVersion = uint32(f.varint)
+		default:
+			m.XXX_unrecognized = appendUnknown(m.XXX_unrecognized, f)
+		}
+		b = rest
+	}
+	return nil
+}
+
+func (m *VerifyPasswordRequest) wireSize() int {
+	return uint32FieldSize(m.Version) + bytesFieldSize(m.Request) + len(m.XXX_unrecognized)
+}
+
+func (m *VerifyPasswordRequest) appendWire(b []byte) []byte {
+	b = appendUint32Field(b, 1, m.Version)
+	b = appendBytesField(b, 2, m.Request)
+	return append(b, m.XXX_unrecognized...)
+}
+
+func (m *VerifyPasswordRequest) unmarshalWire(b []byte) error {
+	m.Reset()
+	for len(b) > 0 {
+		f, rest, err := nextField(b)
+		if err != nil {
+			return err
+		}
+		switch {
+		case f.num == 1 && f.typ == wireVarint:
+			m.Version = uint32(f.varint)
+		case f.num == 2 && f.typ == wireBytes:
+			m.Request = copyBytes(f.bytes)
+		default:
+			m.XXX_unrecognized = appendUnknown(m.XXX_unrecognized, f)
+		}
+		b = rest
+	}
+	return nil
+}
+
+func (m *VerifyPasswordResponse) wireSize() int {
+	return bytesFieldSize(m.Response) + len(m.XXX_unrecognized)
+}
+
+func (m *VerifyPasswordResponse) appendWire(b []byte) []byte {
+	b = appendBytesField(b, 1, m.Response)
+	return append(b, m.XXX_unrecognized...)
+}
+
+func (m *VerifyPasswordResponse) unmarshalWire(b []byte) error {
+	m.Reset()
+	for len(b) > 0 {
+		f, rest, err := nextField(b)
+		if err != nil {
+			return err
+		}
+		switch {
+		case f.num == 1 && f.typ == wireBytes:
+			m.Response = copyBytes(f.bytes)
+		default:
+			m.XXX_unrecognized = appendUnknown(m.XXX_unrecognized, f)
+		}
+		b = rest
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"io"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireMessages(t *testing.T) {
+	long := make([]byte, 200)
+	for i := range long {
+		long[i] = byte(i)
+	}
+
+	tests := []struct {
+		name string
+		msg  wireMessage
+		want []byte
+	}{
+		{"empty record", &DatabaseRecord{}, nil},
+		{"record", &DatabaseRecord{Version: 1, Record: []byte("abc"), PepperVersion: 2}, []byte{0x08, 0x01, 0x12, 0x03, 'a', 'b', 'c', 0x18, 0x02}},
+		{"long record", &DatabaseRecord{Version: 300, Record: long}, append([]byte{0x08, 0xac, 0x02, 0x12, 0xc8, 0x01}, long...)},
+		{"unknown fields", &DatabaseRecord{Version: 1, XXX_unrecognized: []byte{0x20, 0x07}}, []byte{0x08, 0x01, 0x20, 0x07}},
+		{"request", &VerifyPasswordRequest{Version: 5, Request: []byte{0xff}}, []byte{0x08, 0x05, 0x12, 0x01, 0xff}},
+		{"response", &VerifyPasswordResponse{Response: []byte{0x01, 0x02}}, []byte{0x0a, 0x02, 0x01, 0x02}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			b := tt.msg.appendWire(make([]byte, 0, tt.msg.wireSize()))
+			req.Equal(len(tt.want), tt.msg.wireSize())
+			if len(tt.want) == 0 {
+				req.Empty(b)
+			} else {
+				req.Equal(tt.want, b)
+			}
+
+			viaProto, err := proto.Marshal(tt.msg)
+			req.NoError(err)
+			req.Equal(b, viaProto)
+
+			decoded := proto.Clone(tt.msg).(wireMessage)
+			decoded.Reset()
+			req.NoError(unmarshalMessage(b, decoded))
+			req.True(proto.Equal(tt.msg, decoded), "%v != %v", tt.msg, decoded)
+		})
+	}
+}
+
+func TestWireMessages_Decode(t *testing.T) {
+	req := require.New(t)
+
+	buf := []byte{0x12, 0x02, 'a', 'b', 0x08, 0x01, 0x08, 0x02, 0x1a, 0x00, 0x2b, 0x08, 0x01, 0x2c}
+	rec := &DatabaseRecord{PepperVersion: 9}
+	req.NoError(unmarshalMessage(buf, rec))
+	assert.Equal(t, uint32(2), rec.Version)
+	assert.Equal(t, []byte("ab"), rec.Record)
+	assert.Zero(t, rec.PepperVersion)
+	assert.Equal(t, []byte{0x1a, 0x00, 0x2b, 0x08, 0x01, 0x2c}, rec.XXX_unrecognized)
+
+	buf[2] = 'x'
+	assert.Equal(t, []byte("ab"), rec.Record, "bytes fields must not alias the input")
+
+	viaProto := &DatabaseRecord{}
+	req.NoError(proto.Unmarshal(buf, viaProto))
+	assert.Equal(t, rec.Version, viaProto.Version)
+
+	resp := &VerifyPasswordResponse{}
+	req.NoError(unmarshalMessage([]byte{0x0a, 0x00}, resp))
+	req.NotNil(resp.Response)
+	req.Empty(resp.Response)
+}
+
+func TestWireMessages_Invalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x08},
+		{0x12, 0x05, 'a'},
+		{0x00, 0x01},
+		{0x0f},
+		{0x0c},
+		{0x0b, 0x08, 0x01},
+		{0x0b, 0x14},
+		{0x09, 0x01, 0x02},
+		{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+	} {
+		err := unmarshalMessage(b, &DatabaseRecord{})
+		assert.Error(t, err, "%x", b)
+		assert.Error(t, proto.Unmarshal(b, &DatabaseRecord{}), "%x", b)
+	}
+
+	assert.Equal(t, io.ErrUnexpectedEOF, unmarshalMessage([]byte{0x0a, 0x05}, &VerifyPasswordResponse{}))
+}
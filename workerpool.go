@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// WorkerPool caps the number of concurrent PHE computations. They are CPU bound, so a burst of logins
+// or a migration could otherwise occupy every core and starve the host service. Share one pool between
+// Protocol, Migrator and VerifyPasswords to bound all of them together:
+//
+//	pool := passw0rd.NewWorkerPool(2)
+//	protocol.WorkerPool = pool
+//	migrator := &passw0rd.Migrator{UpdateToken: "UT.2....", Workers: 8, WorkerPool: pool}
+//
+// A nil pool does not limit anything. It is safe for concurrent use
+type WorkerPool struct {
+	slots chan struct{}
+}
+
+// NewWorkerPool returns a pool which runs up to cpus computations at once, runtime.NumCPU() if cpus is not positive
+func NewWorkerPool(cpus int) *WorkerPool {
+	if cpus < 1 {
+		cpus = runtime.NumCPU()
+	}
+	return &WorkerPool{slots: make(chan struct{}, cpus)}
+}
+
+// Size returns the number of computations the pool runs at once, runtime.NumCPU() for a nil pool
+func (wp *WorkerPool) Size() int {
+	if wp == nil {
+		return runtime.NumCPU()
+	}
+	return cap(wp.slots)
+}
+
+// Do runs fn once the pool has a free slot. If ctx is done first, fn is not run and ctx.Err() is returned
+func (wp *WorkerPool) Do(ctx context.Context, fn func() error) error {
+	if err := wp.acquire(ctx); err != nil {
+		return err
+	}
+	defer wp.release()
+	return fn()
+}
+
+func (wp *WorkerPool) acquire(ctx context.Context) error {
+	if wp == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case wp.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (wp *WorkerPool) release() {
+	if wp != nil {
+		<-wp.slots
+	}
+}
+
+// forEach calls fn for every index below n from up to workers goroutines and waits for them to finish.
+// Goroutines are labeled with operation and version, see goLabeled. Indexes not started when ctx is done
+// are passed to skip instead
+func forEach(ctx context.Context, operation string, version uint32, workers, n int, fn func(i int), skip func(i int, err error)) {
+	if workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		goLabeled(ctx, operation, version, func(context.Context) {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		})
+	}
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			skip(i, ctx.Err())
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			skip(i, ctx.Err())
+		}
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2015-2018 Virgil Security Inc.
+ *
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     (1) Redistributions of source code must retain the above copyright
+ *     notice, this list of conditions and the following disclaimer.
+ *
+ *     (2) Redistributions in binary form must reproduce the above copyright
+ *     notice, this list of conditions and the following disclaimer in
+ *     the documentation and/or other materials provided with the
+ *     distribution.
+ *
+ *     (3) Neither the name of the copyright holder nor the names of its
+ *     contributors may be used to endorse or promote products derived from
+ *     this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+ * IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+ * SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+ * HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+ * STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+ * IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ * POSSIBILITY OF SUCH DAMAGE.
+ *
+ * Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+ */
+
+package passw0rd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := NewWorkerPool(3)
+	assert.Equal(t, 3, pool.Size())
+
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pool.Do(context.Background(), func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			}))
+		}()
+	}
+	wg.Wait()
+	assert.True(t, max <= 3, "%d computations ran at once", max)
+}
+
+func TestWorkerPool_Canceled(t *testing.T) {
+	req := require.New(t)
+
+	pool := NewWorkerPool(1)
+	release := make(chan struct{})
+	go pool.Do(context.Background(), func() error {
+		<-release
+		return nil
+	})
+	defer close(release)
+	for len(pool.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	ran := false
+	err := pool.Do(ctx, func() error {
+		ran = true
+		return nil
+	})
+	req.Equal(context.DeadlineExceeded, err)
+	req.False(ran)
+
+	var nilPool *WorkerPool
+	req.NoError(nilPool.Do(ctx, func() error { return nil }))
+}
+
+func TestProtocol_VerifyPasswords(t *testing.T) {
+	req := require.New(t)
+
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	p.WorkerPool = NewWorkerPool(2)
+
+	var reqs []VerifyRequest
+	for _, pwd := range []string{"first", "second", "third"} {
+		rec, _, err := p.EnrollAccount(pwd)
+		req.NoError(err)
+		reqs = append(reqs, VerifyRequest{UserID: pwd, Password: pwd, Record: rec})
+	}
+	reqs[1].Password = "wrong"
+
+	results := p.VerifyPasswords(context.Background(), reqs)
+	req.Len(results, 3)
+	req.NoError(results[0].Err)
+	req.NotEmpty(results[0].Key)
+	req.Equal(ErrInvalidPassword, results[1].Err)
+	req.NoError(results[2].Err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, res := range p.VerifyPasswords(ctx, reqs) {
+		req.Equal(context.Canceled, res.Err)
+	}
+}
+
+func TestProtocol_EnrollAccounts(t *testing.T) {
+	req := require.New(t)
+
+	s := newTestService(t)
+	p := s.protocol(t, "")
+	p.WorkerPool = NewWorkerPool(1)
+
+	// the service is slow, so a pipelined batch has several enrollments in flight at once
+	var inFlight, maxInFlight int32
+	p.APIClient.HTTPClient.Client = httpClientFunc(func(r *http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for max := atomic.LoadInt32(&maxInFlight); n > max && !atomic.CompareAndSwapInt32(&maxInFlight, max, n); {
+			max = atomic.LoadInt32(&maxInFlight)
+		}
+		time.Sleep(5 * time.Millisecond)
+		return s.Do(r)
+	})
+
+	var reqs []EnrollRequest
+	for i := 0; i < 8; i++ {
+		reqs = append(reqs, EnrollRequest{UserID: fmt.Sprint("user-", i), Password: fmt.Sprint("password-", i)})
+	}
+
+	results := p.EnrollAccounts(context.Background(), reqs)
+	req.Len(results, len(reqs))
+	for i, res := range results {
+		req.NoError(res.Err)
+		key, err := p.VerifyPassword(reqs[i].Password, res.Record)
+		req.NoError(err)
+		req.Equal(res.Key, key)
+	}
+
+	max := atomic.LoadInt32(&maxInFlight)
+	req.True(max > 1, "enrollments were not fetched ahead")
+	req.True(max <= enrollAhead, "fetched %d enrollments ahead", max)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, res := range p.EnrollAccounts(ctx, reqs) {
+		req.Equal(context.Canceled, res.Err)
+	}
+}